@@ -0,0 +1,329 @@
+// Package calendar awards points for purchases made at particular times: in windows on
+// certain weekdays, within a date range or on a holiday.
+package calendar
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+)
+
+// RulePrefix starts the name of a calendar rule's line in a points breakdown
+const RulePrefix = "calendar:"
+
+// endOfDay may end a window so that it includes the last minute of the day
+const endOfDay = "24:00"
+
+var clockRegex = regexp.MustCompile(`^(2[0-3]|[01][0-9]):[0-5][0-9]$`)
+
+// dayGroups are the names accepted for a window's days besides the weekdays themselves
+var dayGroups = map[string][]time.Weekday{
+	"weekdays": {time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+	"weekends": {time.Saturday, time.Sunday},
+}
+
+// Window is a time of day on some days of the week. Start is included and End is not, so
+// 17:00 to 19:00 covers 17:00 up to 18:59. End may be 24:00. Days are weekday names, weekdays
+// or weekends, and every day when empty.
+type Window struct {
+	Days  []string `json:"days"`
+	Start string   `json:"start"`
+	End   string   `json:"end"`
+}
+
+// Rule awards points to purchases made in any of its windows, between its inclusive From and
+// To dates and, if it names holidays, on one of them. Leaving any of these out places no limit
+// on it. The points are BonusPoints plus the rule points multiplied by Multiplier.
+type Rule struct {
+	Name        string   `json:"name"`
+	Windows     []Window `json:"windows"`
+	From        string   `json:"from"`
+	To          string   `json:"to"`
+	Holidays    []string `json:"holidays"`
+	BonusPoints int      `json:"bonusPoints"`
+	Multiplier  float64  `json:"multiplier"`
+}
+
+// Holiday is a named date in the holiday calendar.
+type Holiday struct {
+	Date string `json:"date"`
+	Name string `json:"name"`
+}
+
+// Engine evaluates calendar rules against purchase dates and times.
+// A nil *Engine awards nothing, so calendar rules are optional.
+type Engine struct {
+	rules    []compiledRule
+	holidays map[string][]string
+	digest   string
+}
+
+type compiledRule struct {
+	Rule
+	windows []compiledWindow
+}
+
+type compiledWindow struct {
+	days  []time.Weekday
+	start string
+	end   string
+}
+
+// New checks the rules against the holiday calendar and returns an engine evaluating them.
+// Every problem found is reported, naming the rule it is in.
+func New(rules []Rule, holidays []Holiday) (*Engine, error) {
+	engine := &Engine{holidays: make(map[string][]string)}
+
+	var errs []error
+	for i, holiday := range holidays {
+		if _, err := time.Parse("2006-01-02", holiday.Date); err != nil {
+			errs = append(errs, fmt.Errorf("holiday %d: bad date %q, must be in YYYY-MM-DD format", i, holiday.Date))
+		}
+		if strings.TrimSpace(holiday.Name) == "" {
+			errs = append(errs, fmt.Errorf("holiday %d: name is required", i))
+		}
+		engine.holidays[holiday.Date] = append(engine.holidays[holiday.Date], holiday.Name)
+	}
+
+	names := make(map[string]bool, len(rules))
+	for i, rule := range rules {
+		compiled, err := compile(rule, holidays)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("calendar rule %d (%s): %w", i, rule.Name, err))
+			continue
+		}
+		if names[rule.Name] {
+			errs = append(errs, fmt.Errorf("calendar rule %d (%s): name is used by another rule", i, rule.Name))
+			continue
+		}
+		names[rule.Name] = true
+		engine.rules = append(engine.rules, compiled)
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	if len(rules) > 0 {
+		definitions, err := json.Marshal(struct {
+			Rules    []Rule
+			Holidays []Holiday
+		}{rules, holidays})
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(definitions)
+		engine.digest = hex.EncodeToString(sum[:])
+	}
+	return engine, nil
+}
+
+// LoadHolidays reads a holiday calendar, a JSON array of dates and names such as
+// [{"date": "2022-11-25", "name": "Black Friday"}].
+func LoadHolidays(path string) ([]Holiday, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var holidays []Holiday
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&holidays); err != nil {
+		return nil, fmt.Errorf("reading holidays from %s: %w", path, err)
+	}
+	return holidays, nil
+}
+
+// Evaluate returns a line for every rule matching a purchase made at the store's local date
+// and time. basePoints are the points from the standard rules, which multipliers apply to.
+func (e *Engine) Evaluate(purchaseDate string, purchaseTime string, basePoints int) []models.PointsLine {
+	if e == nil || len(e.rules) == 0 {
+		return nil
+	}
+
+	date, err := time.Parse("2006-01-02", purchaseDate)
+	if err != nil {
+		return nil
+	}
+
+	var lines []models.PointsLine
+	for _, rule := range e.rules {
+		holiday, ok := rule.matches(date, purchaseDate, purchaseTime, e.holidays)
+		if !ok {
+			continue
+		}
+
+		points, description := rule.award(basePoints)
+		if holiday != "" {
+			description += " on " + holiday
+		}
+		lines = append(lines, models.PointsLine{Rule: RulePrefix + rule.Name, Points: points, Description: description})
+	}
+	return lines
+}
+
+// Rules returns the number of rules the engine evaluates.
+func (e *Engine) Rules() int {
+	if e == nil {
+		return 0
+	}
+	return len(e.rules)
+}
+
+// Digest identifies the rules the engine evaluates and the holiday calendar they are evaluated
+// against, changing whenever either is edited. An engine without rules has an empty digest.
+func (e *Engine) Digest() string {
+	if e == nil {
+		return ""
+	}
+	return e.digest
+}
+
+func compile(rule Rule, holidays []Holiday) (compiledRule, error) {
+	compiled := compiledRule{Rule: rule}
+
+	var errs []error
+	if strings.TrimSpace(rule.Name) == "" {
+		errs = append(errs, errors.New("name is required"))
+	}
+	if rule.From != "" {
+		if _, err := time.Parse("2006-01-02", rule.From); err != nil {
+			errs = append(errs, fmt.Errorf("bad from date %q, must be in YYYY-MM-DD format", rule.From))
+		}
+	}
+	if rule.To != "" {
+		if _, err := time.Parse("2006-01-02", rule.To); err != nil {
+			errs = append(errs, fmt.Errorf("bad to date %q, must be in YYYY-MM-DD format", rule.To))
+		} else if rule.From != "" && rule.To < rule.From {
+			errs = append(errs, errors.New("to date is before from date"))
+		}
+	}
+	for _, name := range rule.Holidays {
+		if !slices.ContainsFunc(holidays, func(h Holiday) bool { return h.Name == name }) {
+			errs = append(errs, fmt.Errorf("holiday %q is not in the holiday calendar", name))
+		}
+	}
+	if rule.BonusPoints < 0 {
+		errs = append(errs, errors.New("bonus points cannot be negative"))
+	}
+	if rule.Multiplier != 0 && rule.Multiplier < 1 {
+		errs = append(errs, errors.New("multiplier must be at least 1"))
+	}
+	if rule.Multiplier <= 1 && rule.BonusPoints <= 0 {
+		errs = append(errs, errors.New("a multiplier above 1 or bonus points are required"))
+	}
+
+	for i, window := range rule.Windows {
+		compiledWindow, err := compileWindow(window)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("window %d: %w", i, err))
+			continue
+		}
+		compiled.windows = append(compiled.windows, compiledWindow)
+	}
+
+	return compiled, errors.Join(errs...)
+}
+
+func compileWindow(window Window) (compiledWindow, error) {
+	compiled := compiledWindow{start: window.Start, end: window.End}
+
+	var errs []error
+	for _, day := range window.Days {
+		name := strings.ToLower(strings.TrimSpace(day))
+		if group, ok := dayGroups[name]; ok {
+			compiled.days = append(compiled.days, group...)
+			continue
+		}
+		weekday, ok := parseWeekday(name)
+		if !ok {
+			errs = append(errs, fmt.Errorf("unknown day %q, must be a weekday name, weekdays or weekends", day))
+			continue
+		}
+		compiled.days = append(compiled.days, weekday)
+	}
+
+	if compiled.start == "" {
+		compiled.start = "00:00"
+	}
+	if compiled.end == "" {
+		compiled.end = endOfDay
+	}
+	if !clockRegex.MatchString(compiled.start) {
+		errs = append(errs, fmt.Errorf("bad start %q, must be in HH:MM format", window.Start))
+	}
+	if compiled.end != endOfDay && !clockRegex.MatchString(compiled.end) {
+		errs = append(errs, fmt.Errorf("bad end %q, must be in HH:MM format or 24:00", window.End))
+	} else if compiled.end <= compiled.start {
+		errs = append(errs, errors.New("end must be after start"))
+	}
+
+	return compiled, errors.Join(errs...)
+}
+
+func parseWeekday(name string) (time.Weekday, bool) {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.ToLower(day.String()) == name {
+			return day, true
+		}
+	}
+	return 0, false
+}
+
+// matches reports whether a purchase falls under the rule, and the holiday it is for if any.
+func (r compiledRule) matches(date time.Time, purchaseDate string, purchaseTime string, holidays map[string][]string) (string, bool) {
+	if (r.From != "" && purchaseDate < r.From) || (r.To != "" && purchaseDate > r.To) {
+		return "", false
+	}
+
+	holiday := ""
+	if len(r.Holidays) > 0 {
+		index := slices.IndexFunc(holidays[purchaseDate], func(name string) bool { return slices.Contains(r.Holidays, name) })
+		if index < 0 {
+			return "", false
+		}
+		holiday = holidays[purchaseDate][index]
+	}
+
+	if len(r.windows) == 0 {
+		return holiday, true
+	}
+	for _, window := range r.windows {
+		if window.matches(date.Weekday(), purchaseTime) {
+			return holiday, true
+		}
+	}
+	return "", false
+}
+
+func (w compiledWindow) matches(weekday time.Weekday, purchaseTime string) bool {
+	if len(w.days) > 0 && !slices.Contains(w.days, weekday) {
+		return false
+	}
+	return purchaseTime >= w.start && purchaseTime < w.end
+}
+
+func (r compiledRule) award(basePoints int) (int, string) {
+	var parts []string
+	points := 0
+	if r.Multiplier > 1 {
+		points += int(math.Round(float64(basePoints) * (r.Multiplier - 1)))
+		parts = append(parts, fmt.Sprintf("%gx %d rule points", r.Multiplier, basePoints))
+	}
+	if r.BonusPoints > 0 {
+		points += r.BonusPoints
+		parts = append(parts, fmt.Sprintf("%d bonus points", r.BonusPoints))
+	}
+	return points, strings.Join(parts, " + ")
+}
@@ -0,0 +1,150 @@
+package calendar
+
+import (
+	"strings"
+	"testing"
+)
+
+var holidays = []Holiday{{Date: "2022-11-25", Name: "Black Friday"}, {Date: "2022-12-25", Name: "Christmas Day"}}
+
+func TestEngine_Evaluate(t *testing.T) {
+	engine, err := New([]Rule{
+		{Name: "weekends", Windows: []Window{{Days: []string{"weekends"}}}, BonusPoints: 20},
+		{Name: "happy-hour", Windows: []Window{{Days: []string{"Monday", "friday"}, Start: "17:00", End: "19:00"}, {Days: []string{"sunday"}, Start: "22:00", End: "24:00"}}, Multiplier: 1.5},
+		{Name: "black-friday", Holidays: []string{"Black Friday"}, Multiplier: 2},
+		{Name: "march-promotion", From: "2022-03-01", To: "2022-03-31", BonusPoints: 5},
+	}, holidays)
+	if err != nil {
+		t.Fatalf("Expected the rules to compile, got %v", err)
+	}
+	if engine.Rules() != 4 {
+		t.Fatalf("Expected 4 rules, got %d", engine.Rules())
+	}
+
+	tests := []struct {
+		name          string
+		purchaseDate  string
+		purchaseTime  string
+		expectedRules []string
+		expectedTotal int
+	}{
+		{"Weekday Morning", "2022-01-04", "09:00", nil, 0},
+		{"Saturday", "2022-01-01", "09:00", []string{"calendar:weekends"}, 20},
+		{"Happy Hour Start", "2022-01-03", "17:00", []string{"calendar:happy-hour"}, 50},
+		{"Happy Hour End Excluded", "2022-01-03", "19:00", nil, 0},
+		{"Late Sunday", "2022-01-02", "23:59", []string{"calendar:weekends", "calendar:happy-hour"}, 70},
+		{"Black Friday Happy Hour", "2022-11-25", "18:30", []string{"calendar:happy-hour", "calendar:black-friday"}, 150},
+		{"Date Range First Day", "2022-03-01", "09:00", []string{"calendar:march-promotion"}, 5},
+		{"Date Range Last Day", "2022-03-31", "09:00", []string{"calendar:march-promotion"}, 5},
+		{"After Date Range", "2022-04-01", "09:00", nil, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lines := engine.Evaluate(test.purchaseDate, test.purchaseTime, 100)
+			var rules []string
+			total := 0
+			for _, line := range lines {
+				rules = append(rules, line.Rule)
+				total += line.Points
+				if line.Description == "" {
+					t.Errorf("Expected %s to be described", line.Rule)
+				}
+			}
+			if strings.Join(rules, ",") != strings.Join(test.expectedRules, ",") {
+				t.Errorf("Expected rules %v, got %v", test.expectedRules, rules)
+			}
+			if total != test.expectedTotal {
+				t.Errorf("Expected %d points, got %d", test.expectedTotal, total)
+			}
+		})
+	}
+}
+
+func TestEngine_EvaluateDescribesHoliday(t *testing.T) {
+	engine, err := New([]Rule{{Name: "black-friday", Holidays: []string{"Black Friday"}, Multiplier: 2, BonusPoints: 10}}, holidays)
+	if err != nil {
+		t.Fatalf("Expected the rule to compile, got %v", err)
+	}
+
+	lines := engine.Evaluate("2022-11-25", "12:00", 31)
+	if len(lines) != 1 {
+		t.Fatalf("Expected 1 line, got %d", len(lines))
+	}
+	if lines[0].Points != 41 {
+		t.Errorf("Expected 41 points, got %d", lines[0].Points)
+	}
+	expected := "2x 31 rule points + 10 bonus points on Black Friday"
+	if lines[0].Description != expected {
+		t.Errorf("Expected description %q, got %q", expected, lines[0].Description)
+	}
+}
+
+func TestEngine_NilAwardsNothing(t *testing.T) {
+	var engine *Engine
+	if lines := engine.Evaluate("2022-01-01", "12:00", 100); lines != nil {
+		t.Errorf("Expected no lines, got %v", lines)
+	}
+	if engine.Rules() != 0 {
+		t.Errorf("Expected no rules, got %d", engine.Rules())
+	}
+	if engine.Digest() != "" {
+		t.Errorf("Expected no digest, got %q", engine.Digest())
+	}
+}
+
+func TestEngine_Digest(t *testing.T) {
+	rules := []Rule{{Name: "black-friday", Holidays: []string{"Black Friday"}, BonusPoints: 50}}
+	holidays := []Holiday{{Date: "2022-11-25", Name: "Black Friday"}}
+	engine, err := New(rules, holidays)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if engine.Digest() == "" {
+		t.Fatalf("Expected a digest")
+	}
+
+	moved, _ := New(rules, []Holiday{{Date: "2023-11-24", Name: "Black Friday"}})
+	if moved.Digest() == engine.Digest() {
+		t.Errorf("Expected moving a holiday to change the digest")
+	}
+	rules[0].BonusPoints = 100
+	if edited, _ := New(rules, holidays); edited.Digest() == engine.Digest() {
+		t.Errorf("Expected an edited rule to change the digest")
+	}
+}
+
+func TestNew_RejectsInvalidRules(t *testing.T) {
+	tests := []struct {
+		name          string
+		rules         []Rule
+		holidays      []Holiday
+		expectedError string
+	}{
+		{"Missing Name", []Rule{{BonusPoints: 5}}, nil, "name is required"},
+		{"Duplicate Name", []Rule{{Name: "bonus", BonusPoints: 5}, {Name: "bonus", BonusPoints: 10}}, nil, "calendar rule 1 (bonus): name is used by another rule"},
+		{"No Award", []Rule{{Name: "nothing"}}, nil, "a multiplier above 1 or bonus points are required"},
+		{"Multiplier Below One", []Rule{{Name: "half", Multiplier: 0.5, BonusPoints: 5}}, nil, "multiplier must be at least 1"},
+		{"Negative Bonus", []Rule{{Name: "negative", BonusPoints: -5, Multiplier: 2}}, nil, "bonus points cannot be negative"},
+		{"Bad From Date", []Rule{{Name: "range", From: "03/01/2022", BonusPoints: 5}}, nil, `bad from date "03/01/2022"`},
+		{"Range Backwards", []Rule{{Name: "range", From: "2022-03-31", To: "2022-03-01", BonusPoints: 5}}, nil, "to date is before from date"},
+		{"Unknown Day", []Rule{{Name: "days", Windows: []Window{{Days: []string{"funday"}}}, BonusPoints: 5}}, nil, `window 0: unknown day "funday"`},
+		{"Bad Start", []Rule{{Name: "clock", Windows: []Window{{Start: "5pm"}}, BonusPoints: 5}}, nil, `bad start "5pm"`},
+		{"End Before Start", []Rule{{Name: "clock", Windows: []Window{{Start: "19:00", End: "17:00"}}, BonusPoints: 5}}, nil, "end must be after start"},
+		{"Unknown Holiday", []Rule{{Name: "holiday", Holidays: []string{"Boxing Day"}, BonusPoints: 5}}, holidays, `holiday "Boxing Day" is not in the holiday calendar`},
+		{"Bad Holiday Date", nil, []Holiday{{Date: "2022-13-01", Name: "Nowhere"}}, `holiday 0: bad date "2022-13-01"`},
+		{"Unnamed Holiday", nil, []Holiday{{Date: "2022-12-01"}}, "holiday 0: name is required"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := New(test.rules, test.holidays)
+			if err == nil {
+				t.Fatalf("Expected an error containing %q", test.expectedError)
+			}
+			if !strings.Contains(err.Error(), test.expectedError) {
+				t.Errorf("Expected an error containing %q, got %v", test.expectedError, err)
+			}
+		})
+	}
+}
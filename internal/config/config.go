@@ -0,0 +1,448 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+)
+
+// StorageMemory keeps receipts in process memory. It is the only backend available so far.
+const StorageMemory = "memory"
+
+// redacted replaces secret values in the effective configuration
+const redacted = "REDACTED"
+
+// Config holds every setting the server reads at startup.
+type Config struct {
+	ListenAddr                string
+	TLSCertFile               string
+	TLSKeyFile                string
+	StorageBackend            string
+	StorageDSN                string
+	LogLevel                  string
+	LogFormat                 string
+	TraceExporter             string
+	TraceFile                 string
+	RequestTimeout            time.Duration
+	ReadTimeout               time.Duration
+	WriteTimeout              time.Duration
+	IdleTimeout               time.Duration
+	ShutdownGrace             time.Duration
+	RateLimitRPS              float64
+	RateLimitBurst            int
+	MaxBodyBytes              int64
+	MaxItems                  int
+	RulesFile                 string
+	HolidaysFile              string
+	EventsFile                string
+	EventsSubject             string
+	PointValue                float64
+	PointsExpiryMonths        int
+	BreakageRate              float64
+	DefaultTimeZone           string
+	MaxPointsPerRule          int
+	MaxPointsPerReceipt       int
+	MaxPointsPerCustomerDay   int
+	MaxPointsPerCustomerMonth int
+}
+
+// Default returns the configuration used when nothing is overridden.
+func Default() Config {
+	return Config{
+		ListenAddr:      ":3000",
+		StorageBackend:  StorageMemory,
+		LogLevel:        "info",
+		LogFormat:       "json",
+		TraceExporter:   "none",
+		RequestTimeout:  5 * time.Second,
+		ReadTimeout:     10 * time.Second,
+		WriteTimeout:    15 * time.Second,
+		IdleTimeout:     60 * time.Second,
+		ShutdownGrace:   30 * time.Second,
+		MaxBodyBytes:    1 << 20,
+		MaxItems:        1000,
+		PointValue:      0.01,
+		DefaultTimeZone: "UTC",
+	}
+}
+
+// setting describes how one Config field is named in the config file, the environment and on the command line.
+type setting struct {
+	key    string
+	env    string
+	flag   string
+	usage  string
+	secret bool
+	set    func(c *Config, value string) error
+	get    func(c Config) string
+}
+
+var settings = []setting{
+	stringSetting("listenAddr", "LISTEN_ADDR", "listen-addr", "address to listen on", func(c *Config) *string { return &c.ListenAddr }),
+	stringSetting("tlsCertFile", "TLS_CERT_FILE", "tls-cert", "TLS certificate file, serves HTTPS together with -tls-key", func(c *Config) *string { return &c.TLSCertFile }),
+	stringSetting("tlsKeyFile", "TLS_KEY_FILE", "tls-key", "TLS private key file", func(c *Config) *string { return &c.TLSKeyFile }),
+	stringSetting("storageBackend", "STORAGE_BACKEND", "storage", "receipt storage backend", func(c *Config) *string { return &c.StorageBackend }),
+	secretSetting(stringSetting("storageDSN", "STORAGE_DSN", "storage-dsn", "connection string for the storage backend", func(c *Config) *string { return &c.StorageDSN })),
+	stringSetting("logLevel", "LOG_LEVEL", "log-level", "debug, info, warn or error", func(c *Config) *string { return &c.LogLevel }),
+	stringSetting("logFormat", "LOG_FORMAT", "log-format", "json or text", func(c *Config) *string { return &c.LogFormat }),
+	stringSetting("traceExporter", "OTEL_TRACES_EXPORTER", "trace-exporter", "none, stdout, file or otlp", func(c *Config) *string { return &c.TraceExporter }),
+	stringSetting("traceFile", "OTEL_TRACES_FILE", "trace-file", "output file for the file trace exporter", func(c *Config) *string { return &c.TraceFile }),
+	durationSetting("requestTimeout", "REQUEST_TIMEOUT", "request-timeout", "time allowed for each receipt request, 0 disables the timeout", func(c *Config) *time.Duration { return &c.RequestTimeout }),
+	durationSetting("readTimeout", "READ_TIMEOUT", "read-timeout", "time allowed to read a request including its body", func(c *Config) *time.Duration { return &c.ReadTimeout }),
+	durationSetting("writeTimeout", "WRITE_TIMEOUT", "write-timeout", "time allowed to write a response, must exceed the request timeout", func(c *Config) *time.Duration { return &c.WriteTimeout }),
+	durationSetting("idleTimeout", "IDLE_TIMEOUT", "idle-timeout", "time an idle keep-alive connection is kept open", func(c *Config) *time.Duration { return &c.IdleTimeout }),
+	durationSetting("shutdownGrace", "SHUTDOWN_GRACE", "shutdown-grace", "time in-flight requests are given to finish after SIGTERM", func(c *Config) *time.Duration { return &c.ShutdownGrace }),
+	{
+		key: "rateLimitRPS", env: "RATE_LIMIT_RPS", flag: "rate-limit-rps", usage: "receipt submissions per second allowed from each IP address, 0 disables rate limiting",
+		set: func(c *Config, value string) (err error) {
+			c.RateLimitRPS, err = strconv.ParseFloat(value, 64)
+			return err
+		},
+		get: func(c Config) string { return strconv.FormatFloat(c.RateLimitRPS, 'f', -1, 64) },
+	},
+	{
+		key: "rateLimitBurst", env: "RATE_LIMIT_BURST", flag: "rate-limit-burst", usage: "requests a client may make at once before being rate limited",
+		set: func(c *Config, value string) (err error) {
+			c.RateLimitBurst, err = strconv.Atoi(value)
+			return err
+		},
+		get: func(c Config) string { return strconv.Itoa(c.RateLimitBurst) },
+	},
+	{
+		key: "maxBodyBytes", env: "MAX_BODY_BYTES", flag: "max-body-bytes", usage: "largest receipt request body accepted, in bytes",
+		set: func(c *Config, value string) (err error) {
+			c.MaxBodyBytes, err = strconv.ParseInt(value, 10, 64)
+			return err
+		},
+		get: func(c Config) string { return strconv.FormatInt(c.MaxBodyBytes, 10) },
+	},
+	{
+		key: "maxItems", env: "MAX_ITEMS", flag: "max-items", usage: "most items accepted on a single receipt",
+		set: func(c *Config, value string) (err error) {
+			c.MaxItems, err = strconv.Atoi(value)
+			return err
+		},
+		get: func(c Config) string { return strconv.Itoa(c.MaxItems) },
+	},
+	stringSetting("rulesFile", "RULES_FILE", "rules-file", "file of additional scoring rules", func(c *Config) *string { return &c.RulesFile }),
+	stringSetting("holidaysFile", "HOLIDAYS_FILE", "holidays-file", "holiday calendar that calendar rules may name holidays from", func(c *Config) *string { return &c.HolidaysFile }),
+	stringSetting("eventsFile", "EVENTS_FILE", "events-file", "file receipt events are appended to as NDJSON, disabled when empty", func(c *Config) *string { return &c.EventsFile }),
+	stringSetting("eventsSubject", "EVENTS_SUBJECT", "events-subject", "subject prefix receipt events are published under over NATS, disabled when empty", func(c *Config) *string { return &c.EventsSubject }),
+	{
+		key: "pointValue", env: "POINT_VALUE", flag: "point-value", usage: "dollar value of one point in the liability report",
+		set: func(c *Config, value string) (err error) {
+			c.PointValue, err = strconv.ParseFloat(value, 64)
+			return err
+		},
+		get: func(c Config) string { return strconv.FormatFloat(c.PointValue, 'f', -1, 64) },
+	},
+	{
+		key: "pointsExpiryMonths", env: "POINTS_EXPIRY_MONTHS", flag: "points-expiry-months", usage: "months after the month they are issued that points expire, 0 if they never do",
+		set: func(c *Config, value string) (err error) {
+			c.PointsExpiryMonths, err = strconv.Atoi(value)
+			return err
+		},
+		get: func(c Config) string { return strconv.Itoa(c.PointsExpiryMonths) },
+	},
+	{
+		key: "breakageRate", env: "BREAKAGE_RATE", flag: "breakage-rate", usage: "share of expiring points expected never to be redeemed, between 0 and 1",
+		set: func(c *Config, value string) (err error) {
+			c.BreakageRate, err = strconv.ParseFloat(value, 64)
+			return err
+		},
+		get: func(c Config) string { return strconv.FormatFloat(c.BreakageRate, 'f', -1, 64) },
+	},
+	stringSetting("defaultTimeZone", "DEFAULT_TIME_ZONE", "default-time-zone", "store time zone of receipts submitted without one, an IANA time zone or a UTC offset", func(c *Config) *string { return &c.DefaultTimeZone }),
+	intSetting("maxPointsPerRule", "MAX_POINTS_PER_RULE", "max-points-per-rule", "most points any one rule awards a receipt, 0 for no cap", func(c *Config) *int { return &c.MaxPointsPerRule }),
+	intSetting("maxPointsPerReceipt", "MAX_POINTS_PER_RECEIPT", "max-points-per-receipt", "most points a receipt earns, 0 for no cap", func(c *Config) *int { return &c.MaxPointsPerReceipt }),
+	intSetting("maxPointsPerCustomerDay", "MAX_POINTS_PER_CUSTOMER_DAY", "max-points-per-customer-day", "most points a customer earns from receipts submitted in a UTC day, 0 for no cap; advisory, as customers are identified by the unauthenticated X-Client-ID header", func(c *Config) *int { return &c.MaxPointsPerCustomerDay }),
+	intSetting("maxPointsPerCustomerMonth", "MAX_POINTS_PER_CUSTOMER_MONTH", "max-points-per-customer-month", "most points a customer earns from receipts submitted in a UTC month, 0 for no cap; advisory, as customers are identified by the unauthenticated X-Client-ID header", func(c *Config) *int { return &c.MaxPointsPerCustomerMonth }),
+}
+
+func stringSetting(key string, env string, flagName string, usage string, field func(c *Config) *string) setting {
+	return setting{
+		key: key, env: env, flag: flagName, usage: usage,
+		set: func(c *Config, value string) error {
+			*field(c) = strings.TrimSpace(value)
+			return nil
+		},
+		get: func(c Config) string { return *field(&c) },
+	}
+}
+
+func durationSetting(key string, env string, flagName string, usage string, field func(c *Config) *time.Duration) setting {
+	return setting{
+		key: key, env: env, flag: flagName, usage: usage,
+		set: func(c *Config, value string) (err error) {
+			*field(c), err = time.ParseDuration(strings.TrimSpace(value))
+			return err
+		},
+		get: func(c Config) string { return field(&c).String() },
+	}
+}
+
+func intSetting(key string, env string, flagName string, usage string, field func(c *Config) *int) setting {
+	return setting{
+		key: key, env: env, flag: flagName, usage: usage,
+		set: func(c *Config, value string) (err error) {
+			*field(c), err = strconv.Atoi(strings.TrimSpace(value))
+			return err
+		},
+		get: func(c Config) string { return strconv.Itoa(*field(&c)) },
+	}
+}
+
+func secretSetting(s setting) setting {
+	s.secret = true
+	return s
+}
+
+// Load builds the configuration from, in increasing order of precedence, the defaults, a JSON
+// config file, environment variables and command line flags. The config file is named by the
+// -config flag or the CONFIG_FILE environment variable. Help output is written to output.
+func Load(args []string, lookupEnv func(string) (string, bool), output io.Writer) (Config, error) {
+	fs := flag.NewFlagSet("receipt-processor", flag.ContinueOnError)
+	fs.SetOutput(output)
+	configFile := fs.String("config", "", "path to a JSON config file")
+
+	defaults := Default()
+	flagValues := make(map[string]string)
+	for _, s := range settings {
+		key := s.key
+		usage := fmt.Sprintf("%s (env %s)", s.usage, s.env)
+		if value := s.get(defaults); value != "" {
+			usage = fmt.Sprintf("%s (env %s, default %s)", s.usage, s.env, value)
+		}
+		fs.Func(s.flag, usage, func(value string) error {
+			flagValues[key] = value
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	cfg := defaults
+
+	path := *configFile
+	if path == "" {
+		path, _ = lookupEnv("CONFIG_FILE")
+	}
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return Config{}, err
+		}
+	}
+
+	for _, s := range settings {
+		if value, ok := lookupEnv(s.env); ok && value != "" {
+			if err := s.set(&cfg, value); err != nil {
+				return Config{}, fmt.Errorf("invalid %s in environment variable %s: %w", s.key, s.env, err)
+			}
+		}
+	}
+
+	for _, s := range settings {
+		if value, ok := flagValues[s.key]; ok {
+			if err := s.set(&cfg, value); err != nil {
+				return Config{}, fmt.Errorf("invalid %s in flag -%s: %w", s.key, s.flag, err)
+			}
+		}
+	}
+
+	return cfg, cfg.Validate()
+}
+
+// loadFile applies a JSON object of setting names to values. Values may be JSON strings or numbers.
+func (c *Config) loadFile(path string) error {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(contents, &values); err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+
+	for key, raw := range values {
+		s, ok := lookupSetting(key)
+		if !ok {
+			return fmt.Errorf("unknown setting %q in config file %s", key, path)
+		}
+
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			value = string(raw)
+		}
+		if err := s.set(c, value); err != nil {
+			return fmt.Errorf("invalid %s in config file %s: %w", key, path, err)
+		}
+	}
+
+	return nil
+}
+
+func lookupSetting(key string) (setting, bool) {
+	for _, s := range settings {
+		if s.key == key {
+			return s, true
+		}
+	}
+	return setting{}, false
+}
+
+// Validate checks that every setting holds a usable value, reporting all problems at once.
+func (c Config) Validate() error {
+	var errs []error
+
+	if _, _, err := net.SplitHostPort(c.ListenAddr); err != nil {
+		errs = append(errs, fmt.Errorf("listenAddr %q is invalid: %w", c.ListenAddr, err))
+	}
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		errs = append(errs, errors.New("tlsCertFile and tlsKeyFile must be set together"))
+	}
+	for _, file := range []string{c.TLSCertFile, c.TLSKeyFile, c.RulesFile, c.HolidaysFile} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			errs = append(errs, fmt.Errorf("cannot read %s: %w", file, err))
+		}
+	}
+
+	switch c.StorageBackend {
+	case StorageMemory:
+		if c.StorageDSN != "" {
+			errs = append(errs, errors.New("storageDSN is not used by the memory storage backend"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("storageBackend %q is not supported, must be %s", c.StorageBackend, StorageMemory))
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		errs = append(errs, fmt.Errorf("logLevel %q is invalid, must be debug, info, warn or error", c.LogLevel))
+	}
+	if format := strings.ToLower(c.LogFormat); format != "json" && format != "text" {
+		errs = append(errs, fmt.Errorf("logFormat %q is invalid, must be json or text", c.LogFormat))
+	}
+	switch strings.ToLower(c.TraceExporter) {
+	case "none", "stdout", "otlp":
+	case "file":
+		if c.TraceFile == "" {
+			errs = append(errs, errors.New("traceFile is required by the file trace exporter"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("traceExporter %q is invalid, must be none, stdout, file or otlp", c.TraceExporter))
+	}
+
+	if c.RequestTimeout < 0 {
+		errs = append(errs, errors.New("requestTimeout cannot be negative"))
+	}
+	serverTimeouts := []struct {
+		name    string
+		timeout time.Duration
+	}{
+		{"readTimeout", c.ReadTimeout},
+		{"writeTimeout", c.WriteTimeout},
+		{"idleTimeout", c.IdleTimeout},
+		{"shutdownGrace", c.ShutdownGrace},
+	}
+	for _, server := range serverTimeouts {
+		if server.timeout <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive", server.name))
+		}
+	}
+	if c.WriteTimeout > 0 && c.RequestTimeout > 0 && c.WriteTimeout <= c.RequestTimeout {
+		errs = append(errs, errors.New("writeTimeout must be longer than requestTimeout so timed out requests can still be answered"))
+	}
+	if c.RateLimitRPS < 0 {
+		errs = append(errs, errors.New("rateLimitRPS cannot be negative"))
+	}
+	if c.RateLimitBurst < 0 {
+		errs = append(errs, errors.New("rateLimitBurst cannot be negative"))
+	}
+	if c.RateLimitRPS > 0 && c.RateLimitBurst == 0 {
+		errs = append(errs, errors.New("rateLimitBurst must be at least 1 when rate limiting is enabled"))
+	}
+	if c.MaxBodyBytes <= 0 {
+		errs = append(errs, errors.New("maxBodyBytes must be positive"))
+	}
+	if c.MaxItems <= 0 {
+		errs = append(errs, errors.New("maxItems must be positive"))
+	}
+	if c.PointValue < 0 {
+		errs = append(errs, errors.New("pointValue cannot be negative"))
+	}
+	if c.PointsExpiryMonths < 0 {
+		errs = append(errs, errors.New("pointsExpiryMonths cannot be negative"))
+	}
+	if c.BreakageRate < 0 || c.BreakageRate > 1 {
+		errs = append(errs, errors.New("breakageRate must be between 0 and 1"))
+	}
+	if _, err := models.LoadTimeZone(c.DefaultTimeZone); err != nil {
+		errs = append(errs, fmt.Errorf("defaultTimeZone is invalid: %w", err))
+	}
+	pointsCaps := []struct {
+		name   string
+		points int
+	}{
+		{"maxPointsPerRule", c.MaxPointsPerRule},
+		{"maxPointsPerReceipt", c.MaxPointsPerReceipt},
+		{"maxPointsPerCustomerDay", c.MaxPointsPerCustomerDay},
+		{"maxPointsPerCustomerMonth", c.MaxPointsPerCustomerMonth},
+	}
+	for _, pointsCap := range pointsCaps {
+		if pointsCap.points < 0 {
+			errs = append(errs, fmt.Errorf("%s cannot be negative", pointsCap.name))
+		}
+	}
+	if c.MaxPointsPerCustomerDay > 0 && c.MaxPointsPerCustomerMonth > 0 && c.MaxPointsPerCustomerMonth < c.MaxPointsPerCustomerDay {
+		errs = append(errs, errors.New("maxPointsPerCustomerMonth cannot be less than maxPointsPerCustomerDay"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Redacted returns the effective configuration keyed by setting name, with secrets masked.
+func (c Config) Redacted() map[string]string {
+	effective := make(map[string]string, len(settings))
+	for _, s := range settings {
+		value := s.get(c)
+		if s.secret {
+			value = redact(value)
+		}
+		effective[s.key] = value
+	}
+
+	return effective
+}
+
+// redact masks a secret. URL style connection strings keep everything but the password.
+func redact(value string) string {
+	if value == "" {
+		return ""
+	}
+
+	if u, err := url.Parse(value); err == nil && u.Scheme != "" && u.Host != "" {
+		if _, hasPassword := u.User.Password(); hasPassword {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+		}
+		u.RawQuery = ""
+		return u.String()
+	}
+
+	return redacted
+}
@@ -0,0 +1,140 @@
+package config
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func envFrom(values map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := values[key]
+		return value, ok
+	}
+}
+
+func writeConfigFile(t *testing.T, contents string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("Unexpected error writing config file: %v", err)
+	}
+	return path
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	cfg, err := Load(nil, envFrom(nil), io.Discard)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg != Default() {
+		t.Errorf("Expected the default configuration, got %+v", cfg)
+	}
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	path := writeConfigFile(t, `{"listenAddr": ":4000", "logLevel": "warn", "requestTimeout": "2s", "rateLimitRPS": 5, "rateLimitBurst": 10}`)
+	env := envFrom(map[string]string{
+		"CONFIG_FILE": path,
+		"LOG_LEVEL":   "debug",
+		"LOG_FORMAT":  "text",
+	})
+
+	cfg, err := Load([]string{"-log-format", "json", "-rate-limit-burst", "20"}, env, io.Discard)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		actual   interface{}
+		expected interface{}
+	}{
+		{"File Over Default", cfg.ListenAddr, ":4000"},
+		{"File Duration", cfg.RequestTimeout, 2 * time.Second},
+		{"File Number", cfg.RateLimitRPS, 5.0},
+		{"Env Over File", cfg.LogLevel, "debug"},
+		{"Flag Over Env", cfg.LogFormat, "json"},
+		{"Flag Over File", cfg.RateLimitBurst, 20},
+		{"Untouched Default", cfg.StorageBackend, StorageMemory},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.actual != test.expected {
+				t.Errorf("Expected %v, got %v", test.expected, test.actual)
+			}
+		})
+	}
+}
+
+func TestLoad_RejectsInvalidValues(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		env      map[string]string
+		expected string
+	}{
+		{"Bad Duration", []string{"-request-timeout", "soon"}, nil, "requestTimeout"},
+		{"Bad Number", nil, map[string]string{"RATE_LIMIT_RPS": "lots"}, "RATE_LIMIT_RPS"},
+		{"Half TLS", []string{"-tls-cert", "cert.pem"}, nil, "tlsCertFile and tlsKeyFile"},
+		{"Unknown Backend", []string{"-storage", "postgres"}, nil, "storageBackend"},
+		{"DSN With Memory", []string{"-storage-dsn", "postgres://db/receipts"}, nil, "storageDSN"},
+		{"Bad Log Level", []string{"-log-level", "verbose"}, nil, "logLevel"},
+		{"Bad Listen Address", []string{"-listen-addr", "3000"}, nil, "listenAddr"},
+		{"File Exporter Without File", []string{"-trace-exporter", "file"}, nil, "traceFile"},
+		{"Rate Limit Without Burst", []string{"-rate-limit-rps", "5"}, nil, "rateLimitBurst"},
+		{"Zero Max Items", []string{"-max-items", "0"}, nil, "maxItems must be positive"},
+		{"Breakage Above One", nil, map[string]string{"BREAKAGE_RATE": "1.5"}, "breakageRate must be between 0 and 1"},
+		{"Unknown Time Zone", nil, map[string]string{"DEFAULT_TIME_ZONE": "America/Springfield"}, "defaultTimeZone is invalid"},
+		{"Negative Receipt Cap", []string{"-max-points-per-receipt", "-1"}, nil, "maxPointsPerReceipt cannot be negative"},
+		{"Monthly Cap Below Daily Cap", []string{"-max-points-per-customer-day", "500", "-max-points-per-customer-month", "100"}, nil, "maxPointsPerCustomerMonth cannot be less than maxPointsPerCustomerDay"},
+		{"Zero Grace Period", []string{"-shutdown-grace", "0s"}, nil, "shutdownGrace must be positive"},
+		{"Write Timeout Within Request Timeout", []string{"-write-timeout", "5s"}, nil, "writeTimeout must be longer"},
+		{"Missing Rules File", []string{"-rules-file", "/does/not/exist.json"}, nil, "/does/not/exist.json"},
+		{"Missing Config File", []string{"-config", "/does/not/exist.json"}, nil, "reading config file"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Load(test.args, envFrom(test.env), io.Discard)
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("Expected an error mentioning %q, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestLoad_RejectsUnknownFileSetting(t *testing.T) {
+	path := writeConfigFile(t, `{"port": 3000}`)
+
+	if _, err := Load([]string{"-config", path}, envFrom(nil), io.Discard); err == nil || !strings.Contains(err.Error(), `"port"`) {
+		t.Errorf("Expected an unknown setting error, got %v", err)
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	tests := []struct {
+		name     string
+		dsn      string
+		expected string
+	}{
+		{"Empty", "", ""},
+		{"URL With Password", "postgres://receipts:hunter2@db:5432/receipts?sslmode=disable", "postgres://receipts:REDACTED@db:5432/receipts"},
+		{"URL Without Password", "postgres://db:5432/receipts", "postgres://db:5432/receipts"},
+		{"Key Value", "host=db user=receipts password=hunter2", "REDACTED"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.StorageDSN = test.dsn
+			if actual := cfg.Redacted()["storageDSN"]; actual != test.expected {
+				t.Errorf("Expected '%s', got '%s'", test.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+// Package events defines the domain events emitted when receipts change and relays them from
+// the repository's outbox to sinks such as in-process subscribers, an NDJSON file or a
+// NATS-compatible broker.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+)
+
+// Type names a kind of domain event
+type Type string
+
+const (
+	TypeReceiptProcessed Type = "ReceiptProcessed"
+	TypePointsAwarded    Type = "PointsAwarded"
+	TypeReceiptReviewed  Type = "ReceiptReviewed"
+	TypeReceiptVoided    Type = "ReceiptVoided"
+	TypePointsAdjusted   Type = "PointsAdjusted"
+	TypeReceiptRescored  Type = "ReceiptRescored"
+)
+
+// Event is a domain event stored in the outbox. Sequence is assigned by the outbox when the
+// event is written and is the offset consumers resume from. Consumers may see an event more
+// than once and should use ID to discard repeats.
+type Event struct {
+	ID         string          `json:"id"`
+	Sequence   uint64          `json:"sequence"`
+	Type       Type            `json:"type"`
+	ReceiptID  string          `json:"receiptId"`
+	OccurredAt time.Time       `json:"occurredAt"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// New builds an event about a receipt. The receipt ID may be left empty for a receipt that is
+// being stored for the first time, the outbox fills it in.
+func New(eventType Type, receiptID string, data any) (Event, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, err
+	}
+
+	return Event{
+		ID:         uuid.NewString(),
+		Type:       eventType,
+		ReceiptID:  receiptID,
+		OccurredAt: time.Now().UTC(),
+		Data:       encoded,
+	}, nil
+}
+
+// ReceiptProcessed is the data of a TypeReceiptProcessed event. Points are what the receipt
+// is worth, which are only awarded once it is approved.
+type ReceiptProcessed struct {
+	Retailer      string               `json:"retailer"`
+	RetailerID    string               `json:"retailerId,omitempty"`
+	PurchaseDate  string               `json:"purchaseDate"`
+	PurchaseTime  string               `json:"purchaseTime"`
+	TimeZone      string               `json:"timeZone"`
+	PurchasedAt   time.Time            `json:"purchasedAt"`
+	Total         string               `json:"total"`
+	ItemCount     int                  `json:"itemCount"`
+	ClientID      string               `json:"clientId"`
+	Status        models.ReceiptStatus `json:"status"`
+	Points        int                  `json:"points"`
+	RuleVersion   string               `json:"ruleVersion"`
+	ReviewReasons []string             `json:"reviewReasons,omitempty"`
+}
+
+// PointsAwarded is the data of a TypePointsAwarded event
+type PointsAwarded struct {
+	Points int `json:"points"`
+}
+
+// ReceiptReviewed is the data of a TypeReceiptReviewed event
+type ReceiptReviewed struct {
+	Status  models.ReceiptStatus `json:"status"`
+	Actor   string               `json:"actor"`
+	Comment string               `json:"comment"`
+}
+
+// ReceiptVoided is the data of a TypeReceiptVoided event
+type ReceiptVoided struct {
+	Reason string `json:"reason"`
+	Actor  string `json:"actor"`
+}
+
+// PointsAdjusted is the data of a TypePointsAdjusted event
+type PointsAdjusted struct {
+	Points int    `json:"points"`
+	Reason string `json:"reason"`
+	Actor  string `json:"actor"`
+}
+
+// ReceiptRescored is the data of a TypeReceiptRescored event, emitted when a backfill moves a
+// receipt to another version of the rules
+type ReceiptRescored struct {
+	BackfillID        string `json:"backfillId"`
+	RuleVersionBefore string `json:"ruleVersionBefore"`
+	RuleVersion       string `json:"ruleVersion"`
+	PointsBefore      int    `json:"pointsBefore"`
+	PointsAfter       int    `json:"pointsAfter"`
+}
+
+// Store is the outbox events are relayed from.
+type Store interface {
+	// EventsAfter returns up to limit events with a sequence greater than after, in sequence order.
+	EventsAfter(ctx context.Context, after uint64, limit int) ([]Event, error)
+}
+
+// Compactor is implemented by stores that can discard the events every consumer has handled.
+type Compactor interface {
+	// CompactThrough discards the events with a sequence up to and including through. Sequences
+	// of the events kept and of those written later are unchanged.
+	CompactThrough(ctx context.Context, through uint64) error
+}
@@ -0,0 +1,219 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// memoryStore is an outbox for relay tests
+type memoryStore struct {
+	events []Event
+	mu     sync.Mutex
+}
+
+func (s *memoryStore) append(t *testing.T, eventType Type, receiptID string) {
+	event, err := New(eventType, receiptID, PointsAwarded{Points: 10})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	event.Sequence = uint64(len(s.events)) + 1
+	s.events = append(s.events, event)
+}
+
+func (s *memoryStore) EventsAfter(ctx context.Context, after uint64, limit int) ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if after >= uint64(len(s.events)) {
+		return nil, nil
+	}
+	pending := s.events[after:]
+	if len(pending) > limit {
+		pending = pending[:limit]
+	}
+	return append([]Event(nil), pending...), nil
+}
+
+// flakySink fails every publish while failing is set
+type flakySink struct {
+	failing   bool
+	published []Event
+}
+
+func (s *flakySink) Publish(ctx context.Context, event Event) error {
+	if s.failing {
+		return errors.New("sink unavailable")
+	}
+	s.published = append(s.published, event)
+	return nil
+}
+
+func TestRelay_AtLeastOnceWithOffsets(t *testing.T) {
+	store := &memoryStore{}
+	store.append(t, TypeReceiptProcessed, "receipt-1")
+	store.append(t, TypePointsAwarded, "receipt-1")
+	store.append(t, TypeReceiptProcessed, "receipt-2")
+
+	offsets := NewInMemoryOffsetStore()
+	healthy := &flakySink{}
+	broken := &flakySink{failing: true}
+
+	relay := NewRelay(store, offsets, nil)
+	relay.BatchSize = 2
+	relay.AddConsumer("analytics", healthy)
+	relay.AddConsumer("crm", broken)
+
+	if published := relay.Relay(context.Background()); published != 3 {
+		t.Fatalf("Expected 3 events published, got %d", published)
+	}
+	if offset, _ := offsets.Load("analytics"); offset != 3 {
+		t.Errorf("Expected the healthy consumer at offset 3, got %d", offset)
+	}
+	if offset, _ := offsets.Load("crm"); offset != 0 {
+		t.Errorf("Expected the failing consumer to stay at offset 0, got %d", offset)
+	}
+
+	broken.failing = false
+	store.append(t, TypePointsAwarded, "receipt-2")
+	relay.Relay(context.Background())
+
+	if len(healthy.published) != 4 || len(broken.published) != 4 {
+		t.Fatalf("Expected both consumers to catch up to 4 events, got %d and %d", len(healthy.published), len(broken.published))
+	}
+	for i, event := range broken.published {
+		if event.Sequence != uint64(i+1) {
+			t.Errorf("Expected events in sequence order, got %d at position %d", event.Sequence, i)
+		}
+	}
+
+	// A relay restarted with the same offsets resumes rather than starting over
+	restarted := NewRelay(store, offsets, nil)
+	restarted.AddConsumer("analytics", healthy)
+	if published := restarted.Relay(context.Background()); published != 0 {
+		t.Errorf("Expected nothing to republish after a restart, got %d", published)
+	}
+}
+
+// compactingStore records how far the relay compacts it
+type compactingStore struct {
+	*memoryStore
+	through uint64
+}
+
+func (s *compactingStore) CompactThrough(ctx context.Context, through uint64) error {
+	s.through = through
+	return nil
+}
+
+func TestRelay_CompactsBelowLowestOffset(t *testing.T) {
+	store := &compactingStore{memoryStore: &memoryStore{}}
+	store.append(t, TypeReceiptProcessed, "receipt-1")
+	store.append(t, TypePointsAwarded, "receipt-1")
+
+	healthy := &flakySink{}
+	broken := &flakySink{failing: true}
+	relay := NewRelay(store, nil, nil)
+	relay.AddConsumer("analytics", healthy)
+	relay.AddConsumer("crm", broken)
+
+	// Events a consumer has yet to handle are kept
+	relay.Relay(context.Background())
+	if store.through != 0 {
+		t.Errorf("Expected nothing compacted while a consumer is behind, got through %d", store.through)
+	}
+
+	broken.failing = false
+	relay.Relay(context.Background())
+	if store.through != 2 {
+		t.Errorf("Expected the outbox compacted through 2 once every consumer handled it, got %d", store.through)
+	}
+}
+
+func TestBus_FiltersByType(t *testing.T) {
+	bus := NewBus()
+
+	var awarded, all int
+	bus.Subscribe(func(ctx context.Context, event Event) error { awarded++; return nil }, TypePointsAwarded)
+	bus.Subscribe(func(ctx context.Context, event Event) error { all++; return nil })
+
+	processed, _ := New(TypeReceiptProcessed, "receipt-1", ReceiptProcessed{})
+	points, _ := New(TypePointsAwarded, "receipt-1", PointsAwarded{Points: 10})
+	bus.Publish(context.Background(), processed)
+	bus.Publish(context.Background(), points)
+
+	if awarded != 1 || all != 2 {
+		t.Errorf("Expected 1 PointsAwarded and 2 events in total, got %d and %d", awarded, all)
+	}
+
+	bus.Subscribe(func(ctx context.Context, event Event) error { return errors.New("crm down") })
+	if err := bus.Publish(context.Background(), points); err == nil {
+		t.Errorf("Expected a failing subscriber to fail the publish so the event is retried")
+	}
+}
+
+func TestNDJSONSink_AppendsLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	sink, err := NewNDJSONSink(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, eventType := range []Type{TypeReceiptProcessed, TypePointsAwarded} {
+		event, _ := New(eventType, "receipt-1", PointsAwarded{Points: 10})
+		if err := sink.Publish(context.Background(), event); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	sink.Close()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer file.Close()
+
+	var types []Type
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("Expected a JSON event per line, got %q", scanner.Text())
+		}
+		types = append(types, event.Type)
+	}
+	if len(types) != 2 || types[0] != TypeReceiptProcessed || types[1] != TypePointsAwarded {
+		t.Errorf("Expected 2 events in order, got %v", types)
+	}
+}
+
+func TestNATSSink_PublishesBySubject(t *testing.T) {
+	broker := NewInMemoryNATS()
+
+	var subjects []string
+	broker.Subscribe("receipts.PointsAwarded", func(data []byte) { subjects = append(subjects, "exact") })
+	broker.Subscribe("receipts.>", func(data []byte) {
+		var event Event
+		if err := json.Unmarshal(data, &event); err == nil {
+			subjects = append(subjects, string(event.Type))
+		}
+	})
+
+	sink := NewNATSSink(broker, "receipts")
+	processed, _ := New(TypeReceiptProcessed, "receipt-1", ReceiptProcessed{})
+	points, _ := New(TypePointsAwarded, "receipt-1", PointsAwarded{Points: 10})
+	sink.Publish(context.Background(), processed)
+	sink.Publish(context.Background(), points)
+
+	if len(subjects) != 3 {
+		t.Errorf("Expected the wildcard to see both events and the exact subscription one, got %v", subjects)
+	}
+}
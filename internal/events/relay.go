@@ -0,0 +1,195 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/logging"
+)
+
+const (
+	DefaultPollInterval = 500 * time.Millisecond
+	DefaultBatchSize    = 100
+)
+
+// Sink receives events from the relay. An error leaves the event to be published again.
+type Sink interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+// OffsetStore remembers the sequence of the last event each consumer has handled.
+type OffsetStore interface {
+	Load(consumer string) (uint64, error)
+	Commit(consumer string, offset uint64) error
+}
+
+// Relay publishes events from the outbox to each consumer's sink. A consumer's offset is only
+// committed after its sink accepts an event, so every event is delivered at least once: a
+// failure or a restart between publishing and committing repeats the event. Consumers are
+// independent, a failing sink holds up only its own consumer. If the store is a Compactor, the
+// events every consumer has handled are discarded after each pass.
+//
+// Offsets must be kept as long as the outbox they index. The in-memory offset store suits the
+// in-memory outbox, as both start over when the process restarts; a durable outbox needs an
+// OffsetStore that is just as durable.
+type Relay struct {
+	PollInterval time.Duration
+	BatchSize    int
+	store        Store
+	offsets      OffsetStore
+	consumers    []consumer
+	compacted    uint64
+	logger       *slog.Logger
+	mu           sync.Mutex
+}
+
+type consumer struct {
+	name string
+	sink Sink
+}
+
+func NewRelay(store Store, offsets OffsetStore, logger *slog.Logger) *Relay {
+	if offsets == nil {
+		offsets = NewInMemoryOffsetStore()
+	}
+	return &Relay{
+		PollInterval: DefaultPollInterval,
+		BatchSize:    DefaultBatchSize,
+		store:        store,
+		offsets:      offsets,
+		logger:       logging.OrDefault(logger),
+	}
+}
+
+// AddConsumer registers a sink under a name, which keys its offset.
+func (r *Relay) AddConsumer(name string, sink Sink) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.consumers = append(r.consumers, consumer{name: name, sink: sink})
+}
+
+// Run relays events every PollInterval until ctx is cancelled.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		r.Relay(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Relay publishes every pending event to every consumer and returns how many were published.
+func (r *Relay) Relay(ctx context.Context) int {
+	r.mu.Lock()
+	consumers := append([]consumer(nil), r.consumers...)
+	r.mu.Unlock()
+
+	published := 0
+	for _, c := range consumers {
+		count, err := r.relayTo(ctx, c)
+		published += count
+		if err != nil && ctx.Err() == nil {
+			r.logger.WarnContext(ctx, "Failed to relay events, will retry", "consumer", c.name, "error", err)
+		}
+	}
+	r.compact(ctx, consumers)
+	return published
+}
+
+// compact discards the events below the lowest offset of the consumers, which they have all
+// handled. A consumer added later starts from the oldest event kept.
+func (r *Relay) compact(ctx context.Context, consumers []consumer) {
+	compactor, ok := r.store.(Compactor)
+	if !ok || len(consumers) == 0 {
+		return
+	}
+
+	through := uint64(math.MaxUint64)
+	for _, c := range consumers {
+		offset, err := r.offsets.Load(c.name)
+		if err != nil {
+			r.logger.WarnContext(ctx, "Failed to load offset, outbox not compacted", "consumer", c.name, "error", err)
+			return
+		}
+		through = min(through, offset)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if through <= r.compacted {
+		return
+	}
+	if err := compactor.CompactThrough(ctx, through); err != nil {
+		if ctx.Err() == nil {
+			r.logger.WarnContext(ctx, "Failed to compact outbox, will retry", "through", through, "error", err)
+		}
+		return
+	}
+	r.compacted = through
+}
+
+func (r *Relay) relayTo(ctx context.Context, c consumer) (int, error) {
+	offset, err := r.offsets.Load(c.name)
+	if err != nil {
+		return 0, fmt.Errorf("loading offset: %w", err)
+	}
+
+	published := 0
+	for {
+		batch, err := r.store.EventsAfter(ctx, offset, r.BatchSize)
+		if err != nil {
+			return published, fmt.Errorf("reading outbox: %w", err)
+		}
+		if len(batch) == 0 {
+			return published, nil
+		}
+
+		for _, event := range batch {
+			if err := c.sink.Publish(ctx, event); err != nil {
+				return published, fmt.Errorf("publishing event %d: %w", event.Sequence, err)
+			}
+			if err := r.offsets.Commit(c.name, event.Sequence); err != nil {
+				return published, fmt.Errorf("committing offset %d: %w", event.Sequence, err)
+			}
+			offset = event.Sequence
+			published++
+		}
+	}
+}
+
+// InMemoryOffsetStore keeps consumer offsets for the life of the process.
+type InMemoryOffsetStore struct {
+	offsets map[string]uint64
+	mu      sync.Mutex
+}
+
+func NewInMemoryOffsetStore() *InMemoryOffsetStore {
+	return &InMemoryOffsetStore{offsets: make(map[string]uint64)}
+}
+
+func (s *InMemoryOffsetStore) Load(consumer string) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.offsets[consumer], nil
+}
+
+func (s *InMemoryOffsetStore) Commit(consumer string, offset uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.offsets[consumer] = offset
+	return nil
+}
@@ -0,0 +1,155 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Handler handles an event delivered by a Bus.
+type Handler func(ctx context.Context, event Event) error
+
+// Bus delivers events to in-process subscribers. If a subscriber fails the whole event is
+// published again, so every subscriber must tolerate repeats.
+type Bus struct {
+	subscribers []subscriber
+	mu          sync.RWMutex
+}
+
+type subscriber struct {
+	types   []Type
+	handler Handler
+}
+
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe calls handler for events of the given types, or for every event if none are given.
+func (b *Bus) Subscribe(handler Handler, types ...Type) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.subscribers = append(b.subscribers, subscriber{types: types, handler: handler})
+}
+
+func (b *Bus) Publish(ctx context.Context, event Event) error {
+	b.mu.RLock()
+	subscribers := slices.Clone(b.subscribers)
+	b.mu.RUnlock()
+
+	var errs []error
+	for _, s := range subscribers {
+		if len(s.types) > 0 && !slices.Contains(s.types, event.Type) {
+			continue
+		}
+		if err := s.handler(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// NDJSONSink appends each event to a file as one line of JSON.
+type NDJSONSink struct {
+	file *os.File
+	mu   sync.Mutex
+}
+
+// NewNDJSONSink opens path for appending, creating it if necessary.
+func NewNDJSONSink(path string) (*NDJSONSink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("opening events file: %w", err)
+	}
+	return &NDJSONSink{file: file}, nil
+}
+
+// Publish writes the event and syncs the file, so an event is on disk before its offset is committed.
+func (s *NDJSONSink) Publish(ctx context.Context, event Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+func (s *NDJSONSink) Close() error {
+	return s.file.Close()
+}
+
+// Publisher is the part of a NATS connection the NATSSink needs. *nats.Conn satisfies it.
+type Publisher interface {
+	Publish(subject string, data []byte) error
+}
+
+// NATSSink publishes each event as JSON on the subject "<prefix>.<type>", e.g. receipts.ReceiptProcessed.
+type NATSSink struct {
+	conn   Publisher
+	prefix string
+}
+
+func NewNATSSink(conn Publisher, prefix string) *NATSSink {
+	return &NATSSink{conn: conn, prefix: prefix}
+}
+
+func (s *NATSSink) Publish(ctx context.Context, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return s.conn.Publish(s.prefix+"."+string(event.Type), data)
+}
+
+// InMemoryNATS stands in for a NATS server in tests and local runs. Subjects match exactly,
+// or by prefix when a subscription ends in the ">" wildcard.
+type InMemoryNATS struct {
+	subscriptions map[string][]func(data []byte)
+	mu            sync.RWMutex
+}
+
+func NewInMemoryNATS() *InMemoryNATS {
+	return &InMemoryNATS{subscriptions: make(map[string][]func(data []byte))}
+}
+
+// Subscribe calls handler with the data of every message published on a matching subject.
+func (n *InMemoryNATS) Subscribe(subject string, handler func(data []byte)) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.subscriptions[subject] = append(n.subscriptions[subject], handler)
+}
+
+func (n *InMemoryNATS) Publish(subject string, data []byte) error {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	for pattern, handlers := range n.subscriptions {
+		if !subjectMatches(pattern, subject) {
+			continue
+		}
+		for _, handler := range handlers {
+			handler(data)
+		}
+	}
+	return nil
+}
+
+func subjectMatches(pattern string, subject string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, ">"); ok {
+		return strings.HasPrefix(subject, prefix)
+	}
+	return pattern == subject
+}
@@ -0,0 +1,261 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Type is the type of a value in an expression.
+type Type int
+
+const (
+	Number Type = iota + 1
+	String
+	Bool
+	// Items is the receipt's items, which only the quantifiers any, all, count and sum accept
+	Items
+)
+
+func (t Type) String() string {
+	switch t {
+	case Number:
+		return "number"
+	case String:
+		return "string"
+	case Bool:
+		return "bool"
+	case Items:
+		return "items"
+	default:
+		return fmt.Sprintf("Type(%d)", int(t))
+	}
+}
+
+// field is a value an expression may read from the receipt or the item being quantified over
+type field struct {
+	typ Type
+	get func(m *machine) any
+}
+
+var receiptFields = map[string]field{
+	"retailer":     {String, func(m *machine) any { return m.retailer }},
+	"purchaseDate": {String, func(m *machine) any { return m.purchaseDate }},
+	"purchaseTime": {String, func(m *machine) any { return m.purchaseTime }},
+	"total":        {Number, func(m *machine) any { return m.total }},
+	"itemCount":    {Number, func(m *machine) any { return float64(len(m.items)) }},
+	"day":          {Number, func(m *machine) any { return float64(m.date.Day()) }},
+	"month":        {Number, func(m *machine) any { return float64(m.date.Month()) }},
+	"weekday":      {String, func(m *machine) any { return strings.ToLower(m.date.Weekday().String()) }},
+	"hour":         {Number, func(m *machine) any { return float64(m.hour) }},
+	"minute":       {Number, func(m *machine) any { return float64(m.minute) }},
+	"items":        {Items, func(m *machine) any { return nil }},
+}
+
+var itemFields = map[string]field{
+	"description": {String, func(m *machine) any { return m.item.description }},
+	"price":       {Number, func(m *machine) any { return m.item.price }},
+}
+
+// function is a built in function of fixed arity
+type function struct {
+	params []Type
+	result Type
+	call   func(args []any) any
+}
+
+var functions = map[string]function{
+	"contains":   {[]Type{String, String}, Bool, func(a []any) any { return strings.Contains(a[0].(string), a[1].(string)) }},
+	"startsWith": {[]Type{String, String}, Bool, func(a []any) any { return strings.HasPrefix(a[0].(string), a[1].(string)) }},
+	"endsWith":   {[]Type{String, String}, Bool, func(a []any) any { return strings.HasSuffix(a[0].(string), a[1].(string)) }},
+	"lower":      {[]Type{String}, String, func(a []any) any { return strings.ToLower(a[0].(string)) }},
+	"upper":      {[]Type{String}, String, func(a []any) any { return strings.ToUpper(a[0].(string)) }},
+	"trim":       {[]Type{String}, String, func(a []any) any { return strings.TrimSpace(a[0].(string)) }},
+	"len":        {[]Type{String}, Number, func(a []any) any { return float64(len([]rune(a[0].(string)))) }},
+	"floor":      {[]Type{Number}, Number, func(a []any) any { return math.Floor(a[0].(float64)) }},
+	"ceil":       {[]Type{Number}, Number, func(a []any) any { return math.Ceil(a[0].(float64)) }},
+	"round":      {[]Type{Number}, Number, func(a []any) any { return math.Round(a[0].(float64)) }},
+	"abs":        {[]Type{Number}, Number, func(a []any) any { return math.Abs(a[0].(float64)) }},
+	"min":        {[]Type{Number, Number}, Number, func(a []any) any { return math.Min(a[0].(float64), a[1].(float64)) }},
+	"max":        {[]Type{Number, Number}, Number, func(a []any) any { return math.Max(a[0].(float64), a[1].(float64)) }},
+}
+
+// quantifiers take the receipt's items and an expression evaluated once per item, in which
+// the item's description and price may be used
+var quantifiers = map[string]struct{ body, result Type }{
+	"any":   {Bool, Bool},
+	"all":   {Bool, Bool},
+	"count": {Bool, Number},
+	"sum":   {Number, Number},
+}
+
+// checker resolves names and checks that every operator and function is given values of the
+// types it works on, turning the parsed expression into one that can be evaluated.
+type checker struct {
+	// inItem is set while checking the body of a quantifier
+	inItem bool
+}
+
+// compile parses an expression and checks that it results in a value of the wanted type.
+func compile(source string, want Type) (evaluable, error) {
+	root, err := parse(source)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &checker{}
+	compiled, typ, err := c.check(root)
+	if err != nil {
+		return nil, err
+	}
+	if typ != want {
+		return nil, errorAt(1, "expression is %s, expected %s", typ, want)
+	}
+	return compiled, nil
+}
+
+func (c *checker) check(n node) (evaluable, Type, error) {
+	switch n := n.(type) {
+	case literal:
+		switch n.value.(type) {
+		case float64:
+			return constant{n.value}, Number, nil
+		case string:
+			return constant{n.value}, String, nil
+		default:
+			return constant{n.value}, Bool, nil
+		}
+	case identifier:
+		return c.checkIdentifier(n)
+	case unary:
+		operand, typ, err := c.check(n.operand)
+		if err != nil {
+			return nil, 0, err
+		}
+		if n.op == "not" {
+			return notNode{operand}, Bool, c.expectType(n.operand, n.op, typ, Bool)
+		}
+		return negateNode{operand}, Number, c.expectType(n.operand, n.op, typ, Number)
+	case binary:
+		return c.checkBinary(n)
+	case call:
+		return c.checkCall(n)
+	default:
+		return nil, 0, errorAt(n.column(), "unsupported expression")
+	}
+}
+
+func (c *checker) checkIdentifier(n identifier) (evaluable, Type, error) {
+	if f, ok := itemFields[n.name]; ok {
+		if !c.inItem {
+			return nil, 0, errorAt(n.at, "%s is a field of an item, use it inside any, all, count or sum", n.name)
+		}
+		return fieldNode{f.get}, f.typ, nil
+	}
+	f, ok := receiptFields[n.name]
+	if !ok {
+		if _, isFunction := functions[n.name]; isFunction {
+			return nil, 0, errorAt(n.at, "%s is a function, call it with parentheses", n.name)
+		}
+		return nil, 0, errorAt(n.at, "unknown field %q", n.name)
+	}
+	if f.typ == Items {
+		return nil, 0, errorAt(n.at, "items can only be the first argument of any, all, count or sum")
+	}
+	return fieldNode{f.get}, f.typ, nil
+}
+
+func (c *checker) checkBinary(n binary) (evaluable, Type, error) {
+	left, leftType, err := c.check(n.left)
+	if err != nil {
+		return nil, 0, err
+	}
+	right, rightType, err := c.check(n.right)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch n.op {
+	case "and", "or":
+		if err := c.expectType(n.left, n.op, leftType, Bool); err != nil {
+			return nil, 0, err
+		}
+		return logicNode{and: n.op == "and", left: left, right: right}, Bool, c.expectType(n.right, n.op, rightType, Bool)
+	case "==", "!=":
+		if leftType != rightType {
+			return nil, 0, errorAt(n.at, "cannot compare %s with %s", leftType, rightType)
+		}
+		return compareNode{op: n.op, left: left, right: right}, Bool, nil
+	case "<", "<=", ">", ">=":
+		if leftType != rightType || leftType == Bool {
+			return nil, 0, errorAt(n.at, "%s compares two numbers or two strings, got %s and %s", n.op, leftType, rightType)
+		}
+		return compareNode{op: n.op, left: left, right: right}, Bool, nil
+	default:
+		if err := c.expectType(n.left, n.op, leftType, Number); err != nil {
+			return nil, 0, err
+		}
+		return arithmeticNode{op: n.op, left: left, right: right}, Number, c.expectType(n.right, n.op, rightType, Number)
+	}
+}
+
+func (c *checker) checkCall(n call) (evaluable, Type, error) {
+	if q, ok := quantifiers[n.name]; ok {
+		return c.checkQuantifier(n, q.body, q.result)
+	}
+
+	fn, ok := functions[n.name]
+	if !ok {
+		if _, isField := receiptFields[n.name]; isField {
+			return nil, 0, errorAt(n.at, "%s is a field, not a function", n.name)
+		}
+		return nil, 0, errorAt(n.at, "unknown function %q", n.name)
+	}
+	if len(n.args) != len(fn.params) {
+		return nil, 0, errorAt(n.at, "%s takes %d arguments, got %d", n.name, len(fn.params), len(n.args))
+	}
+
+	args := make([]evaluable, len(n.args))
+	for i, arg := range n.args {
+		compiled, typ, err := c.check(arg)
+		if err != nil {
+			return nil, 0, err
+		}
+		if typ != fn.params[i] {
+			return nil, 0, errorAt(arg.column(), "argument %d of %s must be %s, got %s", i+1, n.name, fn.params[i], typ)
+		}
+		args[i] = compiled
+	}
+	return callNode{call: fn.call, args: args}, fn.result, nil
+}
+
+func (c *checker) checkQuantifier(n call, body Type, result Type) (evaluable, Type, error) {
+	if len(n.args) != 2 {
+		return nil, 0, errorAt(n.at, "%s takes 2 arguments, items and an expression for each item, got %d", n.name, len(n.args))
+	}
+	if id, ok := n.args[0].(identifier); !ok || id.name != "items" {
+		return nil, 0, errorAt(n.args[0].column(), "the first argument of %s must be items", n.name)
+	}
+	if c.inItem {
+		return nil, 0, errorAt(n.at, "%s cannot be used inside another quantifier", n.name)
+	}
+
+	c.inItem = true
+	compiled, typ, err := c.check(n.args[1])
+	c.inItem = false
+	if err != nil {
+		return nil, 0, err
+	}
+	if typ != body {
+		return nil, 0, errorAt(n.args[1].column(), "the second argument of %s must be %s, got %s", n.name, body, typ)
+	}
+
+	return quantifierNode{name: n.name, body: compiled}, result, nil
+}
+
+func (c *checker) expectType(operand node, op string, got Type, want Type) error {
+	if got != want {
+		return errorAt(operand.column(), "%s needs %s operands, got %s", op, want, got)
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+package expr
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// ErrStepLimit is returned when evaluating a rule takes more steps than it is allowed
+var ErrStepLimit = errors.New("evaluation step limit exceeded")
+
+// evaluable is a checked expression. Since types were checked at compile time, a node may
+// assert the types of the values its operands produce.
+type evaluable interface {
+	eval(m *machine) (any, error)
+}
+
+type item struct {
+	description string
+	price       float64
+}
+
+// machine holds the receipt an expression is evaluated against and counts the steps taken
+type machine struct {
+	retailer     string
+	purchaseDate string
+	purchaseTime string
+	date         time.Time
+	hour, minute int
+	total        float64
+	items        []item
+	// item is the item a quantifier is evaluating its body for
+	item item
+
+	steps    int
+	maxSteps int
+}
+
+// eval evaluates a node as one step
+func (m *machine) eval(e evaluable) (any, error) {
+	m.steps++
+	if m.steps > m.maxSteps {
+		return nil, fmt.Errorf("%w: more than %d steps", ErrStepLimit, m.maxSteps)
+	}
+	return e.eval(m)
+}
+
+type constant struct {
+	value any
+}
+
+func (n constant) eval(m *machine) (any, error) {
+	return n.value, nil
+}
+
+type fieldNode struct {
+	get func(m *machine) any
+}
+
+func (n fieldNode) eval(m *machine) (any, error) {
+	return n.get(m), nil
+}
+
+type notNode struct {
+	operand evaluable
+}
+
+func (n notNode) eval(m *machine) (any, error) {
+	value, err := m.eval(n.operand)
+	if err != nil {
+		return nil, err
+	}
+	return !value.(bool), nil
+}
+
+type negateNode struct {
+	operand evaluable
+}
+
+func (n negateNode) eval(m *machine) (any, error) {
+	value, err := m.eval(n.operand)
+	if err != nil {
+		return nil, err
+	}
+	return -value.(float64), nil
+}
+
+// logicNode evaluates and and or, skipping the right operand when the left decides the result
+type logicNode struct {
+	and         bool
+	left, right evaluable
+}
+
+func (n logicNode) eval(m *machine) (any, error) {
+	left, err := m.eval(n.left)
+	if err != nil {
+		return nil, err
+	}
+	if left.(bool) != n.and {
+		return left, nil
+	}
+	return m.eval(n.right)
+}
+
+type compareNode struct {
+	op          string
+	left, right evaluable
+}
+
+func (n compareNode) eval(m *machine) (any, error) {
+	left, err := m.eval(n.left)
+	if err != nil {
+		return nil, err
+	}
+	right, err := m.eval(n.right)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return left == right, nil
+	case "!=":
+		return left != right, nil
+	}
+
+	var order int
+	switch left := left.(type) {
+	case float64:
+		order = compareNumbers(left, right.(float64))
+	case string:
+		order = strings.Compare(left, right.(string))
+	}
+	switch n.op {
+	case "<":
+		return order < 0, nil
+	case "<=":
+		return order <= 0, nil
+	case ">":
+		return order > 0, nil
+	default:
+		return order >= 0, nil
+	}
+}
+
+func compareNumbers(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+type arithmeticNode struct {
+	op          string
+	left, right evaluable
+}
+
+func (n arithmeticNode) eval(m *machine) (any, error) {
+	leftValue, err := m.eval(n.left)
+	if err != nil {
+		return nil, err
+	}
+	rightValue, err := m.eval(n.right)
+	if err != nil {
+		return nil, err
+	}
+
+	left, right := leftValue.(float64), rightValue.(float64)
+	switch n.op {
+	case "+":
+		return left + right, nil
+	case "-":
+		return left - right, nil
+	case "*":
+		return left * right, nil
+	}
+	if right == 0 {
+		return nil, errors.New("division by zero")
+	}
+	if n.op == "/" {
+		return left / right, nil
+	}
+	return math.Mod(left, right), nil
+}
+
+type callNode struct {
+	call func(args []any) any
+	args []evaluable
+}
+
+func (n callNode) eval(m *machine) (any, error) {
+	args := make([]any, len(n.args))
+	for i, arg := range n.args {
+		value, err := m.eval(arg)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+	return n.call(args), nil
+}
+
+// quantifierNode evaluates its body for each item. any and all stop at the first item that
+// decides the result.
+type quantifierNode struct {
+	name string
+	body evaluable
+}
+
+func (n quantifierNode) eval(m *machine) (any, error) {
+	count, sum := 0, 0.0
+	for _, it := range m.items {
+		m.item = it
+		value, err := m.eval(n.body)
+		if err != nil {
+			return nil, err
+		}
+
+		switch n.name {
+		case "any":
+			if value.(bool) {
+				return true, nil
+			}
+		case "all":
+			if !value.(bool) {
+				return false, nil
+			}
+		case "count":
+			if value.(bool) {
+				count++
+			}
+		case "sum":
+			sum += value.(float64)
+		}
+	}
+
+	switch n.name {
+	case "any":
+		return false, nil
+	case "all":
+		return true, nil
+	case "count":
+		return float64(count), nil
+	default:
+		return sum, nil
+	}
+}
@@ -0,0 +1,254 @@
+// Package expr is a small expression language for custom scoring rules, such as
+//
+//	any(items, contains(lower(description), 'organic')) and total > 20
+//
+// Expressions read a receipt's fields and nothing else. They have no loops besides the
+// quantifiers any, all, count and sum over the receipt's items, and every evaluation is
+// limited to a number of steps, so a rule cannot hang or affect anything outside its result.
+// Rules are parsed and type checked when loaded, reporting the column of any mistake.
+//
+// Receipt fields are retailer, purchaseDate, purchaseTime, weekday (strings), total,
+// itemCount, day, month, hour and minute (numbers). Inside a quantifier, description and
+// price are those of the item being evaluated. Operators are or, and, not, the comparisons
+// == != < <= > >=, and + - * / % on numbers. Functions are contains, startsWith, endsWith,
+// lower, upper, trim, len, floor, ceil, round, abs, min and max.
+package expr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+)
+
+// RulePrefix starts the name of an expression rule's line in a points breakdown
+const RulePrefix = "custom:"
+
+// DefaultMaxSteps is how many steps evaluating a rule may take unless the rule sets its own limit
+const DefaultMaxSteps = 10000
+
+// LimitMaxSteps is the highest step limit a rule may set
+const LimitMaxSteps = 1000000
+
+// Rule awards Points to receipts for which When holds, or to every receipt if When is empty.
+// Points is an expression too, so it may depend on the receipt, and is rounded to the nearest
+// whole point. MaxSteps limits how many steps evaluating the rule may take, DefaultMaxSteps
+// when zero.
+type Rule struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	When        string `json:"when"`
+	Points      string `json:"points"`
+	MaxSteps    int    `json:"maxSteps"`
+}
+
+// Input is the view of a receipt that rules are evaluated against. The purchase date and time
+// are the store's local ones, and the items and total are those still on the receipt after any
+// returns.
+type Input struct {
+	Retailer     string
+	PurchaseDate string
+	PurchaseTime string
+	Total        string
+	Items        []models.Item
+}
+
+// Engine evaluates compiled expression rules.
+// A nil *Engine awards nothing, so expression rules are optional.
+type Engine struct {
+	rules  []compiledRule
+	digest string
+}
+
+type compiledRule struct {
+	Rule
+	when     evaluable
+	points   evaluable
+	maxSteps int
+}
+
+// New compiles the rules, reporting every mistake found along with the rule it is in.
+func New(rules []Rule) (*Engine, error) {
+	engine := &Engine{}
+
+	var errs []error
+	names := make(map[string]bool, len(rules))
+	for i, rule := range rules {
+		compiled, err := compileRule(rule)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("expression rule %d (%s): %w", i, rule.Name, err))
+			continue
+		}
+		if names[rule.Name] {
+			errs = append(errs, fmt.Errorf("expression rule %d (%s): name is used by another rule", i, rule.Name))
+			continue
+		}
+		names[rule.Name] = true
+		engine.rules = append(engine.rules, compiled)
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	if len(rules) > 0 {
+		definitions, err := json.Marshal(rules)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(definitions)
+		engine.digest = hex.EncodeToString(sum[:])
+	}
+	return engine, nil
+}
+
+func compileRule(rule Rule) (compiledRule, error) {
+	compiled := compiledRule{Rule: rule, maxSteps: rule.MaxSteps}
+	if compiled.maxSteps == 0 {
+		compiled.maxSteps = DefaultMaxSteps
+	}
+
+	var errs []error
+	if strings.TrimSpace(rule.Name) == "" {
+		errs = append(errs, errors.New("name is required"))
+	}
+	if rule.MaxSteps < 0 || rule.MaxSteps > LimitMaxSteps {
+		errs = append(errs, fmt.Errorf("maxSteps cannot be negative or more than %d", LimitMaxSteps))
+	}
+	if rule.When != "" {
+		when, err := compile(rule.When, Bool)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("when: %w", err))
+		}
+		compiled.when = when
+	}
+	if rule.Points == "" {
+		errs = append(errs, errors.New("points is required"))
+	} else {
+		points, err := compile(rule.Points, Number)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("points: %w", err))
+		}
+		compiled.points = points
+	}
+
+	return compiled, errors.Join(errs...)
+}
+
+// Evaluate returns a line for every rule that holds for a receipt. A rule that fails to
+// evaluate, by dividing by zero, exceeding its step limit or awarding negative points, awards
+// nothing and its error is returned alongside the lines of the other rules.
+func (e *Engine) Evaluate(input Input) ([]models.PointsLine, error) {
+	if e == nil || len(e.rules) == 0 {
+		return nil, nil
+	}
+
+	m, err := newMachine(input)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []models.PointsLine
+	var errs []error
+	for _, rule := range e.rules {
+		points, ok, err := rule.evaluate(m)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("expression rule %s: %w", rule.Name, err))
+			continue
+		}
+		if ok {
+			lines = append(lines, models.PointsLine{Rule: RulePrefix + rule.Name, Points: points, Description: rule.describe()})
+		}
+	}
+	return lines, errors.Join(errs...)
+}
+
+// Rules returns the number of rules the engine evaluates.
+func (e *Engine) Rules() int {
+	if e == nil {
+		return 0
+	}
+	return len(e.rules)
+}
+
+// Digest identifies the rules the engine evaluates, changing whenever a rule is edited, added or
+// removed. An engine without rules has an empty digest.
+func (e *Engine) Digest() string {
+	if e == nil {
+		return ""
+	}
+	return e.digest
+}
+
+func (r compiledRule) evaluate(m *machine) (int, bool, error) {
+	m.steps, m.maxSteps = 0, r.maxSteps
+
+	if r.when != nil {
+		holds, err := m.eval(r.when)
+		if err != nil {
+			return 0, false, fmt.Errorf("when: %w", err)
+		}
+		if !holds.(bool) {
+			return 0, false, nil
+		}
+	}
+
+	value, err := m.eval(r.points)
+	if err != nil {
+		return 0, false, fmt.Errorf("points: %w", err)
+	}
+	points := math.Round(value.(float64))
+	if math.IsNaN(points) || points < 0 || points > math.MaxInt32 {
+		return 0, false, fmt.Errorf("points: %v is not a number of points that can be awarded", value)
+	}
+	return int(points), true, nil
+}
+
+func (r compiledRule) describe() string {
+	if r.Description != "" {
+		return r.Description
+	}
+	if r.When == "" {
+		return r.Points + " points"
+	}
+	return fmt.Sprintf("%s points when %s", r.Points, r.When)
+}
+
+func newMachine(input Input) (*machine, error) {
+	date, err := time.Parse("2006-01-02", input.PurchaseDate)
+	if err != nil {
+		return nil, fmt.Errorf("purchase date %q: %w", input.PurchaseDate, err)
+	}
+	clock, err := time.Parse("15:04", input.PurchaseTime)
+	if err != nil {
+		return nil, fmt.Errorf("purchase time %q: %w", input.PurchaseTime, err)
+	}
+	total, err := strconv.ParseFloat(input.Total, 64)
+	if err != nil {
+		return nil, fmt.Errorf("total %q is not a number", input.Total)
+	}
+
+	m := &machine{
+		retailer:     input.Retailer,
+		purchaseDate: input.PurchaseDate,
+		purchaseTime: input.PurchaseTime,
+		date:         date,
+		hour:         clock.Hour(),
+		minute:       clock.Minute(),
+		total:        total,
+	}
+	for i, it := range input.Items {
+		price, err := strconv.ParseFloat(it.Price, 64)
+		if err != nil {
+			return nil, fmt.Errorf("price %q of item %d is not a number", it.Price, i)
+		}
+		m.items = append(m.items, item{description: it.ShortDescription, price: price})
+	}
+	return m, nil
+}
@@ -0,0 +1,259 @@
+package expr
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+)
+
+func loadExample(t *testing.T, name string) Input {
+	t.Helper()
+	data, err := os.ReadFile("../../examples/" + name)
+	if err != nil {
+		t.Fatalf("Reading %s: %v", name, err)
+	}
+	var receipt models.Receipt
+	if err := json.Unmarshal(data, &receipt); err != nil {
+		t.Fatalf("Decoding %s: %v", name, err)
+	}
+	return Input{Retailer: receipt.Retailer, PurchaseDate: receipt.PurchaseDate, PurchaseTime: receipt.PurchaseTime, Total: receipt.Total, Items: receipt.Items}
+}
+
+func TestExpressions_ExampleReceipts(t *testing.T) {
+	tests := []struct {
+		expression string
+		example    string
+		expected   any
+	}{
+		{`retailer == "Target"`, "simple-receipt.json", true},
+		{`retailer == 'Target'`, "morning-receipt.json", false},
+		{`total`, "morning-receipt.json", 2.65},
+		{`itemCount * 10 + 1`, "morning-receipt.json", 21.0},
+		{`total > 2 and itemCount >= 2`, "morning-receipt.json", true},
+		{`total > 2 and itemCount >= 2`, "simple-receipt.json", false},
+		{`not (total > 2) or retailer == "Walgreens"`, "simple-receipt.json", true},
+		{`weekday == "sunday" and day == 2 and month == 1`, "simple-receipt.json", true},
+		{`hour < 12`, "morning-receipt.json", true},
+		{`hour * 60 + minute`, "simple-receipt.json", 793.0},
+		{`purchaseTime >= "08:00" and purchaseTime < "09:00"`, "morning-receipt.json", true},
+		{`startsWith(purchaseDate, "2022-")`, "morning-receipt.json", true},
+		{`any(items, contains(lower(description), 'pepsi'))`, "simple-receipt.json", true},
+		{`any(items, contains(lower(description), 'organic')) and total > 20`, "morning-receipt.json", false},
+		{`all(items, price > 1)`, "morning-receipt.json", true},
+		{`all(items, price > 1.3)`, "morning-receipt.json", false},
+		{`count(items, endsWith(description, "oz"))`, "morning-receipt.json", 1.0},
+		{`sum(items, len(trim(description)))`, "morning-receipt.json", 19.0},
+		{`floor(sum(items, price) * 10)`, "morning-receipt.json", 26.0},
+		{`ceil(total) + round(1.5) + abs(-1) + min(1, 2) + max(1, 2)`, "simple-receipt.json", 8.0},
+		{`total % 1 * 100`, "simple-receipt.json", 25.0},
+		{`upper(retailer) != "TARGET"`, "simple-receipt.json", false},
+		{`- -total`, "simple-receipt.json", 1.25},
+		{`"it's" == 'it\'s'`, "simple-receipt.json", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expression, func(t *testing.T) {
+			want := Bool
+			switch test.expected.(type) {
+			case float64:
+				want = Number
+			case string:
+				want = String
+			}
+			compiled, err := compile(test.expression, want)
+			if err != nil {
+				t.Fatalf("Unexpected compile error: %v", err)
+			}
+
+			m, err := newMachine(loadExample(t, test.example))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			m.maxSteps = DefaultMaxSteps
+			result, err := m.eval(compiled)
+			if err != nil {
+				t.Fatalf("Unexpected evaluation error: %v", err)
+			}
+			if number, ok := result.(float64); ok {
+				result = float64(int64(number*1e6+0.5)) / 1e6
+			}
+			if result != test.expected {
+				t.Errorf("Expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestCompile_Errors(t *testing.T) {
+	tests := []struct {
+		expression    string
+		want          Type
+		expectedError string
+	}{
+		{``, Bool, "column 1: expression is empty"},
+		{`total >`, Bool, "column 8: unexpected end of expression, expected a value"},
+		{`total > 20 20`, Bool, `column 12: unexpected "20", expected an operator or the end of the expression`},
+		{`totl > 20`, Bool, `column 1: unknown field "totl"`},
+		{`total > "20"`, Bool, "column 7: > compares two numbers or two strings, got number and string"},
+		{`retailer == 5`, Bool, "column 10: cannot compare string with number"},
+		{`total and true`, Bool, "column 1: and needs bool operands, got number"},
+		{`not retailer`, Bool, "column 5: not needs bool operands, got string"},
+		{`total + retailer`, Number, "column 9: + needs number operands, got string"},
+		{`total > 1`, Number, "column 1: expression is bool, expected number"},
+		{`1 < total < 5`, Bool, "column 11: comparisons cannot be chained, join them with and"},
+		{`contains(retailer)`, Bool, "column 1: contains takes 2 arguments, got 1"},
+		{`contains(retailer, 1)`, Bool, "column 20: argument 2 of contains must be string, got number"},
+		{`shout(retailer)`, Bool, `column 1: unknown function "shout"`},
+		{`total(1)`, Number, "column 1: total is a field, not a function"},
+		{`lower == "a"`, Bool, "column 1: lower is a function, call it with parentheses"},
+		{`price > 1`, Bool, "column 1: price is a field of an item, use it inside any, all, count or sum"},
+		{`items`, Bool, "column 1: items can only be the first argument of any, all, count or sum"},
+		{`any(retailer, true)`, Bool, "column 5: the first argument of any must be items"},
+		{`sum(items, price > 1)`, Number, "column 18: the second argument of sum must be number, got bool"},
+		{`any(items, any(items, true))`, Bool, "column 12: any cannot be used inside another quantifier"},
+		{`retailer == "Target`, Bool, "column 13: string is not terminated, expected a closing \""},
+		{`retailer == "\x"`, Bool, `column 14: unknown escape \x`},
+		{`total >= 1.`, Bool, `column 10: number "1." needs digits after the decimal point`},
+		{`total & 1`, Bool, `column 7: unexpected character '&'`},
+		{`(total > 1`, Bool, `column 11: unexpected end of expression, expected ")"`},
+		{strings.Repeat("(", MaxDepth) + "true" + strings.Repeat(")", MaxDepth), Bool, "nests more than 32 levels deep"},
+		{strings.Repeat("not ", MaxDepth+1) + "true", Bool, "nests more than 32 levels deep"},
+		{strings.Repeat("1+", MaxLength) + "1", Number, "the most allowed is 1000"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expression, func(t *testing.T) {
+			_, err := compile(test.expression, test.want)
+			if err == nil {
+				t.Fatalf("Expected an error containing %q", test.expectedError)
+			}
+			var exprErr *Error
+			if !errors.As(err, &exprErr) {
+				t.Errorf("Expected an *Error, got %T", err)
+			}
+			if !strings.Contains(err.Error(), test.expectedError) {
+				t.Errorf("Expected an error containing %q, got %q", test.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestEngine_Evaluate(t *testing.T) {
+	engine, err := New([]Rule{
+		{Name: "organic", When: `any(items, contains(lower(description), 'organic')) and total > 20`, Points: "15"},
+		{Name: "pepsi", Description: "2 points per Pepsi", When: `any(items, startsWith(description, "Pepsi"))`, Points: `2 * count(items, startsWith(description, "Pepsi"))`},
+		{Name: "per-dollar", Points: "floor(total)"},
+	})
+	if err != nil {
+		t.Fatalf("Expected the rules to compile, got %v", err)
+	}
+	if engine.Rules() != 3 {
+		t.Fatalf("Expected 3 rules, got %d", engine.Rules())
+	}
+
+	lines, err := engine.Evaluate(loadExample(t, "morning-receipt.json"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []models.PointsLine{
+		{Rule: "custom:pepsi", Points: 2, Description: "2 points per Pepsi"},
+		{Rule: "custom:per-dollar", Points: 2, Description: "floor(total) points"},
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected lines %v, got %v", expected, lines)
+	}
+	for i := range expected {
+		if lines[i] != expected[i] {
+			t.Errorf("Expected line %v, got %v", expected[i], lines[i])
+		}
+	}
+
+	organic := Input{Retailer: "Whole Foods", PurchaseDate: "2022-03-20", PurchaseTime: "10:00", Total: "24.00", Items: []models.Item{{ShortDescription: "Organic Kale", Price: "24.00"}}}
+	lines, err = engine.Evaluate(organic)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(lines) != 2 || lines[0].Rule != "custom:organic" || lines[0].Points != 15 || lines[0].Description != `15 points when any(items, contains(lower(description), 'organic')) and total > 20` {
+		t.Errorf("Expected the organic rule to award 15 points, got %v", lines)
+	}
+}
+
+func TestEngine_EvaluationLimits(t *testing.T) {
+	engine, err := New([]Rule{
+		{Name: "slow", When: `count(items, contains(description, "e")) > 0`, Points: "1", MaxSteps: 5},
+		{Name: "divide", Points: "10 / (itemCount - 2)"},
+		{Name: "negative", Points: "total - 100"},
+		{Name: "fine", Points: "1"},
+	})
+	if err != nil {
+		t.Fatalf("Expected the rules to compile, got %v", err)
+	}
+
+	lines, err := engine.Evaluate(loadExample(t, "morning-receipt.json"))
+	if len(lines) != 1 || lines[0].Rule != "custom:fine" {
+		t.Errorf("Expected only the fine rule to award points, got %v", lines)
+	}
+	if !errors.Is(err, ErrStepLimit) {
+		t.Errorf("Expected ErrStepLimit, got %v", err)
+	}
+	for _, expected := range []string{"expression rule slow: when: evaluation step limit exceeded: more than 5 steps", "expression rule divide: points: division by zero", "expression rule negative: points: -97.35 is not a number of points that can be awarded"} {
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected an error containing %q, got %v", expected, err)
+		}
+	}
+}
+
+func TestNew_RejectsInvalidRules(t *testing.T) {
+	_, err := New([]Rule{
+		{Name: "ok", When: "total > 1", Points: "5"},
+		{Name: "ok", Points: "5"},
+		{Points: "5"},
+		{Name: "typo", When: "totl > 1", Points: "five"},
+		{Name: "no-points", When: "true"},
+		{Name: "limit", Points: "1", MaxSteps: -1},
+	})
+	if err == nil {
+		t.Fatal("Expected the rules to be rejected")
+	}
+
+	for _, expected := range []string{
+		"expression rule 1 (ok): name is used by another rule",
+		"expression rule 2 (): name is required",
+		`expression rule 3 (typo): when: column 1: unknown field "totl"`,
+		`points: column 1: unknown field "five"`,
+		"expression rule 4 (no-points): points is required",
+		"expression rule 5 (limit): maxSteps cannot be negative or more than 1000000",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected an error containing %q, got %v", expected, err)
+		}
+	}
+}
+
+func TestEngine_NilAwardsNothing(t *testing.T) {
+	var engine *Engine
+	if lines, err := engine.Evaluate(Input{}); lines != nil || err != nil {
+		t.Errorf("Expected no lines and no error, got %v, %v", lines, err)
+	}
+}
+
+func TestEngine_Digest(t *testing.T) {
+	rules := []Rule{{Name: "pepsi", When: `any(items, contains(lower(description), "pepsi"))`, Points: "15"}}
+	first, _ := New(rules)
+	second, _ := New(rules)
+	if first.Digest() == "" || first.Digest() != second.Digest() {
+		t.Errorf("Expected the same rules to have the same digest, got %q and %q", first.Digest(), second.Digest())
+	}
+
+	rules[0].Points = "20"
+	if edited, _ := New(rules); edited.Digest() == first.Digest() {
+		t.Errorf("Expected an edited rule to change the digest")
+	}
+	if empty, _ := New(nil); empty.Digest() != "" {
+		t.Errorf("Expected an engine without rules to have no digest, got %q", empty.Digest())
+	}
+}
@@ -0,0 +1,143 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenIdent
+	tokenOperator
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	// value is the number or the unquoted string of a literal
+	value any
+	// column counts characters from 1
+	column int
+}
+
+func (t token) String() string {
+	if t.kind == tokenEOF {
+		return "end of expression"
+	}
+	return strconv.Quote(t.text)
+}
+
+// operators are matched longest first
+var operators = []string{"==", "!=", "<=", ">=", "<", ">", "+", "-", "*", "/", "%", "(", ")", ","}
+
+// lex splits an expression into tokens, ending with a tokenEOF.
+func lex(source string) ([]token, error) {
+	runes := []rune(source)
+	var tokens []token
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		column := i + 1
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsDigit(r):
+			start := i
+			for i < len(runes) && unicode.IsDigit(runes[i]) {
+				i++
+			}
+			if i < len(runes) && runes[i] == '.' {
+				i++
+				if i >= len(runes) || !unicode.IsDigit(runes[i]) {
+					return nil, errorAt(column, "number %q needs digits after the decimal point", string(runes[start:i]))
+				}
+				for i < len(runes) && unicode.IsDigit(runes[i]) {
+					i++
+				}
+			}
+			text := string(runes[start:i])
+			value, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return nil, errorAt(column, "bad number %q", text)
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: text, value: value, column: column})
+		case r == '"' || r == '\'':
+			value, end, err := lexString(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokenString, text: string(runes[i:end]), value: value, column: column})
+			i = end
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: string(runes[start:i]), column: column})
+		default:
+			operator := ""
+			for _, op := range operators {
+				if strings.HasPrefix(string(runes[i:min(i+2, len(runes))]), op) {
+					operator = op
+					break
+				}
+			}
+			if operator == "" {
+				return nil, errorAt(column, "unexpected character %q", r)
+			}
+			tokens = append(tokens, token{kind: tokenOperator, text: operator, column: column})
+			i += len(operator)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, column: len(runes) + 1}), nil
+}
+
+// lexString reads a string quoted with either ' or " starting at runes[start]. A backslash
+// escapes the next character, and \n and \t stand for a newline and a tab.
+func lexString(runes []rune, start int) (string, int, error) {
+	quote := runes[start]
+	var value strings.Builder
+	for i := start + 1; i < len(runes); i++ {
+		switch r := runes[i]; r {
+		case quote:
+			return value.String(), i + 1, nil
+		case '\\':
+			i++
+			if i >= len(runes) {
+				break
+			}
+			switch escaped := runes[i]; escaped {
+			case 'n':
+				value.WriteRune('\n')
+			case 't':
+				value.WriteRune('\t')
+			case '\\', '"', '\'':
+				value.WriteRune(escaped)
+			default:
+				return "", 0, errorAt(i, "unknown escape \\%c", escaped)
+			}
+		default:
+			value.WriteRune(r)
+		}
+	}
+	return "", 0, errorAt(start+1, "string is not terminated, expected a closing %c", quote)
+}
+
+// Error is a problem found compiling an expression, at a column counted in characters from 1.
+type Error struct {
+	Column  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("column %d: %s", e.Column, e.Message)
+}
+
+func errorAt(column int, format string, args ...any) *Error {
+	return &Error{Column: column, Message: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,297 @@
+package expr
+
+import "slices"
+
+// MaxLength is the longest expression, in characters, that compiles
+const MaxLength = 1000
+
+// MaxDepth is how deeply operators and calls may nest in an expression
+const MaxDepth = 32
+
+// node is an expression as parsed, before its types are checked
+type node interface {
+	column() int
+}
+
+type literal struct {
+	at    int
+	value any
+}
+
+type identifier struct {
+	at   int
+	name string
+}
+
+type unary struct {
+	at      int
+	op      string
+	operand node
+}
+
+type binary struct {
+	at          int
+	op          string
+	left, right node
+}
+
+type call struct {
+	at   int
+	name string
+	args []node
+}
+
+func (n literal) column() int    { return n.at }
+func (n identifier) column() int { return n.at }
+func (n unary) column() int      { return n.at }
+func (n binary) column() int     { return n.at }
+func (n call) column() int       { return n.at }
+
+var comparisons = []string{"==", "!=", "<", "<=", ">", ">="}
+
+// parser reads an expression by recursive descent. From loosest to tightest the operators
+// bind as: or, and, not, comparisons, + and -, then *, / and %, then unary minus.
+type parser struct {
+	tokens []token
+	next   int
+	depth  int
+}
+
+func parse(source string) (node, error) {
+	if length := len([]rune(source)); length > MaxLength {
+		return nil, errorAt(MaxLength+1, "expression is %d characters long, the most allowed is %d", length, MaxLength)
+	}
+
+	tokens, err := lex(source)
+	if err != nil {
+		return nil, err
+	}
+	if tokens[0].kind == tokenEOF {
+		return nil, errorAt(1, "expression is empty")
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, errorAt(t.column, "unexpected %s, expected an operator or the end of the expression", t)
+	}
+	return root, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) advance() token {
+	t := p.tokens[p.next]
+	if t.kind != tokenEOF {
+		p.next++
+	}
+	return t
+}
+
+// accept consumes the next token if it is one of the operators or keywords given
+func (p *parser) accept(texts ...string) (token, bool) {
+	t := p.peek()
+	if (t.kind == tokenOperator || t.kind == tokenIdent) && slices.Contains(texts, t.text) {
+		return p.advance(), true
+	}
+	return t, false
+}
+
+func (p *parser) expect(text string) error {
+	if t, ok := p.accept(text); !ok {
+		return errorAt(t.column, "unexpected %s, expected %q", t, text)
+	}
+	return nil
+}
+
+// nest guards each level of recursion so that a deeply nested expression fails to compile
+// rather than exhausting the stack
+func (p *parser) nest(column int) error {
+	p.depth++
+	if p.depth > MaxDepth {
+		return errorAt(column, "expression nests more than %d levels deep", MaxDepth)
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	if err := p.nest(p.peek().column); err != nil {
+		return nil, err
+	}
+	defer func() { p.depth-- }()
+
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("or")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = binary{at: op.column, op: op.text, left: left, right: right}
+	}
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("and")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = binary{at: op.column, op: op.text, left: left, right: right}
+	}
+}
+
+func (p *parser) parseNot() (node, error) {
+	op, ok := p.accept("not")
+	if !ok {
+		return p.parseComparison()
+	}
+	if err := p.nest(op.column); err != nil {
+		return nil, err
+	}
+	defer func() { p.depth-- }()
+
+	operand, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	return unary{at: op.column, op: op.text, operand: operand}, nil
+}
+
+// parseComparison reads at most one comparison, since a < b < c is more likely a mistake
+// than a comparison of a bool with c
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := p.accept(comparisons...)
+	if !ok {
+		return left, nil
+	}
+	right, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := p.accept(comparisons...); ok {
+		return nil, errorAt(t.column, "comparisons cannot be chained, join them with and")
+	}
+	return binary{at: op.column, op: op.text, left: left, right: right}, nil
+}
+
+func (p *parser) parseAdditive() (node, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("+", "-")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = binary{at: op.column, op: op.text, left: left, right: right}
+	}
+}
+
+func (p *parser) parseMultiplicative() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("*", "/", "%")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = binary{at: op.column, op: op.text, left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	op, ok := p.accept("-")
+	if !ok {
+		return p.parsePrimary()
+	}
+	if err := p.nest(op.column); err != nil {
+		return nil, err
+	}
+	defer func() { p.depth-- }()
+
+	operand, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return unary{at: op.column, op: op.text, operand: operand}, nil
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.advance()
+	switch t.kind {
+	case tokenNumber, tokenString:
+		return literal{at: t.column, value: t.value}, nil
+	case tokenIdent:
+		switch t.text {
+		case "true", "false":
+			return literal{at: t.column, value: t.text == "true"}, nil
+		case "and", "or", "not":
+			return nil, errorAt(t.column, "unexpected %s, expected a value", t)
+		}
+		if _, ok := p.accept("("); ok {
+			return p.parseCall(t)
+		}
+		return identifier{at: t.column, name: t.text}, nil
+	case tokenOperator:
+		if t.text == "(" {
+			inner, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return inner, p.expect(")")
+		}
+	}
+	return nil, errorAt(t.column, "unexpected %s, expected a value", t)
+}
+
+func (p *parser) parseCall(name token) (node, error) {
+	fn := call{at: name.column, name: name.text}
+	if _, ok := p.accept(")"); ok {
+		return fn, nil
+	}
+	for {
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		fn.args = append(fn.args, arg)
+		if _, ok := p.accept(","); !ok {
+			return fn, p.expect(")")
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package fraud
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+)
+
+// DefaultReviewThreshold is the weighted score at or above which a receipt is flagged for review
+const DefaultReviewThreshold = 1.0
+
+// Result is a signal's opinion of a receipt: a score between 0 (benign) and 1 (certainly fraudulent)
+// and a human readable explanation of how it got there.
+type Result struct {
+	Score  float64
+	Reason string
+}
+
+// Signal is a single, independently weighted indicator of fraud.
+// history holds the receipts previously submitted by the same client.
+type Signal interface {
+	Name() string
+	Weight() float64
+	Evaluate(receipt models.Receipt, history []models.Receipt) Result
+}
+
+// Engine combines signals into a single explainable risk score.
+type Engine struct {
+	signals         []Signal
+	reviewThreshold float64
+}
+
+func NewEngine(reviewThreshold float64, signals ...Signal) *Engine {
+	return &Engine{signals: signals, reviewThreshold: reviewThreshold}
+}
+
+// DefaultEngine uses every built-in signal with its default configuration.
+// The retailer allowlist is left empty, which disables that signal.
+func DefaultEngine() *Engine {
+	return NewEngine(DefaultReviewThreshold,
+		DefaultVelocitySignal(),
+		DefaultRoundTotalSignal(),
+		DefaultItemSumMismatchSignal(),
+		DefaultFuturePurchaseSignal(),
+		&RetailerAllowlistSignal{SignalWeight: 0.5},
+	)
+}
+
+// Assess scores a receipt against every signal. The total score is the sum of each signal's
+// score multiplied by its weight.
+func (e *Engine) Assess(receipt models.Receipt, history []models.Receipt) models.FraudAssessment {
+	assessment := models.FraudAssessment{Threshold: e.reviewThreshold, Signals: []models.FraudSignal{}}
+
+	for _, signal := range e.signals {
+		result := signal.Evaluate(receipt, history)
+		score := math.Max(0, math.Min(1, result.Score))
+
+		assessment.Score += score * signal.Weight()
+		assessment.Signals = append(assessment.Signals, models.FraudSignal{
+			Name:   signal.Name(),
+			Weight: signal.Weight(),
+			Score:  score,
+			Reason: result.Reason,
+		})
+	}
+
+	assessment.Score = math.Round(assessment.Score*1000) / 1000
+	assessment.Flagged = e.reviewThreshold > 0 && assessment.Score >= e.reviewThreshold
+	return assessment
+}
+
+// Explain summarises the signals that contributed to a flagged assessment.
+func Explain(assessment models.FraudAssessment) string {
+	var reasons []string
+	for _, signal := range assessment.Signals {
+		if signal.Score > 0 {
+			reasons = append(reasons, fmt.Sprintf("%s: %s", signal.Name, signal.Reason))
+		}
+	}
+
+	return fmt.Sprintf("fraud score %.2f reached threshold %.2f (%s)", assessment.Score, assessment.Threshold, strings.Join(reasons, "; "))
+}
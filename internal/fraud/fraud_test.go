@@ -0,0 +1,84 @@
+package fraud
+
+import (
+	"testing"
+	"time"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+)
+
+var submittedAt = time.Date(2022, 3, 20, 15, 0, 0, 0, time.UTC)
+
+func gatoradeReceipt(total string) models.Receipt {
+	return models.Receipt{
+		Retailer:     "M&M Corner Market",
+		PurchaseDate: "2022-03-20",
+		PurchaseTime: "14:33",
+		Total:        total,
+		Items:        []models.Item{{ShortDescription: "Gatorade", Price: "2.25"}, {ShortDescription: "Gatorade", Price: "2.25"}},
+		SubmittedAt:  submittedAt,
+	}
+}
+
+func TestSignals(t *testing.T) {
+	history := make([]models.Receipt, 9)
+	for i := range history {
+		history[i] = gatoradeReceipt("4.00")
+		history[i].SubmittedAt = submittedAt.Add(-time.Duration(i) * time.Minute)
+	}
+
+	futureReceipt := gatoradeReceipt("4.50")
+	futureReceipt.PurchaseDate = "2022-03-25"
+
+	tests := []struct {
+		name          string
+		signal        Signal
+		receipt       models.Receipt
+		history       []models.Receipt
+		expectedScore float64
+	}{
+		{"Velocity Under Limit", &VelocitySignal{Window: time.Hour, MaxReceipts: 20, Now: func() time.Time { return submittedAt }}, gatoradeReceipt("4.50"), history, 0.5},
+		{"Velocity Outside Window", &VelocitySignal{Window: time.Second, MaxReceipts: 2, Now: func() time.Time { return submittedAt.Add(time.Hour) }}, gatoradeReceipt("4.50"), history, 0.5},
+		{"Round Totals Too Few Receipts", DefaultRoundTotalSignal(), gatoradeReceipt("4.00"), nil, 0},
+		{"Round Totals Every Receipt", DefaultRoundTotalSignal(), gatoradeReceipt("4.00"), history, 1},
+		{"Item Sum Matches", DefaultItemSumMismatchSignal(), gatoradeReceipt("4.50"), nil, 0},
+		{"Item Sum Mismatch", DefaultItemSumMismatchSignal(), gatoradeReceipt("9.00"), nil, 1},
+		{"Purchase Before Submission", DefaultFuturePurchaseSignal(), gatoradeReceipt("4.50"), nil, 0},
+		{"Purchase After Submission", DefaultFuturePurchaseSignal(), futureReceipt, nil, 1},
+		{"Allowlist Disabled", &RetailerAllowlistSignal{}, gatoradeReceipt("4.50"), nil, 0},
+		{"Allowed Retailer", &RetailerAllowlistSignal{Allowed: []string{"m&m  corner market"}}, gatoradeReceipt("4.50"), nil, 0},
+		{"Unknown Retailer", &RetailerAllowlistSignal{Allowed: []string{"Target"}}, gatoradeReceipt("4.50"), nil, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := test.signal.Evaluate(test.receipt, test.history)
+			if result.Score != test.expectedScore {
+				t.Errorf("Expected score %v, got %v (%s)", test.expectedScore, result.Score, result.Reason)
+			}
+			if result.Reason == "" {
+				t.Errorf("Expected every result to explain itself")
+			}
+		})
+	}
+}
+
+func TestEngine_Assess(t *testing.T) {
+	engine := NewEngine(1,
+		DefaultItemSumMismatchSignal(),
+		&RetailerAllowlistSignal{Allowed: []string{"Target"}, SignalWeight: 0.5},
+	)
+
+	assessment := engine.Assess(gatoradeReceipt("4.50"), nil)
+	if assessment.Score != 0.5 || assessment.Flagged {
+		t.Errorf("Expected an unflagged score of 0.5, got %+v", assessment)
+	}
+
+	assessment = engine.Assess(gatoradeReceipt("9.00"), nil)
+	if assessment.Score != 1 || !assessment.Flagged {
+		t.Errorf("Expected a flagged score of 1, got %+v", assessment)
+	}
+	if len(assessment.Signals) != 2 {
+		t.Errorf("Expected every signal to be reported, got %+v", assessment.Signals)
+	}
+}
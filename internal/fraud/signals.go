@@ -0,0 +1,202 @@
+package fraud
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+)
+
+// VelocitySignal fires when a single client submits many receipts in a short window.
+type VelocitySignal struct {
+	Window       time.Duration
+	MaxReceipts  int
+	SignalWeight float64
+	Now          func() time.Time
+}
+
+func DefaultVelocitySignal() *VelocitySignal {
+	return &VelocitySignal{Window: time.Hour, MaxReceipts: 20, SignalWeight: 1}
+}
+
+func (s *VelocitySignal) Name() string    { return "velocity" }
+func (s *VelocitySignal) Weight() float64 { return s.SignalWeight }
+
+// Evaluate scores linearly up to MaxReceipts submissions in the window, including this one.
+func (s *VelocitySignal) Evaluate(receipt models.Receipt, history []models.Receipt) Result {
+	if s.MaxReceipts <= 0 {
+		return Result{Reason: "disabled"}
+	}
+
+	now := time.Now()
+	if s.Now != nil {
+		now = s.Now()
+	}
+
+	recent := 1
+	for _, previous := range history {
+		if now.Sub(previous.SubmittedAt) <= s.Window {
+			recent++
+		}
+	}
+
+	return Result{
+		Score:  float64(recent) / float64(s.MaxReceipts),
+		Reason: fmt.Sprintf("%d receipt(s) from client in the last %s (limit %d)", recent, s.Window, s.MaxReceipts),
+	}
+}
+
+// RoundTotalSignal fires when a client's receipts end in .00 far more often than real purchases do,
+// a common way of gaming the round dollar rule.
+type RoundTotalSignal struct {
+	MinReceipts  int
+	MaxRatio     float64
+	SignalWeight float64
+}
+
+func DefaultRoundTotalSignal() *RoundTotalSignal {
+	return &RoundTotalSignal{MinReceipts: 5, MaxRatio: 0.5, SignalWeight: 0.75}
+}
+
+func (s *RoundTotalSignal) Name() string    { return "round_total_frequency" }
+func (s *RoundTotalSignal) Weight() float64 { return s.SignalWeight }
+
+// Evaluate scores the share of round totals above MaxRatio, once the client has MinReceipts receipts.
+func (s *RoundTotalSignal) Evaluate(receipt models.Receipt, history []models.Receipt) Result {
+	receipts := append([]models.Receipt{receipt}, history...)
+	if len(receipts) < s.MinReceipts {
+		return Result{Reason: fmt.Sprintf("only %d receipt(s) from client, need %d", len(receipts), s.MinReceipts)}
+	}
+
+	round := 0
+	for _, r := range receipts {
+		if strings.HasSuffix(r.Total, ".00") {
+			round++
+		}
+	}
+	ratio := float64(round) / float64(len(receipts))
+
+	score := 0.0
+	if ratio > s.MaxRatio && s.MaxRatio < 1 {
+		score = (ratio - s.MaxRatio) / (1 - s.MaxRatio)
+	}
+
+	return Result{
+		Score:  score,
+		Reason: fmt.Sprintf("%d of %d receipt(s) have round totals (limit %.0f%%)", round, len(receipts), s.MaxRatio*100),
+	}
+}
+
+// ItemSumMismatchSignal fires when the item prices do not add up to the receipt total.
+type ItemSumMismatchSignal struct {
+	ToleranceCents int64
+	SignalWeight   float64
+}
+
+func DefaultItemSumMismatchSignal() *ItemSumMismatchSignal {
+	return &ItemSumMismatchSignal{ToleranceCents: 0, SignalWeight: 0.5}
+}
+
+func (s *ItemSumMismatchSignal) Name() string    { return "item_sum_mismatch" }
+func (s *ItemSumMismatchSignal) Weight() float64 { return s.SignalWeight }
+
+// Evaluate flags any difference beyond ToleranceCents. Taxes and discounts legitimately cause small
+// differences, so deployments that see them should raise the tolerance.
+func (s *ItemSumMismatchSignal) Evaluate(receipt models.Receipt, history []models.Receipt) Result {
+	total, ok := cents(receipt.Total)
+	if !ok {
+		return Result{Score: 1, Reason: fmt.Sprintf("total %q is not a number", receipt.Total)}
+	}
+
+	var sum int64
+	for _, item := range receipt.Items {
+		price, ok := cents(item.Price)
+		if !ok {
+			return Result{Score: 1, Reason: fmt.Sprintf("price %q is not a number", item.Price)}
+		}
+		sum += price
+	}
+
+	difference := total - sum
+	if difference < 0 {
+		difference = -difference
+	}
+	if difference <= s.ToleranceCents {
+		return Result{Reason: "item prices add up to the total"}
+	}
+
+	return Result{Score: 1, Reason: fmt.Sprintf("item prices add up to %.2f but total is %s", float64(sum)/100, receipt.Total)}
+}
+
+// FuturePurchaseSignal fires when the purchase happened after the receipt was submitted.
+type FuturePurchaseSignal struct {
+	Grace        time.Duration
+	SignalWeight float64
+}
+
+func DefaultFuturePurchaseSignal() *FuturePurchaseSignal {
+	// A day of grace covers every time zone the stores are in
+	return &FuturePurchaseSignal{Grace: 24 * time.Hour, SignalWeight: 1}
+}
+
+func (s *FuturePurchaseSignal) Name() string    { return "future_purchase" }
+func (s *FuturePurchaseSignal) Weight() float64 { return s.SignalWeight }
+
+func (s *FuturePurchaseSignal) Evaluate(receipt models.Receipt, history []models.Receipt) Result {
+	// Without the store's time zone the purchase time is read as UTC, which the grace allows for
+	purchasedAt := receipt.PurchasedAt
+	if purchasedAt.IsZero() {
+		var err error
+		purchasedAt, err = time.Parse("2006-01-02 15:04", receipt.PurchaseDate+" "+receipt.PurchaseTime)
+		if err != nil {
+			return Result{Score: 1, Reason: fmt.Sprintf("purchase time %s %s cannot be parsed", receipt.PurchaseDate, receipt.PurchaseTime)}
+		}
+	}
+
+	if purchasedAt.After(receipt.SubmittedAt.Add(s.Grace)) {
+		return Result{Score: 1, Reason: fmt.Sprintf("purchased at %s, after it was submitted", purchasedAt.UTC().Format("2006-01-02 15:04"))}
+	}
+
+	return Result{Reason: "purchased before it was submitted"}
+}
+
+// RetailerAllowlistSignal fires when the retailer is not one we know about.
+// An empty allowlist disables the signal.
+type RetailerAllowlistSignal struct {
+	Allowed      []string
+	SignalWeight float64
+}
+
+func (s *RetailerAllowlistSignal) Name() string    { return "retailer_allowlist" }
+func (s *RetailerAllowlistSignal) Weight() float64 { return s.SignalWeight }
+
+func (s *RetailerAllowlistSignal) Evaluate(receipt models.Receipt, history []models.Receipt) Result {
+	if len(s.Allowed) == 0 {
+		return Result{Reason: "no allowlist configured"}
+	}
+
+	retailer := normalizeRetailer(receipt.Retailer)
+	for _, allowed := range s.Allowed {
+		if normalizeRetailer(allowed) == retailer {
+			return Result{Reason: fmt.Sprintf("%q is an allowed retailer", receipt.Retailer)}
+		}
+	}
+
+	return Result{Score: 1, Reason: fmt.Sprintf("%q is not an allowed retailer", receipt.Retailer)}
+}
+
+func normalizeRetailer(retailer string) string {
+	return strings.Join(strings.Fields(strings.ToLower(retailer)), " ")
+}
+
+func cents(amount string) (int64, bool) {
+	value, err := strconv.ParseFloat(amount, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return int64(math.Round(value * 100)), true
+}
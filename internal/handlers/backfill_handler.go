@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/logging"
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+	"github.com/javier-tello/receipt-processor-challenge/internal/services"
+	"github.com/javier-tello/receipt-processor-challenge/internal/validation"
+)
+
+// Pages of backfill results hold DefaultResultsLimit results unless the request asks for up to
+// MaxResultsLimit
+const (
+	DefaultResultsLimit = 100
+	MaxResultsLimit     = 1000
+)
+
+type BackfillHandler struct {
+	BackfillService *services.BackfillService
+	Validator       validation.ReceiptValidator
+	logger          *slog.Logger
+}
+
+func NewBackfillHandler(backfillService *services.BackfillService, validator validation.ReceiptValidator, logger *slog.Logger) *BackfillHandler {
+	return &BackfillHandler{
+		BackfillService: backfillService,
+		Validator:       validator,
+		logger:          logging.OrDefault(logger),
+	}
+}
+
+func (h *BackfillHandler) GetBackfills(w http.ResponseWriter, r *http.Request) {
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"backfills": h.BackfillService.GetBackfills()})
+}
+
+// StartBackfill selects the receipts to re-score and queues the job. The worker re-scores them
+// in the background, so the response only says how many were selected.
+func (h *BackfillHandler) StartBackfill(w http.ResponseWriter, r *http.Request) {
+	var request models.BackfillRequest
+	if err := decodeJSON(r, &request); err != nil {
+		h.logger.WarnContext(r.Context(), "Failed to decode backfill JSON", "error", err)
+		http.Error(w, decodeErrorMessage(err, "The backfill request is invalid."), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Validator.ValidateBackfillRequest(request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	job, err := h.BackfillService.StartBackfill(r.Context(), request)
+	if err != nil {
+		h.writeBackfillError(w, r, "", err)
+		return
+	}
+
+	jsonResponse(w, http.StatusAccepted, job)
+}
+
+// GetBackfill reports the status and progress of a backfill.
+func (h *BackfillHandler) GetBackfill(w http.ResponseWriter, r *http.Request) {
+	backfillID := mux.Vars(r)["id"]
+
+	if err := h.Validator.ValidateBackfillID(backfillID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	job, err := h.BackfillService.GetBackfill(backfillID)
+	if err != nil {
+		h.writeBackfillError(w, r, backfillID, err)
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, job)
+}
+
+// GetBackfillResults lists a page of the points before and after of the receipts a backfill
+// re-scored. A full page gives the offset of the next one.
+func (h *BackfillHandler) GetBackfillResults(w http.ResponseWriter, r *http.Request) {
+	backfillID := mux.Vars(r)["id"]
+
+	if err := h.Validator.ValidateBackfillID(backfillID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	offset, limit, err := resultsPage(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	results, err := h.BackfillService.GetBackfillResults(backfillID, offset, limit)
+	if err != nil {
+		h.writeBackfillError(w, r, backfillID, err)
+		return
+	}
+
+	response := map[string]interface{}{"results": results}
+	if len(results) == limit {
+		response["nextOffset"] = offset + limit
+	}
+	jsonResponse(w, http.StatusOK, response)
+}
+
+// resultsPage reads the offset and limit of a page of backfill results, limit defaulting to
+// DefaultResultsLimit and at most MaxResultsLimit.
+func resultsPage(r *http.Request) (offset int, limit int, err error) {
+	query := r.URL.Query()
+	limit = DefaultResultsLimit
+
+	if value := query.Get("offset"); value != "" {
+		if offset, err = strconv.Atoi(value); err != nil || offset < 0 {
+			return 0, 0, errors.New("The request is invalid, offset must be a whole number.")
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > MaxResultsLimit {
+			return 0, 0, fmt.Errorf("The request is invalid, limit must be between 1 and %d.", MaxResultsLimit)
+		}
+	}
+	return offset, limit, nil
+}
+
+func (h *BackfillHandler) PauseBackfill(w http.ResponseWriter, r *http.Request) {
+	h.changeBackfill(w, r, h.BackfillService.PauseBackfill)
+}
+
+func (h *BackfillHandler) ResumeBackfill(w http.ResponseWriter, r *http.Request) {
+	h.changeBackfill(w, r, h.BackfillService.ResumeBackfill)
+}
+
+func (h *BackfillHandler) changeBackfill(w http.ResponseWriter, r *http.Request, change func(string) (models.BackfillJob, error)) {
+	backfillID := mux.Vars(r)["id"]
+
+	if err := h.Validator.ValidateBackfillID(backfillID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	job, err := change(backfillID)
+	if err != nil {
+		h.writeBackfillError(w, r, backfillID, err)
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, job)
+}
+
+// writeBackfillError maps errors returned by the backfill service onto HTTP responses.
+func (h *BackfillHandler) writeBackfillError(w http.ResponseWriter, r *http.Request, id string, err error) {
+	switch {
+	case errors.Is(err, services.ErrBackfillNotFound):
+		h.logger.InfoContext(r.Context(), "Backfill not found", "id", id, "error", err)
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, services.ErrUnknownRuleVersion):
+		http.Error(w, "The backfill request is invalid, "+err.Error()+".", http.StatusBadRequest)
+	case errors.Is(err, services.ErrBackfillNotRunning), errors.Is(err, services.ErrBackfillCompleted):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		h.logger.ErrorContext(r.Context(), "Failed to update backfill", "id", id, "error", err)
+		http.Error(w, "Unable to update backfill", http.StatusInternalServerError)
+	}
+}
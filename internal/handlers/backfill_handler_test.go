@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+	"github.com/javier-tello/receipt-processor-challenge/internal/repositories"
+	"github.com/javier-tello/receipt-processor-challenge/internal/services"
+	"github.com/javier-tello/receipt-processor-challenge/internal/validation"
+)
+
+// Helper to configure the backfill admin router around a store holding one receipt scored under
+// the first rule version
+func setupBackfillRouter(t *testing.T) (*mux.Router, *services.BackfillService) {
+	t.Helper()
+	repo := repositories.NewInMemoryReceiptRepo(nil, nil)
+	if _, err := repo.ProcessReceipt(context.Background(), models.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-02",
+		PurchaseTime: "16:30",
+		Total:        "1.01",
+		Items:        []models.Item{{ShortDescription: "Pepsi", Price: "1.01"}},
+		Status:       models.StatusApproved,
+	}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	service := services.NewBackfillService(services.NewReceiptService(repo), repositories.NewInMemoryBackfillRepo(nil), nil)
+	handler := NewBackfillHandler(service, validation.ReceiptValidator{}, nil)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/admin/backfills", handler.GetBackfills).Methods("GET")
+	router.HandleFunc("/admin/backfills", handler.StartBackfill).Methods("POST")
+	router.HandleFunc("/admin/backfills/{id}", handler.GetBackfill).Methods("GET")
+	router.HandleFunc("/admin/backfills/{id}/results", handler.GetBackfillResults).Methods("GET")
+	router.HandleFunc("/admin/backfills/{id}/pause", handler.PauseBackfill).Methods("POST")
+	router.HandleFunc("/admin/backfills/{id}/resume", handler.ResumeBackfill).Methods("POST")
+
+	return router, service
+}
+
+func TestBackfillHandler_Backfill(t *testing.T) {
+	router, service := setupBackfillRouter(t)
+
+	payload := `{"ruleVersion": "v2", "filter": {"from": "2022-01-01", "retailer": "target"}, "reason": "time window fix", "actor": "ops-1"}`
+	req := httptest.NewRequest(http.MethodPost, "/admin/backfills", bytes.NewBuffer([]byte(payload)))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusAccepted, rec.Code, rec.Body.String())
+	}
+	var started models.BackfillJob
+	if err := json.Unmarshal(rec.Body.Bytes(), &started); err != nil {
+		t.Fatalf("Failed to parse actual JSON: %v", err)
+	}
+	if started.Status != models.BackfillRunning || started.Total != 1 || started.Processed != 0 {
+		t.Errorf("Expected a running job over 1 receipt, got %+v", started)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/admin/backfills/"+started.ID+"/pause", nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"status":"paused"`) {
+		t.Errorf("Expected the job to be paused, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/admin/backfills/"+started.ID+"/pause", nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected status %d pausing a paused job, got %d", http.StatusConflict, rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/admin/backfills/"+started.ID+"/resume", nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d resuming the job, got %d", http.StatusOK, rec.Code)
+	}
+	service.ProcessDue(context.Background())
+
+	req = httptest.NewRequest(http.MethodGet, "/admin/backfills/"+started.ID, nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	var job models.BackfillJob
+	if err := json.Unmarshal(rec.Body.Bytes(), &job); err != nil {
+		t.Fatalf("Failed to parse actual JSON: %v", err)
+	}
+	if job.Status != models.BackfillCompleted || job.Processed != 1 || job.Changed != 1 || job.PointsDelta != -10 {
+		t.Errorf("Expected a completed job taking back 10 points, got %+v", job)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/admin/backfills/"+started.ID+"/results", nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	var results struct {
+		Results []models.BackfillResult `json:"results"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil {
+		t.Fatalf("Failed to parse actual JSON: %v", err)
+	}
+	if len(results.Results) != 1 || results.Results[0].PointsBefore != 16 || results.Results[0].PointsAfter != 6 || results.Results[0].AdjustmentID == "" {
+		t.Errorf("Expected the receipt to drop from 16 to 6 points with an adjustment, got %+v", results.Results)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/admin/backfills/"+started.ID+"/results?offset=0&limit=1", nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"nextOffset":1`) {
+		t.Errorf("Expected a full page to give the next offset, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/admin/backfills", nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), started.ID) {
+		t.Errorf("Expected the job to be listed, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestBackfillHandler_Errors(t *testing.T) {
+	router, _ := setupBackfillRouter(t)
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		payload        string
+		expectedStatus int
+	}{
+		{"Missing Reason", http.MethodPost, "/admin/backfills", `{"ruleVersion": "v2", "actor": "ops-1"}`, http.StatusBadRequest},
+		{"Unknown Field", http.MethodPost, "/admin/backfills", `{"ruleVersion": "v2", "reason": "fix", "actor": "ops-1", "dryRun": true}`, http.StatusBadRequest},
+		{"Unknown Rule Version", http.MethodPost, "/admin/backfills", `{"ruleVersion": "v9", "reason": "fix", "actor": "ops-1"}`, http.StatusBadRequest},
+		{"Missing Job", http.MethodGet, "/admin/backfills/non-existent-id", "", http.StatusNotFound},
+		{"Missing Job Results", http.MethodGet, "/admin/backfills/non-existent-id/results", "", http.StatusNotFound},
+		{"Negative Results Offset", http.MethodGet, "/admin/backfills/non-existent-id/results?offset=-1", "", http.StatusBadRequest},
+		{"Results Limit Too High", http.MethodGet, "/admin/backfills/non-existent-id/results?limit=1001", "", http.StatusBadRequest},
+		{"Resume Missing Job", http.MethodPost, "/admin/backfills/non-existent-id/resume", "", http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, test.path, bytes.NewBuffer([]byte(test.payload)))
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != test.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", test.expectedStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/config"
+)
+
+type ConfigHandler struct {
+	Config config.Config
+}
+
+func NewConfigHandler(cfg config.Config) *ConfigHandler {
+	return &ConfigHandler{Config: cfg}
+}
+
+// GetConfig reports the configuration the server started with. Secrets are redacted.
+func (h *ConfigHandler) GetConfig(w http.ResponseWriter, r *http.Request) {
+	jsonResponse(w, http.StatusOK, h.Config.Redacted())
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/config"
+)
+
+func TestConfigHandler_GetConfig(t *testing.T) {
+	cfg := config.Default()
+	cfg.StorageDSN = "postgres://receipts:hunter2@db:5432/receipts"
+	handler := NewConfigHandler(cfg)
+
+	rec := httptest.NewRecorder()
+	handler.GetConfig(rec, httptest.NewRequest(http.MethodGet, "/admin/config", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var effective map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &effective); err != nil {
+		t.Fatalf("Failed to parse response JSON: %v", err)
+	}
+	if effective["listenAddr"] != ":3000" {
+		t.Errorf("Expected listenAddr ':3000', got '%s'", effective["listenAddr"])
+	}
+	if effective["storageDSN"] != "postgres://receipts:REDACTED@db:5432/receipts" {
+		t.Errorf("Expected the DSN password to be redacted, got '%s'", effective["storageDSN"])
+	}
+}
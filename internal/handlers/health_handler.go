@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/logging"
+)
+
+// DefaultReadinessTimeout bounds how long all readiness checks may take together.
+const DefaultReadinessTimeout = 2 * time.Second
+
+// ReadinessCheck reports whether a dependency is able to serve requests.
+type ReadinessCheck func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check ReadinessCheck
+}
+
+// HealthHandler answers the orchestrator's liveness and readiness probes.
+type HealthHandler struct {
+	Timeout  time.Duration
+	mu       sync.RWMutex
+	checks   []namedCheck
+	draining atomic.Bool
+	logger   *slog.Logger
+}
+
+func NewHealthHandler(logger *slog.Logger) *HealthHandler {
+	return &HealthHandler{
+		Timeout: DefaultReadinessTimeout,
+		logger:  logging.OrDefault(logger),
+	}
+}
+
+// AddCheck registers a dependency that must be healthy before the server reports ready.
+func (h *HealthHandler) AddCheck(name string, check ReadinessCheck) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.checks = append(h.checks, namedCheck{name: name, check: check})
+}
+
+// Drain makes the server report not ready, so no new traffic is routed to it while it shuts down.
+func (h *HealthHandler) Drain() {
+	h.draining.Store(true)
+}
+
+// Liveness reports that the process is up and able to answer HTTP requests.
+func (h *HealthHandler) Liveness(w http.ResponseWriter, r *http.Request) {
+	jsonResponse(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// Readiness runs every registered check and reports 503 if any fails or the server is draining.
+func (h *HealthHandler) Readiness(w http.ResponseWriter, r *http.Request) {
+	if h.draining.Load() {
+		jsonResponse(w, http.StatusServiceUnavailable, map[string]interface{}{"status": "draining", "checks": map[string]string{}})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.Timeout)
+	defer cancel()
+
+	h.mu.RLock()
+	checks := make([]namedCheck, len(h.checks))
+	copy(checks, h.checks)
+	h.mu.RUnlock()
+
+	status, code := "ready", http.StatusOK
+	results := make(map[string]string, len(checks))
+	for _, check := range checks {
+		if err := check.check(ctx); err != nil {
+			h.logger.WarnContext(r.Context(), "Readiness check failed", "check", check.name, "error", err)
+			results[check.name] = err.Error()
+			status, code = "unavailable", http.StatusServiceUnavailable
+			continue
+		}
+		results[check.name] = "ok"
+	}
+
+	jsonResponse(w, code, map[string]interface{}{"status": status, "checks": results})
+}
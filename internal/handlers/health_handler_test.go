@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/repositories"
+)
+
+type readinessResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+func getReadiness(t *testing.T, handler *HealthHandler) (int, readinessResponse) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	handler.Readiness(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	var response readinessResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response JSON: %v", err)
+	}
+	return rec.Code, response
+}
+
+func TestHealthHandler_Liveness(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewHealthHandler(nil).Liveness(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+}
+
+func TestHealthHandler_Readiness(t *testing.T) {
+	handler := NewHealthHandler(nil)
+	handler.AddCheck("repository", repositories.NewInMemoryReceiptRepo(nil, nil).Ping)
+
+	code, response := getReadiness(t, handler)
+	if code != http.StatusOK || response.Status != "ready" || response.Checks["repository"] != "ok" {
+		t.Errorf("Expected ready with a passing repository check, got %d %+v", code, response)
+	}
+
+	handler.AddCheck("rules", func(ctx context.Context) error { return errors.New("rules not loaded") })
+	code, response = getReadiness(t, handler)
+	if code != http.StatusServiceUnavailable || response.Checks["rules"] != "rules not loaded" {
+		t.Errorf("Expected unavailable with a failing rules check, got %d %+v", code, response)
+	}
+}
+
+func TestHealthHandler_ReadinessWhileDraining(t *testing.T) {
+	handler := NewHealthHandler(nil)
+	handler.Drain()
+
+	code, response := getReadiness(t, handler)
+	if code != http.StatusServiceUnavailable || response.Status != "draining" {
+		t.Errorf("Expected draining to report unavailable, got %d %+v", code, response)
+	}
+}
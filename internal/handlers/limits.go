@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+	"github.com/javier-tello/receipt-processor-challenge/internal/validation"
+)
+
+const (
+	// DefaultMaxBodyBytes is the largest receipt body accepted unless configured otherwise.
+	DefaultMaxBodyBytes = 1 << 20
+	// DefaultMaxItems is the most items accepted on one receipt unless configured otherwise.
+	DefaultMaxItems = 1000
+)
+
+// Rejection reasons reported to metrics.
+const (
+	rejectRateLimited  = "rate_limited"
+	rejectBodyTooLarge = "body_too_large"
+	rejectTooManyItems = "too_many_items"
+)
+
+var (
+	errBodyTooLarge = errors.New("request body too large")
+	errTooManyItems = errors.New("too many items")
+)
+
+// allowSubmission applies the rate limit to the address a submission came from, answering 429 if
+// it is exceeded. The limit is not keyed on the X-Client-ID header, which a client could change
+// with every request to never be limited.
+func (h *ReceiptHandler) allowSubmission(w http.ResponseWriter, r *http.Request) bool {
+	remote := remoteHost(r)
+	allowed, retryAfter := h.RateLimiter.Allow(remote)
+	if allowed {
+		return true
+	}
+
+	h.logger.WarnContext(r.Context(), "Client rate limited", "remote_addr", remote, "client_id", clientIdentity(r), "retry_after", retryAfter.String())
+	h.Metrics.ObserveRejection(rejectRateLimited)
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(retryAfter)))
+	http.Error(w, "Too many receipts submitted, retry later", http.StatusTooManyRequests)
+	return false
+}
+
+// retryAfterSeconds rounds up so a client retrying on time always finds a token.
+func retryAfterSeconds(wait time.Duration) int {
+	return max(1, int(math.Ceil(wait.Seconds())))
+}
+
+// decodeReceipt reads a receipt body within the size and item limits. A declared Content-Length
+// over the limit is refused without reading, and the body is cut off once the limit is reached
+// in case the length was not declared. The items are counted before the receipt is built so an
+// oversized receipt is never held in memory as items.
+func (h *ReceiptHandler) decodeReceipt(w http.ResponseWriter, r *http.Request) (models.Receipt, error) {
+	var receipt models.Receipt
+
+	if h.MaxBodyBytes > 0 && r.ContentLength > h.MaxBodyBytes {
+		return receipt, errBodyTooLarge
+	}
+
+	body := r.Body
+	if h.MaxBodyBytes > 0 {
+		body = http.MaxBytesReader(w, r.Body, h.MaxBodyBytes)
+	}
+	data, err := io.ReadAll(body)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return receipt, errBodyTooLarge
+	}
+	if err != nil {
+		return receipt, err
+	}
+
+	if h.MaxItems > 0 {
+		if err := checkItemCount(data, h.MaxItems); err != nil {
+			return receipt, err
+		}
+	}
+
+	var request models.ReceiptRequest
+	if err := validation.DecodeStrict(data, &request); err != nil {
+		return receipt, err
+	}
+	return request.Receipt(), nil
+}
+
+// checkItemCount walks the receipt's tokens and stops as soon as the items array holds more than
+// maxItems entries. Malformed JSON is left for the strict decoder to report.
+func checkItemCount(data []byte, maxItems int) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return nil
+	}
+
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil
+		}
+		if key, _ := token.(string); key != "items" {
+			var skipped json.RawMessage
+			if err := decoder.Decode(&skipped); err != nil {
+				return nil
+			}
+			continue
+		}
+
+		if token, err := decoder.Token(); err != nil || token != json.Delim('[') {
+			return nil
+		}
+		for count := 1; decoder.More(); count++ {
+			if count > maxItems {
+				return fmt.Errorf("%w: a receipt may have at most %d items", errTooManyItems, maxItems)
+			}
+			var skipped json.RawMessage
+			if err := decoder.Decode(&skipped); err != nil {
+				return nil
+			}
+		}
+		return nil
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/ratelimit"
+)
+
+const limitsPayload = `{"retailer": "Target", "purchaseDate": "2022-01-02", "purchaseTime": "13:13", "total": "1.25", "items": [{"shortDescription": "Pepsi - 12-oz", "price": "1.25"}]}`
+
+func submitReceipt(handler *ReceiptHandler, body io.Reader, clientID string) *httptest.ResponseRecorder {
+	return submitReceiptFrom(handler, body, clientID, "192.0.2.1:1234")
+}
+
+func submitReceiptFrom(handler *ReceiptHandler, body io.Reader, clientID string, remoteAddr string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/receipts/process", body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Client-ID", clientID)
+	req.RemoteAddr = remoteAddr
+
+	rec := httptest.NewRecorder()
+	setupRouter(handler).ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandler_ProcessReceipt_RateLimited(t *testing.T) {
+	handler := setupHandler()
+	handler.RateLimiter = ratelimit.New(0.5, 2)
+
+	for i := 0; i < 2; i++ {
+		if rec := submitReceipt(handler, strings.NewReader(limitsPayload), "partner-a"); rec.Code != http.StatusCreated {
+			t.Fatalf("Expected submission %d within the burst to succeed, got %d", i+1, rec.Code)
+		}
+	}
+
+	rec := submitReceipt(handler, strings.NewReader(limitsPayload), "partner-a")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status %d, got %d", http.StatusTooManyRequests, rec.Code)
+	}
+	if retryAfter := rec.Header().Get("Retry-After"); retryAfter != "2" {
+		t.Errorf("Expected Retry-After of 2 seconds, got %q", retryAfter)
+	}
+
+	if rec := submitReceiptFrom(handler, strings.NewReader(limitsPayload), "partner-b", "198.51.100.7:1234"); rec.Code != http.StatusCreated {
+		t.Errorf("Expected another address to be unaffected, got %d", rec.Code)
+	}
+}
+
+func TestHandler_ProcessReceipt_RateLimitIgnoresClientID(t *testing.T) {
+	handler := setupHandler()
+	handler.RateLimiter = ratelimit.New(0.5, 2)
+
+	// A new X-Client-ID with every submission from the same address does not get a new bucket
+	for i := 0; i < 2; i++ {
+		if rec := submitReceipt(handler, strings.NewReader(limitsPayload), fmt.Sprintf("rotating-%d", i)); rec.Code != http.StatusCreated {
+			t.Fatalf("Expected submission %d within the burst to succeed, got %d", i+1, rec.Code)
+		}
+	}
+	if rec := submitReceipt(handler, strings.NewReader(limitsPayload), "rotating-2"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status %d, got %d", http.StatusTooManyRequests, rec.Code)
+	}
+}
+
+func TestHandler_ProcessReceipt_BodyTooLarge(t *testing.T) {
+	handler := setupHandler()
+	handler.MaxBodyBytes = 64
+
+	if rec := submitReceipt(handler, strings.NewReader(limitsPayload), "partner-a"); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status %d for a declared length over the limit, got %d", http.StatusRequestEntityTooLarge, rec.Code)
+	}
+
+	// Without a Content-Length the body is cut off while it is read
+	body := io.MultiReader(strings.NewReader(limitsPayload))
+	if rec := submitReceipt(handler, body, "partner-a"); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status %d for an undeclared length over the limit, got %d", http.StatusRequestEntityTooLarge, rec.Code)
+	}
+}
+
+func TestHandler_ProcessReceipt_TooManyItems(t *testing.T) {
+	handler := setupHandler()
+	handler.MaxItems = 3
+
+	items := strings.Repeat(`{"shortDescription": "Pepsi", "price": "1.00"},`, 4)
+	payload := fmt.Sprintf(`{"retailer": "Target", "purchaseDate": "2022-01-02", "purchaseTime": "13:13", "total": "4.00", "items": [%s]}`, strings.TrimSuffix(items, ","))
+
+	rec := submitReceipt(handler, strings.NewReader(payload), "partner-a")
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status %d, got %d", http.StatusRequestEntityTooLarge, rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "limit is 3") {
+		t.Errorf("Expected the limit in the response, got %q", rec.Body.String())
+	}
+
+	handler.MaxItems = 4
+	if rec := submitReceipt(handler, strings.NewReader(payload), "partner-a"); rec.Code != http.StatusCreated {
+		t.Errorf("Expected a receipt at the limit to be accepted, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
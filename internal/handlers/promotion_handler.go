@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/logging"
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+	"github.com/javier-tello/receipt-processor-challenge/internal/services"
+	"github.com/javier-tello/receipt-processor-challenge/internal/validation"
+)
+
+type PromotionHandler struct {
+	PromotionService *services.PromotionService
+	Validator        validation.ReceiptValidator
+	logger           *slog.Logger
+}
+
+func NewPromotionHandler(promotionService *services.PromotionService, validator validation.ReceiptValidator, logger *slog.Logger) *PromotionHandler {
+	return &PromotionHandler{
+		PromotionService: promotionService,
+		Validator:        validator,
+		logger:           logging.OrDefault(logger),
+	}
+}
+
+func (h *PromotionHandler) GetPromotions(w http.ResponseWriter, r *http.Request) {
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"promotions": h.PromotionService.GetPromotions()})
+}
+
+func (h *PromotionHandler) GetPromotion(w http.ResponseWriter, r *http.Request) {
+	promotionID := mux.Vars(r)["id"]
+
+	if err := h.Validator.ValidatePromotionID(promotionID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	promotion, err := h.PromotionService.GetPromotion(promotionID)
+	if err != nil {
+		h.writePromotionError(w, r, promotionID, err)
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, promotion)
+}
+
+func (h *PromotionHandler) CreatePromotion(w http.ResponseWriter, r *http.Request) {
+	var promotion models.Promotion
+	if err := decodeJSON(r, &promotion); err != nil {
+		h.logger.WarnContext(r.Context(), "Failed to decode promotion JSON", "error", err)
+		http.Error(w, decodeErrorMessage(err, "The promotion is invalid."), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Validator.ValidatePromotion(promotion); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	jsonResponse(w, http.StatusCreated, h.PromotionService.CreatePromotion(promotion))
+}
+
+func (h *PromotionHandler) UpdatePromotion(w http.ResponseWriter, r *http.Request) {
+	promotionID := mux.Vars(r)["id"]
+
+	if err := h.Validator.ValidatePromotionID(promotionID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var promotion models.Promotion
+	if err := decodeJSON(r, &promotion); err != nil {
+		h.logger.WarnContext(r.Context(), "Failed to decode promotion JSON", "error", err)
+		http.Error(w, decodeErrorMessage(err, "The promotion is invalid."), http.StatusBadRequest)
+		return
+	}
+	promotion.ID = promotionID
+
+	if err := h.Validator.ValidatePromotion(promotion); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	updated, err := h.PromotionService.UpdatePromotion(promotion)
+	if err != nil {
+		h.writePromotionError(w, r, promotionID, err)
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, updated)
+}
+
+func (h *PromotionHandler) DeletePromotion(w http.ResponseWriter, r *http.Request) {
+	promotionID := mux.Vars(r)["id"]
+
+	if err := h.Validator.ValidatePromotionID(promotionID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.PromotionService.DeletePromotion(promotionID); err != nil {
+		h.writePromotionError(w, r, promotionID, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writePromotionError maps errors returned by the promotion service onto HTTP responses.
+func (h *PromotionHandler) writePromotionError(w http.ResponseWriter, r *http.Request, promotionID string, err error) {
+	if errors.Is(err, services.ErrPromotionNotFound) {
+		h.logger.InfoContext(r.Context(), "Promotion not found", "promotion_id", promotionID, "error", err)
+		http.Error(w, "No promotion found for that ID", http.StatusNotFound)
+		return
+	}
+
+	h.logger.ErrorContext(r.Context(), "Failed to update promotion", "promotion_id", promotionID, "error", err)
+	http.Error(w, "Unable to update promotion", http.StatusInternalServerError)
+}
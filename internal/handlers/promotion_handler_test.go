@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+	"github.com/javier-tello/receipt-processor-challenge/internal/repositories"
+	"github.com/javier-tello/receipt-processor-challenge/internal/services"
+	"github.com/javier-tello/receipt-processor-challenge/internal/validation"
+)
+
+// Helper to configure the promotion admin router
+func setupPromotionRouter() *mux.Router {
+	handler := NewPromotionHandler(services.NewPromotionService(repositories.NewInMemoryPromotionRepo(MockUUIDGenerator{}), nil), validation.ReceiptValidator{}, nil)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/admin/promotions", handler.GetPromotions).Methods("GET")
+	router.HandleFunc("/admin/promotions", handler.CreatePromotion).Methods("POST")
+	router.HandleFunc("/admin/promotions/{id}", handler.GetPromotion).Methods("GET")
+	router.HandleFunc("/admin/promotions/{id}", handler.UpdatePromotion).Methods("PUT")
+	router.HandleFunc("/admin/promotions/{id}", handler.DeletePromotion).Methods("DELETE")
+
+	return router
+}
+
+func TestPromotionHandler_CreateAndGet(t *testing.T) {
+	router := setupPromotionRouter()
+
+	payload := `{"name": "2x points at Walgreens", "startDate": "2022-01-01", "endDate": "2022-01-07", "retailerIds": ["walgreens"], "multiplier": 2, "awardedPoints": 500}`
+	req := httptest.NewRequest(http.MethodPost, "/admin/promotions", bytes.NewBuffer([]byte(payload)))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/admin/promotions/123e4567-e89b-12d3-a456-426614174000", nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	var promotion models.Promotion
+	if err := json.Unmarshal(rec.Body.Bytes(), &promotion); err != nil {
+		t.Fatalf("Failed to parse actual JSON: %v", err)
+	}
+	if promotion.Multiplier != 2 || promotion.AwardedPoints != 0 {
+		t.Errorf("Expected a fresh 2x promotion, got %+v", promotion)
+	}
+
+	invalid := `{"name": "Nothing", "startDate": "2022-01-01"}`
+	req = httptest.NewRequest(http.MethodPost, "/admin/promotions", bytes.NewBuffer([]byte(invalid)))
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a promotion without a reward, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
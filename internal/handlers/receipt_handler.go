@@ -1,69 +1,395 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
 
+	"github.com/javier-tello/receipt-processor-challenge/internal/logging"
+	"github.com/javier-tello/receipt-processor-challenge/internal/metrics"
 	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+	"github.com/javier-tello/receipt-processor-challenge/internal/ratelimit"
 	"github.com/javier-tello/receipt-processor-challenge/internal/services"
+	"github.com/javier-tello/receipt-processor-challenge/internal/stream"
+	"github.com/javier-tello/receipt-processor-challenge/internal/tracing"
 	"github.com/javier-tello/receipt-processor-challenge/internal/validation"
 )
 
+// DefaultRequestTimeout bounds the time a request may spend in the receipt service and repository.
+const DefaultRequestTimeout = 5 * time.Second
+
+// statusClientClosedRequest is logged and counted when the client goes away before a response is written.
+const statusClientClosedRequest = 499
+
 type ReceiptHandler struct {
 	ReceiptService *services.ReceiptService
 	Validator      validation.ReceiptValidator
+	Metrics        *metrics.Metrics
+	// Timeout is applied to every service call. Zero or less disables it.
+	Timeout time.Duration
+	// RateLimiter limits receipt submissions per client. Nil disables rate limiting.
+	RateLimiter *ratelimit.Limiter
+	// MaxBodyBytes and MaxItems bound a submitted receipt. Zero or less disables the limit.
+	MaxBodyBytes int64
+	MaxItems     int
+	// Activity streams processed receipts to GET /receipts/stream. Nil disables the stream.
+	Activity *stream.Broadcaster
+	logger   *slog.Logger
 }
 
-func NewReceiptHandler(receiptService *services.ReceiptService, validator validation.ReceiptValidator) *ReceiptHandler {
+func NewReceiptHandler(receiptService *services.ReceiptService, validator validation.ReceiptValidator, logger *slog.Logger) *ReceiptHandler {
 	return &ReceiptHandler{
 		ReceiptService: receiptService,
 		Validator:      validator,
+		Timeout:        DefaultRequestTimeout,
+		MaxBodyBytes:   DefaultMaxBodyBytes,
+		MaxItems:       DefaultMaxItems,
+		logger:         logging.OrDefault(logger),
 	}
 }
 
 func (h *ReceiptHandler) ProcessReceipt(w http.ResponseWriter, r *http.Request) {
-	var receipt models.Receipt
-	if err := json.NewDecoder(r.Body).Decode(&receipt); err != nil {
-		log.Printf("Failed to decode receipt JSON: %v", err)
-		http.Error(w, "The receipt is invalid.", http.StatusBadRequest)
+	ctx, cancel := h.requestContext(r)
+	defer cancel()
+
+	clientID := clientIdentity(r)
+	if !h.allowSubmission(w, r) {
 		return
 	}
 
-	if err := h.Validator.ValidateReceipt(receipt); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	receipt, ok := h.readReceipt(ctx, w, r)
+	if !ok {
 		return
 	}
+	receipt.ClientID = clientID
 
-	log.Println("Processing receipt")
-	receiptID := h.ReceiptService.ProcessReceipt(receipt)
+	h.logger.DebugContext(r.Context(), "Processing receipt")
+	receiptID, err := h.ReceiptService.ProcessReceipt(ctx, receipt)
+	if h.writeContextError(w, r, err) {
+		return
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "Failed to process receipt", "error", err)
+		http.Error(w, "Unable to process receipt", http.StatusInternalServerError)
+		return
+	}
 
-	log.Printf("Receipt ID: %s successfully processed", receiptID)
+	h.logger.InfoContext(r.Context(), "Receipt successfully processed", "receipt_id", receiptID)
+	h.publishActivity(ctx, receiptID, receipt)
 	jsonResponse(w, http.StatusCreated, map[string]string{"id": receiptID})
 }
 
+// ScoreReceipt scores a receipt without storing it, so clients can show the points it would
+// earn before it is submitted.
+func (h *ReceiptHandler) ScoreReceipt(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := h.requestContext(r)
+	defer cancel()
+
+	receipt, ok := h.readReceipt(ctx, w, r)
+	if !ok {
+		return
+	}
+	// The client is identified so the preview reflects its customer caps
+	receipt.ClientID = clientIdentity(r)
+
+	breakdown, err := h.ReceiptService.PreviewReceipt(ctx, receipt)
+	if h.writeContextError(w, r, err) {
+		return
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "Failed to score receipt", "error", err)
+		http.Error(w, "Unable to score receipt", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"points": breakdown.Total, "breakdown": breakdown})
+}
+
+// readReceipt decodes and validates a submitted receipt, writing the error response and
+// counting the rejection if it is unacceptable.
+func (h *ReceiptHandler) readReceipt(ctx context.Context, w http.ResponseWriter, r *http.Request) (models.Receipt, bool) {
+	receipt, err := h.decodeReceipt(w, r)
+	switch {
+	case errors.Is(err, errBodyTooLarge):
+		h.logger.WarnContext(r.Context(), "Receipt body too large", "limit_bytes", h.MaxBodyBytes)
+		h.Metrics.ObserveRejection(rejectBodyTooLarge)
+		http.Error(w, fmt.Sprintf("The receipt is too large, the limit is %d bytes.", h.MaxBodyBytes), http.StatusRequestEntityTooLarge)
+		return receipt, false
+	case errors.Is(err, errTooManyItems):
+		h.logger.WarnContext(r.Context(), "Receipt has too many items", "limit", h.MaxItems)
+		h.Metrics.ObserveRejection(rejectTooManyItems)
+		http.Error(w, fmt.Sprintf("The receipt has too many items, the limit is %d.", h.MaxItems), http.StatusRequestEntityTooLarge)
+		return receipt, false
+	case err != nil:
+		h.logger.WarnContext(r.Context(), "Failed to decode receipt JSON", "error", err)
+		var fieldErrors validation.ValidationErrors
+		if errors.As(err, &fieldErrors) {
+			for _, fieldError := range fieldErrors {
+				h.Metrics.ObserveValidationFailure(fieldError.Field, fieldError.Code)
+			}
+		} else {
+			h.Metrics.ObserveValidationFailure("body", "decode")
+		}
+		http.Error(w, decodeErrorMessage(err, "The receipt is invalid."), http.StatusBadRequest)
+		return receipt, false
+	}
+
+	if err := h.validate(ctx, "ValidateReceipt", func() error { return h.Validator.ValidateReceipt(receipt) }); err != nil {
+		var fieldErrors validation.ValidationErrors
+		if errors.As(err, &fieldErrors) {
+			for _, fieldError := range fieldErrors {
+				h.Metrics.ObserveValidationFailure(fieldError.Field, fieldError.Code)
+			}
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return receipt, false
+	}
+	return receipt, true
+}
+
 func (h *ReceiptHandler) GetPointsForReceipt(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := h.requestContext(r)
+	defer cancel()
+
 	vars := mux.Vars(r)
 	receiptID := vars["id"]
 
-	if err := h.Validator.ValidateReceiptID(receiptID); err != nil {
-		log.Printf("Received invalid receipt id: %s", receiptID)
+	if err := h.validate(ctx, "ValidateReceiptID", func() error { return h.Validator.ValidateReceiptID(receiptID) }); err != nil {
+		h.logger.WarnContext(r.Context(), "Received invalid receipt id", "receipt_id", receiptID)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	pointsForReceipt, status, err := h.ReceiptService.GetPointsForReceipt(ctx, receiptID)
+	if err != nil {
+		h.writeServiceError(w, r, receiptID, err)
+		return
+	}
+
+	// Points are withheld until a receipt is approved
+	jsonResponse(w, http.StatusOK, map[string]string{"points": strconv.Itoa(pointsForReceipt), "status": string(status)})
+}
+
+func (h *ReceiptHandler) GetBreakdownForReceipt(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := h.requestContext(r)
+	defer cancel()
+
+	receiptID := mux.Vars(r)["id"]
+
+	if err := h.validate(ctx, "ValidateReceiptID", func() error { return h.Validator.ValidateReceiptID(receiptID) }); err != nil {
+		h.logger.WarnContext(r.Context(), "Received invalid receipt id", "receipt_id", receiptID)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	breakdown, status, err := h.ReceiptService.GetBreakdownForReceipt(ctx, receiptID)
+	if err != nil {
+		h.writeServiceError(w, r, receiptID, err)
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"status": status, "breakdown": breakdown})
+}
+
+func (h *ReceiptHandler) VoidReceipt(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := h.requestContext(r)
+	defer cancel()
+
+	receiptID := mux.Vars(r)["id"]
+
+	if err := h.validate(ctx, "ValidateReceiptID", func() error { return h.Validator.ValidateReceiptID(receiptID) }); err != nil {
+		h.logger.WarnContext(r.Context(), "Received invalid receipt id", "receipt_id", receiptID)
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	pointsForReceipt, err := h.ReceiptService.CalculateTotalPointsForReceipt(receiptID)
+	var request models.VoidRequest
+	if err := decodeJSON(r, &request); err != nil {
+		h.logger.WarnContext(r.Context(), "Failed to decode void request JSON", "error", err)
+		http.Error(w, decodeErrorMessage(err, "The void request is invalid."), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.validate(ctx, "ValidateVoidRequest", func() error { return h.Validator.ValidateVoidRequest(request) }); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
+	adjustment, err := h.ReceiptService.VoidReceipt(ctx, receiptID, request)
 	if err != nil {
-		log.Printf("Receipt ID %s not found: %v", receiptID, err)
-		http.Error(w, "No receipt found for that ID", http.StatusNotFound)
+		h.writeServiceError(w, r, receiptID, err)
 		return
 	}
 
-	jsonResponse(w, http.StatusOK, map[string]string{"points": strconv.Itoa(pointsForReceipt)})
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"status": models.StatusVoided, "adjustment": adjustment})
+}
+
+func (h *ReceiptHandler) ReturnItems(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := h.requestContext(r)
+	defer cancel()
+
+	receiptID := mux.Vars(r)["id"]
+
+	if err := h.validate(ctx, "ValidateReceiptID", func() error { return h.Validator.ValidateReceiptID(receiptID) }); err != nil {
+		h.logger.WarnContext(r.Context(), "Received invalid receipt id", "receipt_id", receiptID)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var request models.ReturnRequest
+	if err := decodeJSON(r, &request); err != nil {
+		h.logger.WarnContext(r.Context(), "Failed to decode return request JSON", "error", err)
+		http.Error(w, decodeErrorMessage(err, "The return request is invalid."), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.validate(ctx, "ValidateReturnRequest", func() error { return h.Validator.ValidateReturnRequest(request) }); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	adjustment, err := h.ReceiptService.ReturnItems(ctx, receiptID, request)
+	if err != nil {
+		h.writeServiceError(w, r, receiptID, err)
+		return
+	}
+
+	pointsForReceipt, err := h.ReceiptService.CalculateTotalPointsForReceipt(ctx, receiptID)
+	if err != nil {
+		h.writeServiceError(w, r, receiptID, err)
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"points": strconv.Itoa(pointsForReceipt), "adjustment": adjustment})
+}
+
+func (h *ReceiptHandler) GetAdjustmentsForReceipt(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := h.requestContext(r)
+	defer cancel()
+
+	receiptID := mux.Vars(r)["id"]
+
+	if err := h.validate(ctx, "ValidateReceiptID", func() error { return h.Validator.ValidateReceiptID(receiptID) }); err != nil {
+		h.logger.WarnContext(r.Context(), "Received invalid receipt id", "receipt_id", receiptID)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	adjustments, err := h.ReceiptService.GetAdjustmentsForReceipt(ctx, receiptID)
+	if err != nil {
+		h.writeServiceError(w, r, receiptID, err)
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"adjustments": adjustments})
+}
+
+// writeServiceError maps errors returned by the receipt service onto HTTP responses.
+func (h *ReceiptHandler) writeServiceError(w http.ResponseWriter, r *http.Request, receiptID string, err error) {
+	if h.writeContextError(w, r, err) {
+		return
+	}
+
+	switch {
+	case errors.Is(err, services.ErrReceiptNotFound):
+		h.logger.InfoContext(r.Context(), "Receipt not found", "receipt_id", receiptID, "error", err)
+		http.Error(w, "No receipt found for that ID", http.StatusNotFound)
+	case errors.Is(err, services.ErrNotAssessed):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, services.ErrReceiptVoided), errors.Is(err, services.ErrReceiptNotPending), errors.Is(err, services.ErrReceiptConflict):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, services.ErrInvalidReturn):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		h.logger.ErrorContext(r.Context(), "Failed to update receipt", "receipt_id", receiptID, "error", err)
+		http.Error(w, "Unable to update receipt", http.StatusInternalServerError)
+	}
+}
+
+// requestContext bounds the request's context by the handler timeout. The context is still
+// cancelled early if the client disconnects.
+func (h *ReceiptHandler) requestContext(r *http.Request) (context.Context, context.CancelFunc) {
+	if h.Timeout <= 0 {
+		return context.WithCancel(r.Context())
+	}
+	return context.WithTimeout(r.Context(), h.Timeout)
+}
+
+// writeContextError reports whether err means the request ran out of time or was abandoned,
+// writing the response if so.
+func (h *ReceiptHandler) writeContextError(w http.ResponseWriter, r *http.Request, err error) bool {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		h.logger.WarnContext(r.Context(), "Request timed out", "timeout", h.Timeout, "error", err)
+		http.Error(w, "The request timed out", http.StatusServiceUnavailable)
+		return true
+	case errors.Is(err, context.Canceled):
+		h.logger.InfoContext(r.Context(), "Client closed request", "error", err)
+		w.WriteHeader(statusClientClosedRequest)
+		return true
+	}
+	return false
+}
+
+// validate runs a validator method in its own span so slow or failing validation shows up in traces.
+func (h *ReceiptHandler) validate(ctx context.Context, method string, validate func() error) error {
+	_, span := tracing.Tracer().Start(ctx, "ReceiptValidator."+method)
+	err := validate()
+
+	var fieldErrors validation.ValidationErrors
+	if errors.As(err, &fieldErrors) {
+		span.SetAttributes(attribute.Int("validation.errors", len(fieldErrors)))
+	}
+	tracing.End(span, err)
+
+	return err
+}
+
+// clientIdentity identifies the submitting client by the X-Client-ID header, falling back to its IP address.
+// The header is not authenticated, so anything keyed on it, such as customer caps, is advisory.
+func clientIdentity(r *http.Request) string {
+	if clientID := strings.TrimSpace(r.Header.Get("X-Client-ID")); clientID != "" {
+		return clientID
+	}
+	return remoteHost(r)
+}
+
+// remoteHost is the IP address the request came from.
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// decodeJSON strictly decodes a request body, see validation.DecodeStrict.
+func decodeJSON(r *http.Request, v any) error {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	return validation.DecodeStrict(data, v)
+}
+
+// decodeErrorMessage explains why a body could not be decoded, falling back to a generic message.
+func decodeErrorMessage(err error, fallback string) string {
+	var fieldErrors validation.ValidationErrors
+	if errors.As(err, &fieldErrors) {
+		return fieldErrors.Error()
+	}
+	return fallback
 }
 
 func jsonResponse(w http.ResponseWriter, status int, data interface{}) {
@@ -2,16 +2,22 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 
+	"github.com/javier-tello/receipt-processor-challenge/internal/events"
 	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+	"github.com/javier-tello/receipt-processor-challenge/internal/repositories"
 	"github.com/javier-tello/receipt-processor-challenge/internal/services"
 	"github.com/javier-tello/receipt-processor-challenge/internal/validation"
 )
@@ -24,22 +30,110 @@ func (m MockUUIDGenerator) New() uuid.UUID {
 
 type MockReceiptRepository struct {
 	receipts    map[string]models.Receipt
+	adjustments map[string][]models.PointsAdjustment
 	idGenerator MockUUIDGenerator
 }
 
 func NewMockReceiptRepository(generator MockUUIDGenerator) *MockReceiptRepository {
-	return &MockReceiptRepository{receipts: make(map[string]models.Receipt), idGenerator: generator}
+	return &MockReceiptRepository{
+		receipts:    make(map[string]models.Receipt),
+		adjustments: make(map[string][]models.PointsAdjustment),
+		idGenerator: generator,
+	}
 }
 
-func (m *MockReceiptRepository) ProcessReceipt(receipt models.Receipt) string {
+func (m *MockReceiptRepository) ProcessReceipt(ctx context.Context, receipt models.Receipt, outbox ...events.Event) (string, error) {
 	receiptID := m.idGenerator.New().String()
+	receipt.ID = receiptID
 	m.receipts[receiptID] = receipt
-	return receiptID
+	return receiptID, nil
 }
 
-func (m *MockReceiptRepository) FindByID(receiptID string) (models.Receipt, bool) {
+func (m *MockReceiptRepository) FindByID(ctx context.Context, receiptID string) (models.Receipt, error) {
 	receipt, exists := m.receipts[receiptID]
-	return receipt, exists
+	if !exists {
+		return models.Receipt{}, repositories.ErrReceiptNotFound
+	}
+	return receipt, nil
+}
+
+func (m *MockReceiptRepository) UpdateReceipt(ctx context.Context, receiptID string, receipt models.Receipt, outbox ...events.Event) error {
+	if _, exists := m.receipts[receiptID]; !exists {
+		return repositories.ErrReceiptNotFound
+	}
+	m.receipts[receiptID] = receipt
+	return nil
+}
+
+func (m *MockReceiptRepository) AdjustReceipt(ctx context.Context, receiptID string, receipt models.Receipt, adjustment models.PointsAdjustment, outbox ...events.Event) (string, error) {
+	if _, exists := m.receipts[receiptID]; !exists {
+		return "", repositories.ErrReceiptNotFound
+	}
+	m.receipts[receiptID] = receipt
+	adjustment.ID = m.idGenerator.New().String()
+	adjustment.ReceiptID = receiptID
+	m.adjustments[receiptID] = append(m.adjustments[receiptID], adjustment)
+	return adjustment.ID, nil
+}
+
+func (m *MockReceiptRepository) FindByStatus(ctx context.Context, status models.ReceiptStatus) ([]models.Receipt, error) {
+	var receipts []models.Receipt
+	for _, receipt := range m.receipts {
+		if receipt.Status == status {
+			receipts = append(receipts, receipt)
+		}
+	}
+	return receipts, nil
+}
+
+func (m *MockReceiptRepository) FindByFingerprint(ctx context.Context, fingerprint string) ([]models.Receipt, error) {
+	var receipts []models.Receipt
+	for _, receipt := range m.receipts {
+		if receipt.Fingerprint == fingerprint {
+			receipts = append(receipts, receipt)
+		}
+	}
+	return receipts, nil
+}
+
+func (m *MockReceiptRepository) FindByClientID(ctx context.Context, clientID string) ([]models.Receipt, error) {
+	var receipts []models.Receipt
+	for _, receipt := range m.receipts {
+		if receipt.ClientID == clientID {
+			receipts = append(receipts, receipt)
+		}
+	}
+	return receipts, nil
+}
+
+func (m *MockReceiptRepository) FindByPurchaseDate(ctx context.Context, from string, to string) ([]models.Receipt, error) {
+	var receipts []models.Receipt
+	for _, receipt := range m.receipts {
+		if (from == "" || receipt.PurchaseDate >= from) && (to == "" || receipt.PurchaseDate <= to) {
+			receipts = append(receipts, receipt)
+		}
+	}
+	return receipts, nil
+}
+
+func (m *MockReceiptRepository) FindCustomerPoints(ctx context.Context, clientID string, submittedAt time.Time) (int, int, error) {
+	day, month := 0, 0
+	for _, receipt := range m.receipts {
+		if receipt.ClientID != clientID || receipt.Status == models.StatusRejected || receipt.Status == models.StatusVoided {
+			continue
+		}
+		if receipt.SubmittedAt.UTC().Format("2006-01") == submittedAt.UTC().Format("2006-01") {
+			month += receipt.Points
+			if receipt.SubmittedAt.UTC().Format("2006-01-02") == submittedAt.UTC().Format("2006-01-02") {
+				day += receipt.Points
+			}
+		}
+	}
+	return day, month, nil
+}
+
+func (m *MockReceiptRepository) FindAdjustmentsByReceiptID(ctx context.Context, receiptID string) ([]models.PointsAdjustment, error) {
+	return m.adjustments[receiptID], nil
 }
 
 // Helper to set up handler and dependencies
@@ -49,14 +143,25 @@ func setupHandler() *ReceiptHandler {
 	repo := NewMockReceiptRepository(mockUUIDGenerator)
 	service := services.NewReceiptService(repo)
 
-	return NewReceiptHandler(service, receiptValidator)
+	return NewReceiptHandler(service, receiptValidator, nil)
 }
 
 // Helper to configure router
 func setupRouter(handler *ReceiptHandler) *mux.Router {
 	router := mux.NewRouter()
 	router.HandleFunc("/receipts/process", handler.ProcessReceipt).Methods("POST")
+	router.HandleFunc("/receipts/score", handler.ScoreReceipt).Methods("POST")
+	router.HandleFunc("/receipts/stream", handler.StreamReceipts).Methods("GET")
 	router.HandleFunc("/receipts/{id}/points", handler.GetPointsForReceipt).Methods("GET")
+	router.HandleFunc("/receipts/{id}/breakdown", handler.GetBreakdownForReceipt).Methods("GET")
+	router.HandleFunc("/receipts/{id}", handler.VoidReceipt).Methods("DELETE")
+	router.HandleFunc("/receipts/{id}/returns", handler.ReturnItems).Methods("POST")
+	router.HandleFunc("/receipts/{id}/adjustments", handler.GetAdjustmentsForReceipt).Methods("GET")
+	router.HandleFunc("/admin/reviews", handler.GetReviewQueue).Methods("GET")
+	router.HandleFunc("/admin/receipts/{id}/approve", handler.ApproveReceipt).Methods("POST")
+	router.HandleFunc("/admin/receipts/{id}/reject", handler.RejectReceipt).Methods("POST")
+	router.HandleFunc("/admin/receipts/{id}/fraud", handler.GetFraudAssessment).Methods("GET")
+	router.HandleFunc("/admin/rules/simulate", handler.SimulateRules).Methods("POST")
 
 	return router
 }
@@ -87,6 +192,24 @@ func TestHandler_ProcessReceipt_ValidPayload(t *testing.T) {
 	}
 }
 
+func TestHandler_ProcessReceipt_StrictDecoding(t *testing.T) {
+	handler := setupHandler()
+
+	payload := `{"id": "chosen-by-client", "retailer": "Target", "purchaseDate": "2022-01-02", "purchaseTime": "13:13", "total": "1.25", "items": [{"shortDescription": "Pepsi - 12-oz", "price": "1.25"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/receipts/process", bytes.NewBuffer([]byte(payload)))
+	req.Header.Set("Content-Type", "application/json")
+
+	rec := httptest.NewRecorder()
+	setupRouter(handler).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "id is not a known field") {
+		t.Errorf("Expected the unknown field to be named, got %q", rec.Body.String())
+	}
+}
+
 func TestHandler_GetPointsForReceipt_ValidID(t *testing.T) {
 	handler := setupHandler()
 
@@ -98,7 +221,7 @@ func TestHandler_GetPointsForReceipt_ValidID(t *testing.T) {
 		Total:        "1.25",
 		Items:        []models.Item{{ShortDescription: "Pepsi - 12-oz", Price: "1.25"}},
 	}
-	receiptID, err := handler.ReceiptService.ProcessReceipt(receipt)
+	receiptID, err := handler.ReceiptService.ProcessReceipt(context.Background(), receipt)
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
@@ -113,7 +236,7 @@ func TestHandler_GetPointsForReceipt_ValidID(t *testing.T) {
 		t.Errorf("Expected status %d, got %d", http.StatusOK, rec.Code)
 	}
 
-	expectedResponse := map[string]interface{}{"points": "31"}
+	expectedResponse := map[string]interface{}{"points": "31", "status": "approved"}
 	var actualResponse map[string]interface{}
 	if err := json.Unmarshal(rec.Body.Bytes(), &actualResponse); err != nil {
 		t.Fatalf("Failed to parse actual JSON: %v", err)
@@ -137,3 +260,246 @@ func TestHandler_GetPointsForReceipt_InvalidID(t *testing.T) {
 		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rec.Code)
 	}
 }
+
+func TestHandler_ScoreReceipt(t *testing.T) {
+	handler := setupHandler()
+	router := setupRouter(handler)
+
+	payload := `{"retailer": "Target", "purchaseDate": "2022-01-02", "purchaseTime": "13:13", "total": "1.25", "items": [{"shortDescription": "Pepsi - 12-oz", "price": "1.25"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/receipts/score", bytes.NewBuffer([]byte(payload)))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	var actualResponse struct {
+		Points    int                    `json:"points"`
+		Breakdown models.PointsBreakdown `json:"breakdown"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &actualResponse); err != nil {
+		t.Fatalf("Failed to parse actual JSON: %v", err)
+	}
+	if actualResponse.Points != 31 || actualResponse.Breakdown.Total != 31 || len(actualResponse.Breakdown.Lines) != 2 {
+		t.Errorf("Unexpected response: %+v", actualResponse)
+	}
+
+	if _, _, err := handler.ReceiptService.GetPointsForReceipt(context.Background(), "123e4567-e89b-12d3-a456-426614174000"); !errors.Is(err, services.ErrReceiptNotFound) {
+		t.Errorf("Expected nothing to be stored, got %v", err)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/receipts/score", bytes.NewBuffer([]byte(`{"retailer": "Target"}`)))
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an invalid receipt, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+func TestHandler_VoidReceipt(t *testing.T) {
+	handler := setupHandler()
+
+	receiptID, err := handler.ReceiptService.ProcessReceipt(context.Background(), models.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-02",
+		PurchaseTime: "13:13",
+		Total:        "1.25",
+		Items:        []models.Item{{ShortDescription: "Pepsi - 12-oz", Price: "1.25"}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	router := setupRouter(handler)
+
+	payload := `{"reason": "customer refund", "actor": "agent-7"}`
+	req := httptest.NewRequest(http.MethodDelete, "/receipts/"+receiptID, bytes.NewBuffer([]byte(payload)))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var actualResponse struct {
+		Status     models.ReceiptStatus    `json:"status"`
+		Adjustment models.PointsAdjustment `json:"adjustment"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &actualResponse); err != nil {
+		t.Fatalf("Failed to parse actual JSON: %v", err)
+	}
+	if actualResponse.Status != models.StatusVoided || actualResponse.Adjustment.Points != -31 || actualResponse.Adjustment.Actor != "agent-7" {
+		t.Errorf("Unexpected response: %+v", actualResponse)
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/receipts/"+receiptID, bytes.NewBuffer([]byte(payload)))
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected status %d voiding twice, got %d", http.StatusConflict, rec.Code)
+	}
+}
+
+func TestHandler_ReturnItems_InvalidIndex(t *testing.T) {
+	handler := setupHandler()
+
+	receiptID, err := handler.ReceiptService.ProcessReceipt(context.Background(), models.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-02",
+		PurchaseTime: "13:13",
+		Total:        "1.25",
+		Items:        []models.Item{{ShortDescription: "Pepsi - 12-oz", Price: "1.25"}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	payload := `{"items": [4], "reason": "damaged", "actor": "agent-7"}`
+	req := httptest.NewRequest(http.MethodPost, "/receipts/"+receiptID+"/returns", bytes.NewBuffer([]byte(payload)))
+	rec := httptest.NewRecorder()
+	setupRouter(handler).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+func TestHandler_ReviewQueue_ApproveDuplicate(t *testing.T) {
+	handler := setupHandler()
+	router := setupRouter(handler)
+
+	payload := `{"retailer": "Target", "purchaseDate": "2022-01-02", "purchaseTime": "13:13", "total": "1.25", "items": [{"shortDescription": "Pepsi - 12-oz", "price": "1.25"}]}`
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/receipts/process", bytes.NewBuffer([]byte(payload)))
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	receiptID := "123e4567-e89b-12d3-a456-426614174000"
+	req := httptest.NewRequest(http.MethodGet, "/receipts/"+receiptID+"/points", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	expectedResponse := map[string]string{"points": "0", "status": "pending"}
+	var actualResponse map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &actualResponse); err != nil {
+		t.Fatalf("Failed to parse actual JSON: %v", err)
+	}
+	if !reflect.DeepEqual(expectedResponse, actualResponse) {
+		t.Errorf("Expected response: %v, got: %v", expectedResponse, actualResponse)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/admin/reviews", nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	var queue struct {
+		Receipts []reviewQueueEntry `json:"receipts"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &queue); err != nil {
+		t.Fatalf("Failed to parse actual JSON: %v", err)
+	}
+	if len(queue.Receipts) != 1 || len(queue.Receipts[0].Reasons) != 1 {
+		t.Fatalf("Expected one flagged receipt in the review queue, got %+v", queue.Receipts)
+	}
+
+	review := `{"comment": "customer submitted twice by mistake, keeping one", "actor": "reviewer-1"}`
+	req = httptest.NewRequest(http.MethodPost, "/admin/receipts/"+receiptID+"/approve", bytes.NewBuffer([]byte(review)))
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/admin/receipts/"+receiptID+"/reject", bytes.NewBuffer([]byte(review)))
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected status %d rejecting an approved receipt, got %d", http.StatusConflict, rec.Code)
+	}
+}
+
+func TestHandler_GetBreakdownForReceipt(t *testing.T) {
+	handler := setupHandler()
+
+	receiptID, err := handler.ReceiptService.ProcessReceipt(context.Background(), models.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-02",
+		PurchaseTime: "13:13",
+		Total:        "1.25",
+		Items:        []models.Item{{ShortDescription: "Pepsi - 12-oz", Price: "1.25"}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/receipts/"+receiptID+"/breakdown", nil)
+	rec := httptest.NewRecorder()
+	setupRouter(handler).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var actualResponse struct {
+		Status    models.ReceiptStatus   `json:"status"`
+		Breakdown models.PointsBreakdown `json:"breakdown"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &actualResponse); err != nil {
+		t.Fatalf("Failed to parse actual JSON: %v", err)
+	}
+
+	expectedLines := []string{services.RuleRetailerName, services.RuleTotalDecimals}
+	if actualResponse.Breakdown.Total != 31 || len(actualResponse.Breakdown.Lines) != len(expectedLines) {
+		t.Fatalf("Unexpected breakdown: %+v", actualResponse.Breakdown)
+	}
+	for i, rule := range expectedLines {
+		if actualResponse.Breakdown.Lines[i].Rule != rule {
+			t.Errorf("Expected line %d to be %s, got %s", i, rule, actualResponse.Breakdown.Lines[i].Rule)
+		}
+	}
+}
+
+// BlockingReceiptRepository never answers a lookup until the caller's context is done.
+type BlockingReceiptRepository struct {
+	*MockReceiptRepository
+}
+
+func (b BlockingReceiptRepository) FindByID(ctx context.Context, receiptID string) (models.Receipt, error) {
+	<-ctx.Done()
+	return models.Receipt{}, ctx.Err()
+}
+
+func TestHandler_GetPointsForReceipt_Timeout(t *testing.T) {
+	repo := BlockingReceiptRepository{NewMockReceiptRepository(MockUUIDGenerator{})}
+	handler := NewReceiptHandler(services.NewReceiptService(repo), validation.ReceiptValidator{}, nil)
+	handler.Timeout = 10 * time.Millisecond
+
+	req := httptest.NewRequest(http.MethodGet, "/receipts/123e4567-e89b-12d3-a456-426614174000/points", nil)
+	rec := httptest.NewRecorder()
+	setupRouter(handler).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d once the timeout elapses, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+}
+
+func TestHandler_GetPointsForReceipt_ClientGone(t *testing.T) {
+	repo := BlockingReceiptRepository{NewMockReceiptRepository(MockUUIDGenerator{})}
+	handler := NewReceiptHandler(services.NewReceiptService(repo), validation.ReceiptValidator{}, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	req := httptest.NewRequest(http.MethodGet, "/receipts/123e4567-e89b-12d3-a456-426614174000/points", nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	setupRouter(handler).ServeHTTP(rec, req)
+
+	if rec.Code != statusClientClosedRequest {
+		t.Errorf("Expected status %d when the client disconnects, got %d", statusClientClosedRequest, rec.Code)
+	}
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/logging"
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+	"github.com/javier-tello/receipt-processor-challenge/internal/reporting"
+	"github.com/javier-tello/receipt-processor-challenge/internal/validation"
+)
+
+// Report formats
+const (
+	formatJSON = "json"
+	formatCSV  = "csv"
+)
+
+type ReportHandler struct {
+	Reports   *reporting.Service
+	Validator validation.ReceiptValidator
+	logger    *slog.Logger
+}
+
+func NewReportHandler(reports *reporting.Service, validator validation.ReceiptValidator, logger *slog.Logger) *ReportHandler {
+	return &ReportHandler{
+		Reports:   reports,
+		Validator: validator,
+		logger:    logging.OrDefault(logger),
+	}
+}
+
+// GetReport aggregates approved receipts grouped by the dimension in the path, between the
+// from and to purchase dates, as CSV or JSON.
+func (h *ReportHandler) GetReport(w http.ResponseWriter, r *http.Request) {
+	query := models.ReportQuery{
+		GroupBy:  models.ReportDimension(mux.Vars(r)["groupBy"]),
+		From:     r.URL.Query().Get("from"),
+		To:       r.URL.Query().Get("to"),
+		TimeZone: r.URL.Query().Get("timeZone"),
+	}
+
+	if err := h.Validator.ValidateReportQuery(query); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format, ok := reportFormat(w, r)
+	if !ok {
+		return
+	}
+
+	report, err := h.Reports.Report(r.Context(), query)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "Failed to build report", "group_by", query.GroupBy, "error", err)
+		http.Error(w, "Unable to build report", http.StatusInternalServerError)
+		return
+	}
+
+	if format == formatJSON {
+		jsonResponse(w, http.StatusOK, report)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", reportFilename(query)))
+	w.WriteHeader(http.StatusOK)
+	if err := reporting.WriteCSV(w, report); err != nil {
+		h.logger.WarnContext(r.Context(), "Failed to write CSV report", "group_by", query.GroupBy, "error", err)
+	}
+}
+
+// GetLiabilityReport reports outstanding points by issuance month as of the end of the asOf
+// date, today if it is not given. It is CSV or JSON like the aggregate reports.
+func (h *ReportHandler) GetLiabilityReport(w http.ResponseWriter, r *http.Request) {
+	asOf := time.Now().UTC()
+	if date := r.URL.Query().Get("asOf"); date != "" {
+		parsed, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			http.Error(w, "The report request is invalid, bad as of date. Must be in YYYY-MM-DD format.", http.StatusBadRequest)
+			return
+		}
+		asOf = parsed
+	}
+	format, ok := reportFormat(w, r)
+	if !ok {
+		return
+	}
+
+	report, err := h.Reports.Liability(r.Context(), asOf)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "Failed to build liability report", "as_of", asOf, "error", err)
+		http.Error(w, "Unable to build report", http.StatusInternalServerError)
+		return
+	}
+
+	if format == formatJSON {
+		jsonResponse(w, http.StatusOK, report)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "points-liability-"+report.AsOf+".csv"))
+	w.WriteHeader(http.StatusOK)
+	if err := reporting.WriteLiabilityCSV(w, report); err != nil {
+		h.logger.WarnContext(r.Context(), "Failed to write CSV report", "as_of", report.AsOf, "error", err)
+	}
+}
+
+// reportFormat picks CSV when format=csv is passed or the client accepts text/csv, and JSON
+// otherwise, answering 400 for any other format.
+func reportFormat(w http.ResponseWriter, r *http.Request) (string, bool) {
+	switch format := strings.ToLower(r.URL.Query().Get("format")); format {
+	case formatJSON, formatCSV:
+		return format, true
+	case "":
+		if strings.Contains(r.Header.Get("Accept"), "text/csv") {
+			return formatCSV, true
+		}
+		return formatJSON, true
+	default:
+		http.Error(w, "The report request is invalid, format must be json or csv.", http.StatusBadRequest)
+		return "", false
+	}
+}
+
+// reportFilename names a downloaded report after its dimension and date range, e.g.
+// points-by-retailer-from-2022-01-01-to-2022-01-31.csv.
+func reportFilename(query models.ReportQuery) string {
+	name := "points-by-" + string(query.GroupBy)
+	if query.From != "" {
+		name += "-from-" + query.From
+	}
+	if query.To != "" {
+		name += "-to-" + query.To
+	}
+	return name + ".csv"
+}
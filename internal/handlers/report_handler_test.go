@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+	"github.com/javier-tello/receipt-processor-challenge/internal/reporting"
+	"github.com/javier-tello/receipt-processor-challenge/internal/services"
+	"github.com/javier-tello/receipt-processor-challenge/internal/validation"
+)
+
+// Helper to configure the reports router over two approved receipts worth 28 and 109 points
+func setupReportRouter() *mux.Router {
+	repo := NewMockReceiptRepository(MockUUIDGenerator{})
+	repo.receipts["receipt-1"] = models.Receipt{ID: "receipt-1", Retailer: "Target", PurchaseDate: "2022-01-01", PurchaseTime: "13:01", Total: "35.35", Status: models.StatusApproved, IssuedPoints: 28, SubmittedAt: time.Date(2022, 1, 1, 13, 5, 0, 0, time.UTC),
+		Items: []models.Item{
+			{ShortDescription: "Mountain Dew 12PK", Price: "6.49"},
+			{ShortDescription: "Emils Cheese Pizza", Price: "12.25"},
+			{ShortDescription: "Knorr Creamy Chicken", Price: "1.26"},
+			{ShortDescription: "Doritos Nacho Cheese", Price: "3.35"},
+			{ShortDescription: "   Klarbrunn 12-PK 12 FL OZ  ", Price: "12.00"},
+		}}
+	repo.receipts["receipt-2"] = models.Receipt{ID: "receipt-2", Retailer: "M&M Corner Market", PurchaseDate: "2022-03-20", PurchaseTime: "14:33", Total: "9.00", Status: models.StatusApproved, IssuedPoints: 109, SubmittedAt: time.Date(2022, 3, 20, 14, 40, 0, 0, time.UTC),
+		Items: []models.Item{{ShortDescription: "Gatorade", Price: "2.25"}, {ShortDescription: "Gatorade", Price: "2.25"}, {ShortDescription: "Gatorade", Price: "2.25"}, {ShortDescription: "Gatorade", Price: "2.25"}}}
+
+	receiptService := services.NewReceiptService(repo)
+	handler := NewReportHandler(reporting.NewService(repo, receiptService, nil), validation.ReceiptValidator{}, nil)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/reports/liability", handler.GetLiabilityReport).Methods("GET")
+	router.HandleFunc("/reports/{groupBy}", handler.GetReport).Methods("GET")
+	return router
+}
+
+func TestReportHandler_JSON(t *testing.T) {
+	router := setupReportRouter()
+
+	req := httptest.NewRequest(http.MethodGet, "/reports/retailer?from=2022-01-01&to=2022-12-31", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	var report models.Report
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Failed to parse actual JSON: %v", err)
+	}
+	if len(report.Groups) != 2 || report.Groups[0].Key != "M&M Corner Market" || report.Groups[0].Points != 109 {
+		t.Errorf("Expected M&M Corner Market first with 109 points, got %+v", report.Groups)
+	}
+	if report.Total.Receipts != 2 || report.Total.Points != 137 || report.Total.Spend != "44.35" {
+		t.Errorf("Unexpected total %+v", report.Total)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/reports/date?from=2022-03-01", nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil || len(report.Groups) != 1 || report.Groups[0].Key != "2022-03-20" {
+		t.Errorf("Expected only the March receipt, got %+v", report.Groups)
+	}
+}
+
+func TestReportHandler_CSV(t *testing.T) {
+	router := setupReportRouter()
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/reports/hour?format=csv", nil),
+		func() *http.Request {
+			req := httptest.NewRequest(http.MethodGet, "/reports/hour", nil)
+			req.Header.Set("Accept", "text/csv")
+			return req
+		}(),
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/csv" {
+			t.Fatalf("Expected a CSV report, got status %d and %q", rec.Code, rec.Header().Get("Content-Type"))
+		}
+		rows, err := csv.NewReader(strings.NewReader(rec.Body.String())).ReadAll()
+		if err != nil || len(rows) != 3 || rows[1][0] != "13:00" || rows[2][0] != "14:00" {
+			t.Errorf("Expected a header and rows for 13:00 and 14:00, got %v (%v)", rows, err)
+		}
+	}
+}
+
+func TestReportHandler_InvalidRequests(t *testing.T) {
+	router := setupReportRouter()
+
+	for _, target := range []string{
+		"/reports/month",
+		"/reports/date?from=yesterday",
+		"/reports/date?from=2022-02-01&to=2022-01-01",
+		"/reports/date?format=xlsx",
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d for %s, got %d", http.StatusBadRequest, target, rec.Code)
+		}
+	}
+}
+
+func TestReportHandler_Liability(t *testing.T) {
+	router := setupReportRouter()
+
+	req := httptest.NewRequest(http.MethodGet, "/reports/liability?asOf=2022-02-28", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	var report models.LiabilityReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Failed to parse actual JSON: %v", err)
+	}
+	// The March receipt had not been submitted yet
+	if report.AsOf != "2022-02-28" || report.Total.LiabilityPoints != 28 || report.Total.LiabilityValue != "0.28" {
+		t.Errorf("Expected 28 points worth 0.28 as of 2022-02-28, got %+v", report)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/reports/liability?asOf=2022-02-28&format=csv", nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Header().Get("Content-Type") != "text/csv" || !strings.Contains(rec.Header().Get("Content-Disposition"), "points-liability-2022-02-28.csv") {
+		t.Errorf("Expected a CSV download, got %q and %q", rec.Header().Get("Content-Type"), rec.Header().Get("Content-Disposition"))
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/reports/liability?asOf=february", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a bad date, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/logging"
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+	"github.com/javier-tello/receipt-processor-challenge/internal/services"
+	"github.com/javier-tello/receipt-processor-challenge/internal/validation"
+)
+
+type RetailerHandler struct {
+	RetailerService *services.RetailerService
+	Validator       validation.ReceiptValidator
+	logger          *slog.Logger
+}
+
+func NewRetailerHandler(retailerService *services.RetailerService, validator validation.ReceiptValidator, logger *slog.Logger) *RetailerHandler {
+	return &RetailerHandler{
+		RetailerService: retailerService,
+		Validator:       validator,
+		logger:          logging.OrDefault(logger),
+	}
+}
+
+func (h *RetailerHandler) GetRetailers(w http.ResponseWriter, r *http.Request) {
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"retailers": h.RetailerService.GetRetailers()})
+}
+
+func (h *RetailerHandler) GetRetailer(w http.ResponseWriter, r *http.Request) {
+	retailerID := mux.Vars(r)["id"]
+
+	if err := h.Validator.ValidateRetailerID(retailerID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	retailer, err := h.RetailerService.GetRetailer(retailerID)
+	if err != nil {
+		h.writeRetailerError(w, r, retailerID, err)
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, retailer)
+}
+
+func (h *RetailerHandler) CreateRetailer(w http.ResponseWriter, r *http.Request) {
+	var retailer models.Retailer
+	if err := decodeJSON(r, &retailer); err != nil {
+		h.logger.WarnContext(r.Context(), "Failed to decode retailer JSON", "error", err)
+		http.Error(w, decodeErrorMessage(err, "The retailer is invalid."), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Validator.ValidateRetailer(retailer); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	created, err := h.RetailerService.CreateRetailer(retailer)
+	if err != nil {
+		h.writeRetailerError(w, r, retailer.ID, err)
+		return
+	}
+
+	jsonResponse(w, http.StatusCreated, created)
+}
+
+func (h *RetailerHandler) UpdateRetailer(w http.ResponseWriter, r *http.Request) {
+	retailerID := mux.Vars(r)["id"]
+
+	if err := h.Validator.ValidateRetailerID(retailerID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var retailer models.Retailer
+	if err := decodeJSON(r, &retailer); err != nil {
+		h.logger.WarnContext(r.Context(), "Failed to decode retailer JSON", "error", err)
+		http.Error(w, decodeErrorMessage(err, "The retailer is invalid."), http.StatusBadRequest)
+		return
+	}
+	retailer.ID = retailerID
+
+	if err := h.Validator.ValidateRetailer(retailer); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	updated, err := h.RetailerService.UpdateRetailer(retailer)
+	if err != nil {
+		h.writeRetailerError(w, r, retailerID, err)
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, updated)
+}
+
+func (h *RetailerHandler) DeleteRetailer(w http.ResponseWriter, r *http.Request) {
+	retailerID := mux.Vars(r)["id"]
+
+	if err := h.Validator.ValidateRetailerID(retailerID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.RetailerService.DeleteRetailer(retailerID); err != nil {
+		h.writeRetailerError(w, r, retailerID, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeRetailerError maps errors returned by the retailer service onto HTTP responses.
+func (h *RetailerHandler) writeRetailerError(w http.ResponseWriter, r *http.Request, retailerID string, err error) {
+	switch {
+	case errors.Is(err, services.ErrRetailerNotFound):
+		h.logger.InfoContext(r.Context(), "Retailer not found", "retailer_id", retailerID, "error", err)
+		http.Error(w, "No retailer found for that ID", http.StatusNotFound)
+	case errors.Is(err, services.ErrRetailerConflict):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		h.logger.ErrorContext(r.Context(), "Failed to update retailer", "retailer_id", retailerID, "error", err)
+		http.Error(w, "Unable to update retailer", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+	"github.com/javier-tello/receipt-processor-challenge/internal/repositories"
+	"github.com/javier-tello/receipt-processor-challenge/internal/services"
+	"github.com/javier-tello/receipt-processor-challenge/internal/validation"
+)
+
+// Helper to configure the retailer admin router
+func setupRetailerRouter() *mux.Router {
+	handler := NewRetailerHandler(services.NewRetailerService(repositories.NewInMemoryRetailerRepo(), nil), validation.ReceiptValidator{}, nil)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/admin/retailers", handler.GetRetailers).Methods("GET")
+	router.HandleFunc("/admin/retailers", handler.CreateRetailer).Methods("POST")
+	router.HandleFunc("/admin/retailers/{id}", handler.GetRetailer).Methods("GET")
+	router.HandleFunc("/admin/retailers/{id}", handler.UpdateRetailer).Methods("PUT")
+	router.HandleFunc("/admin/retailers/{id}", handler.DeleteRetailer).Methods("DELETE")
+
+	return router
+}
+
+func TestRetailerHandler_CRUD(t *testing.T) {
+	router := setupRetailerRouter()
+
+	payload := `{"displayName": "Target", "aliases": ["Target Store"], "categories": ["general"], "active": true}`
+	req := httptest.NewRequest(http.MethodPost, "/admin/retailers", bytes.NewBuffer([]byte(payload)))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, rec.Code)
+	}
+	var created models.Retailer
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Failed to parse actual JSON: %v", err)
+	}
+	if created.ID != "target" {
+		t.Errorf("Expected generated ID 'target', got '%s'", created.ID)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/admin/retailers", bytes.NewBuffer([]byte(payload)))
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected status %d registering a retailer twice, got %d", http.StatusConflict, rec.Code)
+	}
+
+	update := `{"displayName": "Target", "aliases": [], "active": false}`
+	req = httptest.NewRequest(http.MethodPut, "/admin/retailers/target", bytes.NewBuffer([]byte(update)))
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/admin/retailers/target", nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d, got %d", http.StatusNoContent, rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/admin/retailers/target", nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rec.Code)
+	}
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+)
+
+type reviewQueueEntry struct {
+	ID           string    `json:"id"`
+	Retailer     string    `json:"retailer"`
+	PurchaseDate string    `json:"purchaseDate"`
+	PurchaseTime string    `json:"purchaseTime"`
+	Total        string    `json:"total"`
+	ItemCount    int       `json:"itemCount"`
+	SubmittedAt  time.Time `json:"submittedAt"`
+	FraudScore   *float64  `json:"fraudScore,omitempty"`
+	Reasons      []string  `json:"reasons"`
+}
+
+func (h *ReceiptHandler) GetReviewQueue(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := h.requestContext(r)
+	defer cancel()
+
+	pending, err := h.ReceiptService.GetReviewQueue(ctx)
+	if err != nil {
+		h.writeServiceError(w, r, "", err)
+		return
+	}
+
+	queue := []reviewQueueEntry{}
+	for _, receipt := range pending {
+		var fraudScore *float64
+		if receipt.Fraud != nil {
+			fraudScore = &receipt.Fraud.Score
+		}
+
+		queue = append(queue, reviewQueueEntry{
+			ID:           receipt.ID,
+			Retailer:     receipt.Retailer,
+			PurchaseDate: receipt.PurchaseDate,
+			PurchaseTime: receipt.PurchaseTime,
+			Total:        receipt.Total,
+			ItemCount:    len(receipt.Items),
+			SubmittedAt:  receipt.SubmittedAt,
+			FraudScore:   fraudScore,
+			Reasons:      receipt.ReviewReasons,
+		})
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"receipts": queue})
+}
+
+func (h *ReceiptHandler) ApproveReceipt(w http.ResponseWriter, r *http.Request) {
+	h.decideReview(w, r, h.ReceiptService.ApproveReceipt)
+}
+
+func (h *ReceiptHandler) RejectReceipt(w http.ResponseWriter, r *http.Request) {
+	h.decideReview(w, r, h.ReceiptService.RejectReceipt)
+}
+
+func (h *ReceiptHandler) decideReview(w http.ResponseWriter, r *http.Request, decide func(context.Context, string, models.ReviewRequest) (models.Receipt, error)) {
+	ctx, cancel := h.requestContext(r)
+	defer cancel()
+
+	receiptID := mux.Vars(r)["id"]
+
+	if err := h.validate(ctx, "ValidateReceiptID", func() error { return h.Validator.ValidateReceiptID(receiptID) }); err != nil {
+		h.logger.WarnContext(r.Context(), "Received invalid receipt id", "receipt_id", receiptID)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var request models.ReviewRequest
+	if err := decodeJSON(r, &request); err != nil {
+		h.logger.WarnContext(r.Context(), "Failed to decode review request JSON", "error", err)
+		http.Error(w, decodeErrorMessage(err, "The review request is invalid."), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.validate(ctx, "ValidateReviewRequest", func() error { return h.Validator.ValidateReviewRequest(request) }); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	receipt, err := decide(ctx, receiptID, request)
+	if err != nil {
+		h.writeServiceError(w, r, receiptID, err)
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"id": receipt.ID, "status": receipt.Status, "review": receipt.Review})
+}
+
+func (h *ReceiptHandler) GetFraudAssessment(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := h.requestContext(r)
+	defer cancel()
+
+	receiptID := mux.Vars(r)["id"]
+
+	if err := h.validate(ctx, "ValidateReceiptID", func() error { return h.Validator.ValidateReceiptID(receiptID) }); err != nil {
+		h.logger.WarnContext(r.Context(), "Received invalid receipt id", "receipt_id", receiptID)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	assessment, err := h.ReceiptService.GetFraudAssessment(ctx, receiptID)
+	if err != nil {
+		h.writeServiceError(w, r, receiptID, err)
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, assessment)
+}
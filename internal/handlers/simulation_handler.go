@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+	"github.com/javier-tello/receipt-processor-challenge/internal/services"
+	"github.com/javier-tello/receipt-processor-challenge/internal/validation"
+)
+
+// SimulateRules reports how the points for stored receipts would change under a candidate
+// rule configuration, without storing anything. Rules left out of the request keep the values
+// each receipt was scored under.
+func (h *ReceiptHandler) SimulateRules(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := h.requestContext(r)
+	defer cancel()
+
+	request := models.RuleSimulationRequest{Rules: services.DefaultRules()}
+	data, err := io.ReadAll(r.Body)
+	if err == nil {
+		err = validation.DecodeStrict(data, &request)
+	}
+	if err == nil {
+		request.Overrides, err = ruleOverrides(data)
+	}
+	if err != nil {
+		h.logger.WarnContext(r.Context(), "Failed to decode rule simulation JSON", "error", err)
+		http.Error(w, decodeErrorMessage(err, "The simulation request is invalid."), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.validate(ctx, "ValidateRuleSimulation", func() error { return h.Validator.ValidateRuleSimulation(request) }); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	simulation, err := h.ReceiptService.SimulateRules(ctx, request)
+	if err != nil {
+		h.writeServiceError(w, r, "", err)
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, simulation)
+}
+
+// ruleOverrides lists the rules a simulation request sets, so the rest can keep the values
+// each receipt was scored under.
+func ruleOverrides(data []byte) ([]string, error) {
+	var body struct {
+		Rules map[string]json.RawMessage `json:"rules"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil, err
+	}
+	return slices.Sorted(maps.Keys(body.Rules)), nil
+}
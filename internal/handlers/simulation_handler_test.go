@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+)
+
+func TestHandler_SimulateRules(t *testing.T) {
+	handler := setupHandler()
+
+	_, err := handler.ReceiptService.ProcessReceipt(context.Background(), models.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-02",
+		PurchaseTime: "13:13",
+		Total:        "1.25",
+		Items:        []models.Item{{ShortDescription: "Pepsi - 12-oz", Price: "1.25"}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	router := setupRouter(handler)
+
+	payload := `{"rules": {"pointsForQuarterMultiple": 0, "timeWindowStart": "13:00"}}`
+	req := httptest.NewRequest(http.MethodPost, "/admin/rules/simulate", bytes.NewBuffer([]byte(payload)))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	var simulation models.RuleSimulation
+	if err := json.Unmarshal(rec.Body.Bytes(), &simulation); err != nil {
+		t.Fatalf("Failed to parse response JSON: %v", err)
+	}
+	if simulation.Receipts != 1 || simulation.Current.Points != 31 || simulation.Candidate.Points != 16 || simulation.PointsDelta != -15 {
+		t.Errorf("Unexpected simulation: %+v", simulation)
+	}
+	if simulation.Rules.PointsForRoundDollar != 50 || simulation.Rules.TimeWindowEnd != "16:00" {
+		t.Errorf("Expected rules left out of the request to keep their current values, got %+v", simulation.Rules)
+	}
+	if len(simulation.TopRetailers) != 1 || simulation.TopRetailers[0].Retailer != "Target" || simulation.TopRetailers[0].PointsDelta != -15 {
+		t.Errorf("Unexpected top retailers: %+v", simulation.TopRetailers)
+	}
+
+	points, _, err := handler.ReceiptService.GetPointsForReceipt(context.Background(), "123e4567-e89b-12d3-a456-426614174000")
+	if err != nil || points != 31 {
+		t.Errorf("Expected the stored receipt to keep 31 points, got %d (%v)", points, err)
+	}
+}
+
+func TestHandler_SimulateRules_InvalidRequest(t *testing.T) {
+	router := setupRouter(setupHandler())
+
+	for _, payload := range []string{
+		`{"rules": {"pointsPerItemPair": -5}}`,
+		`{"rules": {"timeWindowStart": "18:00", "timeWindowEnd": "14:00"}}`,
+		`{"rules": {"pointsForBirthdays": 100}}`,
+		`{"sampleSize": -1}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/admin/rules/simulate", bytes.NewBuffer([]byte(payload)))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d for %s, got %d", http.StatusBadRequest, payload, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+	"github.com/javier-tello/receipt-processor-challenge/internal/stream"
+)
+
+// streamHeartbeat is how often an idle stream sends a comment so proxies keep the connection open
+const streamHeartbeat = 15 * time.Second
+
+// streamRetry tells browsers how long to wait, in milliseconds, before reconnecting to a dropped stream
+const streamRetry = 3000
+
+// StreamReceipts serves receipts as they are processed as Server-Sent Events, filtered by the
+// retailer and minPoints query parameters. A client that reconnects with Last-Event-ID is sent
+// what it missed first, as far back as the stream's history goes. A client too slow to keep up
+// is disconnected rather than holding up submissions, and catches up the same way.
+func (h *ReceiptHandler) StreamReceipts(w http.ResponseWriter, r *http.Request) {
+	if h.Activity == nil {
+		http.Error(w, "The receipt stream is not enabled.", http.StatusServiceUnavailable)
+		return
+	}
+
+	filter, err := streamFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var sub *stream.Subscription
+	var replay []stream.Activity
+	if lastEventID := r.Header.Get("Last-Event-ID"); lastEventID != "" {
+		id, err := strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			http.Error(w, "The request is invalid, Last-Event-ID must be an event ID from this stream.", http.StatusBadRequest)
+			return
+		}
+
+		var complete bool
+		sub, replay, complete = h.Activity.SubscribeAfter(filter, id)
+		if !complete {
+			h.logger.InfoContext(r.Context(), "Resumed receipt stream is missing activity no longer in the history", "last_event_id", id)
+		}
+	} else {
+		sub = h.Activity.Subscribe(filter)
+	}
+	defer h.Activity.Unsubscribe(sub)
+
+	// The server's write timeout would otherwise cut every stream off
+	controller := http.NewResponseController(w)
+	if err := controller.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		h.logger.WarnContext(r.Context(), "Failed to lift the write deadline for a receipt stream", "error", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetry)
+
+	for _, activity := range replay {
+		if err := writeActivity(w, activity); err != nil {
+			return
+		}
+	}
+	if controller.Flush() != nil {
+		return
+	}
+
+	h.logger.DebugContext(r.Context(), "Receipt stream opened", "retailer", filter.Retailer, "min_points", filter.MinPoints, "replayed", len(replay))
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case activity, ok := <-sub.C:
+			if !ok {
+				if sub.Lagged() {
+					h.logger.WarnContext(r.Context(), "Receipt stream client fell behind, disconnecting it")
+				}
+				return
+			}
+			if err := writeActivity(w, activity); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+
+		if controller.Flush() != nil {
+			return
+		}
+	}
+}
+
+// publishActivity tells stream clients a receipt was processed.
+func (h *ReceiptHandler) publishActivity(ctx context.Context, receiptID string, receipt models.Receipt) {
+	if h.Activity == nil {
+		return
+	}
+
+	points, status, err := h.ReceiptService.GetPointsForReceipt(ctx, receiptID)
+	if err != nil {
+		h.logger.WarnContext(ctx, "Failed to publish receipt activity", "receipt_id", receiptID, "error", err)
+		return
+	}
+
+	h.Activity.Publish(stream.Activity{
+		ReceiptID:   receiptID,
+		Retailer:    receipt.Retailer,
+		Points:      points,
+		Status:      status,
+		ProcessedAt: time.Now().UTC(),
+	})
+}
+
+func streamFilter(r *http.Request) (stream.Filter, error) {
+	query := r.URL.Query()
+	filter := stream.Filter{Retailer: query.Get("retailer")}
+
+	if minPoints := query.Get("minPoints"); minPoints != "" {
+		points, err := strconv.Atoi(minPoints)
+		if err != nil || points < 0 {
+			return filter, errors.New("The request is invalid, minPoints must be a whole number of points.")
+		}
+		filter.MinPoints = points
+	}
+	return filter, nil
+}
+
+func writeActivity(w http.ResponseWriter, activity stream.Activity) error {
+	data, err := json.Marshal(activity)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: receipt\ndata: %s\n\n", activity.ID, data)
+	return err
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/stream"
+)
+
+// openStream connects to the receipt stream, failing the test unless it is accepted. The
+// stream is closed before the server, which waits for it.
+func openStream(t *testing.T, server *httptest.Server, query string, lastEventID string) *bufio.Reader {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/receipts/stream"+query, nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got status %d and %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	return bufio.NewReader(resp.Body)
+}
+
+// readActivity skips to the next receipt event and returns its ID and activity.
+func readActivity(t *testing.T, reader *bufio.Reader) (string, stream.Activity) {
+	t.Helper()
+
+	var id string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Stream ended unexpectedly: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			var activity stream.Activity
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &activity); err != nil {
+				t.Fatalf("Expected JSON data, got %q", line)
+			}
+			return id, activity
+		}
+	}
+}
+
+func TestHandler_StreamReceipts_Filters(t *testing.T) {
+	handler := setupHandler()
+	handler.Activity = stream.New(10, 10)
+	server := httptest.NewServer(setupRouter(handler))
+	t.Cleanup(server.Close)
+
+	events := openStream(t, server, "?retailer=target&minPoints=30", "")
+
+	walgreens := strings.Replace(limitsPayload, "Target", "Walgreens", 1)
+	smallTarget := strings.Replace(limitsPayload, `"1.25"`, `"1.26"`, 2)
+	for _, payload := range []string{walgreens, smallTarget, limitsPayload} {
+		if rec := submitReceipt(handler, strings.NewReader(payload), "partner-a"); rec.Code != http.StatusCreated {
+			t.Fatalf("Expected status %d, got %d", http.StatusCreated, rec.Code)
+		}
+	}
+
+	// Only the last receipt is from Target and worth at least 30 points
+	id, activity := readActivity(t, events)
+	if id != "3" || activity.Retailer != "Target" || activity.Points != 31 {
+		t.Errorf("Expected the 31 point Target receipt as event 3, got event %s: %+v", id, activity)
+	}
+}
+
+func TestHandler_StreamReceipts_ResumesFromLastEventID(t *testing.T) {
+	handler := setupHandler()
+	handler.Activity = stream.New(10, 10)
+	server := httptest.NewServer(setupRouter(handler))
+	t.Cleanup(server.Close)
+
+	for _, retailer := range []string{"Target", "Walgreens", "Costco"} {
+		handler.Activity.Publish(stream.Activity{Retailer: retailer})
+	}
+
+	events := openStream(t, server, "", "1")
+	for _, expected := range []string{"Walgreens", "Costco"} {
+		if _, activity := readActivity(t, events); activity.Retailer != expected {
+			t.Errorf("Expected to resume with %s, got %+v", expected, activity)
+		}
+	}
+}
+
+func TestHandler_StreamReceipts_InvalidRequests(t *testing.T) {
+	handler := setupHandler()
+
+	rec := httptest.NewRecorder()
+	setupRouter(handler).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/receipts/stream", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d without a stream, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+
+	handler.Activity = stream.New(10, 10)
+	rec = httptest.NewRecorder()
+	setupRouter(handler).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/receipts/stream?minPoints=lots", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an invalid filter, got %d", http.StatusBadRequest, rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/receipts/stream", nil)
+	req.Header.Set("Last-Event-ID", "yesterday")
+	rec = httptest.NewRecorder()
+	setupRouter(handler).ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an invalid Last-Event-ID, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/logging"
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+	"github.com/javier-tello/receipt-processor-challenge/internal/services"
+	"github.com/javier-tello/receipt-processor-challenge/internal/validation"
+)
+
+type WebhookHandler struct {
+	WebhookService *services.WebhookService
+	Validator      validation.ReceiptValidator
+	logger         *slog.Logger
+}
+
+func NewWebhookHandler(webhookService *services.WebhookService, validator validation.ReceiptValidator, logger *slog.Logger) *WebhookHandler {
+	return &WebhookHandler{
+		WebhookService: webhookService,
+		Validator:      validator,
+		logger:         logging.OrDefault(logger),
+	}
+}
+
+func (h *WebhookHandler) GetSubscriptions(w http.ResponseWriter, r *http.Request) {
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"subscriptions": h.WebhookService.GetSubscriptions()})
+}
+
+func (h *WebhookHandler) GetSubscription(w http.ResponseWriter, r *http.Request) {
+	subscriptionID := mux.Vars(r)["id"]
+
+	if err := h.Validator.ValidateWebhookID(subscriptionID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	subscription, err := h.WebhookService.GetSubscription(subscriptionID)
+	if err != nil {
+		h.writeWebhookError(w, r, subscriptionID, err)
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, subscription)
+}
+
+// CreateSubscription registers a partner endpoint. The response is the only place the signing secret is shown.
+func (h *WebhookHandler) CreateSubscription(w http.ResponseWriter, r *http.Request) {
+	var request models.WebhookSubscriptionRequest
+	if err := decodeJSON(r, &request); err != nil {
+		h.logger.WarnContext(r.Context(), "Failed to decode webhook subscription JSON", "error", err)
+		http.Error(w, decodeErrorMessage(err, "The webhook subscription is invalid."), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Validator.ValidateWebhookSubscription(request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	subscription, err := h.WebhookService.CreateSubscription(request)
+	if err != nil {
+		h.writeWebhookError(w, r, "", err)
+		return
+	}
+
+	jsonResponse(w, http.StatusCreated, subscription)
+}
+
+func (h *WebhookHandler) DeleteSubscription(w http.ResponseWriter, r *http.Request) {
+	subscriptionID := mux.Vars(r)["id"]
+
+	if err := h.Validator.ValidateWebhookID(subscriptionID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.WebhookService.DeleteSubscription(subscriptionID); err != nil {
+		h.writeWebhookError(w, r, subscriptionID, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *WebhookHandler) GetDeadLetters(w http.ResponseWriter, r *http.Request) {
+	deliveries := h.WebhookService.GetDeadLetters()
+	if deliveries == nil {
+		deliveries = []models.WebhookDelivery{}
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"deliveries": deliveries})
+}
+
+func (h *WebhookHandler) Redeliver(w http.ResponseWriter, r *http.Request) {
+	deliveryID := mux.Vars(r)["id"]
+
+	if err := h.Validator.ValidateWebhookID(deliveryID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	delivery, err := h.WebhookService.Redeliver(deliveryID)
+	if err != nil {
+		h.writeWebhookError(w, r, deliveryID, err)
+		return
+	}
+
+	jsonResponse(w, http.StatusAccepted, delivery)
+}
+
+// writeWebhookError maps errors returned by the webhook service onto HTTP responses.
+func (h *WebhookHandler) writeWebhookError(w http.ResponseWriter, r *http.Request, id string, err error) {
+	switch {
+	case errors.Is(err, services.ErrSubscriptionNotFound), errors.Is(err, services.ErrDeliveryNotFound):
+		h.logger.InfoContext(r.Context(), "Webhook resource not found", "id", id, "error", err)
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, services.ErrDeliveryPending):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		h.logger.ErrorContext(r.Context(), "Failed to update webhook", "id", id, "error", err)
+		http.Error(w, "Unable to update webhook", http.StatusInternalServerError)
+	}
+}
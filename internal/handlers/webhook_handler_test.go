@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+	"github.com/javier-tello/receipt-processor-challenge/internal/repositories"
+	"github.com/javier-tello/receipt-processor-challenge/internal/services"
+	"github.com/javier-tello/receipt-processor-challenge/internal/validation"
+)
+
+// Helper to configure the webhook admin router
+func setupWebhookRouter() *mux.Router {
+	handler := NewWebhookHandler(services.NewWebhookService(repositories.NewInMemoryWebhookRepo(MockUUIDGenerator{}), nil), validation.ReceiptValidator{}, nil)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/admin/webhooks", handler.GetSubscriptions).Methods("GET")
+	router.HandleFunc("/admin/webhooks", handler.CreateSubscription).Methods("POST")
+	router.HandleFunc("/admin/webhooks/dead-letters", handler.GetDeadLetters).Methods("GET")
+	router.HandleFunc("/admin/webhooks/deliveries/{id}/redeliver", handler.Redeliver).Methods("POST")
+	router.HandleFunc("/admin/webhooks/{id}", handler.GetSubscription).Methods("GET")
+	router.HandleFunc("/admin/webhooks/{id}", handler.DeleteSubscription).Methods("DELETE")
+
+	return router
+}
+
+func TestWebhookHandler_Subscriptions(t *testing.T) {
+	router := setupWebhookRouter()
+
+	payload := `{"url": "https://partner.example.com/hooks", "events": ["receipt.scored", "receipt.voided"]}`
+	req := httptest.NewRequest(http.MethodPost, "/admin/webhooks", bytes.NewBuffer([]byte(payload)))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, rec.Code)
+	}
+	var created models.WebhookSubscription
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Failed to parse actual JSON: %v", err)
+	}
+	if created.Secret == "" || len(created.Events) != 2 {
+		t.Errorf("Expected a subscription to 2 events with its secret, got %+v", created)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/admin/webhooks/"+created.ID, nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	var fetched models.WebhookSubscription
+	if err := json.Unmarshal(rec.Body.Bytes(), &fetched); err != nil {
+		t.Fatalf("Failed to parse actual JSON: %v", err)
+	}
+	if fetched.Secret != "" {
+		t.Errorf("Expected the secret to be hidden, got %q", fetched.Secret)
+	}
+
+	invalid := `{"url": "partner.example.com", "events": ["receipt.deleted"]}`
+	req = httptest.NewRequest(http.MethodPost, "/admin/webhooks", bytes.NewBuffer([]byte(invalid)))
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an invalid subscription, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+func TestWebhookHandler_DeadLetters(t *testing.T) {
+	router := setupWebhookRouter()
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/webhooks/dead-letters", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || rec.Body.String() != "{\"deliveries\":[]}\n" {
+		t.Errorf("Expected an empty dead-letter list, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/admin/webhooks/deliveries/non-existent-id/redeliver", nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d redelivering a missing delivery, got %d", http.StatusNotFound, rec.Code)
+	}
+}
@@ -0,0 +1,82 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNew_RejectsBadConfiguration(t *testing.T) {
+	tests := []struct {
+		name      string
+		level     string
+		format    string
+		expectErr bool
+	}{
+		{"JSON Info", "info", "json", false},
+		{"Text Debug", "DEBUG", "text", false},
+		{"Bad Level", "verbose", "json", true},
+		{"Bad Format", "info", "xml", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := New(&bytes.Buffer{}, test.level, test.format)
+			if (err != nil) != test.expectErr {
+				t.Errorf("New(%q, %q) error = %v, expectErr = %v", test.level, test.format, err, test.expectErr)
+			}
+		})
+	}
+}
+
+func TestMiddleware_PropagatesRequestID(t *testing.T) {
+	var output bytes.Buffer
+	logger, _ := New(&output, "debug", "json")
+
+	var seenRequestID string
+	handler := Middleware(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seenRequestID = RequestID(r.Context())
+		logger.DebugContext(r.Context(), "inside handler")
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/receipts/abc/points", nil)
+	req.Header.Set(RequestIDHeader, "req-123")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if seenRequestID != "req-123" {
+		t.Errorf("Expected the handler to see request ID 'req-123', got '%s'", seenRequestID)
+	}
+	if rec.Header().Get(RequestIDHeader) != "req-123" {
+		t.Errorf("Expected the request ID to be echoed on the response")
+	}
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected a handler line and an access log line, got %d lines", len(lines))
+	}
+	for _, line := range lines {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Expected JSON log output, got %q", line)
+		}
+		if record["request_id"] != "req-123" {
+			t.Errorf("Expected request_id on every line, got %v", record)
+		}
+	}
+}
+
+func TestMiddleware_GeneratesRequestID(t *testing.T) {
+	logger, _ := New(&bytes.Buffer{}, "info", "json")
+	handler := Middleware(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Header().Get(RequestIDHeader) == "" {
+		t.Errorf("Expected a generated request ID on the response")
+	}
+}
@@ -0,0 +1,205 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+)
+
+const namespace = "receipt_processor"
+
+// Metrics holds every Prometheus collector the service exposes on /metrics.
+// A nil *Metrics is valid and records nothing, so instrumentation is optional.
+type Metrics struct {
+	registry           *prometheus.Registry
+	requests           *prometheus.CounterVec
+	requestDuration    *prometheus.HistogramVec
+	validationFailures *prometheus.CounterVec
+	receiptsStored     *prometheus.CounterVec
+	repoDuration       *prometheus.HistogramVec
+	rulePoints         *prometheus.HistogramVec
+	rejections         *prometheus.CounterVec
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by route template, method and status code.",
+		}, []string{"route", "method", "code"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by route template and method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+		validationFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "validation_failures_total",
+			Help:      "Receipt validation failures by field and failure code.",
+		}, []string{"field", "code"}),
+		receiptsStored: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "receipts_stored_total",
+			Help:      "Receipts stored by the status they were stored with.",
+		}, []string{"status"}),
+		repoDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "repository_operation_duration_seconds",
+			Help:      "Receipt repository operation latency by operation.",
+			Buckets:   []float64{.00001, .00005, .0001, .0005, .001, .005, .01, .05, .1, .5, 1},
+		}, []string{"operation"}),
+		rulePoints: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "rule_points_awarded",
+			Help:      "Points awarded per stored receipt by each scoring rule, promotions are grouped under 'promotion' and points withheld by a cap are negative points under the cap.",
+			Buckets:   []float64{0, 1, 5, 10, 25, 50, 75, 100, 250, 500, 1000},
+		}, []string{"rule"}),
+		rejections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "requests_rejected_total",
+			Help:      "Receipt submissions rejected before processing by reason: rate_limited, body_too_large or too_many_items.",
+		}, []string{"reason"}),
+	}
+
+	m.registry.MustRegister(
+		m.requests,
+		m.requestDuration,
+		m.validationFailures,
+		m.receiptsStored,
+		m.repoDuration,
+		m.rulePoints,
+		m.rejections,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// Middleware counts and times requests per route. It must be installed with router.Use so that
+// the matched route template, rather than the raw path, is used as the label.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		route := "unmatched"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		next.ServeHTTP(recorder, r)
+
+		m.requestDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+		m.requests.WithLabelValues(route, r.Method, strconv.Itoa(recorder.status)).Inc()
+	})
+}
+
+// ObserveValidationFailure counts a failed validation of a receipt field.
+// Item indexes are dropped from the field name to keep the label set bounded.
+func (m *Metrics) ObserveValidationFailure(field string, code string) {
+	if m == nil {
+		return
+	}
+
+	m.validationFailures.WithLabelValues(stripIndexes(field), code).Inc()
+}
+
+// ObserveRejection counts a receipt submission turned away before it was decoded or processed.
+func (m *Metrics) ObserveRejection(reason string) {
+	if m == nil {
+		return
+	}
+
+	m.rejections.WithLabelValues(reason).Inc()
+}
+
+// ObserveReceiptStored counts a receipt written to the repository.
+func (m *Metrics) ObserveReceiptStored(status models.ReceiptStatus) {
+	if m == nil {
+		return
+	}
+
+	m.receiptsStored.WithLabelValues(string(status)).Inc()
+}
+
+// ObserveRepositoryOperation records how long a repository call took.
+func (m *Metrics) ObserveRepositoryOperation(operation string, duration time.Duration) {
+	if m == nil {
+		return
+	}
+
+	m.repoDuration.WithLabelValues(operation).Observe(duration.Seconds())
+}
+
+// ObserveRulePoints records the points each rule contributed to a newly stored receipt, and
+// those each cap withheld.
+func (m *Metrics) ObserveRulePoints(lines []models.PointsLine) {
+	if m == nil {
+		return
+	}
+
+	for _, line := range lines {
+		rule := line.Rule
+		if strings.HasPrefix(rule, "promotion:") {
+			rule = "promotion"
+		}
+		m.rulePoints.WithLabelValues(rule).Observe(float64(line.Points))
+	}
+}
+
+// stripIndexes turns "items[3].price" into "items[].price".
+func stripIndexes(field string) string {
+	var b strings.Builder
+	skipping := false
+	for _, r := range field {
+		switch {
+		case r == '[':
+			skipping = true
+			b.WriteRune(r)
+		case r == ']':
+			skipping = false
+			b.WriteRune(r)
+		case !skipping:
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to flush a stream.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+	"github.com/javier-tello/receipt-processor-challenge/internal/repositories"
+)
+
+func TestMiddleware_LabelsByRouteTemplate(t *testing.T) {
+	m := New()
+
+	router := mux.NewRouter()
+	router.Use(m.Middleware)
+	router.HandleFunc("/receipts/{id}/points", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "No receipt found for that ID", http.StatusNotFound)
+	}).Methods("GET")
+
+	for _, id := range []string{"a", "b", "c"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/receipts/"+id+"/points", nil))
+	}
+
+	count := testutil.ToFloat64(m.requests.WithLabelValues("/receipts/{id}/points", "GET", "404"))
+	if count != 3 {
+		t.Errorf("Expected 3 requests counted against the route template, got %v", count)
+	}
+}
+
+func TestHandler_ExposesServiceMetrics(t *testing.T) {
+	m := New()
+
+	repo := NewInstrumentedReceiptRepo(repositories.NewInMemoryReceiptRepo(nil, nil), m)
+	receiptID, _ := repo.ProcessReceipt(context.Background(), models.Receipt{Status: models.StatusApproved})
+	repo.FindByID(context.Background(), receiptID)
+
+	m.ObserveValidationFailure("items[3].price", "format")
+	m.ObserveRulePoints([]models.PointsLine{{Rule: "retailer_name", Points: 6}, {Rule: "promotion:abc", Points: 100}})
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+
+	for _, expected := range []string{
+		`receipt_processor_receipts_stored_total{status="approved"} 1`,
+		`receipt_processor_repository_operation_duration_seconds_count{operation="find_by_id"} 1`,
+		`receipt_processor_validation_failures_total{code="format",field="items[].price"} 1`,
+		`receipt_processor_rule_points_awarded_sum{rule="retailer_name"} 6`,
+		`receipt_processor_rule_points_awarded_sum{rule="promotion"} 100`,
+	} {
+		if !strings.Contains(string(body), expected) {
+			t.Errorf("Expected metrics output to contain %q", expected)
+		}
+	}
+}
+
+func TestNilMetrics_RecordNothing(t *testing.T) {
+	var m *Metrics
+
+	m.ObserveValidationFailure("retailer", "required")
+	m.ObserveReceiptStored(models.StatusApproved)
+	m.ObserveRulePoints([]models.PointsLine{{Rule: "retailer_name", Points: 6}})
+	m.ObserveRejection("rate_limited")
+
+	rec := httptest.NewRecorder()
+	m.Middleware(http.NotFoundHandler()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected the wrapped handler to run, got status %d", rec.Code)
+	}
+}
@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/events"
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+	"github.com/javier-tello/receipt-processor-challenge/internal/repositories"
+)
+
+// InstrumentedReceiptRepo times every call to the wrapped repository and counts stored receipts.
+type InstrumentedReceiptRepo struct {
+	repo    repositories.ReceiptRepository
+	metrics *Metrics
+}
+
+func NewInstrumentedReceiptRepo(repo repositories.ReceiptRepository, metrics *Metrics) *InstrumentedReceiptRepo {
+	return &InstrumentedReceiptRepo{repo: repo, metrics: metrics}
+}
+
+func (i *InstrumentedReceiptRepo) observe(operation string, start time.Time) {
+	i.metrics.ObserveRepositoryOperation(operation, time.Since(start))
+}
+
+func (i *InstrumentedReceiptRepo) ProcessReceipt(ctx context.Context, receipt models.Receipt, outbox ...events.Event) (string, error) {
+	defer i.observe("process_receipt", time.Now())
+
+	receiptID, err := i.repo.ProcessReceipt(ctx, receipt, outbox...)
+	if err == nil {
+		i.metrics.ObserveReceiptStored(receipt.Status)
+	}
+	return receiptID, err
+}
+
+func (i *InstrumentedReceiptRepo) FindByID(ctx context.Context, receiptID string) (models.Receipt, error) {
+	defer i.observe("find_by_id", time.Now())
+	return i.repo.FindByID(ctx, receiptID)
+}
+
+func (i *InstrumentedReceiptRepo) UpdateReceipt(ctx context.Context, receiptID string, receipt models.Receipt, outbox ...events.Event) error {
+	defer i.observe("update_receipt", time.Now())
+	return i.repo.UpdateReceipt(ctx, receiptID, receipt, outbox...)
+}
+
+func (i *InstrumentedReceiptRepo) AdjustReceipt(ctx context.Context, receiptID string, receipt models.Receipt, adjustment models.PointsAdjustment, outbox ...events.Event) (string, error) {
+	defer i.observe("adjust_receipt", time.Now())
+	return i.repo.AdjustReceipt(ctx, receiptID, receipt, adjustment, outbox...)
+}
+
+func (i *InstrumentedReceiptRepo) FindByStatus(ctx context.Context, status models.ReceiptStatus) ([]models.Receipt, error) {
+	defer i.observe("find_by_status", time.Now())
+	return i.repo.FindByStatus(ctx, status)
+}
+
+func (i *InstrumentedReceiptRepo) FindByFingerprint(ctx context.Context, fingerprint string) ([]models.Receipt, error) {
+	defer i.observe("find_by_fingerprint", time.Now())
+	return i.repo.FindByFingerprint(ctx, fingerprint)
+}
+
+func (i *InstrumentedReceiptRepo) FindByClientID(ctx context.Context, clientID string) ([]models.Receipt, error) {
+	defer i.observe("find_by_client_id", time.Now())
+	return i.repo.FindByClientID(ctx, clientID)
+}
+
+func (i *InstrumentedReceiptRepo) FindByPurchaseDate(ctx context.Context, from string, to string) ([]models.Receipt, error) {
+	defer i.observe("find_by_purchase_date", time.Now())
+	return i.repo.FindByPurchaseDate(ctx, from, to)
+}
+
+func (i *InstrumentedReceiptRepo) FindCustomerPoints(ctx context.Context, clientID string, submittedAt time.Time) (int, int, error) {
+	defer i.observe("find_customer_points", time.Now())
+	return i.repo.FindCustomerPoints(ctx, clientID, submittedAt)
+}
+
+func (i *InstrumentedReceiptRepo) FindAdjustmentsByReceiptID(ctx context.Context, receiptID string) ([]models.PointsAdjustment, error) {
+	defer i.observe("find_adjustments_by_receipt_id", time.Now())
+	return i.repo.FindAdjustmentsByReceiptID(ctx, receiptID)
+}
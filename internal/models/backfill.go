@@ -0,0 +1,62 @@
+package models
+
+import "time"
+
+// Lifecycle status of a backfill job
+type BackfillStatus string
+
+const (
+	BackfillRunning   BackfillStatus = "running"
+	BackfillPaused    BackfillStatus = "paused"
+	BackfillCompleted BackfillStatus = "completed"
+	// Failed jobs stopped at a receipt they could not re-score and can be resumed from it
+	BackfillFailed BackfillStatus = "failed"
+)
+
+// Selects the receipts a backfill re-scores. Purchase dates are inclusive and either may be left
+// out. Empty lists match every rule version and the approved and pending statuses.
+type BackfillFilter struct {
+	From         string          `json:"from,omitempty"`
+	To           string          `json:"to,omitempty"`
+	Retailer     string          `json:"retailer,omitempty"`
+	RuleVersions []string        `json:"ruleVersions,omitempty"`
+	Statuses     []ReceiptStatus `json:"statuses,omitempty"`
+}
+
+// Body of a backfill request. Receipts are re-scored at up to ReceiptsPerSecond, or as fast as
+// the worker polls when it is zero.
+type BackfillRequest struct {
+	RuleVersion       string         `json:"ruleVersion"`
+	Filter            BackfillFilter `json:"filter"`
+	ReceiptsPerSecond float64        `json:"receiptsPerSecond"`
+	Reason            string         `json:"reason"`
+	Actor             string         `json:"actor"`
+}
+
+// The points of one receipt before and after a backfill re-scored it. Changed points are
+// recorded as an adjustment.
+type BackfillResult struct {
+	ReceiptID         string    `json:"receiptId"`
+	RuleVersionBefore string    `json:"ruleVersionBefore"`
+	PointsBefore      int       `json:"pointsBefore"`
+	PointsAfter       int       `json:"pointsAfter"`
+	AdjustmentID      string    `json:"adjustmentId,omitempty"`
+	RescoredAt        time.Time `json:"rescoredAt"`
+}
+
+// A job re-scoring the receipts selected when it started under a version of the rules. Receipts
+// are re-scored in order, so Processed is also the position the job resumes from. The receipts
+// and their results are stored apart from the job.
+type BackfillJob struct {
+	ID          string          `json:"id"`
+	Status      BackfillStatus  `json:"status"`
+	Request     BackfillRequest `json:"request"`
+	Total       int             `json:"total"`
+	Processed   int             `json:"processed"`
+	Changed     int             `json:"changed"`
+	PointsDelta int             `json:"pointsDelta"`
+	LastError   string          `json:"lastError,omitempty"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	UpdatedAt   time.Time       `json:"updatedAt"`
+	CompletedAt *time.Time      `json:"completedAt,omitempty"`
+}
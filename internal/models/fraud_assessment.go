@@ -0,0 +1,17 @@
+package models
+
+// Risk score computed for a receipt when it was submitted
+type FraudAssessment struct {
+	Score     float64       `json:"score"`
+	Threshold float64       `json:"threshold"`
+	Flagged   bool          `json:"flagged"`
+	Signals   []FraudSignal `json:"signals"`
+}
+
+// Contribution of a single fraud signal to a receipt's risk score
+type FraudSignal struct {
+	Name   string  `json:"name"`
+	Weight float64 `json:"weight"`
+	Score  float64 `json:"score"`
+	Reason string  `json:"reason"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// A change to the points awarded for a receipt, e.g. a clawback after a void or return
+type PointsAdjustment struct {
+	ID        string    `json:"id"`
+	ReceiptID string    `json:"receiptId"`
+	Points    int       `json:"points"`
+	Reason    string    `json:"reason"`
+	Actor     string    `json:"actor"`
+	CreatedAt time.Time `json:"createdAt"`
+}
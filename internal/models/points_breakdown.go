@@ -0,0 +1,29 @@
+package models
+
+// Itemised explanation of the points for a receipt
+type PointsBreakdown struct {
+	Total int          `json:"total"`
+	Lines []PointsLine `json:"lines"`
+}
+
+// Points earned from a single rule or promotion
+type PointsLine struct {
+	Rule        string `json:"rule"`
+	Points      int    `json:"points"`
+	Description string `json:"description"`
+}
+
+// Most points a receipt may earn under one of its customer's caps, fixed when it was processed
+// from the points the customer had already earned
+type PointsCeiling struct {
+	Cap    string `json:"cap"`
+	Points int    `json:"points"`
+	Reason string `json:"reason"`
+}
+
+// Most points a receipt may earn from each rule and in all, fixed when it was processed. A zero
+// limit is no limit.
+type ReceiptCaps struct {
+	PerRule    int `json:"perRule"`
+	PerReceipt int `json:"perReceipt"`
+}
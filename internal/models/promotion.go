@@ -0,0 +1,31 @@
+package models
+
+// A partner funded promotion awarding extra points on matching receipts.
+// Dates are inclusive and compared against the purchase date.
+type Promotion struct {
+	ID            string   `json:"id"`
+	Name          string   `json:"name"`
+	StartDate     string   `json:"startDate"`
+	EndDate       string   `json:"endDate"`
+	RetailerIDs   []string `json:"retailerIds"`
+	ItemPattern   string   `json:"itemPattern"`
+	Multiplier    float64  `json:"multiplier"`
+	BonusPoints   int      `json:"bonusPoints"`
+	Stackable     bool     `json:"stackable"`
+	BudgetPoints  int      `json:"budgetPoints"`
+	AwardedPoints int      `json:"awardedPoints"`
+}
+
+// Points a promotion awarded to a receipt when it was scored. The promotion's multiplier and
+// bonus, and the rule points the multiplier applied to, are kept with the award so it can be
+// recomputed as items are returned however the promotion is edited later.
+type PromotionAward struct {
+	PromotionID string  `json:"promotionId"`
+	Name        string  `json:"name"`
+	Points      int     `json:"points"`
+	Description string  `json:"description"`
+	ItemIndexes []int   `json:"itemIndexes,omitempty"`
+	Multiplier  float64 `json:"multiplier,omitempty"`
+	RulePoints  int     `json:"rulePoints,omitempty"`
+	BonusPoints int     `json:"bonusPoints,omitempty"`
+}
@@ -1,16 +1,106 @@
 package models
 
-// Contents of a receipt
+import "time"
+
+// Lifecycle status of a stored receipt
+type ReceiptStatus string
+
+const (
+	StatusPending  ReceiptStatus = "pending"
+	StatusApproved ReceiptStatus = "approved"
+	StatusRejected ReceiptStatus = "rejected"
+	StatusVoided   ReceiptStatus = "voided"
+)
+
+// Contents of a receipt. The purchase date and time are the store's wall clock, TimeZone is the
+// store's time zone and PurchasedAt is the instant they describe. RuleLines are the points from
+// each rule, calendar and expression rules included, fixed when the receipt was scored so that
+// editing the rules never changes them, and RulesDigest identifies the calendar and expression
+// rules they were scored under. Points are what the receipt earns once every cap is applied,
+// fixed whenever it is scored and awarded once it is approved. IssuedPoints are the points it was
+// awarded when approved, kept as they were for the liability report however it is rescored or
+// adjusted later. Revision counts the updates to a stored receipt, so that an update made from a
+// stale copy can be rejected.
 type Receipt struct {
-	ID           string
+	ID            string
+	Retailer      string           `json:"retailer"`
+	PurchaseDate  string           `json:"purchaseDate"`
+	PurchaseTime  string           `json:"purchaseTime"`
+	TimeZone      string           `json:"timeZone,omitempty"`
+	Total         string           `json:"total"`
+	Items         []Item           `json:"items"`
+	PurchasedAt   time.Time        `json:"-"`
+	Status        ReceiptStatus    `json:"-"`
+	RetailerID    string           `json:"-"`
+	RetailerName  string           `json:"-"`
+	ClientID      string           `json:"-"`
+	SubmittedAt   time.Time        `json:"-"`
+	Fingerprint   string           `json:"-"`
+	ReviewReasons []string         `json:"-"`
+	Review        *ReviewDecision  `json:"-"`
+	Fraud         *FraudAssessment `json:"-"`
+	Promotions    []PromotionAward `json:"-"`
+	Ceilings      []PointsCeiling  `json:"-"`
+	Caps          *ReceiptCaps     `json:"-"`
+	RuleVersion   string           `json:"-"`
+	RuleLines     []PointsLine     `json:"-"`
+	RulesDigest   string           `json:"-"`
+	Points        int              `json:"-"`
+	IssuedPoints  int              `json:"-"`
+	Revision      int              `json:"-"`
+}
+
+// Body of a receipt submission. Server assigned fields such as the ID cannot be set by the client.
+type ReceiptRequest struct {
 	Retailer     string `json:"retailer"`
 	PurchaseDate string `json:"purchaseDate"`
 	PurchaseTime string `json:"purchaseTime"`
+	TimeZone     string `json:"timeZone"`
 	Total        string `json:"total"`
 	Items        []Item `json:"items"`
 }
 
+// Receipt returns the submitted receipt, ready for validation and processing
+func (r ReceiptRequest) Receipt() Receipt {
+	return Receipt{
+		Retailer:     r.Retailer,
+		PurchaseDate: r.PurchaseDate,
+		PurchaseTime: r.PurchaseTime,
+		TimeZone:     r.TimeZone,
+		Total:        r.Total,
+		Items:        r.Items,
+	}
+}
+
+// Outcome of a manual review of a flagged receipt
+type ReviewDecision struct {
+	Status    ReceiptStatus `json:"status"`
+	Comment   string        `json:"comment"`
+	Actor     string        `json:"actor"`
+	DecidedAt time.Time     `json:"decidedAt"`
+}
+
 type Item struct {
 	ShortDescription string `json:"shortDescription"`
 	Price            string `json:"price"`
+	Returned         bool   `json:"-"`
+}
+
+// Body of a void request
+type VoidRequest struct {
+	Reason string `json:"reason"`
+	Actor  string `json:"actor"`
+}
+
+// Body of a partial return request, items are indexes into the receipt's items
+type ReturnRequest struct {
+	Items  []int  `json:"items"`
+	Reason string `json:"reason"`
+	Actor  string `json:"actor"`
+}
+
+// Body of an approve or reject request from the review queue
+type ReviewRequest struct {
+	Comment string `json:"comment"`
+	Actor   string `json:"actor"`
 }
@@ -0,0 +1,69 @@
+package models
+
+// What a report groups receipts by
+type ReportDimension string
+
+const (
+	DimensionRetailer ReportDimension = "retailer"
+	DimensionDate     ReportDimension = "date"
+	DimensionWeekday  ReportDimension = "weekday"
+	DimensionHour     ReportDimension = "hour"
+)
+
+// ReportDimensions lists every dimension a report can be grouped by
+var ReportDimensions = []ReportDimension{DimensionRetailer, DimensionDate, DimensionWeekday, DimensionHour}
+
+// Parameters of an aggregate report. Dates are inclusive purchase dates, empty when unbounded.
+// Receipts are grouped by date, weekday and hour in their store's time zone, or in TimeZone
+// when it is set.
+type ReportQuery struct {
+	GroupBy  ReportDimension
+	From     string
+	To       string
+	TimeZone string
+}
+
+// Aggregates over the approved receipts purchased in a report's date range
+type Report struct {
+	GroupBy  ReportDimension `json:"groupBy"`
+	From     string          `json:"from,omitempty"`
+	To       string          `json:"to,omitempty"`
+	TimeZone string          `json:"timeZone,omitempty"`
+	Groups   []ReportGroup   `json:"groups"`
+	Total    ReportGroup     `json:"total"`
+}
+
+// Aggregates for the receipts sharing one value of a report's dimension
+type ReportGroup struct {
+	Key           string  `json:"key"`
+	Receipts      int     `json:"receipts"`
+	Spend         string  `json:"spend"`
+	Points        int     `json:"points"`
+	AveragePoints float64 `json:"averagePoints"`
+	P50Points     int     `json:"p50Points"`
+	P90Points     int     `json:"p90Points"`
+	P99Points     int     `json:"p99Points"`
+}
+
+// Outstanding points and the liability they represent as of a date, by the month they were issued
+type LiabilityReport struct {
+	AsOf         string           `json:"asOf"`
+	PointValue   float64          `json:"pointValue"`
+	ExpiryMonths int              `json:"expiryMonths"`
+	BreakageRate float64          `json:"breakageRate"`
+	Months       []LiabilityMonth `json:"months"`
+	Total        LiabilityMonth   `json:"total"`
+}
+
+// Points issued in one month and what remains of them as of the report date
+type LiabilityMonth struct {
+	Month             string `json:"month"`
+	IssuedPoints      int    `json:"issuedPoints"`
+	AdjustedPoints    int    `json:"adjustedPoints"`
+	ExpiredPoints     int    `json:"expiredPoints"`
+	OutstandingPoints int    `json:"outstandingPoints"`
+	ExpiresOn         string `json:"expiresOn,omitempty"`
+	BreakagePoints    int    `json:"breakagePoints"`
+	LiabilityPoints   int    `json:"liabilityPoints"`
+	LiabilityValue    string `json:"liabilityValue"`
+}
@@ -0,0 +1,10 @@
+package models
+
+// A merchant known to the registry. Receipts are matched to a retailer by its display name or any alias.
+type Retailer struct {
+	ID          string   `json:"id"`
+	DisplayName string   `json:"displayName"`
+	Aliases     []string `json:"aliases"`
+	Categories  []string `json:"categories"`
+	Active      bool     `json:"active"`
+}
@@ -0,0 +1,66 @@
+package models
+
+// Values of the scoring rules. Times are HH:MM and the time window excludes both ends.
+type RuleConfig struct {
+	PointsPerRetailerCharacter int     `json:"pointsPerRetailerCharacter"`
+	PointsForRoundDollar       int     `json:"pointsForRoundDollar"`
+	PointsForQuarterMultiple   int     `json:"pointsForQuarterMultiple"`
+	PointsPerItemPair          int     `json:"pointsPerItemPair"`
+	DescriptionLengthMultiple  int     `json:"descriptionLengthMultiple"`
+	DescriptionPriceMultiplier float64 `json:"descriptionPriceMultiplier"`
+	PointsForOddDay            int     `json:"pointsForOddDay"`
+	PointsForTimeWindow        int     `json:"pointsForTimeWindow"`
+	TimeWindowStart            string  `json:"timeWindowStart"`
+	TimeWindowEnd              string  `json:"timeWindowEnd"`
+}
+
+// A candidate rule configuration to score stored receipts with. Overrides names the rules the
+// request sets, and only those replace the rules each receipt was scored under. A sample size
+// of zero scores every receipt.
+type RuleSimulationRequest struct {
+	Rules        RuleConfig `json:"rules"`
+	Overrides    []string   `json:"-"`
+	SampleSize   int        `json:"sampleSize"`
+	Seed         uint64     `json:"seed"`
+	TopRetailers int        `json:"topRetailers"`
+}
+
+// How the points for stored receipts would change under a candidate rule configuration
+type RuleSimulation struct {
+	Rules           RuleConfig         `json:"rules"`
+	Receipts        int                `json:"receipts"`
+	SampledFrom     int                `json:"sampledFrom"`
+	Seed            uint64             `json:"seed,omitempty"`
+	ChangedReceipts int                `json:"changedReceipts"`
+	PointsDelta     int                `json:"pointsDelta"`
+	Current         PointsDistribution `json:"current"`
+	Candidate       PointsDistribution `json:"candidate"`
+	RuleDeltas      []RuleDelta        `json:"ruleDeltas"`
+	TopRetailers    []RetailerDelta    `json:"topRetailers"`
+}
+
+// Points awarded across the simulated receipts
+type PointsDistribution struct {
+	Points        int     `json:"points"`
+	AveragePoints float64 `json:"averagePoints"`
+	P50Points     int     `json:"p50Points"`
+	P90Points     int     `json:"p90Points"`
+	P99Points     int     `json:"p99Points"`
+}
+
+// Change in the points awarded by one rule
+type RuleDelta struct {
+	Rule            string `json:"rule"`
+	CurrentPoints   int    `json:"currentPoints"`
+	CandidatePoints int    `json:"candidatePoints"`
+	PointsDelta     int    `json:"pointsDelta"`
+}
+
+// Change in the points awarded for one retailer's receipts
+type RetailerDelta struct {
+	Retailer        string `json:"retailer"`
+	Receipts        int    `json:"receipts"`
+	CurrentPoints   int    `json:"currentPoints"`
+	CandidatePoints int    `json:"candidatePoints"`
+	PointsDelta     int    `json:"pointsDelta"`
+}
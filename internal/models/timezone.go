@@ -0,0 +1,67 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var errBadTimeZone = errors.New("must be an IANA time zone such as America/Chicago or a UTC offset such as -05:00")
+
+// LoadTimeZone reads a store time zone, either an IANA name such as America/Chicago or a
+// fixed UTC offset such as -05:00 or +0530. Offsets do not follow daylight saving time.
+func LoadTimeZone(name string) (*time.Location, error) {
+	if name == "" {
+		return nil, fmt.Errorf("time zone is empty: %w", errBadTimeZone)
+	}
+
+	if name[0] == '+' || name[0] == '-' {
+		for _, layout := range []string{"-07:00", "-0700", "-07"} {
+			if offset, err := time.Parse(layout, name); err == nil {
+				_, seconds := offset.Zone()
+				return time.FixedZone("UTC"+name, seconds), nil
+			}
+		}
+		return nil, fmt.Errorf("time zone %q: %w", name, errBadTimeZone)
+	}
+
+	location, err := time.LoadLocation(name)
+	if err != nil || name == "Local" {
+		return nil, fmt.Errorf("time zone %q: %w", name, errBadTimeZone)
+	}
+	return location, nil
+}
+
+// PurchaseInstant is when a receipt's purchase happened, reading its purchase date and time
+// as the wall clock in the store's time zone. A wall clock time skipped by a daylight saving
+// change is moved forward by the length of the change.
+func PurchaseInstant(purchaseDate string, purchaseTime string, location *time.Location) (time.Time, error) {
+	wallClock, err := time.Parse("2006-01-02 15:04", purchaseDate+" "+purchaseTime)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	instant := time.Date(wallClock.Year(), wallClock.Month(), wallClock.Day(), wallClock.Hour(), wallClock.Minute(), 0, 0, location)
+	// time.Date may resolve a skipped wall clock to either side of the change, so the gap is
+	// measured and the instant moved past it
+	resolved := time.Date(instant.Year(), instant.Month(), instant.Day(), instant.Hour(), instant.Minute(), 0, 0, time.UTC)
+	if skipped := wallClock.Sub(resolved); skipped > 0 {
+		instant = instant.Add(skipped)
+	}
+	return instant, nil
+}
+
+// LocalPurchase returns the purchase date and time of a receipt in the store's time zone.
+// Receipts stored before purchases were normalized to an instant use the date and time
+// exactly as submitted.
+func (r Receipt) LocalPurchase() (purchaseDate string, purchaseTime string) {
+	if r.PurchasedAt.IsZero() {
+		return r.PurchaseDate, r.PurchaseTime
+	}
+
+	local := r.PurchasedAt
+	if location, err := LoadTimeZone(r.TimeZone); err == nil {
+		local = local.In(location)
+	}
+	return local.Format("2006-01-02"), local.Format("15:04")
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Receipt events partners can subscribe to
+type WebhookEvent string
+
+const (
+	EventReceiptScored   WebhookEvent = "receipt.scored"
+	EventReceiptFlagged  WebhookEvent = "receipt.flagged"
+	EventReceiptApproved WebhookEvent = "receipt.approved"
+	EventReceiptRejected WebhookEvent = "receipt.rejected"
+	EventReceiptVoided   WebhookEvent = "receipt.voided"
+	EventReceiptAdjusted WebhookEvent = "receipt.adjusted"
+)
+
+// WebhookEvents lists every event a subscription may name
+var WebhookEvents = []WebhookEvent{
+	EventReceiptScored,
+	EventReceiptFlagged,
+	EventReceiptApproved,
+	EventReceiptRejected,
+	EventReceiptVoided,
+	EventReceiptAdjusted,
+}
+
+// A partner endpoint notified of receipt events. The secret signs every delivery and is only
+// shown when the subscription is created.
+type WebhookSubscription struct {
+	ID        string         `json:"id"`
+	URL       string         `json:"url"`
+	Events    []WebhookEvent `json:"events"`
+	Secret    string         `json:"secret,omitempty"`
+	CreatedAt time.Time      `json:"createdAt"`
+}
+
+// Body of a webhook subscription request, an empty list of events subscribes to all of them
+type WebhookSubscriptionRequest struct {
+	URL    string         `json:"url"`
+	Events []WebhookEvent `json:"events"`
+}
+
+// Lifecycle status of a webhook delivery
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliveryDelivered DeliveryStatus = "delivered"
+	// Failed deliveries have used up their retries and sit in the dead-letter list until redelivered
+	DeliveryFailed DeliveryStatus = "failed"
+)
+
+// One notification of an event to one subscription, retried until it is delivered or fails
+type WebhookDelivery struct {
+	ID             string          `json:"id"`
+	SubscriptionID string          `json:"subscriptionId"`
+	Event          WebhookEvent    `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         DeliveryStatus  `json:"status"`
+	Attempts       int             `json:"attempts"`
+	LastError      string          `json:"lastError,omitempty"`
+	CreatedAt      time.Time       `json:"createdAt"`
+	NextAttemptAt  time.Time       `json:"nextAttemptAt"`
+	DeliveredAt    *time.Time      `json:"deliveredAt,omitempty"`
+}
+
+// Body posted to a webhook when a receipt is scored or changes state
+type ReceiptNotification struct {
+	Event      WebhookEvent      `json:"event"`
+	OccurredAt time.Time         `json:"occurredAt"`
+	ReceiptID  string            `json:"receiptId"`
+	Status     ReceiptStatus     `json:"status"`
+	Retailer   string            `json:"retailer"`
+	Total      string            `json:"total"`
+	Points     int               `json:"points"`
+	Reasons    []string          `json:"reasons,omitempty"`
+	Adjustment *PointsAdjustment `json:"adjustment,omitempty"`
+}
@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func newTestLimiter(rate float64, burst int) (*Limiter, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)}
+	limiter := New(rate, burst)
+	limiter.now = clock.Now
+	return limiter, clock
+}
+
+func TestLimiter_Burst(t *testing.T) {
+	limiter, clock := newTestLimiter(1, 3)
+
+	for i := 0; i < 3; i++ {
+		if allowed, _ := limiter.Allow("partner-a"); !allowed {
+			t.Fatalf("Expected request %d within the burst to be allowed", i+1)
+		}
+	}
+
+	allowed, retryAfter := limiter.Allow("partner-a")
+	if allowed {
+		t.Fatalf("Expected the request after the burst to be limited")
+	}
+	if retryAfter != time.Second {
+		t.Errorf("Expected to retry after 1s, got %s", retryAfter)
+	}
+
+	if allowed, _ := limiter.Allow("partner-b"); !allowed {
+		t.Errorf("Expected other clients to have their own bucket")
+	}
+
+	clock.now = clock.now.Add(time.Second)
+	if allowed, _ := limiter.Allow("partner-a"); !allowed {
+		t.Errorf("Expected a token to be refilled after 1s")
+	}
+}
+
+func TestLimiter_SweepsIdleBuckets(t *testing.T) {
+	limiter, clock := newTestLimiter(10, 5)
+
+	limiter.Allow("partner-a")
+	clock.now = clock.now.Add(2 * sweepInterval)
+	limiter.Allow("partner-b")
+
+	if _, ok := limiter.buckets["partner-a"]; ok {
+		t.Errorf("Expected the idle bucket to be forgotten")
+	}
+	if len(limiter.buckets) != 1 {
+		t.Errorf("Expected 1 bucket, got %d", len(limiter.buckets))
+	}
+}
+
+func TestLimiter_NilAllowsEverything(t *testing.T) {
+	limiter := New(0, 10)
+	if limiter != nil {
+		t.Fatalf("Expected a disabled limiter to be nil")
+	}
+	if allowed, _ := limiter.Allow("partner-a"); !allowed {
+		t.Errorf("Expected a nil limiter to allow requests")
+	}
+}
@@ -0,0 +1,179 @@
+package reporting
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+)
+
+// DefaultPointValue is the dollar value of a point unless configured otherwise
+const DefaultPointValue = 0.01
+
+// LiabilityCSVHeader names the columns written by WriteLiabilityCSV
+var LiabilityCSVHeader = []string{"month", "issuedPoints", "adjustedPoints", "expiredPoints", "outstandingPoints", "expiresOn", "breakagePoints", "liabilityPoints", "liabilityValue"}
+
+// LiabilityPolicy values outstanding points in the liability report.
+type LiabilityPolicy struct {
+	// PointValue is the dollar value of one point
+	PointValue float64
+	// ExpiryMonths is how many months after the month they were issued points expire, zero if they never do
+	ExpiryMonths int
+	// BreakageRate is the share of points expected to expire unredeemed. Points that never
+	// expire are all expected to be redeemed.
+	BreakageRate float64
+}
+
+// issuance totals the points issued in one month.
+type issuance struct {
+	month    time.Time
+	issued   int
+	adjusted int
+}
+
+// Liability reports the points outstanding at the end of the asOf date by the month they were
+// issued. Points are issued when a receipt is approved and fixed on it then, and only
+// adjustments recorded by the end of the day count, so the report for a past date does not
+// change as receipts are voided, returned or rescored later, or as the rules are edited.
+func (s *Service) Liability(ctx context.Context, asOf time.Time) (models.LiabilityReport, error) {
+	asOf = time.Date(asOf.Year(), asOf.Month(), asOf.Day(), 0, 0, 0, 0, time.UTC)
+	cutoff := asOf.AddDate(0, 0, 1)
+
+	receipts, err := s.repo.FindByPurchaseDate(ctx, "", "")
+	if err != nil {
+		return models.LiabilityReport{}, err
+	}
+
+	months := make(map[time.Time]*issuance)
+	for _, receipt := range receipts {
+		issuedAt := issuanceTime(receipt).UTC()
+		if !issuedAt.Before(cutoff) {
+			continue
+		}
+
+		adjustments, err := s.repo.FindAdjustmentsByReceiptID(ctx, receipt.ID)
+		if err != nil {
+			return models.LiabilityReport{}, err
+		}
+
+		issued := receipt.IssuedPoints
+		adjusted := 0
+		for _, adjustment := range adjustments {
+			if adjustment.CreatedAt.Before(cutoff) {
+				adjusted += adjustment.Points
+			}
+		}
+		if issued == 0 && adjusted == 0 {
+			continue
+		}
+
+		month := time.Date(issuedAt.Year(), issuedAt.Month(), 1, 0, 0, 0, 0, time.UTC)
+		if months[month] == nil {
+			months[month] = &issuance{month: month}
+		}
+		months[month].issued += issued
+		months[month].adjusted += adjusted
+	}
+
+	ordered := make([]*issuance, 0, len(months))
+	for _, month := range months {
+		ordered = append(ordered, month)
+	}
+	slices.SortFunc(ordered, func(a, b *issuance) int { return a.month.Compare(b.month) })
+
+	report := models.LiabilityReport{
+		AsOf:         asOf.Format("2006-01-02"),
+		PointValue:   s.Policy.PointValue,
+		ExpiryMonths: s.Policy.ExpiryMonths,
+		BreakageRate: s.Policy.BreakageRate,
+		Months:       make([]models.LiabilityMonth, 0, len(ordered)),
+		Total:        models.LiabilityMonth{Month: "total"},
+	}
+	for _, month := range ordered {
+		row := s.Policy.value(month, asOf)
+		report.Months = append(report.Months, row)
+
+		report.Total.IssuedPoints += row.IssuedPoints
+		report.Total.AdjustedPoints += row.AdjustedPoints
+		report.Total.ExpiredPoints += row.ExpiredPoints
+		report.Total.OutstandingPoints += row.OutstandingPoints
+		report.Total.BreakagePoints += row.BreakagePoints
+		report.Total.LiabilityPoints += row.LiabilityPoints
+	}
+	report.Total.LiabilityValue = s.Policy.dollars(report.Total.LiabilityPoints)
+
+	s.logger.DebugContext(ctx, "Liability report built", "as_of", report.AsOf, "months", len(report.Months), "liability_points", report.Total.LiabilityPoints)
+	return report, nil
+}
+
+// WriteLiabilityCSV writes one row per issuance month of the report, without the total.
+func WriteLiabilityCSV(w io.Writer, report models.LiabilityReport) error {
+	writer := csv.NewWriter(w)
+	writer.Write(LiabilityCSVHeader)
+	for _, month := range report.Months {
+		writer.Write([]string{
+			month.Month,
+			strconv.Itoa(month.IssuedPoints),
+			strconv.Itoa(month.AdjustedPoints),
+			strconv.Itoa(month.ExpiredPoints),
+			strconv.Itoa(month.OutstandingPoints),
+			month.ExpiresOn,
+			strconv.Itoa(month.BreakagePoints),
+			strconv.Itoa(month.LiabilityPoints),
+			month.LiabilityValue,
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// value applies the expiry policy to the points issued in a month. They expire at the end of
+// the month ExpiryMonths later, e.g. points issued in January 2022 with a 12 month expiry
+// expire on 2023-02-01.
+func (p LiabilityPolicy) value(month *issuance, asOf time.Time) models.LiabilityMonth {
+	row := models.LiabilityMonth{
+		Month:          month.month.Format("2006-01"),
+		IssuedPoints:   month.issued,
+		AdjustedPoints: month.adjusted,
+	}
+	net := month.issued + month.adjusted
+
+	if p.ExpiryMonths <= 0 {
+		row.OutstandingPoints = net
+		row.LiabilityPoints = net
+		row.LiabilityValue = p.dollars(net)
+		return row
+	}
+
+	expiresOn := month.month.AddDate(0, p.ExpiryMonths+1, 0)
+	row.ExpiresOn = expiresOn.Format("2006-01-02")
+	if !expiresOn.After(asOf) {
+		row.ExpiredPoints = net
+		row.LiabilityValue = p.dollars(0)
+		return row
+	}
+
+	row.OutstandingPoints = net
+	row.BreakagePoints = int(math.Round(float64(net) * p.BreakageRate))
+	row.LiabilityPoints = net - row.BreakagePoints
+	row.LiabilityValue = p.dollars(row.LiabilityPoints)
+	return row
+}
+
+func (p LiabilityPolicy) dollars(points int) string {
+	return formatCents(int64(math.Round(float64(points) * p.PointValue * 100)))
+}
+
+// issuanceTime is when a receipt's points were awarded: when it was approved after review,
+// or when it was submitted if it was approved straight away.
+func issuanceTime(receipt models.Receipt) time.Time {
+	if receipt.Review != nil && receipt.Review.Status == models.StatusApproved {
+		return receipt.Review.DecidedAt
+	}
+	return receipt.SubmittedAt
+}
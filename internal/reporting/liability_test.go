@@ -0,0 +1,131 @@
+package reporting
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+	"github.com/javier-tello/receipt-processor-challenge/internal/repositories"
+)
+
+func day(date string) time.Time {
+	parsed, _ := time.Parse("2006-01-02", date)
+	return parsed.Add(12 * time.Hour)
+}
+
+// adjust records a points adjustment against a stored receipt at the given time
+func adjust(t *testing.T, repo repositories.ReceiptRepository, receiptID string, points int, at time.Time) {
+	receipt, err := repo.FindByID(context.Background(), receiptID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := repo.AdjustReceipt(context.Background(), receiptID, receipt, models.PointsAdjustment{Points: points, CreatedAt: at}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+// setupLiabilityService stores receipts whose points were issued in January and February 2022
+// and adjusted later on.
+func setupLiabilityService(t *testing.T) *Service {
+	repo := repositories.NewInMemoryReceiptRepo(nil, nil)
+	ctx := context.Background()
+
+	// 30 points issued in January, 10 clawed back by a return in February
+	returned, _ := repo.ProcessReceipt(ctx, models.Receipt{Status: models.StatusApproved, SubmittedAt: day("2022-01-10"), IssuedPoints: 30,
+		Items: []models.Item{{Price: "1.00"}, {Price: "1.00"}}})
+	adjust(t, repo, returned, -10, day("2022-02-05"))
+
+	// Submitted in January but approved in February, then voided in March
+	voided, _ := repo.ProcessReceipt(ctx, models.Receipt{Status: models.StatusVoided, SubmittedAt: day("2022-01-30"), IssuedPoints: 20,
+		Review: &models.ReviewDecision{Status: models.StatusApproved, DecidedAt: day("2022-02-02")},
+		Items:  []models.Item{{Price: "1.00"}, {Price: "1.00"}}})
+	adjust(t, repo, voided, -20, day("2022-03-10"))
+
+	repo.ProcessReceipt(ctx, models.Receipt{Status: models.StatusApproved, SubmittedAt: day("2022-02-15"), IssuedPoints: 10, Items: []models.Item{{Price: "1.00"}}})
+	// Neither pending nor rejected receipts have been issued points
+	repo.ProcessReceipt(ctx, models.Receipt{Status: models.StatusPending, SubmittedAt: day("2022-02-20"), Items: []models.Item{{Price: "1.00"}}})
+	repo.ProcessReceipt(ctx, models.Receipt{Status: models.StatusRejected, SubmittedAt: day("2022-02-20"), Items: []models.Item{{Price: "1.00"}}})
+
+	return NewService(repo, itemScorer{}, nil)
+}
+
+func TestService_Liability(t *testing.T) {
+	service := setupLiabilityService(t)
+
+	tests := []struct {
+		name   string
+		asOf   string
+		months []models.LiabilityMonth
+		total  string
+	}{
+		{"Before Any Adjustments", "2022-01-31", []models.LiabilityMonth{
+			{Month: "2022-01", IssuedPoints: 30, OutstandingPoints: 30, LiabilityPoints: 30, LiabilityValue: "0.30"},
+		}, "0.30"},
+		{"After The Return", "2022-02-28", []models.LiabilityMonth{
+			{Month: "2022-01", IssuedPoints: 30, AdjustedPoints: -10, OutstandingPoints: 20, LiabilityPoints: 20, LiabilityValue: "0.20"},
+			{Month: "2022-02", IssuedPoints: 30, OutstandingPoints: 30, LiabilityPoints: 30, LiabilityValue: "0.30"},
+		}, "0.50"},
+		{"After The Void", "2022-03-31", []models.LiabilityMonth{
+			{Month: "2022-01", IssuedPoints: 30, AdjustedPoints: -10, OutstandingPoints: 20, LiabilityPoints: 20, LiabilityValue: "0.20"},
+			{Month: "2022-02", IssuedPoints: 30, AdjustedPoints: -20, OutstandingPoints: 10, LiabilityPoints: 10, LiabilityValue: "0.10"},
+		}, "0.30"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			report, err := service.Liability(context.Background(), day(test.asOf))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if report.AsOf != test.asOf || !reflect.DeepEqual(report.Months, test.months) {
+				t.Errorf("Expected months %+v as of %s, got %+v as of %s", test.months, test.asOf, report.Months, report.AsOf)
+			}
+			if report.Total.LiabilityValue != test.total {
+				t.Errorf("Expected a total liability of %s, got %s", test.total, report.Total.LiabilityValue)
+			}
+		})
+	}
+}
+
+func TestService_LiabilityExpiryAndBreakage(t *testing.T) {
+	service := setupLiabilityService(t)
+	service.Policy = LiabilityPolicy{PointValue: 0.05, ExpiryMonths: 1, BreakageRate: 0.25}
+
+	report, _ := service.Liability(context.Background(), day("2022-02-28"))
+	expected := []models.LiabilityMonth{
+		{Month: "2022-01", IssuedPoints: 30, AdjustedPoints: -10, OutstandingPoints: 20, ExpiresOn: "2022-03-01", BreakagePoints: 5, LiabilityPoints: 15, LiabilityValue: "0.75"},
+		{Month: "2022-02", IssuedPoints: 30, OutstandingPoints: 30, ExpiresOn: "2022-04-01", BreakagePoints: 8, LiabilityPoints: 22, LiabilityValue: "1.10"},
+	}
+	if !reflect.DeepEqual(report.Months, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, report.Months)
+	}
+
+	// January's points expire on the first of March
+	report, _ = service.Liability(context.Background(), day("2022-03-01"))
+	if january := report.Months[0]; january.ExpiredPoints != 20 || january.OutstandingPoints != 0 || january.LiabilityValue != "0.00" {
+		t.Errorf("Expected January's 20 points to have expired, got %+v", january)
+	}
+	if report.Total.OutstandingPoints != 30 || report.Total.ExpiredPoints != 20 || report.Total.LiabilityPoints != 22 {
+		t.Errorf("Unexpected total %+v", report.Total)
+	}
+}
+
+func TestWriteLiabilityCSV(t *testing.T) {
+	service := setupLiabilityService(t)
+	report, _ := service.Liability(context.Background(), day("2022-01-31"))
+
+	var buf bytes.Buffer
+	if err := WriteLiabilityCSV(&buf, report); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	rows, _ := csv.NewReader(&buf).ReadAll()
+	expected := [][]string{LiabilityCSVHeader, {"2022-01", "30", "0", "0", "30", "", "0", "30", "0.30"}}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Expected rows %v, got %v", expected, rows)
+	}
+}
@@ -0,0 +1,235 @@
+// Package reporting aggregates stored receipts into points and spend reports.
+package reporting
+
+import (
+	"cmp"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/logging"
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+	"github.com/javier-tello/receipt-processor-challenge/internal/repositories"
+)
+
+// CSVHeader names the columns written by WriteCSV
+var CSVHeader = []string{"key", "receipts", "spend", "points", "averagePoints", "p50Points", "p90Points", "p99Points"}
+
+// Scorer returns the points awarded for a stored receipt.
+type Scorer interface {
+	AwardedPoints(ctx context.Context, receipt models.Receipt) int
+}
+
+// Service builds reports over the receipt repository from the points awarded by the Scorer.
+type Service struct {
+	// Policy values the points in the liability report
+	Policy LiabilityPolicy
+	repo   repositories.ReceiptRepository
+	scorer Scorer
+	logger *slog.Logger
+}
+
+func NewService(repo repositories.ReceiptRepository, scorer Scorer, logger *slog.Logger) *Service {
+	return &Service{
+		Policy: LiabilityPolicy{PointValue: DefaultPointValue},
+		repo:   repo,
+		scorer: scorer,
+		logger: logging.OrDefault(logger),
+	}
+}
+
+// accumulator collects the receipts in one group of a report.
+type accumulator struct {
+	key        string
+	order      int
+	spendCents int64
+	points     []int
+}
+
+// Report aggregates the approved receipts purchased in the query's date range.
+func (s *Service) Report(ctx context.Context, query models.ReportQuery) (models.Report, error) {
+	receipts, err := s.repo.FindByPurchaseDate(ctx, query.From, query.To)
+	if err != nil {
+		return models.Report{}, err
+	}
+
+	var location *time.Location
+	if query.TimeZone != "" {
+		if location, err = models.LoadTimeZone(query.TimeZone); err != nil {
+			return models.Report{}, err
+		}
+	}
+
+	groups := make(map[string]*accumulator)
+	total := &accumulator{key: "total"}
+	for _, receipt := range receipts {
+		if receipt.Status != models.StatusApproved {
+			continue
+		}
+
+		key, order, ok := groupKey(query.GroupBy, receipt, location)
+		if !ok {
+			s.logger.WarnContext(ctx, "Receipt left out of report, cannot group it", "receipt_id", receipt.ID, "group_by", query.GroupBy)
+			continue
+		}
+		group, exists := groups[key]
+		if !exists {
+			group = &accumulator{key: key, order: order}
+			groups[key] = group
+		}
+
+		spend := spendCents(receipt)
+		points := s.scorer.AwardedPoints(ctx, receipt)
+		for _, acc := range []*accumulator{group, total} {
+			acc.spendCents += spend
+			acc.points = append(acc.points, points)
+		}
+	}
+
+	ordered := make([]*accumulator, 0, len(groups))
+	for _, group := range groups {
+		ordered = append(ordered, group)
+	}
+	slices.SortFunc(ordered, func(a, b *accumulator) int {
+		return cmp.Or(cmp.Compare(a.order, b.order), cmp.Compare(a.key, b.key))
+	})
+
+	report := models.Report{GroupBy: query.GroupBy, From: query.From, To: query.To, TimeZone: query.TimeZone, Groups: make([]models.ReportGroup, 0, len(ordered)), Total: total.summarise()}
+	for _, group := range ordered {
+		report.Groups = append(report.Groups, group.summarise())
+	}
+
+	s.logger.DebugContext(ctx, "Report built", "group_by", query.GroupBy, "from", query.From, "to", query.To, "receipts", report.Total.Receipts)
+	return report, nil
+}
+
+// WriteCSV writes one row per group of the report, without the total.
+func WriteCSV(w io.Writer, report models.Report) error {
+	writer := csv.NewWriter(w)
+	writer.Write(CSVHeader)
+	for _, group := range report.Groups {
+		writer.Write([]string{
+			group.Key,
+			strconv.Itoa(group.Receipts),
+			group.Spend,
+			strconv.Itoa(group.Points),
+			strconv.FormatFloat(group.AveragePoints, 'f', 2, 64),
+			strconv.Itoa(group.P50Points),
+			strconv.Itoa(group.P90Points),
+			strconv.Itoa(group.P99Points),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func (a *accumulator) summarise() models.ReportGroup {
+	group := models.ReportGroup{Key: a.key, Receipts: len(a.points), Spend: formatCents(a.spendCents)}
+	if len(a.points) == 0 {
+		return group
+	}
+
+	distribution := Distribution(a.points)
+	group.Points = distribution.Points
+	group.AveragePoints = distribution.AveragePoints
+	group.P50Points = distribution.P50Points
+	group.P90Points = distribution.P90Points
+	group.P99Points = distribution.P99Points
+	return group
+}
+
+// Distribution totals and averages points and finds their 50th, 90th and 99th percentiles.
+func Distribution(points []int) models.PointsDistribution {
+	if len(points) == 0 {
+		return models.PointsDistribution{}
+	}
+
+	sorted := slices.Clone(points)
+	slices.Sort(sorted)
+
+	var d models.PointsDistribution
+	for _, p := range sorted {
+		d.Points += p
+	}
+	d.AveragePoints = math.Round(float64(d.Points)/float64(len(sorted))*100) / 100
+	d.P50Points = percentile(sorted, 50)
+	d.P90Points = percentile(sorted, 90)
+	d.P99Points = percentile(sorted, 99)
+	return d
+}
+
+// groupKey returns the group a receipt falls into and where that group sorts. Weekdays sort
+// Monday first rather than alphabetically. Times are the store's unless a location is given.
+func groupKey(dimension models.ReportDimension, receipt models.Receipt, location *time.Location) (string, int, bool) {
+	purchaseDate, purchaseTime := receipt.LocalPurchase()
+	if location != nil && !receipt.PurchasedAt.IsZero() {
+		local := receipt.PurchasedAt.In(location)
+		purchaseDate, purchaseTime = local.Format("2006-01-02"), local.Format("15:04")
+	}
+
+	switch dimension {
+	case models.DimensionRetailer:
+		if receipt.RetailerName != "" {
+			return receipt.RetailerName, 0, true
+		}
+		return strings.TrimSpace(receipt.Retailer), 0, true
+	case models.DimensionDate:
+		return purchaseDate, 0, purchaseDate != ""
+	case models.DimensionWeekday:
+		date, err := time.Parse("2006-01-02", purchaseDate)
+		if err != nil {
+			return "", 0, false
+		}
+		return date.Weekday().String(), (int(date.Weekday()) + 6) % 7, true
+	case models.DimensionHour:
+		clock, err := time.Parse("15:04", purchaseTime)
+		if err != nil {
+			return "", 0, false
+		}
+		return fmt.Sprintf("%02d:00", clock.Hour()), clock.Hour(), true
+	}
+	return "", 0, false
+}
+
+// percentile returns the nearest-rank percentile of sorted points.
+func percentile(sorted []int, p int) int {
+	rank := int(math.Ceil(float64(p) / 100 * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
+
+// spendCents is what the customer paid, less any items they returned.
+func spendCents(receipt models.Receipt) int64 {
+	spend, ok := ToCents(receipt.Total)
+	if !ok {
+		return 0
+	}
+	for _, item := range receipt.Items {
+		if !item.Returned {
+			continue
+		}
+		if price, ok := ToCents(item.Price); ok {
+			spend -= price
+		}
+	}
+	return max(spend, 0)
+}
+
+// ToCents parses a dollar amount such as "35.35" into cents.
+func ToCents(amount string) (int64, bool) {
+	value, err := strconv.ParseFloat(amount, 64)
+	if err != nil {
+		return 0, false
+	}
+	return int64(math.Round(value * 100)), true
+}
+
+func formatCents(cents int64) string {
+	return fmt.Sprintf("%d.%02d", cents/100, cents%100)
+}
@@ -0,0 +1,170 @@
+package reporting
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+	"github.com/javier-tello/receipt-processor-challenge/internal/repositories"
+)
+
+// itemScorer awards approved receipts 10 points per item
+type itemScorer struct{}
+
+func (itemScorer) AwardedPoints(ctx context.Context, receipt models.Receipt) int {
+	if receipt.Status != models.StatusApproved {
+		return 0
+	}
+	return 10 * len(receipt.Items)
+}
+
+func setupService(t *testing.T) *Service {
+	repo := repositories.NewInMemoryReceiptRepo(nil, nil)
+	receipts := []models.Receipt{
+		// Saturday and Sunday at M&M Corner Market, one with a returned item
+		{Retailer: "M&M Corner Market", PurchaseDate: "2022-03-19", PurchaseTime: "14:33", Total: "9.00", Status: models.StatusApproved,
+			Items: []models.Item{{Price: "2.25"}, {Price: "2.25"}, {Price: "2.25"}, {Price: "2.25", Returned: true}}},
+		{Retailer: "M&M Corner Market", PurchaseDate: "2022-03-20", PurchaseTime: "14:01", Total: "1.00", Status: models.StatusApproved,
+			Items: []models.Item{{Price: "1.00"}}},
+		// Target, named by the retailer registry
+		{Retailer: "TARGET STORE #42", RetailerName: "Target", PurchaseDate: "2022-03-21", PurchaseTime: "09:15", Total: "5.50", Status: models.StatusApproved,
+			Items: []models.Item{{Price: "5.50"}, {Price: "0.00"}}},
+		// Not counted: pending, voided and purchased outside the range
+		{Retailer: "Target", PurchaseDate: "2022-03-21", PurchaseTime: "09:15", Total: "100.00", Status: models.StatusPending, Items: []models.Item{{Price: "100.00"}}},
+		{Retailer: "Target", PurchaseDate: "2022-03-21", PurchaseTime: "09:15", Total: "100.00", Status: models.StatusVoided, Items: []models.Item{{Price: "100.00"}}},
+		{Retailer: "Target", PurchaseDate: "2022-04-01", PurchaseTime: "09:15", Total: "100.00", Status: models.StatusApproved, Items: []models.Item{{Price: "100.00"}}},
+	}
+	for _, receipt := range receipts {
+		if _, err := repo.ProcessReceipt(context.Background(), receipt); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	return NewService(repo, itemScorer{}, nil)
+}
+
+func TestService_Report(t *testing.T) {
+	service := setupService(t)
+
+	tests := []struct {
+		name    string
+		groupBy models.ReportDimension
+		keys    []string
+	}{
+		{"By Retailer", models.DimensionRetailer, []string{"M&M Corner Market", "Target"}},
+		{"By Date", models.DimensionDate, []string{"2022-03-19", "2022-03-20", "2022-03-21"}},
+		{"By Weekday Monday First", models.DimensionWeekday, []string{"Monday", "Saturday", "Sunday"}},
+		{"By Hour", models.DimensionHour, []string{"09:00", "14:00"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			report, err := service.Report(context.Background(), models.ReportQuery{GroupBy: test.groupBy, From: "2022-03-01", To: "2022-03-31"})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var keys []string
+			for _, group := range report.Groups {
+				keys = append(keys, group.Key)
+			}
+			if !reflect.DeepEqual(keys, test.keys) {
+				t.Errorf("Expected groups %v, got %v", test.keys, keys)
+			}
+
+			expectedTotal := models.ReportGroup{Key: "total", Receipts: 3, Spend: "13.25", Points: 70, AveragePoints: 23.33, P50Points: 20, P90Points: 40, P99Points: 40}
+			if report.Total != expectedTotal {
+				t.Errorf("Expected total %+v, got %+v", expectedTotal, report.Total)
+			}
+		})
+	}
+}
+
+func TestService_ReportInTimeZone(t *testing.T) {
+	repo := repositories.NewInMemoryReceiptRepo(nil, nil)
+	receipts := []models.Receipt{
+		// 2pm in Chicago and 11am in Los Angeles, 3pm and 2pm in New York
+		{Retailer: "Target", PurchaseDate: "2022-03-21", PurchaseTime: "14:00", TimeZone: "America/Chicago", PurchasedAt: time.Date(2022, 3, 21, 19, 0, 0, 0, time.UTC), Status: models.StatusApproved},
+		{Retailer: "Target", PurchaseDate: "2022-03-21", PurchaseTime: "11:00", TimeZone: "America/Los_Angeles", PurchasedAt: time.Date(2022, 3, 21, 18, 0, 0, 0, time.UTC), Status: models.StatusApproved},
+		// 11pm in Los Angeles is the next day in New York
+		{Retailer: "Target", PurchaseDate: "2022-03-21", PurchaseTime: "23:00", TimeZone: "America/Los_Angeles", PurchasedAt: time.Date(2022, 3, 22, 6, 0, 0, 0, time.UTC), Status: models.StatusApproved},
+	}
+	for _, receipt := range receipts {
+		if _, err := repo.ProcessReceipt(context.Background(), receipt); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	service := NewService(repo, itemScorer{}, nil)
+
+	tests := []struct {
+		name     string
+		query    models.ReportQuery
+		expected []string
+	}{
+		{"Store Hours", models.ReportQuery{GroupBy: models.DimensionHour}, []string{"11:00", "14:00", "23:00"}},
+		{"New York Hours", models.ReportQuery{GroupBy: models.DimensionHour, TimeZone: "America/New_York"}, []string{"02:00", "14:00", "15:00"}},
+		{"Store Dates", models.ReportQuery{GroupBy: models.DimensionDate}, []string{"2022-03-21"}},
+		{"New York Dates", models.ReportQuery{GroupBy: models.DimensionDate, TimeZone: "America/New_York"}, []string{"2022-03-21", "2022-03-22"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			report, err := service.Report(context.Background(), test.query)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var keys []string
+			for _, group := range report.Groups {
+				keys = append(keys, group.Key)
+			}
+			if !reflect.DeepEqual(keys, test.expected) {
+				t.Errorf("Expected groups %v, got %v", test.expected, keys)
+			}
+		})
+	}
+}
+
+func TestService_ReportRetailerAggregates(t *testing.T) {
+	service := setupService(t)
+
+	report, _ := service.Report(context.Background(), models.ReportQuery{GroupBy: models.DimensionRetailer, From: "2022-03-01", To: "2022-03-31"})
+
+	// 9.00 less the returned 2.25, plus 1.00
+	expected := models.ReportGroup{Key: "M&M Corner Market", Receipts: 2, Spend: "7.75", Points: 50, AveragePoints: 25, P50Points: 10, P90Points: 40, P99Points: 40}
+	if report.Groups[0] != expected {
+		t.Errorf("Expected %+v, got %+v", expected, report.Groups[0])
+	}
+
+	empty, _ := service.Report(context.Background(), models.ReportQuery{GroupBy: models.DimensionRetailer, From: "2023-01-01"})
+	if len(empty.Groups) != 0 || empty.Total.Receipts != 0 || empty.Total.Spend != "0.00" {
+		t.Errorf("Expected an empty report, got %+v", empty)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	service := setupService(t)
+	report, _ := service.Report(context.Background(), models.ReportQuery{GroupBy: models.DimensionRetailer, From: "2022-03-01", To: "2022-03-31"})
+
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, report); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("Expected valid CSV, got %v", err)
+	}
+	expected := [][]string{
+		CSVHeader,
+		{"M&M Corner Market", "2", "7.75", "50", "25.00", "10", "40", "40"},
+		{"Target", "1", "5.50", "20", "20.00", "20", "20", "20"},
+	}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Expected rows %v, got %v", expected, rows)
+	}
+}
@@ -0,0 +1,142 @@
+package repositories
+
+import (
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+)
+
+// Repository. A job's receipts and results are kept apart from the job, so that reading and
+// updating a job costs the same however many receipts it re-scores.
+type BackfillRepository interface {
+	CreateJob(job models.BackfillJob, receiptIDs []string) string
+	FindJob(id string) (models.BackfillJob, bool)
+	FindJobs() []models.BackfillJob
+	FindJobsByStatus(status models.BackfillStatus) []models.BackfillJob
+	FindReceiptID(jobID string, position int) (string, bool)
+	FindResults(jobID string, offset int, limit int) []models.BackfillResult
+	UpdateJob(job models.BackfillJob, results ...models.BackfillResult) bool
+}
+
+// In-memory implementation of the backfill jobs and their results
+type InMemoryBackfillRepo struct {
+	jobs        map[string]models.BackfillJob
+	receiptIDs  map[string][]string
+	results     map[string][]models.BackfillResult
+	idGenerator UUIDGenerator
+	mu          sync.RWMutex
+}
+
+func NewInMemoryBackfillRepo(generator UUIDGenerator) *InMemoryBackfillRepo {
+	if generator == nil {
+		generator = DefaultUUIDGenerator{}
+	}
+	return &InMemoryBackfillRepo{
+		jobs:        make(map[string]models.BackfillJob),
+		receiptIDs:  make(map[string][]string),
+		results:     make(map[string][]models.BackfillResult),
+		idGenerator: generator,
+	}
+}
+
+// CreateJob saves a job along with the receipts it re-scores, in order, and returns its
+// generated ID.
+func (repo *InMemoryBackfillRepo) CreateJob(job models.BackfillJob, receiptIDs []string) string {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	job.ID = repo.idGenerator.New().String()
+	repo.jobs[job.ID] = cloneJob(job)
+	repo.receiptIDs[job.ID] = slices.Clone(receiptIDs)
+	return job.ID
+}
+
+// FindJob retrieves a job by its ID. Returns the job and a boolean indicating if it exists.
+func (repo *InMemoryBackfillRepo) FindJob(jobID string) (models.BackfillJob, bool) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	job, ok := repo.jobs[jobID]
+	return cloneJob(job), ok
+}
+
+// FindJobs returns every job, oldest first.
+func (repo *InMemoryBackfillRepo) FindJobs() []models.BackfillJob {
+	return repo.filter(func(models.BackfillJob) bool { return true })
+}
+
+// FindJobsByStatus returns the jobs with a status, oldest first.
+func (repo *InMemoryBackfillRepo) FindJobsByStatus(status models.BackfillStatus) []models.BackfillJob {
+	return repo.filter(func(job models.BackfillJob) bool { return job.Status == status })
+}
+
+// FindReceiptID returns the receipt at a position in a job's receipts. Returns false if the job
+// has no receipt there.
+func (repo *InMemoryBackfillRepo) FindReceiptID(jobID string, position int) (string, bool) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	receiptIDs := repo.receiptIDs[jobID]
+	if position < 0 || position >= len(receiptIDs) {
+		return "", false
+	}
+	return receiptIDs[position], true
+}
+
+// FindResults returns up to limit of a job's results starting at offset, in the order they were
+// recorded.
+func (repo *InMemoryBackfillRepo) FindResults(jobID string, offset int, limit int) []models.BackfillResult {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	results := repo.results[jobID]
+	if offset < 0 || offset >= len(results) || limit <= 0 {
+		return []models.BackfillResult{}
+	}
+	return slices.Clone(results[offset:min(offset+limit, len(results))])
+}
+
+// UpdateJob replaces a stored job and records any new results with it. Returns false if no job
+// exists for the ID.
+func (repo *InMemoryBackfillRepo) UpdateJob(job models.BackfillJob, results ...models.BackfillResult) bool {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if _, exists := repo.jobs[job.ID]; !exists {
+		return false
+	}
+
+	repo.jobs[job.ID] = cloneJob(job)
+	repo.results[job.ID] = append(repo.results[job.ID], results...)
+	return true
+}
+
+func (repo *InMemoryBackfillRepo) filter(match func(models.BackfillJob) bool) []models.BackfillJob {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	jobs := []models.BackfillJob{}
+	for _, job := range repo.jobs {
+		if match(job) {
+			jobs = append(jobs, cloneJob(job))
+		}
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		if !jobs[i].CreatedAt.Equal(jobs[j].CreatedAt) {
+			return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+		}
+		return jobs[i].ID < jobs[j].ID
+	})
+	return jobs
+}
+
+// cloneJob copies the filter of a job, so callers changing it never share storage with the
+// stored job.
+func cloneJob(job models.BackfillJob) models.BackfillJob {
+	job.Request.Filter.RuleVersions = slices.Clone(job.Request.Filter.RuleVersions)
+	job.Request.Filter.Statuses = slices.Clone(job.Request.Filter.Statuses)
+	return job
+}
@@ -0,0 +1,85 @@
+package repositories
+
+import (
+	"testing"
+	"time"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+)
+
+func TestInMemoryBackfillRepo_Jobs(t *testing.T) {
+	repo := NewInMemoryBackfillRepo(nil)
+
+	createdAt := time.Date(2022, 1, 2, 13, 13, 0, 0, time.UTC)
+	second := repo.CreateJob(models.BackfillJob{Status: models.BackfillRunning, CreatedAt: createdAt.Add(time.Minute)}, nil)
+	receiptIDs := []string{"a", "b"}
+	first := repo.CreateJob(models.BackfillJob{Status: models.BackfillRunning, Total: 2, CreatedAt: createdAt}, receiptIDs)
+	repo.CreateJob(models.BackfillJob{Status: models.BackfillCompleted, CreatedAt: createdAt}, nil)
+
+	running := repo.FindJobsByStatus(models.BackfillRunning)
+	if len(running) != 2 || running[0].ID != first || running[1].ID != second {
+		t.Fatalf("Expected running jobs [%s %s] oldest first, got %+v", first, second, running)
+	}
+	if jobs := repo.FindJobs(); len(jobs) != 3 {
+		t.Errorf("Expected 3 jobs, got %+v", jobs)
+	}
+
+	receiptIDs[0] = "changed"
+	if receiptID, ok := repo.FindReceiptID(first, 0); !ok || receiptID != "a" {
+		t.Errorf("Expected the stored receipts to be unaffected by changes to the caller's, got %q", receiptID)
+	}
+	if _, ok := repo.FindReceiptID(first, 2); ok {
+		t.Errorf("Expected no receipt past the end of the job")
+	}
+
+	job := running[0]
+	job.Processed = 1
+	job.Status = models.BackfillPaused
+	if !repo.UpdateJob(job, models.BackfillResult{ReceiptID: "a"}) {
+		t.Fatalf("Expected job '%s' to be updated", job.ID)
+	}
+	if paused := repo.FindJobsByStatus(models.BackfillPaused); len(paused) != 1 || paused[0].ID != first || paused[0].Processed != 1 {
+		t.Errorf("Expected job '%s' to be paused, got %+v", first, paused)
+	}
+	if _, ok := repo.FindJob("non-existent-id"); ok {
+		t.Errorf("Expected no job for a missing ID")
+	}
+	if repo.UpdateJob(models.BackfillJob{ID: "non-existent-id"}, models.BackfillResult{ReceiptID: "a"}) {
+		t.Errorf("Expected updating a missing job to fail")
+	}
+}
+
+func TestInMemoryBackfillRepo_Results(t *testing.T) {
+	repo := NewInMemoryBackfillRepo(nil)
+	jobID := repo.CreateJob(models.BackfillJob{Status: models.BackfillRunning, Total: 3}, []string{"a", "b", "c"})
+
+	job, _ := repo.FindJob(jobID)
+	repo.UpdateJob(job, models.BackfillResult{ReceiptID: "a"}, models.BackfillResult{ReceiptID: "b"})
+	repo.UpdateJob(job, models.BackfillResult{ReceiptID: "c"})
+
+	tests := []struct {
+		name     string
+		offset   int
+		limit    int
+		expected []string
+	}{
+		{"First Page", 0, 2, []string{"a", "b"}},
+		{"Last Page", 2, 2, []string{"c"}},
+		{"Past The End", 3, 2, []string{}},
+		{"Negative Offset", -1, 2, []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			results := repo.FindResults(jobID, test.offset, test.limit)
+			if results == nil || len(results) != len(test.expected) {
+				t.Fatalf("Expected results %v, got %+v", test.expected, results)
+			}
+			for i, result := range results {
+				if result.ReceiptID != test.expected[i] {
+					t.Errorf("Expected result %d to be for %s, got %+v", i, test.expected[i], result)
+				}
+			}
+		})
+	}
+}
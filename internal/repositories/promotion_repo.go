@@ -0,0 +1,138 @@
+package repositories
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+)
+
+// Repository
+type PromotionRepository interface {
+	Create(promotion models.Promotion) string
+	FindByID(id string) (models.Promotion, bool)
+	FindAll() []models.Promotion
+	Update(promotion models.Promotion) bool
+	Delete(id string) bool
+	ReserveBudget(id string, points int) int
+	ReleaseBudget(id string, points int)
+}
+
+// In-memory implementation of the promotions store
+type InMemoryPromotionRepo struct {
+	promotions  map[string]models.Promotion
+	idGenerator UUIDGenerator
+	mu          sync.RWMutex
+}
+
+func NewInMemoryPromotionRepo(generator UUIDGenerator) *InMemoryPromotionRepo {
+	if generator == nil {
+		generator = DefaultUUIDGenerator{}
+	}
+	return &InMemoryPromotionRepo{
+		promotions:  make(map[string]models.Promotion),
+		idGenerator: generator,
+	}
+}
+
+// Create saves a promotion with nothing awarded yet and returns its generated ID.
+func (repo *InMemoryPromotionRepo) Create(promotion models.Promotion) string {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	promotion.ID = repo.idGenerator.New().String()
+	promotion.AwardedPoints = 0
+
+	repo.promotions[promotion.ID] = promotion
+	return promotion.ID
+}
+
+// FindByID retrieves a promotion by its ID. Returns the promotion and a boolean indicating if it exists.
+func (repo *InMemoryPromotionRepo) FindByID(promotionID string) (models.Promotion, bool) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	promotion, ok := repo.promotions[promotionID]
+
+	return promotion, ok
+}
+
+// FindAll returns every promotion ordered by ID.
+func (repo *InMemoryPromotionRepo) FindAll() []models.Promotion {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	promotions := make([]models.Promotion, 0, len(repo.promotions))
+	for _, promotion := range repo.promotions {
+		promotions = append(promotions, promotion)
+	}
+
+	sort.Slice(promotions, func(i, j int) bool { return promotions[i].ID < promotions[j].ID })
+	return promotions
+}
+
+// Update replaces a stored promotion, keeping the points already awarded against its budget.
+// Returns false if no promotion exists for the ID.
+func (repo *InMemoryPromotionRepo) Update(promotion models.Promotion) bool {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	existing, exists := repo.promotions[promotion.ID]
+	if !exists {
+		return false
+	}
+
+	promotion.AwardedPoints = existing.AwardedPoints
+	repo.promotions[promotion.ID] = promotion
+	return true
+}
+
+// Delete removes a promotion. Returns false if no promotion exists for the ID.
+func (repo *InMemoryPromotionRepo) Delete(promotionID string) bool {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if _, exists := repo.promotions[promotionID]; !exists {
+		return false
+	}
+
+	delete(repo.promotions, promotionID)
+	return true
+}
+
+// ReserveBudget records points awarded by a promotion and returns how many were granted,
+// which is less than requested once the budget runs low.
+func (repo *InMemoryPromotionRepo) ReserveBudget(promotionID string, points int) int {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	promotion, exists := repo.promotions[promotionID]
+	if !exists || points <= 0 {
+		return 0
+	}
+
+	if promotion.BudgetPoints > 0 {
+		remaining := promotion.BudgetPoints - promotion.AwardedPoints
+		if remaining < points {
+			points = max(remaining, 0)
+		}
+	}
+
+	promotion.AwardedPoints += points
+	repo.promotions[promotionID] = promotion
+	return points
+}
+
+// ReleaseBudget returns points to a promotion's budget, e.g. when the receipt they were awarded to is voided.
+func (repo *InMemoryPromotionRepo) ReleaseBudget(promotionID string, points int) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	promotion, exists := repo.promotions[promotionID]
+	if !exists {
+		return
+	}
+
+	promotion.AwardedPoints = max(promotion.AwardedPoints-points, 0)
+	repo.promotions[promotionID] = promotion
+}
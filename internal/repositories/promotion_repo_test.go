@@ -0,0 +1,49 @@
+package repositories
+
+import (
+	"testing"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+)
+
+func TestInMemoryPromotionRepo_Budget(t *testing.T) {
+	repo := NewInMemoryPromotionRepo(MockUUIDGenerator{})
+
+	promotionID := repo.Create(models.Promotion{Name: "Gatorade bonus", BonusPoints: 100, BudgetPoints: 150, AwardedPoints: 999})
+	if promotionID != "123e4567-e89b-12d3-a456-426614174000" {
+		t.Errorf("Unexpected promotion ID '%s'", promotionID)
+	}
+
+	if granted := repo.ReserveBudget(promotionID, 100); granted != 100 {
+		t.Errorf("Expected 100 points granted, got %d", granted)
+	}
+	if granted := repo.ReserveBudget(promotionID, 100); granted != 50 {
+		t.Errorf("Expected the budget to cap the grant at 50 points, got %d", granted)
+	}
+	if granted := repo.ReserveBudget(promotionID, 100); granted != 0 {
+		t.Errorf("Expected an exhausted budget to grant nothing, got %d", granted)
+	}
+
+	repo.ReleaseBudget(promotionID, 50)
+	repo.Update(models.Promotion{ID: promotionID, Name: "Gatorade bonus", BonusPoints: 100, BudgetPoints: 150})
+
+	promotion, _ := repo.FindByID(promotionID)
+	if promotion.AwardedPoints != 100 {
+		t.Errorf("Expected 100 points awarded after release and update, got %d", promotion.AwardedPoints)
+	}
+}
+
+func TestInMemoryPromotionRepo_UnlimitedBudget(t *testing.T) {
+	repo := NewInMemoryPromotionRepo(nil)
+
+	promotionID := repo.Create(models.Promotion{Name: "Double points", Multiplier: 2})
+	if granted := repo.ReserveBudget(promotionID, 10000); granted != 10000 {
+		t.Errorf("Expected an unlimited budget to grant everything, got %d", granted)
+	}
+	if granted := repo.ReserveBudget("non-existent-id", 10); granted != 0 {
+		t.Errorf("Expected a missing promotion to grant nothing, got %d", granted)
+	}
+	if !repo.Delete(promotionID) || len(repo.FindAll()) != 0 {
+		t.Errorf("Expected the promotion to be deleted")
+	}
+}
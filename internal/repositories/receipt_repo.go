@@ -1,8 +1,16 @@
 package repositories
 
 import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"sort"
 	"sync"
+	"time"
 
+	"github.com/javier-tello/receipt-processor-challenge/internal/events"
+	"github.com/javier-tello/receipt-processor-challenge/internal/logging"
 	"github.com/javier-tello/receipt-processor-challenge/internal/models"
 
 	"github.com/google/uuid"
@@ -20,46 +28,304 @@ func (g DefaultUUIDGenerator) New() uuid.UUID {
 	return uuid.New()
 }
 
-// Repository
+var (
+	// ErrReceiptNotFound is returned when no receipt is stored under the requested ID.
+	ErrReceiptNotFound = errors.New("cannot find receipt")
+	// ErrReceiptConflict is returned when a receipt is updated from a copy read before its last
+	// update. The caller should read the receipt again and redo its change.
+	ErrReceiptConflict = errors.New("receipt was changed by another request")
+)
+
+// ReceiptRepository stores receipts and their points adjustments. Every method takes the
+// request context so implementations can trace calls and give up once it is cancelled.
+// Events passed to a write are stored in the outbox in the same transaction as the change
+// they describe, so an event is never lost or emitted for a change that did not happen.
+// Updates only succeed if the receipt's Revision is still the stored one, and increment it.
+// The points of each customer's approved and pending receipts are totalled by UTC day and month
+// of submission as receipts are written, so customer caps never read a customer's history.
 type ReceiptRepository interface {
-	ProcessReceipt(receipt models.Receipt) string
-	FindByID(id string) (models.Receipt, bool)
+	ProcessReceipt(ctx context.Context, receipt models.Receipt, outbox ...events.Event) (string, error)
+	FindByID(ctx context.Context, id string) (models.Receipt, error)
+	UpdateReceipt(ctx context.Context, id string, receipt models.Receipt, outbox ...events.Event) error
+	AdjustReceipt(ctx context.Context, id string, receipt models.Receipt, adjustment models.PointsAdjustment, outbox ...events.Event) (string, error)
+	FindByStatus(ctx context.Context, status models.ReceiptStatus) ([]models.Receipt, error)
+	FindByFingerprint(ctx context.Context, fingerprint string) ([]models.Receipt, error)
+	FindByClientID(ctx context.Context, clientID string) ([]models.Receipt, error)
+	FindByPurchaseDate(ctx context.Context, from string, to string) ([]models.Receipt, error)
+	FindCustomerPoints(ctx context.Context, clientID string, submittedAt time.Time) (day int, month int, err error)
+	FindAdjustmentsByReceiptID(ctx context.Context, id string) ([]models.PointsAdjustment, error)
+}
+
+// Pinger is implemented by repositories that can report whether their backend is reachable.
+type Pinger interface {
+	Ping(ctx context.Context) error
 }
 
 // In-memory implementation for this challenge
 type InMemoryReceiptRepo struct {
-	receipts    map[string]models.Receipt
-	idGenerator UUIDGenerator
-	mu          sync.RWMutex
+	receipts       map[string]models.Receipt
+	adjustments    map[string][]models.PointsAdjustment
+	customerPoints map[string]int
+	outbox         []events.Event
+	compacted      uint64
+	idGenerator    UUIDGenerator
+	logger         *slog.Logger
+	mu             sync.RWMutex
 }
 
-func NewInMemoryReceiptRepo(generator UUIDGenerator) *InMemoryReceiptRepo {
+func NewInMemoryReceiptRepo(generator UUIDGenerator, logger *slog.Logger) *InMemoryReceiptRepo {
 	if generator == nil {
 		generator = DefaultUUIDGenerator{}
 	}
 	return &InMemoryReceiptRepo{
-		receipts:    make(map[string]models.Receipt),
-		idGenerator: generator,
+		receipts:       make(map[string]models.Receipt),
+		adjustments:    make(map[string][]models.PointsAdjustment),
+		customerPoints: make(map[string]int),
+		idGenerator:    generator,
+		logger:         logging.OrDefault(logger),
 	}
 }
 
-// FindByID retrieves a receipt by its ID. Returns the receipt and a boolean indicating if it exists.
-func (repo *InMemoryReceiptRepo) FindByID(receiptID string) (models.Receipt, bool) {
+// FindByID retrieves a receipt by its ID, returning ErrReceiptNotFound if it does not exist.
+func (repo *InMemoryReceiptRepo) FindByID(ctx context.Context, receiptID string) (models.Receipt, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Receipt{}, err
+	}
+
 	repo.mu.RLock()
 	defer repo.mu.RUnlock()
 
 	receipt, ok := repo.receipts[receiptID]
+	if !ok {
+		return models.Receipt{}, ErrReceiptNotFound
+	}
 
-	return receipt, ok
+	return receipt, nil
 }
 
 // ProcessReceipt saves a receipt in memory and returns its generated ID.
-func (repo *InMemoryReceiptRepo) ProcessReceipt(receipt models.Receipt) string {
+func (repo *InMemoryReceiptRepo) ProcessReceipt(ctx context.Context, receipt models.Receipt, outbox ...events.Event) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
 	repo.mu.Lock()
 	defer repo.mu.Unlock()
 
 	receiptID := repo.idGenerator.New().String()
+	receipt.ID = receiptID
 
 	repo.receipts[receiptID] = receipt
-	return receiptID
+	repo.countCustomerPoints(receipt, 1)
+	repo.appendOutbox(receiptID, outbox)
+	repo.logger.DebugContext(ctx, "Receipt stored", "receipt_id", receiptID, "status", receipt.Status, "receipts", len(repo.receipts))
+	return receiptID, nil
+}
+
+// UpdateReceipt replaces a stored receipt, returning ErrReceiptNotFound if no receipt exists for
+// the ID and ErrReceiptConflict if it has been updated since it was read.
+func (repo *InMemoryReceiptRepo) UpdateReceipt(ctx context.Context, receiptID string, receipt models.Receipt, outbox ...events.Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if err := repo.replace(receiptID, receipt); err != nil {
+		return err
+	}
+	repo.appendOutbox(receiptID, outbox)
+	repo.logger.DebugContext(ctx, "Receipt updated", "receipt_id", receiptID, "status", receipt.Status)
+	return nil
+}
+
+// AdjustReceipt replaces a stored receipt and records a points adjustment against it in one
+// write, returning the adjustment's generated ID. Neither is stored if the receipt is missing or
+// has been updated since it was read.
+func (repo *InMemoryReceiptRepo) AdjustReceipt(ctx context.Context, receiptID string, receipt models.Receipt, adjustment models.PointsAdjustment, outbox ...events.Event) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if err := repo.replace(receiptID, receipt); err != nil {
+		return "", err
+	}
+	adjustment.ID = repo.idGenerator.New().String()
+	adjustment.ReceiptID = receiptID
+	repo.adjustments[receiptID] = append(repo.adjustments[receiptID], adjustment)
+	repo.appendOutbox(receiptID, outbox)
+	repo.logger.DebugContext(ctx, "Receipt adjusted", "receipt_id", receiptID, "status", receipt.Status, "adjustment_id", adjustment.ID, "points", adjustment.Points)
+	return adjustment.ID, nil
+}
+
+// replace stores the next revision of a receipt. It must be called with the lock held.
+func (repo *InMemoryReceiptRepo) replace(receiptID string, receipt models.Receipt) error {
+	stored, ok := repo.receipts[receiptID]
+	if !ok {
+		return ErrReceiptNotFound
+	}
+	if receipt.Revision != stored.Revision {
+		return ErrReceiptConflict
+	}
+
+	receipt.Revision++
+	repo.receipts[receiptID] = receipt
+	repo.countCustomerPoints(stored, -1)
+	repo.countCustomerPoints(receipt, 1)
+	return nil
+}
+
+// countCustomerPoints adds a receipt's points to, or with a sign of -1 takes them from, its
+// customer's totals for the day and month it was submitted. Rejected and voided receipts earn
+// nothing. It must be called with the lock held.
+func (repo *InMemoryReceiptRepo) countCustomerPoints(receipt models.Receipt, sign int) {
+	if receipt.ClientID == "" || receipt.Status == models.StatusRejected || receipt.Status == models.StatusVoided {
+		return
+	}
+	day, month := customerPointsKeys(receipt.ClientID, receipt.SubmittedAt)
+	repo.customerPoints[day] += sign * receipt.Points
+	repo.customerPoints[month] += sign * receipt.Points
+}
+
+// FindCustomerPoints returns the points of a customer's approved and pending receipts submitted
+// on the UTC day and in the UTC month of submittedAt.
+func (repo *InMemoryReceiptRepo) FindCustomerPoints(ctx context.Context, clientID string, submittedAt time.Time) (int, int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	day, month := customerPointsKeys(clientID, submittedAt)
+	return repo.customerPoints[day], repo.customerPoints[month], nil
+}
+
+func customerPointsKeys(clientID string, submittedAt time.Time) (day string, month string) {
+	submittedAt = submittedAt.UTC()
+	return clientID + " " + submittedAt.Format("2006-01-02"), clientID + " " + submittedAt.Format("2006-01")
+}
+
+// FindByStatus returns every receipt in the given status, oldest submission first.
+func (repo *InMemoryReceiptRepo) FindByStatus(ctx context.Context, status models.ReceiptStatus) ([]models.Receipt, error) {
+	return repo.filter(ctx, func(receipt models.Receipt) bool { return receipt.Status == status })
+}
+
+// FindByFingerprint returns every receipt sharing the given fingerprint, oldest submission first.
+func (repo *InMemoryReceiptRepo) FindByFingerprint(ctx context.Context, fingerprint string) ([]models.Receipt, error) {
+	return repo.filter(ctx, func(receipt models.Receipt) bool { return receipt.Fingerprint == fingerprint })
+}
+
+// FindByClientID returns every receipt submitted by a client, oldest submission first.
+func (repo *InMemoryReceiptRepo) FindByClientID(ctx context.Context, clientID string) ([]models.Receipt, error) {
+	return repo.filter(ctx, func(receipt models.Receipt) bool { return receipt.ClientID == clientID })
+}
+
+// FindByPurchaseDate returns every receipt purchased between from and to inclusive, oldest
+// submission first. Dates are YYYY-MM-DD and an empty bound is open.
+func (repo *InMemoryReceiptRepo) FindByPurchaseDate(ctx context.Context, from string, to string) ([]models.Receipt, error) {
+	return repo.filter(ctx, func(receipt models.Receipt) bool {
+		return (from == "" || receipt.PurchaseDate >= from) && (to == "" || receipt.PurchaseDate <= to)
+	})
+}
+
+func (repo *InMemoryReceiptRepo) filter(ctx context.Context, match func(models.Receipt) bool) ([]models.Receipt, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	var receipts []models.Receipt
+	for _, receipt := range repo.receipts {
+		if match(receipt) {
+			receipts = append(receipts, receipt)
+		}
+	}
+
+	sort.Slice(receipts, func(i, j int) bool {
+		if receipts[i].SubmittedAt.Equal(receipts[j].SubmittedAt) {
+			return receipts[i].ID < receipts[j].ID
+		}
+		return receipts[i].SubmittedAt.Before(receipts[j].SubmittedAt)
+	})
+	return receipts, nil
+}
+
+// FindAdjustmentsByReceiptID returns the points adjustments for a receipt in the order they were recorded.
+func (repo *InMemoryReceiptRepo) FindAdjustmentsByReceiptID(ctx context.Context, receiptID string) ([]models.PointsAdjustment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	adjustments := make([]models.PointsAdjustment, len(repo.adjustments[receiptID]))
+	copy(adjustments, repo.adjustments[receiptID])
+
+	return adjustments, nil
+}
+
+// appendOutbox numbers events in the order they were written, filling in the receipt ID of
+// events about a receipt stored by the same call. It must be called with the lock held.
+func (repo *InMemoryReceiptRepo) appendOutbox(receiptID string, outbox []events.Event) {
+	for _, event := range outbox {
+		if event.ReceiptID == "" {
+			event.ReceiptID = receiptID
+		}
+		event.Sequence = repo.compacted + uint64(len(repo.outbox)) + 1
+		repo.outbox = append(repo.outbox, event)
+	}
+}
+
+// EventsAfter returns up to limit outbox events with a sequence greater than after. Events
+// already compacted are skipped.
+func (repo *InMemoryReceiptRepo) EventsAfter(ctx context.Context, after uint64, limit int) ([]events.Event, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	after = max(after, repo.compacted) - repo.compacted
+	if after >= uint64(len(repo.outbox)) {
+		return nil, nil
+	}
+	pending := repo.outbox[after:]
+	if limit > 0 && len(pending) > limit {
+		pending = pending[:limit]
+	}
+	return slices.Clone(pending), nil
+}
+
+// CompactThrough discards the outbox events with a sequence up to and including through.
+func (repo *InMemoryReceiptRepo) CompactThrough(ctx context.Context, through uint64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if through <= repo.compacted {
+		return nil
+	}
+	discard := min(through-repo.compacted, uint64(len(repo.outbox)))
+	// The kept events are copied so the discarded ones can be freed
+	repo.outbox = slices.Clone(repo.outbox[discard:])
+	repo.compacted += discard
+	repo.logger.DebugContext(ctx, "Outbox compacted", "through", repo.compacted, "kept", len(repo.outbox))
+	return nil
+}
+
+// Ping always succeeds while ctx is live, since the in-memory store has no backend to lose.
+func (repo *InMemoryReceiptRepo) Ping(ctx context.Context) error {
+	return ctx.Err()
 }
@@ -1,10 +1,14 @@
 package repositories
 
 import (
+	"context"
+	"errors"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/javier-tello/receipt-processor-challenge/internal/events"
 	"github.com/javier-tello/receipt-processor-challenge/internal/models"
 )
 
@@ -17,14 +21,17 @@ func (m MockUUIDGenerator) New() uuid.UUID {
 func TestInMemoryReceiptRepo_ProcessReceipt(t *testing.T) {
 	// Arrange: Use the mock UUID generator
 	mockGenerator := MockUUIDGenerator{}
-	repo := NewInMemoryReceiptRepo(mockGenerator)
+	repo := NewInMemoryReceiptRepo(mockGenerator, nil)
 
-	receiptID := repo.ProcessReceipt(models.Receipt{
+	receiptID, err := repo.ProcessReceipt(context.Background(), models.Receipt{
 		Retailer:     "Target",
 		PurchaseDate: "2022-01-02",
 		PurchaseTime: "13:13",
 		Total:        "1.25",
 		Items:        []models.Item{{ShortDescription: "Pepsi - 12-oz", Price: "1.25"}}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
 
 	expectedUUID := "123e4567-e89b-12d3-a456-426614174000"
 	if receiptID != expectedUUID {
@@ -37,7 +44,7 @@ func TestInMemoryReceiptRepo_ProcessReceipt(t *testing.T) {
 }
 
 func TestInMemoryReceiptRepo_FindByID(t *testing.T) {
-	repo := NewInMemoryReceiptRepo(nil)
+	repo := NewInMemoryReceiptRepo(nil, nil)
 
 	receipt := models.Receipt{
 		Retailer:     "Target",
@@ -46,13 +53,246 @@ func TestInMemoryReceiptRepo_FindByID(t *testing.T) {
 		Total:        "1.25",
 		Items:        []models.Item{{ShortDescription: "Pepsi - 12-oz", Price: "1.25"}}}
 
-	receiptID := repo.ProcessReceipt(receipt)
-	foundReceipt, exists := repo.FindByID(receiptID)
-	if !exists {
+	receiptID, _ := repo.ProcessReceipt(context.Background(), receipt)
+	foundReceipt, err := repo.FindByID(context.Background(), receiptID)
+	if err != nil {
 		t.Fatalf("User with ID '%s' not found", receiptID)
 	}
 
+	receipt.ID = receiptID
 	if !reflect.DeepEqual(foundReceipt, receipt) {
 		t.Errorf("Expected user: %+v, got: %+v", receipt, foundReceipt)
 	}
 }
+
+func TestInMemoryReceiptRepo_UpdateReceipt(t *testing.T) {
+	repo := NewInMemoryReceiptRepo(nil, nil)
+
+	receiptID, _ := repo.ProcessReceipt(context.Background(), models.Receipt{Retailer: "Target", Status: models.StatusApproved})
+
+	if err := repo.UpdateReceipt(context.Background(), receiptID, models.Receipt{Retailer: "Target", Status: models.StatusVoided}); err != nil {
+		t.Fatalf("Expected receipt with ID '%s' to be updated", receiptID)
+	}
+
+	foundReceipt, _ := repo.FindByID(context.Background(), receiptID)
+	if foundReceipt.Status != models.StatusVoided {
+		t.Errorf("Expected status '%s', got '%s'", models.StatusVoided, foundReceipt.Status)
+	}
+
+	if err := repo.UpdateReceipt(context.Background(), "non-existent-id", models.Receipt{}); !errors.Is(err, ErrReceiptNotFound) {
+		t.Errorf("Expected ErrReceiptNotFound updating a missing receipt, got %v", err)
+	}
+}
+
+func TestInMemoryReceiptRepo_UpdateStaleReceipt(t *testing.T) {
+	repo := NewInMemoryReceiptRepo(nil, nil)
+
+	receiptID, _ := repo.ProcessReceipt(context.Background(), models.Receipt{Retailer: "Target", Status: models.StatusApproved})
+	first, _ := repo.FindByID(context.Background(), receiptID)
+	second := first
+
+	first.Status = models.StatusVoided
+	if err := repo.UpdateReceipt(context.Background(), receiptID, first); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	second.Status = models.StatusRejected
+	if err := repo.UpdateReceipt(context.Background(), receiptID, second); !errors.Is(err, ErrReceiptConflict) {
+		t.Errorf("Expected ErrReceiptConflict updating a stale copy, got %v", err)
+	}
+	if foundReceipt, _ := repo.FindByID(context.Background(), receiptID); foundReceipt.Status != models.StatusVoided || foundReceipt.Revision != 1 {
+		t.Errorf("Expected the first update to be kept, got %+v", foundReceipt)
+	}
+}
+
+func TestInMemoryReceiptRepo_AdjustReceipt(t *testing.T) {
+	repo := NewInMemoryReceiptRepo(MockUUIDGenerator{}, nil)
+
+	receiptID, _ := repo.ProcessReceipt(context.Background(), models.Receipt{Retailer: "Target", Status: models.StatusApproved})
+	receipt, _ := repo.FindByID(context.Background(), receiptID)
+	stale := receipt
+
+	receipt.Status = models.StatusVoided
+	adjustmentID, err := repo.AdjustReceipt(context.Background(), receiptID, receipt, models.PointsAdjustment{Points: -31, Reason: "refund", Actor: "agent-7"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	adjustments, _ := repo.FindAdjustmentsByReceiptID(context.Background(), receiptID)
+	if len(adjustments) != 1 || adjustments[0].ID != adjustmentID || adjustments[0].ReceiptID != receiptID {
+		t.Fatalf("Expected the adjustment to be recorded against the receipt, got %+v", adjustments)
+	}
+
+	stale.Status = models.StatusVoided
+	if _, err := repo.AdjustReceipt(context.Background(), receiptID, stale, models.PointsAdjustment{Points: -31}); !errors.Is(err, ErrReceiptConflict) {
+		t.Errorf("Expected ErrReceiptConflict adjusting a stale copy, got %v", err)
+	}
+	if adjustments, _ := repo.FindAdjustmentsByReceiptID(context.Background(), receiptID); len(adjustments) != 1 {
+		t.Errorf("Expected a rejected adjustment not to be recorded, got %+v", adjustments)
+	}
+	if _, err := repo.AdjustReceipt(context.Background(), "receipt-2", receipt, models.PointsAdjustment{Points: -31}); !errors.Is(err, ErrReceiptNotFound) {
+		t.Errorf("Expected ErrReceiptNotFound adjusting an unknown receipt, got %v", err)
+	}
+	if adjustments, _ := repo.FindAdjustmentsByReceiptID(context.Background(), "receipt-2"); len(adjustments) != 0 {
+		t.Errorf("Expected no adjustments for an unknown receipt")
+	}
+}
+
+func TestInMemoryReceiptRepo_FindCustomerPoints(t *testing.T) {
+	repo := NewInMemoryReceiptRepo(nil, nil)
+
+	submittedAt := time.Date(2022, 1, 2, 13, 13, 0, 0, time.UTC)
+	first, _ := repo.ProcessReceipt(context.Background(), models.Receipt{ClientID: "client-a", Status: models.StatusApproved, Points: 10, SubmittedAt: submittedAt})
+	repo.ProcessReceipt(context.Background(), models.Receipt{ClientID: "client-a", Status: models.StatusPending, Points: 5, SubmittedAt: submittedAt.Add(time.Hour)})
+	repo.ProcessReceipt(context.Background(), models.Receipt{ClientID: "client-a", Status: models.StatusApproved, Points: 7, SubmittedAt: submittedAt.AddDate(0, 0, 1)})
+	repo.ProcessReceipt(context.Background(), models.Receipt{ClientID: "client-a", Status: models.StatusApproved, Points: 100, SubmittedAt: submittedAt.AddDate(0, 1, 0)})
+	repo.ProcessReceipt(context.Background(), models.Receipt{ClientID: "client-b", Status: models.StatusApproved, Points: 100, SubmittedAt: submittedAt})
+
+	if day, month, _ := repo.FindCustomerPoints(context.Background(), "client-a", submittedAt); day != 15 || month != 22 {
+		t.Errorf("Expected 15 points on the day and 22 in the month, got %d and %d", day, month)
+	}
+
+	// Voiding a receipt takes its points off the totals
+	receipt, _ := repo.FindByID(context.Background(), first)
+	receipt.Status = models.StatusVoided
+	if err := repo.UpdateReceipt(context.Background(), first, receipt); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if day, month, _ := repo.FindCustomerPoints(context.Background(), "client-a", submittedAt); day != 5 || month != 12 {
+		t.Errorf("Expected 5 points on the day and 12 in the month, got %d and %d", day, month)
+	}
+}
+
+func TestInMemoryReceiptRepo_FindByStatusAndFingerprint(t *testing.T) {
+	repo := NewInMemoryReceiptRepo(nil, nil)
+
+	submittedAt := time.Date(2022, 1, 2, 13, 13, 0, 0, time.UTC)
+	first, _ := repo.ProcessReceipt(context.Background(), models.Receipt{Status: models.StatusPending, Fingerprint: "abc", SubmittedAt: submittedAt})
+	second, _ := repo.ProcessReceipt(context.Background(), models.Receipt{Status: models.StatusPending, Fingerprint: "abc", SubmittedAt: submittedAt.Add(time.Minute)})
+	repo.ProcessReceipt(context.Background(), models.Receipt{Status: models.StatusApproved, Fingerprint: "def", SubmittedAt: submittedAt})
+
+	pending, _ := repo.FindByStatus(context.Background(), models.StatusPending)
+	if len(pending) != 2 || pending[0].ID != first || pending[1].ID != second {
+		t.Errorf("Expected pending receipts [%s %s] oldest first, got %+v", first, second, pending)
+	}
+
+	if matches, _ := repo.FindByFingerprint(context.Background(), "abc"); len(matches) != 2 {
+		t.Errorf("Expected 2 receipts with fingerprint 'abc', got %d", len(matches))
+	}
+	if matches, _ := repo.FindByFingerprint(context.Background(), "xyz"); len(matches) != 0 {
+		t.Errorf("Expected no receipts with fingerprint 'xyz', got %d", len(matches))
+	}
+}
+
+func TestInMemoryReceiptRepo_FindByClientID(t *testing.T) {
+	repo := NewInMemoryReceiptRepo(nil, nil)
+
+	repo.ProcessReceipt(context.Background(), models.Receipt{ClientID: "partner-a"})
+	repo.ProcessReceipt(context.Background(), models.Receipt{ClientID: "partner-a"})
+	repo.ProcessReceipt(context.Background(), models.Receipt{ClientID: "partner-b"})
+
+	if matches, _ := repo.FindByClientID(context.Background(), "partner-a"); len(matches) != 2 {
+		t.Errorf("Expected 2 receipts from 'partner-a', got %d", len(matches))
+	}
+}
+
+func TestInMemoryReceiptRepo_FindByPurchaseDate(t *testing.T) {
+	repo := NewInMemoryReceiptRepo(nil, nil)
+
+	for _, purchaseDate := range []string{"2022-01-01", "2022-01-15", "2022-01-31", "2022-02-01"} {
+		repo.ProcessReceipt(context.Background(), models.Receipt{PurchaseDate: purchaseDate})
+	}
+
+	if matches, _ := repo.FindByPurchaseDate(context.Background(), "2022-01-01", "2022-01-31"); len(matches) != 3 {
+		t.Errorf("Expected 3 receipts purchased in January, got %d", len(matches))
+	}
+	if matches, _ := repo.FindByPurchaseDate(context.Background(), "2022-01-15", ""); len(matches) != 3 {
+		t.Errorf("Expected 3 receipts purchased from the 15th, got %d", len(matches))
+	}
+	if matches, _ := repo.FindByPurchaseDate(context.Background(), "", ""); len(matches) != 4 {
+		t.Errorf("Expected every receipt without bounds, got %d", len(matches))
+	}
+}
+
+func TestInMemoryReceiptRepo_CancelledContext(t *testing.T) {
+	repo := NewInMemoryReceiptRepo(nil, nil)
+	receiptID, _ := repo.ProcessReceipt(context.Background(), models.Receipt{Retailer: "Target"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := repo.ProcessReceipt(ctx, models.Receipt{Retailer: "Target"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled storing a receipt, got %v", err)
+	}
+	if _, err := repo.FindByID(ctx, receiptID); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled finding a receipt, got %v", err)
+	}
+	if len(repo.receipts) != 1 {
+		t.Errorf("Expected a cancelled write to store nothing, got %d receipts", len(repo.receipts))
+	}
+}
+
+func TestInMemoryReceiptRepo_Outbox(t *testing.T) {
+	repo := NewInMemoryReceiptRepo(nil, nil)
+
+	processed, _ := events.New(events.TypeReceiptProcessed, "", events.ReceiptProcessed{Retailer: "Target"})
+	awarded, _ := events.New(events.TypePointsAwarded, "", events.PointsAwarded{Points: 12})
+	receiptID, _ := repo.ProcessReceipt(context.Background(), models.Receipt{Retailer: "Target"}, processed, awarded)
+
+	adjusted, _ := events.New(events.TypePointsAdjusted, receiptID, events.PointsAdjusted{Points: -12})
+	receipt, _ := repo.FindByID(context.Background(), receiptID)
+	repo.AdjustReceipt(context.Background(), receiptID, receipt, models.PointsAdjustment{Points: -12}, adjusted)
+
+	// A cancelled write stores neither the change nor its events
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	voided, _ := events.New(events.TypeReceiptVoided, receiptID, events.ReceiptVoided{})
+	repo.UpdateReceipt(ctx, receiptID, models.Receipt{Retailer: "Target", Status: models.StatusVoided}, voided)
+
+	outbox, err := repo.EventsAfter(context.Background(), 0, 10)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(outbox) != 3 {
+		t.Fatalf("Expected 3 events in the outbox, got %d", len(outbox))
+	}
+	for i, event := range outbox {
+		if event.Sequence != uint64(i+1) || event.ReceiptID != receiptID {
+			t.Errorf("Expected event %d about receipt '%s', got sequence %d about '%s'", i+1, receiptID, event.Sequence, event.ReceiptID)
+		}
+	}
+
+	page, _ := repo.EventsAfter(context.Background(), 1, 1)
+	if len(page) != 1 || page[0].Type != events.TypePointsAwarded {
+		t.Errorf("Expected the second event alone, got %+v", page)
+	}
+	if rest, _ := repo.EventsAfter(context.Background(), 3, 10); len(rest) != 0 {
+		t.Errorf("Expected no events after the last one, got %d", len(rest))
+	}
+}
+
+func TestInMemoryReceiptRepo_CompactOutbox(t *testing.T) {
+	repo := NewInMemoryReceiptRepo(nil, nil)
+	for range 3 {
+		processed, _ := events.New(events.TypeReceiptProcessed, "", events.ReceiptProcessed{Retailer: "Target"})
+		repo.ProcessReceipt(context.Background(), models.Receipt{Retailer: "Target"}, processed)
+	}
+
+	if err := repo.CompactThrough(context.Background(), 2); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	processed, _ := events.New(events.TypeReceiptProcessed, "", events.ReceiptProcessed{Retailer: "Target"})
+	repo.ProcessReceipt(context.Background(), models.Receipt{Retailer: "Target"}, processed)
+
+	// Sequences carry on from the compacted events, which are no longer returned
+	outbox, _ := repo.EventsAfter(context.Background(), 0, 10)
+	if len(outbox) != 2 || outbox[0].Sequence != 3 || outbox[1].Sequence != 4 {
+		t.Fatalf("Expected events 3 and 4 to be kept, got %+v", outbox)
+	}
+	if page, _ := repo.EventsAfter(context.Background(), 3, 10); len(page) != 1 || page[0].Sequence != 4 {
+		t.Errorf("Expected event 4 after 3, got %+v", page)
+	}
+	if err := repo.CompactThrough(context.Background(), 1); err != nil || len(repo.outbox) != 2 {
+		t.Errorf("Expected compacting behind the outbox to keep every event, got %d and %v", len(repo.outbox), err)
+	}
+}
@@ -0,0 +1,90 @@
+package repositories
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+)
+
+// Repository
+type RetailerRepository interface {
+	Create(retailer models.Retailer) bool
+	FindByID(id string) (models.Retailer, bool)
+	FindAll() []models.Retailer
+	Update(retailer models.Retailer) bool
+	Delete(id string) bool
+}
+
+// In-memory implementation of the retailer registry
+type InMemoryRetailerRepo struct {
+	retailers map[string]models.Retailer
+	mu        sync.RWMutex
+}
+
+func NewInMemoryRetailerRepo() *InMemoryRetailerRepo {
+	return &InMemoryRetailerRepo{retailers: make(map[string]models.Retailer)}
+}
+
+// Create stores a new retailer. Returns false if a retailer with the same ID already exists.
+func (repo *InMemoryRetailerRepo) Create(retailer models.Retailer) bool {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if _, exists := repo.retailers[retailer.ID]; exists {
+		return false
+	}
+
+	repo.retailers[retailer.ID] = retailer
+	return true
+}
+
+// FindByID retrieves a retailer by its canonical ID. Returns the retailer and a boolean indicating if it exists.
+func (repo *InMemoryRetailerRepo) FindByID(retailerID string) (models.Retailer, bool) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	retailer, ok := repo.retailers[retailerID]
+
+	return retailer, ok
+}
+
+// FindAll returns every retailer ordered by ID.
+func (repo *InMemoryRetailerRepo) FindAll() []models.Retailer {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	retailers := make([]models.Retailer, 0, len(repo.retailers))
+	for _, retailer := range repo.retailers {
+		retailers = append(retailers, retailer)
+	}
+
+	sort.Slice(retailers, func(i, j int) bool { return retailers[i].ID < retailers[j].ID })
+	return retailers
+}
+
+// Update replaces a stored retailer. Returns false if no retailer exists for the ID.
+func (repo *InMemoryRetailerRepo) Update(retailer models.Retailer) bool {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if _, exists := repo.retailers[retailer.ID]; !exists {
+		return false
+	}
+
+	repo.retailers[retailer.ID] = retailer
+	return true
+}
+
+// Delete removes a retailer. Returns false if no retailer exists for the ID.
+func (repo *InMemoryRetailerRepo) Delete(retailerID string) bool {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if _, exists := repo.retailers[retailerID]; !exists {
+		return false
+	}
+
+	delete(repo.retailers, retailerID)
+	return true
+}
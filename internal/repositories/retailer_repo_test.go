@@ -0,0 +1,44 @@
+package repositories
+
+import (
+	"testing"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+)
+
+func TestInMemoryRetailerRepo_CRUD(t *testing.T) {
+	repo := NewInMemoryRetailerRepo()
+
+	target := models.Retailer{ID: "target", DisplayName: "Target", Active: true}
+	if !repo.Create(target) {
+		t.Fatalf("Expected retailer '%s' to be created", target.ID)
+	}
+	if repo.Create(target) {
+		t.Errorf("Expected creating a duplicate ID to fail")
+	}
+	repo.Create(models.Retailer{ID: "walgreens", DisplayName: "Walgreens", Active: true})
+
+	all := repo.FindAll()
+	if len(all) != 2 || all[0].ID != "target" || all[1].ID != "walgreens" {
+		t.Errorf("Expected retailers ordered by ID, got %+v", all)
+	}
+
+	target.Aliases = []string{"Target Store"}
+	if !repo.Update(target) {
+		t.Fatalf("Expected retailer '%s' to be updated", target.ID)
+	}
+	found, exists := repo.FindByID("target")
+	if !exists || len(found.Aliases) != 1 {
+		t.Errorf("Expected updated retailer, got %+v", found)
+	}
+
+	if !repo.Delete("target") {
+		t.Fatalf("Expected retailer '%s' to be deleted", target.ID)
+	}
+	if _, exists := repo.FindByID("target"); exists {
+		t.Errorf("Expected retailer '%s' to be gone", target.ID)
+	}
+	if repo.Update(target) || repo.Delete("target") {
+		t.Errorf("Expected update and delete of a missing retailer to fail")
+	}
+}
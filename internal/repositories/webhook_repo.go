@@ -0,0 +1,143 @@
+package repositories
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+)
+
+// Repository
+type WebhookRepository interface {
+	CreateSubscription(subscription models.WebhookSubscription) string
+	FindSubscription(id string) (models.WebhookSubscription, bool)
+	FindSubscriptions() []models.WebhookSubscription
+	DeleteSubscription(id string) bool
+	CreateDelivery(delivery models.WebhookDelivery) string
+	FindDelivery(id string) (models.WebhookDelivery, bool)
+	FindDeliveriesByStatus(status models.DeliveryStatus) []models.WebhookDelivery
+	UpdateDelivery(delivery models.WebhookDelivery) bool
+}
+
+// In-memory implementation of the webhook subscriptions and their deliveries
+type InMemoryWebhookRepo struct {
+	subscriptions map[string]models.WebhookSubscription
+	deliveries    map[string]models.WebhookDelivery
+	idGenerator   UUIDGenerator
+	mu            sync.RWMutex
+}
+
+func NewInMemoryWebhookRepo(generator UUIDGenerator) *InMemoryWebhookRepo {
+	if generator == nil {
+		generator = DefaultUUIDGenerator{}
+	}
+	return &InMemoryWebhookRepo{
+		subscriptions: make(map[string]models.WebhookSubscription),
+		deliveries:    make(map[string]models.WebhookDelivery),
+		idGenerator:   generator,
+	}
+}
+
+// CreateSubscription saves a subscription and returns its generated ID.
+func (repo *InMemoryWebhookRepo) CreateSubscription(subscription models.WebhookSubscription) string {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	subscription.ID = repo.idGenerator.New().String()
+	repo.subscriptions[subscription.ID] = subscription
+	return subscription.ID
+}
+
+// FindSubscription retrieves a subscription by its ID. Returns the subscription and a boolean indicating if it exists.
+func (repo *InMemoryWebhookRepo) FindSubscription(subscriptionID string) (models.WebhookSubscription, bool) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	subscription, ok := repo.subscriptions[subscriptionID]
+	return subscription, ok
+}
+
+// FindSubscriptions returns every subscription, oldest first.
+func (repo *InMemoryWebhookRepo) FindSubscriptions() []models.WebhookSubscription {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	subscriptions := make([]models.WebhookSubscription, 0, len(repo.subscriptions))
+	for _, subscription := range repo.subscriptions {
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	sort.Slice(subscriptions, func(i, j int) bool {
+		if !subscriptions[i].CreatedAt.Equal(subscriptions[j].CreatedAt) {
+			return subscriptions[i].CreatedAt.Before(subscriptions[j].CreatedAt)
+		}
+		return subscriptions[i].ID < subscriptions[j].ID
+	})
+	return subscriptions
+}
+
+// DeleteSubscription removes a subscription. Returns false if no subscription exists for the ID.
+func (repo *InMemoryWebhookRepo) DeleteSubscription(subscriptionID string) bool {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if _, exists := repo.subscriptions[subscriptionID]; !exists {
+		return false
+	}
+
+	delete(repo.subscriptions, subscriptionID)
+	return true
+}
+
+// CreateDelivery saves a delivery and returns its generated ID.
+func (repo *InMemoryWebhookRepo) CreateDelivery(delivery models.WebhookDelivery) string {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	delivery.ID = repo.idGenerator.New().String()
+	repo.deliveries[delivery.ID] = delivery
+	return delivery.ID
+}
+
+// FindDelivery retrieves a delivery by its ID. Returns the delivery and a boolean indicating if it exists.
+func (repo *InMemoryWebhookRepo) FindDelivery(deliveryID string) (models.WebhookDelivery, bool) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	delivery, ok := repo.deliveries[deliveryID]
+	return delivery, ok
+}
+
+// FindDeliveriesByStatus returns the deliveries with a status, oldest first.
+func (repo *InMemoryWebhookRepo) FindDeliveriesByStatus(status models.DeliveryStatus) []models.WebhookDelivery {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	var deliveries []models.WebhookDelivery
+	for _, delivery := range repo.deliveries {
+		if delivery.Status == status {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+
+	sort.Slice(deliveries, func(i, j int) bool {
+		if !deliveries[i].CreatedAt.Equal(deliveries[j].CreatedAt) {
+			return deliveries[i].CreatedAt.Before(deliveries[j].CreatedAt)
+		}
+		return deliveries[i].ID < deliveries[j].ID
+	})
+	return deliveries
+}
+
+// UpdateDelivery replaces a stored delivery. Returns false if no delivery exists for the ID.
+func (repo *InMemoryWebhookRepo) UpdateDelivery(delivery models.WebhookDelivery) bool {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if _, exists := repo.deliveries[delivery.ID]; !exists {
+		return false
+	}
+
+	repo.deliveries[delivery.ID] = delivery
+	return true
+}
@@ -0,0 +1,49 @@
+package repositories
+
+import (
+	"testing"
+	"time"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+)
+
+func TestInMemoryWebhookRepo_Deliveries(t *testing.T) {
+	repo := NewInMemoryWebhookRepo(nil)
+
+	createdAt := time.Date(2022, 1, 2, 13, 13, 0, 0, time.UTC)
+	second := repo.CreateDelivery(models.WebhookDelivery{Status: models.DeliveryPending, CreatedAt: createdAt.Add(time.Minute)})
+	first := repo.CreateDelivery(models.WebhookDelivery{Status: models.DeliveryPending, CreatedAt: createdAt})
+	repo.CreateDelivery(models.WebhookDelivery{Status: models.DeliveryDelivered, CreatedAt: createdAt})
+
+	pending := repo.FindDeliveriesByStatus(models.DeliveryPending)
+	if len(pending) != 2 || pending[0].ID != first || pending[1].ID != second {
+		t.Fatalf("Expected pending deliveries [%s %s] oldest first, got %+v", first, second, pending)
+	}
+
+	delivery := pending[0]
+	delivery.Status = models.DeliveryFailed
+	if !repo.UpdateDelivery(delivery) {
+		t.Fatalf("Expected delivery '%s' to be updated", delivery.ID)
+	}
+	if failed := repo.FindDeliveriesByStatus(models.DeliveryFailed); len(failed) != 1 || failed[0].ID != first {
+		t.Errorf("Expected delivery '%s' to be failed, got %+v", first, failed)
+	}
+	if repo.UpdateDelivery(models.WebhookDelivery{ID: "non-existent-id"}) {
+		t.Errorf("Expected updating a missing delivery to fail")
+	}
+}
+
+func TestInMemoryWebhookRepo_Subscriptions(t *testing.T) {
+	repo := NewInMemoryWebhookRepo(MockUUIDGenerator{})
+
+	subscriptionID := repo.CreateSubscription(models.WebhookSubscription{URL: "https://partner.example.com/hooks"})
+	if subscription, ok := repo.FindSubscription(subscriptionID); !ok || subscription.URL != "https://partner.example.com/hooks" {
+		t.Errorf("Expected to find subscription '%s', got %+v", subscriptionID, subscription)
+	}
+	if !repo.DeleteSubscription(subscriptionID) || len(repo.FindSubscriptions()) != 0 {
+		t.Errorf("Expected the subscription to be deleted")
+	}
+	if repo.DeleteSubscription(subscriptionID) {
+		t.Errorf("Expected deleting a missing subscription to fail")
+	}
+}
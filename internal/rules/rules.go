@@ -0,0 +1,44 @@
+// Package rules reads the rules file, which adds scoring rules to the built-in ones.
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/calendar"
+	"github.com/javier-tello/receipt-processor-challenge/internal/expr"
+)
+
+// File is the contents of a rules file, e.g.
+//
+//	{
+//		"calendar": [{"name": "weekend-bonus", "windows": [{"days": ["weekends"]}], "bonusPoints": 20}],
+//		"expressions": [{"name": "organic", "when": "any(items, contains(lower(description), 'organic')) and total > 20", "points": "15"}]
+//	}
+type File struct {
+	Calendar    []calendar.Rule `json:"calendar"`
+	Expressions []expr.Rule     `json:"expressions"`
+}
+
+// Load reads a rules file. An empty path adds no rules. Fields the file format does not
+// define are rejected so that a misspelt setting is not silently ignored.
+func Load(path string) (File, error) {
+	if path == "" {
+		return File{}, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return File{}, err
+	}
+	defer f.Close()
+
+	var file File
+	decoder := json.NewDecoder(f)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return File{}, fmt.Errorf("reading rules from %s: %w", path, err)
+	}
+	return file, nil
+}
@@ -0,0 +1,360 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/events"
+	"github.com/javier-tello/receipt-processor-challenge/internal/logging"
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+	"github.com/javier-tello/receipt-processor-challenge/internal/ratelimit"
+	"github.com/javier-tello/receipt-processor-challenge/internal/repositories"
+	"github.com/javier-tello/receipt-processor-challenge/internal/tracing"
+)
+
+const (
+	DefaultBackfillPollInterval = time.Second
+	// DefaultBackfillBatchSize is the most receipts a job re-scores each poll, however high its rate
+	DefaultBackfillBatchSize = 100
+)
+
+var (
+	ErrBackfillNotFound   = errors.New("cannot find backfill")
+	ErrBackfillNotRunning = errors.New("backfill is not running")
+	ErrBackfillCompleted  = errors.New("backfill has already completed")
+)
+
+// BackfillService re-scores stored receipts under a version of the rules after a rule is fixed.
+// A job selects its receipts when it starts and Run re-scores them in the background, one at a
+// time and no faster than the job's rate. Jobs can be paused and resumed, and a job that fails
+// on a receipt stops there so that resuming it retries that receipt.
+type BackfillService struct {
+	PollInterval time.Duration
+	BatchSize    int
+	receipts     *ReceiptService
+	repo         repositories.BackfillRepository
+	limiters     map[string]*ratelimit.Limiter
+	logger       *slog.Logger
+
+	// mu serializes each step of a job with pausing and resuming it, so a job is never paused
+	// while a receipt is half re-scored
+	mu sync.Mutex
+}
+
+func NewBackfillService(receipts *ReceiptService, repo repositories.BackfillRepository, logger *slog.Logger) *BackfillService {
+	return &BackfillService{
+		PollInterval: DefaultBackfillPollInterval,
+		BatchSize:    DefaultBackfillBatchSize,
+		receipts:     receipts,
+		repo:         repo,
+		limiters:     make(map[string]*ratelimit.Limiter),
+		logger:       logging.OrDefault(logger),
+	}
+}
+
+// StartBackfill selects the receipts matching the request's filter that are not already scored
+// under its rule version and the calendar and expression rules in force, and queues a job to
+// re-score them.
+func (s *BackfillService) StartBackfill(ctx context.Context, request models.BackfillRequest) (models.BackfillJob, error) {
+	for _, version := range append([]string{request.RuleVersion}, request.Filter.RuleVersions...) {
+		if _, err := RulesForVersion(version); err != nil {
+			return models.BackfillJob{}, err
+		}
+	}
+	if len(request.Filter.Statuses) == 0 {
+		request.Filter.Statuses = []models.ReceiptStatus{models.StatusApproved, models.StatusPending}
+	}
+
+	receipts, err := s.receipts.repo.FindByPurchaseDate(ctx, request.Filter.From, request.Filter.To)
+	if err != nil {
+		return models.BackfillJob{}, err
+	}
+
+	digest := s.receipts.RulesDigest()
+	now := time.Now().UTC()
+	job := models.BackfillJob{Status: models.BackfillRunning, Request: request, CreatedAt: now, UpdatedAt: now}
+	var receiptIDs []string
+	for _, receipt := range receipts {
+		if matchesBackfill(request, digest, receipt) {
+			receiptIDs = append(receiptIDs, receipt.ID)
+		}
+	}
+	job.Total = len(receiptIDs)
+	if job.Total == 0 {
+		job.Status = models.BackfillCompleted
+		job.CompletedAt = &now
+	}
+	job.ID = s.repo.CreateJob(job, receiptIDs)
+
+	s.logger.InfoContext(ctx, "Backfill started", "backfill_id", job.ID, "rule_version", request.RuleVersion, "receipts", job.Total, "actor", request.Actor)
+	return job, nil
+}
+
+// matchesBackfill reports whether a backfill re-scores a receipt. Receipts already scored under
+// the backfill's rule version and the custom rules with the given digest are left alone.
+func matchesBackfill(request models.BackfillRequest, digest string, receipt models.Receipt) bool {
+	version := ruleVersion(receipt)
+	if version == request.RuleVersion && receipt.RulesDigest == digest {
+		return false
+	}
+	if len(request.Filter.RuleVersions) > 0 && !slices.Contains(request.Filter.RuleVersions, version) {
+		return false
+	}
+	if !slices.Contains(request.Filter.Statuses, receipt.Status) {
+		return false
+	}
+	if retailer := request.Filter.Retailer; retailer != "" && !strings.EqualFold(retailer, receipt.Retailer) && !strings.EqualFold(retailer, canonicalRetailerName(receipt)) {
+		return false
+	}
+	return true
+}
+
+// GetBackfills returns every backfill job, oldest first.
+func (s *BackfillService) GetBackfills() []models.BackfillJob {
+	return s.repo.FindJobs()
+}
+
+// GetBackfill returns a backfill job and its progress.
+func (s *BackfillService) GetBackfill(backfillID string) (models.BackfillJob, error) {
+	job, exists := s.repo.FindJob(backfillID)
+	if !exists {
+		return models.BackfillJob{}, ErrBackfillNotFound
+	}
+	return job, nil
+}
+
+// GetBackfillResults returns a page of the points before and after of the receipts a job has
+// re-scored, in the order they were re-scored, skipping offset results and returning up to limit.
+func (s *BackfillService) GetBackfillResults(backfillID string, offset int, limit int) ([]models.BackfillResult, error) {
+	if _, err := s.GetBackfill(backfillID); err != nil {
+		return nil, err
+	}
+	return s.repo.FindResults(backfillID, offset, limit), nil
+}
+
+// PauseBackfill stops a running job after the receipt it is re-scoring, if any.
+func (s *BackfillService) PauseBackfill(backfillID string) (models.BackfillJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, exists := s.repo.FindJob(backfillID)
+	if !exists {
+		return models.BackfillJob{}, ErrBackfillNotFound
+	}
+	if job.Status != models.BackfillRunning {
+		return models.BackfillJob{}, ErrBackfillNotRunning
+	}
+
+	job.Status = models.BackfillPaused
+	job.UpdatedAt = time.Now().UTC()
+	s.repo.UpdateJob(job)
+	delete(s.limiters, job.ID)
+
+	s.logger.Info("Backfill paused", "backfill_id", backfillID, "processed", job.Processed, "total", job.Total)
+	return job, nil
+}
+
+// ResumeBackfill continues a paused or failed job from the first receipt it has not re-scored.
+// Resuming a running job changes nothing.
+func (s *BackfillService) ResumeBackfill(backfillID string) (models.BackfillJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, exists := s.repo.FindJob(backfillID)
+	if !exists {
+		return models.BackfillJob{}, ErrBackfillNotFound
+	}
+	switch job.Status {
+	case models.BackfillCompleted:
+		return models.BackfillJob{}, ErrBackfillCompleted
+	case models.BackfillRunning:
+		return job, nil
+	}
+
+	job.Status = models.BackfillRunning
+	job.UpdatedAt = time.Now().UTC()
+	s.repo.UpdateJob(job)
+
+	s.logger.Info("Backfill resumed", "backfill_id", backfillID, "processed", job.Processed, "total", job.Total)
+	return job, nil
+}
+
+// Run re-scores receipts for running jobs every PollInterval until ctx is cancelled.
+func (s *BackfillService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		s.ProcessDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessDue re-scores up to BatchSize receipts for each running job, as many as the job's rate
+// allows, and returns how many were re-scored.
+func (s *BackfillService) ProcessDue(ctx context.Context) int {
+	rescored := 0
+	for _, job := range s.repo.FindJobsByStatus(models.BackfillRunning) {
+		limiter := s.limiter(job)
+		for range s.BatchSize {
+			if ctx.Err() != nil {
+				return rescored
+			}
+			if allowed, _ := limiter.Allow(job.ID); !allowed {
+				break
+			}
+			more, ok := s.step(ctx, job.ID)
+			if ok {
+				rescored++
+			}
+			if !more {
+				break
+			}
+		}
+	}
+	return rescored
+}
+
+// limiter returns the rate limiter of a running job, which holds as many receipts as the job may
+// re-score between polls. A job without a rate has a nil limiter and is only limited by BatchSize.
+// The limiter is dropped once the job stops running.
+func (s *BackfillService) limiter(job models.BackfillJob) *ratelimit.Limiter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	limiter, exists := s.limiters[job.ID]
+	if !exists {
+		rate := job.Request.ReceiptsPerSecond
+		limiter = ratelimit.New(rate, int(math.Ceil(rate*s.PollInterval.Seconds())))
+		s.limiters[job.ID] = limiter
+	}
+	return limiter
+}
+
+// step re-scores the next receipt of a running job. It reports whether the job has more receipts
+// to re-score and whether a receipt was re-scored.
+func (s *BackfillService) step(ctx context.Context, backfillID string) (more bool, rescored bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, exists := s.repo.FindJob(backfillID)
+	if !exists || job.Status != models.BackfillRunning {
+		return false, false
+	}
+	logger := s.logger.With("backfill_id", job.ID)
+
+	var results []models.BackfillResult
+	if receiptID, ok := s.repo.FindReceiptID(job.ID, job.Processed); ok {
+		result, err := s.receipts.RescoreReceipt(ctx, receiptID, job.ID, job.Request)
+		if err != nil {
+			if ctx.Err() != nil {
+				return false, false
+			}
+			job.Status = models.BackfillFailed
+			job.LastError = fmt.Sprintf("receipt %s: %v", receiptID, err)
+			job.UpdatedAt = time.Now().UTC()
+			s.repo.UpdateJob(job)
+			delete(s.limiters, job.ID)
+			logger.WarnContext(ctx, "Backfill failed, resume it to retry the receipt", "receipt_id", receiptID, "processed", job.Processed, "error", err)
+			return false, false
+		}
+
+		results = append(results, result)
+		job.Processed++
+		if result.PointsAfter != result.PointsBefore {
+			job.Changed++
+			job.PointsDelta += result.PointsAfter - result.PointsBefore
+		}
+		job.LastError = ""
+		rescored = true
+	}
+
+	now := time.Now().UTC()
+	job.UpdatedAt = now
+	if job.Processed >= job.Total {
+		job.Status = models.BackfillCompleted
+		job.CompletedAt = &now
+		delete(s.limiters, job.ID)
+		logger.InfoContext(ctx, "Backfill completed", "receipts", job.Total, "changed", job.Changed, "points_delta", job.PointsDelta)
+	}
+	s.repo.UpdateJob(job, results...)
+	return job.Status == models.BackfillRunning, rescored
+}
+
+// RescoreReceipt moves a receipt to the backfill's rule version, re-scoring it under the calendar
+// and expression rules in force. Awarded points that change are recorded as an adjustment with
+// the backfill's reason and actor. Promotions and caps were settled when the receipt was
+// processed and are kept.
+func (rs *ReceiptService) RescoreReceipt(ctx context.Context, receiptID string, backfillID string, request models.BackfillRequest) (result models.BackfillResult, err error) {
+	ctx, span := rs.startSpan(ctx, "RescoreReceipt", receiptID)
+	defer func() { tracing.End(span, err) }()
+
+	if _, err := RulesForVersion(request.RuleVersion); err != nil {
+		return models.BackfillResult{}, err
+	}
+
+	// The new rule version and the adjustment are stored in one write, so a receipt is never left
+	// on the new version without its adjustment
+	var receipt models.Receipt
+	var adjustment models.PointsAdjustment
+	err = retryOnConflict(ctx, func() error {
+		if receipt, err = rs.repo.FindByID(ctx, receiptID); err != nil {
+			return err
+		}
+
+		result = models.BackfillResult{
+			ReceiptID:         receiptID,
+			RuleVersionBefore: ruleVersion(receipt),
+			PointsBefore:      rs.calculatePoints(ctx, receipt),
+			RescoredAt:        time.Now().UTC(),
+		}
+		digestBefore := receipt.RulesDigest
+		receipt.RuleVersion = request.RuleVersion
+		receipt = rs.scoreRules(ctx, receipt)
+		receipt.Points = rs.calculateBreakdown(ctx, receipt).Total
+		result.PointsAfter = rs.calculatePoints(ctx, receipt)
+		if result.RuleVersionBefore == request.RuleVersion && digestBefore == receipt.RulesDigest {
+			return nil
+		}
+
+		rescored := pendingEvent{events.TypeReceiptRescored, events.ReceiptRescored{
+			BackfillID:        backfillID,
+			RuleVersionBefore: result.RuleVersionBefore,
+			RuleVersion:       request.RuleVersion,
+			PointsBefore:      result.PointsBefore,
+			PointsAfter:       result.PointsAfter,
+		}}
+		if result.PointsAfter == result.PointsBefore {
+			outbox, err := buildEvents(receiptID, rescored)
+			if err != nil {
+				return err
+			}
+			return rs.repo.UpdateReceipt(ctx, receiptID, receipt, outbox...)
+		}
+
+		adjustment, err = rs.adjust(ctx, receiptID, receipt, result.PointsAfter-result.PointsBefore, request.Reason, request.Actor, rescored)
+		result.AdjustmentID = adjustment.ID
+		return err
+	})
+	if err != nil {
+		return models.BackfillResult{}, err
+	}
+
+	rs.logger.DebugContext(ctx, "Receipt rescored", "receipt_id", receiptID, "backfill_id", backfillID, "rule_version_before", result.RuleVersionBefore, "rule_version", request.RuleVersion, "points_before", result.PointsBefore, "points_after", result.PointsAfter)
+	if result.AdjustmentID != "" {
+		rs.notify(ctx, models.EventReceiptAdjusted, receipt, &adjustment)
+	}
+	return result, nil
+}
@@ -0,0 +1,266 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/events"
+	"github.com/javier-tello/receipt-processor-challenge/internal/expr"
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+	"github.com/javier-tello/receipt-processor-challenge/internal/repositories"
+)
+
+// failingReceiptRepo fails to store, update or adjust receipts while fail is set
+type failingReceiptRepo struct {
+	*repositories.InMemoryReceiptRepo
+	fail bool
+}
+
+func (repo *failingReceiptRepo) ProcessReceipt(ctx context.Context, receipt models.Receipt, outbox ...events.Event) (string, error) {
+	if repo.fail {
+		return "", errors.New("storage unavailable")
+	}
+	return repo.InMemoryReceiptRepo.ProcessReceipt(ctx, receipt, outbox...)
+}
+
+func (repo *failingReceiptRepo) UpdateReceipt(ctx context.Context, receiptID string, receipt models.Receipt, outbox ...events.Event) error {
+	if repo.fail {
+		return errors.New("storage unavailable")
+	}
+	return repo.InMemoryReceiptRepo.UpdateReceipt(ctx, receiptID, receipt, outbox...)
+}
+
+func (repo *failingReceiptRepo) AdjustReceipt(ctx context.Context, receiptID string, receipt models.Receipt, adjustment models.PointsAdjustment, outbox ...events.Event) (string, error) {
+	if repo.fail {
+		return "", errors.New("storage unavailable")
+	}
+	return repo.InMemoryReceiptRepo.AdjustReceipt(ctx, receiptID, receipt, adjustment, outbox...)
+}
+
+// storeLegacyReceipt stores a receipt scored before the rules were versioned. It earns 6 points
+// for the retailer, plus 10 for the time of purchase under the first rule version if bought
+// after 14:00 and before 18:00.
+func storeLegacyReceipt(t *testing.T, repo repositories.ReceiptRepository, purchaseTime string, status models.ReceiptStatus, submitted int) string {
+	t.Helper()
+	receiptID, err := repo.ProcessReceipt(context.Background(), models.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-02",
+		PurchaseTime: purchaseTime,
+		Total:        "1.01",
+		Items:        []models.Item{{ShortDescription: "Pepsi", Price: "1.01"}},
+		Status:       status,
+		SubmittedAt:  time.Date(2022, 1, 2, 0, submitted, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return receiptID
+}
+
+func TestBackfillService_RescoresReceipts(t *testing.T) {
+	repo := repositories.NewInMemoryReceiptRepo(nil, nil)
+	receipts := NewReceiptService(repo)
+	backfills := NewBackfillService(receipts, repositories.NewInMemoryBackfillRepo(nil), nil)
+	backfills.BatchSize = 2
+
+	afterWindow := storeLegacyReceipt(t, repo, "16:30", models.StatusApproved, 1)
+	inWindow := storeLegacyReceipt(t, repo, "15:00", models.StatusApproved, 2)
+	pending := storeLegacyReceipt(t, repo, "16:30", models.StatusPending, 3)
+	storeLegacyReceipt(t, repo, "16:30", models.StatusVoided, 4)
+	if _, err := receipts.ProcessReceipt(context.Background(), models.Receipt{Retailer: "Target", PurchaseDate: "2022-01-02", PurchaseTime: "16:30", Total: "1.01", Items: []models.Item{{ShortDescription: "Pepsi", Price: "1.01"}}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	job, err := backfills.StartBackfill(context.Background(), models.BackfillRequest{RuleVersion: RuleVersion2, Reason: "time window fix", Actor: "ops-1"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if job.Total != 3 || job.Status != models.BackfillRunning {
+		t.Fatalf("Expected a running job over the 3 approved and pending legacy receipts, got %+v", job)
+	}
+
+	if rescored := backfills.ProcessDue(context.Background()); rescored != 2 {
+		t.Errorf("Expected a batch of 2 receipts, got %d", rescored)
+	}
+	if _, err := backfills.PauseBackfill(job.ID); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if rescored := backfills.ProcessDue(context.Background()); rescored != 0 {
+		t.Errorf("Expected a paused job to re-score nothing, got %d", rescored)
+	}
+	if _, err := backfills.PauseBackfill(job.ID); !errors.Is(err, ErrBackfillNotRunning) {
+		t.Errorf("Expected ErrBackfillNotRunning, got %v", err)
+	}
+	if _, err := backfills.ResumeBackfill(job.ID); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	backfills.ProcessDue(context.Background())
+
+	job, _ = backfills.GetBackfill(job.ID)
+	if job.Status != models.BackfillCompleted || job.Processed != 3 || job.Changed != 1 || job.PointsDelta != -10 || job.CompletedAt == nil {
+		t.Errorf("Expected a completed job taking back 10 points from one receipt, got %+v", job)
+	}
+	if _, err := backfills.ResumeBackfill(job.ID); !errors.Is(err, ErrBackfillCompleted) {
+		t.Errorf("Expected ErrBackfillCompleted, got %v", err)
+	}
+	if len(backfills.limiters) != 0 {
+		t.Errorf("Expected the rate limiter of a completed job to be dropped, got %d limiters", len(backfills.limiters))
+	}
+
+	if page, _ := backfills.GetBackfillResults(job.ID, 2, 10); len(page) != 1 || page[0].ReceiptID != pending {
+		t.Errorf("Expected the last page to hold the pending receipt, got %+v", page)
+	}
+	results, _ := backfills.GetBackfillResults(job.ID, 0, 10)
+	expected := []models.BackfillResult{
+		{ReceiptID: afterWindow, RuleVersionBefore: RuleVersion1, PointsBefore: 16, PointsAfter: 6},
+		{ReceiptID: inWindow, RuleVersionBefore: RuleVersion1, PointsBefore: 16, PointsAfter: 16},
+		{ReceiptID: pending, RuleVersionBefore: RuleVersion1},
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("Expected %d results, got %+v", len(expected), results)
+	}
+	for i, result := range results {
+		if result.ReceiptID != expected[i].ReceiptID || result.RuleVersionBefore != expected[i].RuleVersionBefore || result.PointsBefore != expected[i].PointsBefore || result.PointsAfter != expected[i].PointsAfter {
+			t.Errorf("Expected result %+v, got %+v", expected[i], result)
+		}
+		if (result.AdjustmentID != "") != (result.PointsAfter != result.PointsBefore) {
+			t.Errorf("Expected an adjustment only when the points changed, got %+v", result)
+		}
+	}
+
+	adjustments, _ := receipts.GetAdjustmentsForReceipt(context.Background(), afterWindow)
+	if len(adjustments) != 1 || adjustments[0].Points != -10 || adjustments[0].Reason != "time window fix" || adjustments[0].Actor != "ops-1" {
+		t.Errorf("Expected a 10 point adjustment, got %+v", adjustments)
+	}
+	if points, _ := receipts.CalculateTotalPointsForReceipt(context.Background(), afterWindow); points != 6 {
+		t.Errorf("Expected the receipt to be worth 6 points under the fixed rules, got %d", points)
+	}
+
+	// Every receipt is now scored under the fixed rules, so a second backfill has nothing to do
+	again, _ := backfills.StartBackfill(context.Background(), models.BackfillRequest{RuleVersion: RuleVersion2, Reason: "time window fix", Actor: "ops-1"})
+	if again.Total != 0 || again.Status != models.BackfillCompleted {
+		t.Errorf("Expected an empty completed job, got %+v", again)
+	}
+}
+
+func TestBackfillService_RescoresEditedExpressionRules(t *testing.T) {
+	repo := repositories.NewInMemoryReceiptRepo(nil, nil)
+	engine, err := expr.New([]expr.Rule{{Name: "pepsi", When: `any(items, contains(lower(description), "pepsi"))`, Points: "15"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	receiptID, err := NewReceiptService(repo, WithExpressions(engine)).ProcessReceipt(context.Background(), models.Receipt{Retailer: "Target", PurchaseDate: "2022-01-02", PurchaseTime: "16:30", Total: "1.01", Items: []models.Item{{ShortDescription: "Pepsi", Price: "1.01"}}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	edited, err := expr.New([]expr.Rule{{Name: "pepsi", When: `any(items, contains(lower(description), "pepsi"))`, Points: "25"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	receipts := NewReceiptService(repo, WithExpressions(edited))
+	backfills := NewBackfillService(receipts, repositories.NewInMemoryBackfillRepo(nil), nil)
+
+	// The receipt keeps its points until a backfill re-scores it under the edited rule
+	if points, _ := receipts.CalculateTotalPointsForReceipt(context.Background(), receiptID); points != 21 {
+		t.Errorf("Expected the receipt to keep its 21 points, got %d", points)
+	}
+
+	job, err := backfills.StartBackfill(context.Background(), models.BackfillRequest{RuleVersion: CurrentRuleVersion, Reason: "pepsi bonus raised", Actor: "ops-1"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if job.Total != 1 {
+		t.Fatalf("Expected the receipt scored under the old rule to be selected, got %+v", job)
+	}
+	backfills.ProcessDue(context.Background())
+
+	if job, _ = backfills.GetBackfill(job.ID); job.Status != models.BackfillCompleted || job.Changed != 1 || job.PointsDelta != 10 {
+		t.Errorf("Expected a completed job awarding 10 points, got %+v", job)
+	}
+	if points, _ := receipts.CalculateTotalPointsForReceipt(context.Background(), receiptID); points != 31 {
+		t.Errorf("Expected the receipt to be worth 31 points under the edited rule, got %d", points)
+	}
+	if adjustments, _ := receipts.GetAdjustmentsForReceipt(context.Background(), receiptID); len(adjustments) != 1 || adjustments[0].Points != 10 {
+		t.Errorf("Expected a 10 point adjustment, got %+v", adjustments)
+	}
+
+	if again, _ := backfills.StartBackfill(context.Background(), models.BackfillRequest{RuleVersion: CurrentRuleVersion, Reason: "pepsi bonus raised", Actor: "ops-1"}); again.Total != 0 {
+		t.Errorf("Expected nothing left to re-score, got %+v", again)
+	}
+}
+
+func TestBackfillService_RateLimit(t *testing.T) {
+	repo := repositories.NewInMemoryReceiptRepo(nil, nil)
+	backfills := NewBackfillService(NewReceiptService(repo), repositories.NewInMemoryBackfillRepo(nil), nil)
+	for i := range 5 {
+		storeLegacyReceipt(t, repo, "16:30", models.StatusApproved, i)
+	}
+
+	job, err := backfills.StartBackfill(context.Background(), models.BackfillRequest{RuleVersion: RuleVersion2, ReceiptsPerSecond: 2, Reason: "time window fix", Actor: "ops-1"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// A poll every second at 2 receipts per second allows 2 receipts, then the bucket is empty
+	if rescored := backfills.ProcessDue(context.Background()); rescored != 2 {
+		t.Errorf("Expected 2 receipts to be re-scored, got %d", rescored)
+	}
+	if rescored := backfills.ProcessDue(context.Background()); rescored != 0 {
+		t.Errorf("Expected the rate limit to hold back the rest, got %d", rescored)
+	}
+	if job, _ = backfills.GetBackfill(job.ID); job.Processed != 2 || job.Status != models.BackfillRunning {
+		t.Errorf("Expected 2 of 5 receipts processed, got %+v", job)
+	}
+}
+
+func TestBackfillService_ResumesAfterFailure(t *testing.T) {
+	repo := &failingReceiptRepo{InMemoryReceiptRepo: repositories.NewInMemoryReceiptRepo(nil, nil)}
+	backfills := NewBackfillService(NewReceiptService(repo), repositories.NewInMemoryBackfillRepo(nil), nil)
+	first := storeLegacyReceipt(t, repo, "16:30", models.StatusApproved, 1)
+	storeLegacyReceipt(t, repo, "16:45", models.StatusApproved, 2)
+
+	job, _ := backfills.StartBackfill(context.Background(), models.BackfillRequest{RuleVersion: RuleVersion2, Reason: "time window fix", Actor: "ops-1"})
+	repo.fail = true
+	backfills.ProcessDue(context.Background())
+
+	job, _ = backfills.GetBackfill(job.ID)
+	if job.Status != models.BackfillFailed || job.Processed != 0 || job.LastError != "receipt "+first+": storage unavailable" {
+		t.Fatalf("Expected the job to fail on the first receipt, got %+v", job)
+	}
+	if adjustments, _ := repo.FindAdjustmentsByReceiptID(context.Background(), first); len(adjustments) != 0 {
+		t.Errorf("Expected no adjustment for a receipt that was not re-scored, got %+v", adjustments)
+	}
+	if receipt, _ := repo.FindByID(context.Background(), first); receipt.RuleVersion != "" {
+		t.Errorf("Expected the receipt to stay on its rule version without its adjustment, got %q", receipt.RuleVersion)
+	}
+
+	repo.fail = false
+	if _, err := backfills.ResumeBackfill(job.ID); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	backfills.ProcessDue(context.Background())
+
+	job, _ = backfills.GetBackfill(job.ID)
+	if job.Status != models.BackfillCompleted || job.Processed != 2 || job.PointsDelta != -20 || job.LastError != "" {
+		t.Errorf("Expected the resumed job to re-score both receipts, got %+v", job)
+	}
+	if adjustments, _ := repo.FindAdjustmentsByReceiptID(context.Background(), first); len(adjustments) != 1 || adjustments[0].Points != -10 {
+		t.Errorf("Expected the retried receipt to be adjusted once, got %+v", adjustments)
+	}
+}
+
+func TestBackfillService_UnknownRuleVersion(t *testing.T) {
+	backfills := NewBackfillService(NewReceiptService(repositories.NewInMemoryReceiptRepo(nil, nil)), repositories.NewInMemoryBackfillRepo(nil), nil)
+
+	for _, request := range []models.BackfillRequest{
+		{RuleVersion: "v9"},
+		{RuleVersion: RuleVersion2, Filter: models.BackfillFilter{RuleVersions: []string{"v0"}}},
+	} {
+		if _, err := backfills.StartBackfill(context.Background(), request); !errors.Is(err, ErrUnknownRuleVersion) {
+			t.Errorf("Expected ErrUnknownRuleVersion for %+v, got %v", request, err)
+		}
+	}
+}
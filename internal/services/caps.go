@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+)
+
+// Breakdown lines withholding the points over a cap are named after the cap
+const (
+	CapRule          = "cap:rule"
+	CapReceipt       = "cap:receipt"
+	CapCustomerDay   = "cap:customer_day"
+	CapCustomerMonth = "cap:customer_month"
+)
+
+// PointsCaps are hard limits on the points awarded, a zero limit being no limit. The points
+// from each rule and for each receipt are capped at the limits in force when the receipt was
+// processed, so changing them never changes a stored receipt's points. A customer's
+// points for receipts submitted in a UTC day or month are capped as each receipt is processed,
+// counting what the customer's earlier receipts earned, so receipts submitted once a cap has
+// been reached earn nothing. Customers are told apart by the client ID the handlers attribute a
+// receipt to, which the client supplies itself, so the customer caps are advisory: they hold back
+// an honest client but a client sending a new ID with each receipt is never capped.
+type PointsCaps struct {
+	PerRule          int
+	PerReceipt       int
+	PerCustomerDay   int
+	PerCustomerMonth int
+}
+
+func (c PointsCaps) perCustomer() bool {
+	return c.PerCustomerDay > 0 || c.PerCustomerMonth > 0
+}
+
+// applyCaps follows a receipt's rule and promotion lines with a line for each cap withholding
+// points, saying which cap it is and why. Promotions have their own budgets, so the per rule
+// cap only applies to rules.
+func (rs *ReceiptService) applyCaps(receipt models.Receipt, ruleLines []models.PointsLine, promotionLines []models.PointsLine) []models.PointsLine {
+	lines := append(append([]models.PointsLine{}, ruleLines...), promotionLines...)
+	caps := rs.receiptCaps()
+	if receipt.Caps != nil {
+		caps = *receipt.Caps
+	}
+
+	var capped []models.PointsLine
+	if caps.PerRule > 0 {
+		for _, line := range ruleLines {
+			if line.Points > caps.PerRule {
+				capped = append(capped, models.PointsLine{Rule: CapRule, Points: caps.PerRule - line.Points, Description: fmt.Sprintf("%s capped at %d points per rule", line.Rule, caps.PerRule)})
+			}
+		}
+	}
+
+	total := sumPoints(lines) + sumPoints(capped)
+	if caps.PerReceipt > 0 && total > caps.PerReceipt {
+		capped = append(capped, models.PointsLine{Rule: CapReceipt, Points: caps.PerReceipt - total, Description: fmt.Sprintf("capped at %d points per receipt", caps.PerReceipt)})
+		total = caps.PerReceipt
+	}
+
+	for _, ceiling := range receipt.Ceilings {
+		if total > ceiling.Points {
+			capped = append(capped, models.PointsLine{Rule: ceiling.Cap, Points: ceiling.Points - total, Description: ceiling.Reason})
+			total = ceiling.Points
+		}
+	}
+
+	return append(lines, capped...)
+}
+
+// receiptCaps returns the per rule and per receipt caps in force. Receipts keep the caps they
+// were processed under, and those not yet submitted are capped under these.
+func (rs *ReceiptService) receiptCaps() models.ReceiptCaps {
+	return models.ReceiptCaps{PerRule: rs.caps.PerRule, PerReceipt: rs.caps.PerReceipt}
+}
+
+// customerCeilings works out the most points a receipt may earn under its customer's daily and
+// monthly caps from the customer's running totals. Receipts still pending review count towards
+// the caps, so approving them later can never take a customer over.
+func (rs *ReceiptService) customerCeilings(ctx context.Context, receipt models.Receipt) ([]models.PointsCeiling, error) {
+	if !rs.caps.perCustomer() || receipt.ClientID == "" {
+		return nil, nil
+	}
+
+	day := receipt.SubmittedAt.UTC().Format("2006-01-02")
+	month := receipt.SubmittedAt.UTC().Format("2006-01")
+	earnedDay, earnedMonth, err := rs.repo.FindCustomerPoints(ctx, receipt.ClientID, receipt.SubmittedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	var ceilings []models.PointsCeiling
+	if limit := rs.caps.PerCustomerDay; limit > 0 {
+		ceilings = append(ceilings, models.PointsCeiling{
+			Cap:    CapCustomerDay,
+			Points: max(limit-earnedDay, 0),
+			Reason: fmt.Sprintf("capped at %d points per customer per day, %d already earned on %s", limit, earnedDay, day),
+		})
+	}
+	if limit := rs.caps.PerCustomerMonth; limit > 0 {
+		ceilings = append(ceilings, models.PointsCeiling{
+			Cap:    CapCustomerMonth,
+			Points: max(limit-earnedMonth, 0),
+			Reason: fmt.Sprintf("capped at %d points per customer per month, %d already earned in %s", limit, earnedMonth, month),
+		})
+	}
+	return ceilings, nil
+}
+
+// customerLocks hands out a lock for each customer, so that one customer's receipts are stored
+// one at a time while other customers' are stored concurrently. A customer's lock is dropped
+// once nobody holds or waits for it.
+type customerLocks struct {
+	mu    sync.Mutex
+	locks map[string]*customerLock
+}
+
+type customerLock struct {
+	sync.Mutex
+	users int
+}
+
+// lock blocks until the customer's lock is held and returns the function releasing it.
+func (c *customerLocks) lock(clientID string) (unlock func()) {
+	c.mu.Lock()
+	if c.locks == nil {
+		c.locks = make(map[string]*customerLock)
+	}
+	lock, exists := c.locks[clientID]
+	if !exists {
+		lock = &customerLock{}
+		c.locks[clientID] = lock
+	}
+	lock.users++
+	c.mu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if lock.users--; lock.users == 0 {
+			delete(c.locks, clientID)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+	"github.com/javier-tello/receipt-processor-challenge/internal/repositories"
+)
+
+func TestReceiptService_RuleAndReceiptCaps(t *testing.T) {
+	service := NewReceiptService(NewMockReceiptRepository(MockUUIDGenerator{}), WithPointsCaps(PointsCaps{PerRule: 60, PerReceipt: 100}))
+
+	// Uncapped the receipt earns 6 + 75 + 100 + 6 = 187 points
+	breakdown := service.ScoreReceipt(context.Background(), models.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-01",
+		PurchaseTime: "13:01",
+		Total:        "500.00",
+		Items:        []models.Item{{ShortDescription: "Emils Cheese Pizza", Price: "500.00"}},
+	})
+
+	if breakdown.Total != 100 {
+		t.Errorf("Expected 100 points, got %d", breakdown.Total)
+	}
+	expected := []models.PointsLine{
+		{Rule: CapRule, Points: -15, Description: "total_decimals capped at 60 points per rule"},
+		{Rule: CapRule, Points: -40, Description: "item_description capped at 60 points per rule"},
+		{Rule: CapReceipt, Points: -32, Description: "capped at 100 points per receipt"},
+	}
+	caps := breakdown.Lines[len(breakdown.Lines)-len(expected):]
+	for i := range expected {
+		if caps[i] != expected[i] {
+			t.Errorf("Expected line %+v, got %+v", expected[i], caps[i])
+		}
+	}
+}
+
+func TestReceiptService_CapsFixedWhenProcessed(t *testing.T) {
+	repo := NewMockReceiptRepository(MockUUIDGenerator{})
+	receiptID, err := NewReceiptService(repo, WithPointsCaps(PointsCaps{PerRule: 60, PerReceipt: 100})).ProcessReceipt(context.Background(), models.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-01",
+		PurchaseTime: "13:01",
+		Total:        "500.00",
+		Items:        []models.Item{{ShortDescription: "Emils Cheese Pizza", Price: "500.00"}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Lifting the caps leaves the receipt capped as it was when processed
+	service := NewReceiptService(repo)
+	if points, _ := service.CalculateTotalPointsForReceipt(context.Background(), receiptID); points != 100 {
+		t.Errorf("Expected the receipt to keep its 100 points, got %d", points)
+	}
+	breakdown, _, _ := service.GetBreakdownForReceipt(context.Background(), receiptID)
+	if last := breakdown.Lines[len(breakdown.Lines)-1]; last.Rule != CapReceipt || last.Points != -32 {
+		t.Errorf("Expected the receipt cap it was processed under, got %+v", last)
+	}
+}
+
+// recordingObserver keeps the lines of every receipt it is told about
+type recordingObserver struct {
+	observed [][]models.PointsLine
+}
+
+func (o *recordingObserver) ObserveRulePoints(lines []models.PointsLine) {
+	o.observed = append(o.observed, lines)
+}
+
+func TestReceiptService_ObservesCappedPointsOnceStored(t *testing.T) {
+	observer := &recordingObserver{}
+	repo := &failingReceiptRepo{InMemoryReceiptRepo: repositories.NewInMemoryReceiptRepo(nil, nil), fail: true}
+	service := NewReceiptService(repo, WithScoreObserver(observer), WithPointsCaps(PointsCaps{PerReceipt: 100}))
+	receipt := models.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-01",
+		PurchaseTime: "13:01",
+		Total:        "500.00",
+		Items:        []models.Item{{ShortDescription: "Emils Cheese Pizza", Price: "500.00"}},
+	}
+
+	if _, err := service.ProcessReceipt(context.Background(), receipt); err == nil {
+		t.Fatalf("Expected an error storing the receipt")
+	}
+	if len(observer.observed) != 0 {
+		t.Errorf("Expected a receipt that was not stored not to be observed, got %+v", observer.observed)
+	}
+
+	repo.fail = false
+	if _, err := service.ProcessReceipt(context.Background(), receipt); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(observer.observed) != 1 || sumPoints(observer.observed[0]) != 100 {
+		t.Fatalf("Expected the capped points of the stored receipt to be observed, got %+v", observer.observed)
+	}
+	if last := observer.observed[0][len(observer.observed[0])-1]; last.Rule != CapReceipt {
+		t.Errorf("Expected the points withheld by the cap to be observed, got %+v", last)
+	}
+}
+
+func TestReceiptService_CustomerCaps(t *testing.T) {
+	service := NewReceiptService(repositories.NewInMemoryReceiptRepo(nil, nil), WithPointsCaps(PointsCaps{PerCustomerDay: 30, PerCustomerMonth: 100}))
+
+	// Each receipt earns 12 points
+	process := func(clientID string, purchaseTime string) string {
+		t.Helper()
+		receiptID, err := service.ProcessReceipt(context.Background(), models.Receipt{
+			Retailer:     "Target",
+			PurchaseDate: "2022-01-01",
+			PurchaseTime: purchaseTime,
+			Total:        "1.01",
+			Items:        []models.Item{{ShortDescription: "Pepsi", Price: "1.01"}},
+			ClientID:     clientID,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return receiptID
+	}
+
+	tests := []struct {
+		name           string
+		clientID       string
+		purchaseTime   string
+		expectedPoints int
+	}{
+		{"First Receipt", "client-a", "10:01", 12},
+		{"Second Receipt", "client-a", "10:02", 12},
+		{"Reaches Daily Cap", "client-a", "10:03", 6},
+		{"Over Daily Cap", "client-a", "10:04", 0},
+		{"Another Customer", "client-b", "10:05", 12},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			receiptID := process(test.clientID, test.purchaseTime)
+			points, err := service.CalculateTotalPointsForReceipt(context.Background(), receiptID)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if points != test.expectedPoints {
+				t.Errorf("Expected %d points, got %d", test.expectedPoints, points)
+			}
+
+			breakdown, _, err := service.GetBreakdownForReceipt(context.Background(), receiptID)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			last := breakdown.Lines[len(breakdown.Lines)-1]
+			if capped := test.expectedPoints < 12; capped != (last.Rule == CapCustomerDay) {
+				t.Errorf("Expected the daily cap line only when points are withheld, got %+v", last)
+			}
+			if last.Rule == CapCustomerDay && !strings.Contains(last.Description, "capped at 30 points per customer per day") {
+				t.Errorf("Expected the cap to explain itself, got %q", last.Description)
+			}
+		})
+	}
+}
+
+func TestReceiptService_ConcurrentCustomerCaps(t *testing.T) {
+	service := NewReceiptService(repositories.NewInMemoryReceiptRepo(nil, nil), WithPointsCaps(PointsCaps{PerCustomerDay: 30}))
+
+	// Each receipt earns 12 points, so however they interleave the customer earns 30 in all
+	receiptIDs := make(chan string, 10)
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			receiptID, err := service.ProcessReceipt(context.Background(), models.Receipt{
+				Retailer:     "Target",
+				PurchaseDate: "2022-01-01",
+				PurchaseTime: fmt.Sprintf("10:%02d", i),
+				Total:        "1.01",
+				Items:        []models.Item{{ShortDescription: "Pepsi", Price: "1.01"}},
+				ClientID:     "client-a",
+			})
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			receiptIDs <- receiptID
+		}()
+	}
+	wg.Wait()
+	close(receiptIDs)
+
+	total := 0
+	for receiptID := range receiptIDs {
+		points, _ := service.CalculateTotalPointsForReceipt(context.Background(), receiptID)
+		total += points
+	}
+	if total != 30 {
+		t.Errorf("Expected the customer to earn 30 points, got %d", total)
+	}
+	if len(service.customers.locks) != 0 {
+		t.Errorf("Expected the customer's lock to be dropped, got %d locks", len(service.customers.locks))
+	}
+}
+
+func TestCustomerLocks(t *testing.T) {
+	var locks customerLocks
+	unlockA := locks.lock("client-a")
+
+	// Another customer is not held up by the first
+	locked := make(chan func())
+	go func() { locked <- locks.lock("client-b") }()
+	select {
+	case unlockB := <-locked:
+		unlockB()
+	case <-time.After(time.Second):
+		t.Fatalf("Expected another customer's lock not to wait")
+	}
+
+	// The same customer waits for the lock to be released
+	go func() { locked <- locks.lock("client-a") }()
+	select {
+	case <-locked:
+		t.Fatalf("Expected the same customer's lock to wait")
+	case <-time.After(10 * time.Millisecond):
+	}
+	unlockA()
+	(<-locked)()
+
+	if len(locks.locks) != 0 {
+		t.Errorf("Expected unused locks to be dropped, got %d", len(locks.locks))
+	}
+}
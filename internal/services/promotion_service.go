@@ -0,0 +1,270 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/logging"
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+	"github.com/javier-tello/receipt-processor-challenge/internal/repositories"
+)
+
+var ErrPromotionNotFound = errors.New("cannot find promotion")
+
+// PromotionApplier awards promotion points to receipts as they are scored and gives
+// them back to the promotion budgets when the receipt no longer qualifies. Preview shows
+// what would be awarded to a receipt that is not being stored.
+type PromotionApplier interface {
+	Apply(receipt models.Receipt, basePoints int) []models.PromotionAward
+	Preview(receipt models.Receipt, basePoints int) []models.PromotionAward
+	Release(awards []models.PromotionAward)
+}
+
+type PromotionService struct {
+	repo   repositories.PromotionRepository
+	logger *slog.Logger
+}
+
+func NewPromotionService(repo repositories.PromotionRepository, logger *slog.Logger) *PromotionService {
+	return &PromotionService{repo: repo, logger: logging.OrDefault(logger)}
+}
+
+func (s *PromotionService) GetPromotions() []models.Promotion {
+	return s.repo.FindAll()
+}
+
+func (s *PromotionService) GetPromotion(promotionID string) (models.Promotion, error) {
+	promotion, exists := s.repo.FindByID(promotionID)
+	if !exists {
+		return models.Promotion{}, ErrPromotionNotFound
+	}
+
+	return promotion, nil
+}
+
+func (s *PromotionService) CreatePromotion(promotion models.Promotion) models.Promotion {
+	promotion.ID = s.repo.Create(promotion)
+	promotion.AwardedPoints = 0
+
+	s.logger.Info("Promotion created", "promotion_id", promotion.ID, "start_date", promotion.StartDate, "end_date", promotion.EndDate)
+	return promotion
+}
+
+// UpdatePromotion changes a promotion for receipts scored from now on; receipts already scored keep their awards.
+func (s *PromotionService) UpdatePromotion(promotion models.Promotion) (models.Promotion, error) {
+	if !s.repo.Update(promotion) {
+		return models.Promotion{}, ErrPromotionNotFound
+	}
+
+	s.logger.Info("Promotion updated", "promotion_id", promotion.ID)
+	return s.GetPromotion(promotion.ID)
+}
+
+func (s *PromotionService) DeletePromotion(promotionID string) error {
+	if !s.repo.Delete(promotionID) {
+		return ErrPromotionNotFound
+	}
+
+	s.logger.Info("Promotion deleted", "promotion_id", promotionID)
+	return nil
+}
+
+// Apply works out which promotions a receipt qualifies for and reserves their points.
+// Every stackable promotion applies, but only the most generous non-stackable one does.
+// Multipliers are applied to the rule points, never to other promotions.
+func (s *PromotionService) Apply(receipt models.Receipt, basePoints int) []models.PromotionAward {
+	var awards []models.PromotionAward
+	for _, candidate := range s.qualifying(receipt, basePoints) {
+		award := candidate.award
+		granted := s.repo.ReserveBudget(award.PromotionID, award.Points)
+		if granted == 0 {
+			s.logger.Info("Promotion budget exhausted", "promotion_id", award.PromotionID)
+			continue
+		}
+		awards = append(awards, capAward(award, granted))
+	}
+
+	return awards
+}
+
+// Preview works out the awards Apply would make for a receipt now, without reserving any points.
+func (s *PromotionService) Preview(receipt models.Receipt, basePoints int) []models.PromotionAward {
+	var awards []models.PromotionAward
+	for _, candidate := range s.qualifying(receipt, basePoints) {
+		award := candidate.award
+		granted := award.Points
+		if promotion := candidate.promotion; promotion.BudgetPoints > 0 {
+			granted = min(granted, max(promotion.BudgetPoints-promotion.AwardedPoints, 0))
+		}
+		if granted == 0 {
+			continue
+		}
+		awards = append(awards, capAward(award, granted))
+	}
+
+	return awards
+}
+
+// candidateAward is an award a receipt qualifies for, before the promotion's budget is checked.
+type candidateAward struct {
+	promotion models.Promotion
+	award     models.PromotionAward
+}
+
+// qualifying returns every stackable promotion a receipt qualifies for and the most generous
+// non-stackable one.
+func (s *PromotionService) qualifying(receipt models.Receipt, basePoints int) []candidateAward {
+	var stackable []candidateAward
+	var exclusive *candidateAward
+
+	for _, promotion := range s.repo.FindAll() {
+		award, ok := evaluatePromotion(promotion, receipt, basePoints)
+		if !ok {
+			continue
+		}
+
+		if promotion.Stackable {
+			stackable = append(stackable, candidateAward{promotion, award})
+		} else if exclusive == nil || award.Points > exclusive.award.Points {
+			exclusive = &candidateAward{promotion, award}
+		}
+	}
+	if exclusive != nil {
+		stackable = append(stackable, *exclusive)
+	}
+
+	return stackable
+}
+
+// capAward reduces an award to the points its promotion's budget granted.
+func capAward(award models.PromotionAward, granted int) models.PromotionAward {
+	if granted < award.Points {
+		award.Description = fmt.Sprintf("%s, capped from %d points by the remaining budget", award.Description, award.Points)
+		award.Points = granted
+	}
+	return award
+}
+
+// Release gives awarded points back to their promotions' budgets.
+func (s *PromotionService) Release(awards []models.PromotionAward) {
+	for _, award := range awards {
+		s.repo.ReleaseBudget(award.PromotionID, award.Points)
+	}
+}
+
+func evaluatePromotion(promotion models.Promotion, receipt models.Receipt, basePoints int) (models.PromotionAward, bool) {
+	if receipt.PurchaseDate < promotion.StartDate || (promotion.EndDate != "" && receipt.PurchaseDate > promotion.EndDate) {
+		return models.PromotionAward{}, false
+	}
+
+	if len(promotion.RetailerIDs) > 0 {
+		matched := false
+		for _, retailerID := range promotion.RetailerIDs {
+			if retailerID == receipt.RetailerID {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return models.PromotionAward{}, false
+		}
+	}
+
+	var itemIndexes []int
+	if promotion.ItemPattern != "" {
+		pattern := strings.ToLower(promotion.ItemPattern)
+		for i, item := range receipt.Items {
+			if !item.Returned && strings.Contains(strings.ToLower(item.ShortDescription), pattern) {
+				itemIndexes = append(itemIndexes, i)
+			}
+		}
+		if len(itemIndexes) == 0 {
+			return models.PromotionAward{}, false
+		}
+	}
+
+	award := models.PromotionAward{
+		PromotionID: promotion.ID,
+		Name:        promotion.Name,
+		ItemIndexes: itemIndexes,
+		BonusPoints: max(promotion.BonusPoints, 0),
+	}
+	if promotion.Multiplier > 1 {
+		award.Multiplier = promotion.Multiplier
+		award.RulePoints = basePoints
+	}
+	award.Points, award.Description = awardPoints(award)
+	if award.Points <= 0 {
+		return models.PromotionAward{}, false
+	}
+
+	return award, true
+}
+
+// awardPoints works out the points and description of an award from its promotion's multiplier
+// and bonus, before any budget cap.
+func awardPoints(award models.PromotionAward) (int, string) {
+	var parts []string
+	points := 0
+	if award.Multiplier > 1 {
+		points += int(math.Round(float64(award.RulePoints) * (award.Multiplier - 1)))
+		parts = append(parts, fmt.Sprintf("%gx %d rule points", award.Multiplier, award.RulePoints))
+	}
+	if award.BonusPoints > 0 {
+		points += award.BonusPoints
+		parts = append(parts, fmt.Sprintf("%d bonus points", award.BonusPoints))
+	}
+	return points, strings.Join(parts, " + ")
+}
+
+// rescaleAwards recomputes multiplier awards against the rule points a receipt now earns, e.g.
+// once items are returned. An award never grows beyond the points reserved for it.
+func rescaleAwards(awards []models.PromotionAward, rulePoints int) []models.PromotionAward {
+	rescaled := slices.Clone(awards)
+	for i, award := range rescaled {
+		if award.Multiplier <= 1 || award.RulePoints == rulePoints {
+			continue
+		}
+		reserved := award.Points
+		award.RulePoints = rulePoints
+		award.Points, award.Description = awardPoints(award)
+		rescaled[i] = capAward(award, reserved)
+	}
+	return rescaled
+}
+
+// activeAwards drops item promotions once every item that qualified for them has been returned.
+func activeAwards(receipt models.Receipt) []models.PromotionAward {
+	var awards []models.PromotionAward
+	for _, award := range receipt.Promotions {
+		if len(award.ItemIndexes) == 0 {
+			awards = append(awards, award)
+			continue
+		}
+		for _, index := range award.ItemIndexes {
+			if index < len(receipt.Items) && !receipt.Items[index].Returned {
+				awards = append(awards, award)
+				break
+			}
+		}
+	}
+
+	return awards
+}
+
+func promotionLines(receipt models.Receipt) []models.PointsLine {
+	var lines []models.PointsLine
+	for _, award := range activeAwards(receipt) {
+		lines = append(lines, models.PointsLine{
+			Rule:        "promotion:" + award.PromotionID,
+			Points:      award.Points,
+			Description: fmt.Sprintf("%s: %s", award.Name, award.Description),
+		})
+	}
+
+	return lines
+}
@@ -0,0 +1,203 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+	"github.com/javier-tello/receipt-processor-challenge/internal/repositories"
+)
+
+// M&M Corner Market example from the README, worth 109 rule points
+func gatoradeReceipt() models.Receipt {
+	return models.Receipt{
+		Retailer:     "M&M Corner Market",
+		RetailerID:   "m-m-corner-market",
+		PurchaseDate: "2022-03-20",
+		PurchaseTime: "14:33",
+		Total:        "9.00",
+		Items: []models.Item{
+			{ShortDescription: "Gatorade", Price: "2.25"},
+			{ShortDescription: "Gatorade", Price: "2.25"},
+			{ShortDescription: "Gatorade", Price: "2.25"},
+			{ShortDescription: "Gatorade", Price: "2.25"},
+		},
+	}
+}
+
+func TestPromotionService_Apply(t *testing.T) {
+	tests := []struct {
+		name           string
+		promotions     []models.Promotion
+		expectedPoints []int
+	}{
+		{
+			name:           "Retailer Multiplier",
+			promotions:     []models.Promotion{{Name: "2x", StartDate: "2022-03-14", EndDate: "2022-03-20", RetailerIDs: []string{"m-m-corner-market"}, Multiplier: 2}},
+			expectedPoints: []int{109},
+		},
+		{
+			name:           "Other Retailer",
+			promotions:     []models.Promotion{{Name: "2x", StartDate: "2022-03-14", RetailerIDs: []string{"walgreens"}, Multiplier: 2}},
+			expectedPoints: nil,
+		},
+		{
+			name:           "Outside Date Window",
+			promotions:     []models.Promotion{{Name: "2x", StartDate: "2022-03-01", EndDate: "2022-03-19", Multiplier: 2}},
+			expectedPoints: nil,
+		},
+		{
+			name:           "Item Bonus",
+			promotions:     []models.Promotion{{Name: "Gatorade", StartDate: "2022-03-01", ItemPattern: "gatorade", BonusPoints: 100}},
+			expectedPoints: []int{100},
+		},
+		{
+			name: "Only The Best Exclusive Promotion",
+			promotions: []models.Promotion{
+				{Name: "Gatorade", StartDate: "2022-03-01", ItemPattern: "Gatorade", BonusPoints: 100},
+				{Name: "3x", StartDate: "2022-03-01", Multiplier: 3},
+			},
+			expectedPoints: []int{218},
+		},
+		{
+			name: "Stackable Promotions Add Up",
+			promotions: []models.Promotion{
+				{Name: "Gatorade", StartDate: "2022-03-01", ItemPattern: "Gatorade", BonusPoints: 100, Stackable: true},
+				{Name: "Weekend", StartDate: "2022-03-01", BonusPoints: 20, Stackable: true},
+				{Name: "3x", StartDate: "2022-03-01", Multiplier: 3},
+			},
+			expectedPoints: []int{100, 20, 218},
+		},
+		{
+			name:           "Capped By Budget",
+			promotions:     []models.Promotion{{Name: "Gatorade", StartDate: "2022-03-01", ItemPattern: "Gatorade", BonusPoints: 100, BudgetPoints: 40}},
+			expectedPoints: []int{40},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service := NewPromotionService(repositories.NewInMemoryPromotionRepo(nil), nil)
+			for _, promotion := range test.promotions {
+				service.CreatePromotion(promotion)
+			}
+
+			awards := service.Apply(gatoradeReceipt(), 109)
+
+			var points []int
+			for _, award := range awards {
+				points = append(points, award.Points)
+			}
+			if len(points) != len(test.expectedPoints) {
+				t.Fatalf("Expected awards %v, got %v", test.expectedPoints, points)
+			}
+			for _, expected := range test.expectedPoints {
+				found := false
+				for _, actual := range points {
+					found = found || actual == expected
+				}
+				if !found {
+					t.Errorf("Expected awards %v, got %v", test.expectedPoints, points)
+				}
+			}
+		})
+	}
+}
+
+func TestReceiptService_PromotionsAreScoredOnce(t *testing.T) {
+	promotions := NewPromotionService(repositories.NewInMemoryPromotionRepo(nil), nil)
+	promotion := promotions.CreatePromotion(models.Promotion{Name: "Gatorade", StartDate: "2022-03-01", EndDate: "2022-03-31", ItemPattern: "Gatorade", BonusPoints: 100, BudgetPoints: 1000})
+
+	service := NewReceiptService(repositories.NewInMemoryReceiptRepo(nil, nil), WithPromotions(promotions))
+	receiptID, _ := service.ProcessReceipt(context.Background(), gatoradeReceipt())
+
+	// Ending the promotion early does not change the receipt that was already scored
+	promotion.EndDate = "2022-03-02"
+	promotions.UpdatePromotion(promotion)
+
+	breakdown, _, _ := service.GetBreakdownForReceipt(context.Background(), receiptID)
+	if breakdown.Total != 209 {
+		t.Errorf("Expected 209 points including the promotion, got %d: %+v", breakdown.Total, breakdown.Lines)
+	}
+
+	if _, err := service.ReturnItems(context.Background(), receiptID, models.ReturnRequest{Items: []int{0, 1, 2}, Reason: "damaged", Actor: "agent-7"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	breakdown, _, _ = service.GetBreakdownForReceipt(context.Background(), receiptID)
+	if breakdown.Lines[len(breakdown.Lines)-1].Rule != "promotion:"+promotion.ID {
+		t.Errorf("Expected the promotion to remain while a Gatorade is kept, got %+v", breakdown.Lines)
+	}
+
+	if _, err := service.VoidReceipt(context.Background(), receiptID, models.VoidRequest{Reason: "refund", Actor: "agent-7"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	promotion, _ = promotions.GetPromotion(promotion.ID)
+	if promotion.AwardedPoints != 0 {
+		t.Errorf("Expected voiding to return the points to the budget, got %d awarded", promotion.AwardedPoints)
+	}
+}
+
+func TestReceiptService_ReturnsRescaleMultiplierPromotions(t *testing.T) {
+	promotions := NewPromotionService(repositories.NewInMemoryPromotionRepo(nil), nil)
+	promotion := promotions.CreatePromotion(models.Promotion{Name: "2x", StartDate: "2022-03-01", Multiplier: 2, BudgetPoints: 1000})
+
+	service := NewReceiptService(repositories.NewInMemoryReceiptRepo(nil, nil), WithPromotions(promotions))
+	receiptID, _ := service.ProcessReceipt(context.Background(), gatoradeReceipt())
+
+	// The return leaves 54 rule points, so the 2x promotion pays 54 rather than 109
+	adjustment, err := service.ReturnItems(context.Background(), receiptID, models.ReturnRequest{Items: []int{3}, Reason: "damaged", Actor: "agent-7"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if adjustment.Points != -110 {
+		t.Errorf("Expected clawback of -110 points, got %d", adjustment.Points)
+	}
+	breakdown, _, _ := service.GetBreakdownForReceipt(context.Background(), receiptID)
+	if last := breakdown.Lines[len(breakdown.Lines)-1]; last.Points != 54 || !strings.Contains(last.Description, "2x 54 rule points") {
+		t.Errorf("Expected the promotion to pay on the remaining rule points, got %+v", last)
+	}
+	if promotion, _ = promotions.GetPromotion(promotion.ID); promotion.AwardedPoints != 54 {
+		t.Errorf("Expected the points no longer paid to return to the budget, got %d awarded", promotion.AwardedPoints)
+	}
+}
+
+func TestReceiptService_ReleasesPromotionsWhenNotStored(t *testing.T) {
+	promotions := NewPromotionService(repositories.NewInMemoryPromotionRepo(nil), nil)
+	promotion := promotions.CreatePromotion(models.Promotion{Name: "Gatorade", StartDate: "2022-03-01", EndDate: "2022-03-31", ItemPattern: "Gatorade", BonusPoints: 100, BudgetPoints: 1000})
+
+	repo := &failingReceiptRepo{InMemoryReceiptRepo: repositories.NewInMemoryReceiptRepo(nil, nil), fail: true}
+	service := NewReceiptService(repo, WithPromotions(promotions))
+	if _, err := service.ProcessReceipt(context.Background(), gatoradeReceipt()); err == nil {
+		t.Fatalf("Expected an error storing the receipt")
+	}
+
+	promotion, _ = promotions.GetPromotion(promotion.ID)
+	if promotion.AwardedPoints != 0 {
+		t.Errorf("Expected the reserved points to return to the budget, got %d awarded", promotion.AwardedPoints)
+	}
+}
+
+func TestReceiptService_PreviewReceipt(t *testing.T) {
+	promotions := NewPromotionService(repositories.NewInMemoryPromotionRepo(nil), nil)
+	promotion := promotions.CreatePromotion(models.Promotion{Name: "Gatorade", StartDate: "2022-03-01", ItemPattern: "Gatorade", BonusPoints: 100, BudgetPoints: 40})
+
+	repo := repositories.NewInMemoryReceiptRepo(nil, nil)
+	service := NewReceiptService(repo, WithPromotions(promotions))
+
+	breakdown, err := service.PreviewReceipt(context.Background(), gatoradeReceipt())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if breakdown.Total != 149 {
+		t.Errorf("Expected 149 points including the promotion capped by its budget, got %d: %+v", breakdown.Total, breakdown.Lines)
+	}
+
+	promotion, _ = promotions.GetPromotion(promotion.ID)
+	if promotion.AwardedPoints != 0 {
+		t.Errorf("Expected previewing to leave the budget alone, got %d awarded", promotion.AwardedPoints)
+	}
+	if receipts, _ := repo.FindByPurchaseDate(context.Background(), "", ""); len(receipts) != 0 {
+		t.Errorf("Expected nothing to be stored, got %d receipts", len(receipts))
+	}
+}
@@ -1,123 +1,889 @@
 package services
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
-	"log"
+	"fmt"
+	"log/slog"
 	"math"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/calendar"
+	"github.com/javier-tello/receipt-processor-challenge/internal/events"
+	"github.com/javier-tello/receipt-processor-challenge/internal/expr"
+	"github.com/javier-tello/receipt-processor-challenge/internal/fraud"
+	"github.com/javier-tello/receipt-processor-challenge/internal/logging"
 	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+	"github.com/javier-tello/receipt-processor-challenge/internal/reporting"
 	"github.com/javier-tello/receipt-processor-challenge/internal/repositories"
+	"github.com/javier-tello/receipt-processor-challenge/internal/tracing"
+)
+
+const (
+	PointsPerRetailerCharacter = 1
+	PointsForOddDay            = 6
+	PointsForTimeWindow        = 10
+	PointsForRoundDollar       = 50
+	PointsForQuarterMultiple   = 25
+	PointsPerItemPair          = 5
+	DescriptionLengthMultiple  = 3
+	DescriptionPriceMultiplier = 0.2
+	TimeWindowStart            = "14:00"
+	TimeWindowEnd              = "16:00"
 )
 
+// DefaultRules returns the values of the current version of the standard rules.
+func DefaultRules() models.RuleConfig {
+	return models.RuleConfig{
+		PointsPerRetailerCharacter: PointsPerRetailerCharacter,
+		PointsForRoundDollar:       PointsForRoundDollar,
+		PointsForQuarterMultiple:   PointsForQuarterMultiple,
+		PointsPerItemPair:          PointsPerItemPair,
+		DescriptionLengthMultiple:  DescriptionLengthMultiple,
+		DescriptionPriceMultiplier: DescriptionPriceMultiplier,
+		PointsForOddDay:            PointsForOddDay,
+		PointsForTimeWindow:        PointsForTimeWindow,
+		TimeWindowStart:            TimeWindowStart,
+		TimeWindowEnd:              TimeWindowEnd,
+	}
+}
+
+// Names of the scoring rules as they appear in a points breakdown
 const (
-	PointsForOddDay          = 6
-	PointsForTimeWindow      = 10
-	PointsForRoundDollar     = 50
-	PointsForQuarterMultiple = 25
-	PointsPerItemPair        = 5
+	RuleRetailerName    = "retailer_name"
+	RuleTotalDecimals   = "total_decimals"
+	RuleItemPairs       = "item_pairs"
+	RuleItemDescription = "item_description"
+	RuleDayOfPurchase   = "day_of_purchase"
+	RuleTimeOfPurchase  = "time_of_purchase"
+)
+
+// maxConflictRetries is how many times a change to a receipt is redone after losing a race with
+// another request changing the same receipt
+const maxConflictRetries = 5
+
+var (
+	ErrReceiptNotFound = repositories.ErrReceiptNotFound
+	ErrReceiptConflict = repositories.ErrReceiptConflict
+	ErrReceiptVoided   = errors.New("receipt has already been voided")
+	ErrInvalidReturn   = errors.New("invalid item return")
+	ErrNotAssessed     = errors.New("receipt has no fraud assessment")
 )
 
 type ReceiptService struct {
-	repo repositories.ReceiptRepository
+	repo         repositories.ReceiptRepository
+	reviewPolicy ReviewPolicy
+	fraudEngine  *fraud.Engine
+	retailers    RetailerResolver
+	promotions   PromotionApplier
+	observer     ScoreObserver
+	notifier     Notifier
+	timeZone     string
+	calendar     *calendar.Engine
+	expressions  *expr.Engine
+	caps         PointsCaps
+	customers    customerLocks
+	logger       *slog.Logger
+}
+
+// ScoreObserver is told the points each rule and promotion awarded a stored receipt, followed by
+// any withheld by caps as negative points, once the receipt has been stored.
+type ScoreObserver interface {
+	ObserveRulePoints(lines []models.PointsLine)
+}
+
+// Option configures optional ReceiptService behaviour
+type Option func(*ReceiptService)
+
+// WithReviewPolicy replaces the default policy for routing receipts to the review queue.
+func WithReviewPolicy(policy ReviewPolicy) Option {
+	return func(rs *ReceiptService) {
+		rs.reviewPolicy = policy
+	}
+}
+
+// WithFraudEngine scores every incoming receipt for fraud, holding high risk receipts for review.
+func WithFraudEngine(engine *fraud.Engine) Option {
+	return func(rs *ReceiptService) {
+		rs.fraudEngine = engine
+	}
+}
+
+// WithRetailerResolver normalizes incoming receipts to a canonical retailer from the registry.
+func WithRetailerResolver(resolver RetailerResolver) Option {
+	return func(rs *ReceiptService) {
+		rs.retailers = resolver
+	}
+}
+
+// WithPromotions awards points from active promotions to receipts as they are processed.
+func WithPromotions(applier PromotionApplier) Option {
+	return func(rs *ReceiptService) {
+		rs.promotions = applier
+	}
+}
+
+// WithScoreObserver reports the points awarded by each rule for every processed receipt.
+func WithScoreObserver(observer ScoreObserver) Option {
+	return func(rs *ReceiptService) {
+		rs.observer = observer
+	}
+}
+
+// WithNotifier tells the notifier whenever a receipt is scored, flagged, reviewed, voided or adjusted.
+func WithNotifier(notifier Notifier) Option {
+	return func(rs *ReceiptService) {
+		rs.notifier = notifier
+	}
+}
+
+// WithDefaultTimeZone sets the store time zone of receipts submitted without one, UTC unless set.
+func WithDefaultTimeZone(timeZone string) Option {
+	return func(rs *ReceiptService) {
+		rs.timeZone = timeZone
+	}
+}
+
+// WithCalendar adds the calendar rules of an engine to the standard scoring rules.
+func WithCalendar(engine *calendar.Engine) Option {
+	return func(rs *ReceiptService) {
+		rs.calendar = engine
+	}
+}
+
+// WithExpressions adds the expression rules of an engine to the standard scoring rules.
+func WithExpressions(engine *expr.Engine) Option {
+	return func(rs *ReceiptService) {
+		rs.expressions = engine
+	}
+}
+
+// WithPointsCaps limits the points awarded per rule, per receipt and per customer.
+func WithPointsCaps(caps PointsCaps) Option {
+	return func(rs *ReceiptService) {
+		rs.caps = caps
+	}
+}
+
+// WithLogger replaces slog.Default() as the service's logger.
+func WithLogger(logger *slog.Logger) Option {
+	return func(rs *ReceiptService) {
+		rs.logger = logging.OrDefault(logger)
+	}
+}
+
+func NewReceiptService(repo repositories.ReceiptRepository, opts ...Option) *ReceiptService {
+	rs := &ReceiptService{repo: repo, reviewPolicy: DefaultReviewPolicy(), timeZone: "UTC", logger: slog.Default()}
+	for _, opt := range opts {
+		opt(rs)
+	}
+	return rs
+}
+
+// ProcessReceipt stores a receipt, approving it unless the review policy flags it as suspicious.
+func (rs *ReceiptService) ProcessReceipt(ctx context.Context, receipt models.Receipt) (receiptID string, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "ReceiptService.ProcessReceipt")
+	defer func() { tracing.End(span, err) }()
+
+	receipt.SubmittedAt = time.Now().UTC()
+	receipt = rs.resolveRetailer(receipt)
+	if receipt, err = rs.normalizePurchase(receipt); err != nil {
+		return "", err
+	}
+	receipt.Fingerprint = Fingerprint(receipt)
+	duplicates, err := rs.repo.FindByFingerprint(ctx, receipt.Fingerprint)
+	if err != nil {
+		return "", err
+	}
+	receipt.ReviewReasons = rs.reviewPolicy.Evaluate(receipt, duplicates)
+
+	if rs.fraudEngine != nil {
+		history, err := rs.repo.FindByClientID(ctx, receipt.ClientID)
+		if err != nil {
+			return "", err
+		}
+		assessment := rs.fraudEngine.Assess(receipt, history)
+		receipt.Fraud = &assessment
+		if assessment.Flagged {
+			receipt.ReviewReasons = append(receipt.ReviewReasons, fraud.Explain(assessment))
+		}
+	}
+
+	receipt.Status = models.StatusApproved
+	if len(receipt.ReviewReasons) > 0 {
+		rs.logger.InfoContext(ctx, "Receipt held for review", "reasons", strings.Join(receipt.ReviewReasons, "; "))
+		receipt.Status = models.StatusPending
+	}
+
+	// Rules, promotions and caps are settled once, so later changes to them never affect this receipt
+	receipt.RuleVersion = CurrentRuleVersion
+	caps := rs.receiptCaps()
+	receipt.Caps = &caps
+	receipt = rs.scoreRules(ctx, receipt)
+	if rs.promotions != nil {
+		receipt.Promotions = rs.promotions.Apply(receipt, sumPoints(receipt.RuleLines))
+		// The budget reserved for a receipt that is not stored goes back to its promotions
+		defer func() {
+			if err != nil {
+				rs.releasePromotions(receipt.Promotions)
+			}
+		}()
+	}
+
+	stored, err := rs.storeReceipt(ctx, receipt)
+	if err != nil {
+		return "", err
+	}
+	receipt, receiptID = stored, stored.ID
+	if rs.observer != nil {
+		rs.observer.ObserveRulePoints(rs.applyCaps(receipt, receipt.RuleLines, promotionLines(receipt)))
+	}
+	span.SetAttributes(tracing.ReceiptIDKey.String(receiptID), tracing.ReceiptStatusKey.String(string(receipt.Status)))
+
+	event := models.EventReceiptScored
+	if receipt.Status == models.StatusPending {
+		event = models.EventReceiptFlagged
+	}
+	rs.notify(ctx, event, receipt, nil)
+	return receiptID, nil
+}
+
+// storeReceipt fixes the customer caps of a scored receipt and stores it along with the events
+// recording its points, returning the stored receipt.
+func (rs *ReceiptService) storeReceipt(ctx context.Context, receipt models.Receipt) (models.Receipt, error) {
+	// Receipts from the same customer are stored one at a time while customer caps are enforced,
+	// so that they cannot each spend what remains of a cap
+	if rs.caps.perCustomer() && receipt.ClientID != "" {
+		unlock := rs.customers.lock(receipt.ClientID)
+		defer unlock()
+	}
+	var err error
+	if receipt.Ceilings, err = rs.customerCeilings(ctx, receipt); err != nil {
+		return models.Receipt{}, err
+	}
+
+	points := sumPoints(rs.applyCaps(receipt, receipt.RuleLines, promotionLines(receipt)))
+	receipt.Points = points
+	pending := []pendingEvent{{events.TypeReceiptProcessed, events.ReceiptProcessed{
+		Retailer:      receipt.Retailer,
+		RetailerID:    receipt.RetailerID,
+		PurchaseDate:  receipt.PurchaseDate,
+		PurchaseTime:  receipt.PurchaseTime,
+		TimeZone:      receipt.TimeZone,
+		PurchasedAt:   receipt.PurchasedAt,
+		Total:         receipt.Total,
+		ItemCount:     len(receipt.Items),
+		ClientID:      receipt.ClientID,
+		Status:        receipt.Status,
+		Points:        points,
+		RuleVersion:   receipt.RuleVersion,
+		ReviewReasons: receipt.ReviewReasons,
+	}}}
+	if receipt.Status == models.StatusApproved {
+		receipt.IssuedPoints = points
+		pending = append(pending, pendingEvent{events.TypePointsAwarded, events.PointsAwarded{Points: points}})
+	}
+	outbox, err := buildEvents("", pending...)
+	if err != nil {
+		return models.Receipt{}, err
+	}
+
+	if receipt.ID, err = rs.repo.ProcessReceipt(ctx, receipt, outbox...); err != nil {
+		return models.Receipt{}, err
+	}
+	return receipt, nil
+}
+
+// PreviewReceipt scores a receipt that has not been submitted, including the promotions it
+// would be awarded now. Nothing is stored and no promotion budget is reserved.
+func (rs *ReceiptService) PreviewReceipt(ctx context.Context, receipt models.Receipt) (breakdown models.PointsBreakdown, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "ReceiptService.PreviewReceipt")
+	defer func() { tracing.End(span, err) }()
+
+	if err := ctx.Err(); err != nil {
+		return models.PointsBreakdown{}, err
+	}
+
+	receipt = rs.resolveRetailer(receipt)
+	if receipt, err = rs.normalizePurchase(receipt); err != nil {
+		return models.PointsBreakdown{}, err
+	}
+	receipt.Promotions = nil
+	receipt.RuleVersion = CurrentRuleVersion
+	if rs.promotions != nil {
+		receipt.Promotions = rs.promotions.Preview(receipt, sumPoints(rs.calculateRulePoints(ctx, rulesFor(receipt), receipt)))
+	}
+	receipt.SubmittedAt = time.Now().UTC()
+	if receipt.Ceilings, err = rs.customerCeilings(ctx, receipt); err != nil {
+		return models.PointsBreakdown{}, err
+	}
+
+	breakdown = rs.ScoreReceipt(ctx, receipt)
+	span.SetAttributes(tracing.PointsTotalKey.Int(breakdown.Total))
+	return breakdown, nil
+}
+
+// ScoreReceipt itemises the points a receipt earns from each rule and the promotions it was
+// awarded, regardless of whether it has been approved.
+func (rs *ReceiptService) ScoreReceipt(ctx context.Context, receipt models.Receipt) models.PointsBreakdown {
+	return rs.calculateBreakdown(ctx, receipt)
+}
+
+// CalculateTotalPointsForReceipt returns the points awarded for a receipt, which is zero until it is approved.
+func (rs *ReceiptService) CalculateTotalPointsForReceipt(ctx context.Context, receiptID string) (int, error) {
+	points, _, err := rs.GetPointsForReceipt(ctx, receiptID)
+	return points, err
 }
 
-func NewReceiptService(repo repositories.ReceiptRepository) *ReceiptService {
-	return &ReceiptService{repo: repo}
+// GetPointsForReceipt returns the points awarded for a receipt along with its status.
+func (rs *ReceiptService) GetPointsForReceipt(ctx context.Context, receiptID string) (points int, status models.ReceiptStatus, err error) {
+	ctx, span := rs.startSpan(ctx, "GetPointsForReceipt", receiptID)
+	defer func() { tracing.End(span, err) }()
+
+	rs.logger.DebugContext(ctx, "Retrieving receipt", "receipt_id", receiptID)
+	receipt, err := rs.repo.FindByID(ctx, receiptID)
+	if err != nil {
+		return -1, "", err
+	}
+
+	rs.logger.DebugContext(ctx, "Calculating points for receipt", "receipt_id", receiptID)
+	return rs.calculatePoints(ctx, receipt), receipt.Status, nil
 }
 
-func (rs *ReceiptService) ProcessReceipt(receipt models.Receipt) string {
-	return rs.repo.ProcessReceipt(receipt)
+// AwardedPoints returns the points awarded for a stored receipt, which is zero unless it is approved.
+func (rs *ReceiptService) AwardedPoints(ctx context.Context, receipt models.Receipt) int {
+	return rs.calculatePoints(ctx, receipt)
 }
 
-func (rs *ReceiptService) CalculateTotalPointsForReceipt(receiptID string) (int, error) {
-	log.Println("Retreiving receipt")
-	receipt, exists := rs.repo.FindByID(receiptID)
-	if !exists {
-		return -1, errors.New("cannot find receipt")
+// GetBreakdownForReceipt itemises the points for a receipt along with its status.
+// The breakdown is shown even while points are withheld.
+func (rs *ReceiptService) GetBreakdownForReceipt(ctx context.Context, receiptID string) (breakdown models.PointsBreakdown, status models.ReceiptStatus, err error) {
+	ctx, span := rs.startSpan(ctx, "GetBreakdownForReceipt", receiptID)
+	defer func() { tracing.End(span, err) }()
+
+	receipt, err := rs.repo.FindByID(ctx, receiptID)
+	if err != nil {
+		return models.PointsBreakdown{}, "", err
 	}
-	log.Println("Receipt successfully retreived")
 
-	log.Println("Calculating points for receipt")
-	points := calculatePointsForDayOfPurchase(receipt.PurchaseDate) +
-		calculatePointsForItemDescription(receipt.Items) +
-		calculatePointsForItemPairs(receipt.Items) +
-		calculatePointsForRetailerName(receipt.Retailer) +
-		calculatePointsForTimeOfPurchase(receipt.PurchaseTime) +
-		calculatePointsForTotalDecimals(receipt.Total)
+	return rs.ScoreReceipt(ctx, receipt), receipt.Status, nil
+}
+
+// GetFraudAssessment returns the risk score computed for a receipt when it was submitted.
+func (rs *ReceiptService) GetFraudAssessment(ctx context.Context, receiptID string) (assessment models.FraudAssessment, err error) {
+	ctx, span := rs.startSpan(ctx, "GetFraudAssessment", receiptID)
+	defer func() { tracing.End(span, err) }()
+
+	receipt, err := rs.repo.FindByID(ctx, receiptID)
+	if err != nil {
+		return models.FraudAssessment{}, err
+	}
+	if receipt.Fraud == nil {
+		return models.FraudAssessment{}, ErrNotAssessed
+	}
 
-	return points, nil
+	return *receipt.Fraud, nil
 }
 
-func calculatePointsForRetailerName(retailerName string) int {
+// VoidReceipt marks a receipt as voided and claws back every point it was awarded.
+func (rs *ReceiptService) VoidReceipt(ctx context.Context, receiptID string, request models.VoidRequest) (adjustment models.PointsAdjustment, err error) {
+	ctx, span := rs.startSpan(ctx, "VoidReceipt", receiptID)
+	defer func() { tracing.End(span, err) }()
+
+	var receipt models.Receipt
+	var awards []models.PromotionAward
+	err = retryOnConflict(ctx, func() error {
+		receipt, err = rs.repo.FindByID(ctx, receiptID)
+		if err != nil {
+			return err
+		}
+		if receipt.Status == models.StatusVoided {
+			return ErrReceiptVoided
+		}
+
+		pointsBefore := rs.calculatePoints(ctx, receipt)
+		awards = activeAwards(receipt)
+		receipt.Status = models.StatusVoided
+		adjustment, err = rs.adjust(ctx, receiptID, receipt, -pointsBefore, request.Reason, request.Actor, pendingEvent{events.TypeReceiptVoided, events.ReceiptVoided{Reason: request.Reason, Actor: request.Actor}})
+		return err
+	})
+	if err != nil {
+		return models.PointsAdjustment{}, err
+	}
+	rs.releasePromotions(awards)
+
+	rs.logger.InfoContext(ctx, "Receipt voided", "receipt_id", receiptID, "actor", request.Actor, "clawback", -adjustment.Points)
+	rs.notify(ctx, models.EventReceiptVoided, receipt, &adjustment)
+	return adjustment, nil
+}
+
+// ReturnItems marks items on a receipt as returned, re-scores the remaining items under the rules
+// the receipt was scored with and recomputes its multiplier promotions against the rule points
+// that remain, and records the difference as an adjustment. Returning every remaining item voids
+// the receipt.
+func (rs *ReceiptService) ReturnItems(ctx context.Context, receiptID string, request models.ReturnRequest) (adjustment models.PointsAdjustment, err error) {
+	ctx, span := rs.startSpan(ctx, "ReturnItems", receiptID)
+	defer func() { tracing.End(span, err) }()
+
+	var receipt models.Receipt
+	var awardsBefore []models.PromotionAward
+	err = retryOnConflict(ctx, func() error {
+		receipt, err = rs.repo.FindByID(ctx, receiptID)
+		if err != nil {
+			return err
+		}
+		if receipt.Status == models.StatusVoided {
+			return ErrReceiptVoided
+		}
+
+		items := make([]models.Item, len(receipt.Items))
+		copy(items, receipt.Items)
+		for _, index := range request.Items {
+			if index < 0 || index >= len(items) {
+				return fmt.Errorf("%w: no item at index %d", ErrInvalidReturn, index)
+			}
+			if items[index].Returned {
+				return fmt.Errorf("%w: item at index %d has already been returned", ErrInvalidReturn, index)
+			}
+			items[index].Returned = true
+		}
+
+		pointsBefore := rs.calculatePoints(ctx, receipt)
+		awardsBefore = activeAwards(receipt)
+		receipt.Items = items
+		receipt = rs.rescoreItems(ctx, receipt)
+		receipt.Promotions = rescaleAwards(receipt.Promotions, sumPoints(receipt.RuleLines))
+		receipt.Points = rs.calculateBreakdown(ctx, receipt).Total
+		var pending []pendingEvent
+		if len(remainingItems(receipt.Items)) == 0 {
+			receipt.Status = models.StatusVoided
+			pending = append(pending, pendingEvent{events.TypeReceiptVoided, events.ReceiptVoided{Reason: request.Reason, Actor: request.Actor}})
+		}
+		pointsAfter := rs.calculatePoints(ctx, receipt)
+
+		adjustment, err = rs.adjust(ctx, receiptID, receipt, pointsAfter-pointsBefore, request.Reason, request.Actor, pending...)
+		return err
+	})
+	if err != nil {
+		return models.PointsAdjustment{}, err
+	}
+	if receipt.Status == models.StatusVoided {
+		rs.releasePromotions(awardsBefore)
+	} else {
+		rs.releasePromotions(releasedAwards(awardsBefore, activeAwards(receipt)))
+	}
+
+	rs.logger.InfoContext(ctx, "Receipt items returned", "receipt_id", receiptID, "items", len(request.Items), "actor", request.Actor, "points", adjustment.Points)
+	event := models.EventReceiptAdjusted
+	if receipt.Status == models.StatusVoided {
+		event = models.EventReceiptVoided
+	}
+	rs.notify(ctx, event, receipt, &adjustment)
+	return adjustment, nil
+}
+
+// GetAdjustmentsForReceipt returns the clawbacks recorded against a receipt.
+func (rs *ReceiptService) GetAdjustmentsForReceipt(ctx context.Context, receiptID string) (adjustments []models.PointsAdjustment, err error) {
+	ctx, span := rs.startSpan(ctx, "GetAdjustmentsForReceipt", receiptID)
+	defer func() { tracing.End(span, err) }()
+
+	if _, err := rs.repo.FindByID(ctx, receiptID); err != nil {
+		return nil, err
+	}
+
+	return rs.repo.FindAdjustmentsByReceiptID(ctx, receiptID)
+}
+
+// resolveRetailer normalizes a receipt to its canonical retailer from the registry, if any.
+func (rs *ReceiptService) resolveRetailer(receipt models.Receipt) models.Receipt {
+	if rs.retailers != nil {
+		if retailer, ok := rs.retailers.Resolve(receipt.Retailer); ok {
+			receipt.RetailerID = retailer.ID
+			receipt.RetailerName = retailer.DisplayName
+		}
+	}
+	return receipt
+}
+
+// normalizePurchase records the store's time zone on a receipt, the default if it was submitted
+// without one, and the instant of the purchase.
+func (rs *ReceiptService) normalizePurchase(receipt models.Receipt) (models.Receipt, error) {
+	if receipt.TimeZone == "" {
+		receipt.TimeZone = rs.timeZone
+	}
+	location, err := models.LoadTimeZone(receipt.TimeZone)
+	if err != nil {
+		return models.Receipt{}, err
+	}
+	receipt.PurchasedAt, err = models.PurchaseInstant(receipt.PurchaseDate, receipt.PurchaseTime, location)
+	if err != nil {
+		return models.Receipt{}, fmt.Errorf("reading purchase date and time: %w", err)
+	}
+	receipt.PurchasedAt = receipt.PurchasedAt.UTC()
+	return receipt, nil
+}
+
+// startSpan starts a span for a service method acting on a single receipt.
+func (rs *ReceiptService) startSpan(ctx context.Context, method string, receiptID string) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, "ReceiptService."+method, trace.WithAttributes(tracing.ReceiptIDKey.String(receiptID)))
+}
+
+// pendingEvent is an event to be built for the outbox.
+type pendingEvent struct {
+	eventType events.Type
+	data      any
+}
+
+// buildEvents builds the outbox events written along with a change to a receipt.
+func buildEvents(receiptID string, pending ...pendingEvent) ([]events.Event, error) {
+	outbox := make([]events.Event, 0, len(pending))
+	for _, p := range pending {
+		event, err := events.New(p.eventType, receiptID, p.data)
+		if err != nil {
+			return nil, fmt.Errorf("building %s event: %w", p.eventType, err)
+		}
+		outbox = append(outbox, event)
+	}
+	return outbox, nil
+}
+
+// notify tells the notifier, if any, about a receipt after a change has been stored.
+func (rs *ReceiptService) notify(ctx context.Context, event models.WebhookEvent, receipt models.Receipt, adjustment *models.PointsAdjustment) {
+	if rs.notifier == nil {
+		return
+	}
+
+	rs.notifier.Notify(ctx, models.ReceiptNotification{
+		Event:      event,
+		OccurredAt: time.Now().UTC(),
+		ReceiptID:  receipt.ID,
+		Status:     receipt.Status,
+		Retailer:   canonicalRetailerName(receipt),
+		Total:      receipt.Total,
+		Points:     rs.calculatePoints(ctx, receipt),
+		Reasons:    receipt.ReviewReasons,
+		Adjustment: adjustment,
+	})
+}
+
+func (rs *ReceiptService) releasePromotions(awards []models.PromotionAward) {
+	if rs.promotions != nil && len(awards) > 0 {
+		rs.promotions.Release(awards)
+	}
+}
+
+// releasedAwards returns the points of each award that were given up between before and after,
+// whether the award was dropped or reduced.
+func releasedAwards(before []models.PromotionAward, after []models.PromotionAward) []models.PromotionAward {
+	kept := make(map[string]int, len(after))
+	for _, award := range after {
+		kept[award.PromotionID] = award.Points
+	}
+
+	var released []models.PromotionAward
+	for _, award := range before {
+		if points := award.Points - kept[award.PromotionID]; points > 0 {
+			award.Points = points
+			released = append(released, award)
+		}
+	}
+
+	return released
+}
+
+// adjust stores a changed receipt together with an adjustment of its points, and the events
+// recording both, in one write. It fails with repositories.ErrReceiptConflict if the receipt
+// changed after it was read.
+func (rs *ReceiptService) adjust(ctx context.Context, receiptID string, receipt models.Receipt, points int, reason string, actor string, pending ...pendingEvent) (models.PointsAdjustment, error) {
+	adjustment := models.PointsAdjustment{
+		ReceiptID: receiptID,
+		Points:    points,
+		Reason:    reason,
+		Actor:     actor,
+		CreatedAt: time.Now().UTC(),
+	}
+	pending = append(pending, pendingEvent{events.TypePointsAdjusted, events.PointsAdjusted{Points: points, Reason: reason, Actor: actor}})
+	outbox, err := buildEvents(receiptID, pending...)
+	if err != nil {
+		return models.PointsAdjustment{}, err
+	}
+	adjustmentID, err := rs.repo.AdjustReceipt(ctx, receiptID, receipt, adjustment, outbox...)
+	if err != nil {
+		return models.PointsAdjustment{}, err
+	}
+	adjustment.ID = adjustmentID
+
+	return adjustment, nil
+}
+
+// retryOnConflict redoes a read-modify-write of a receipt whenever another request updated the
+// receipt between the read and the write, up to maxConflictRetries times.
+func retryOnConflict(ctx context.Context, change func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := change()
+		if !errors.Is(err, ErrReceiptConflict) || attempt == maxConflictRetries || ctx.Err() != nil {
+			return err
+		}
+	}
+}
+
+// calculatePoints returns the points awarded for a receipt. Only approved receipts are awarded points.
+func (rs *ReceiptService) calculatePoints(ctx context.Context, receipt models.Receipt) int {
+	if receipt.Status != models.StatusApproved {
+		return 0
+	}
+
+	return rs.calculateBreakdown(ctx, receipt).Total
+}
+
+// calculateBreakdown itemises the points a receipt earns from each rule under its rule version and
+// from each promotion, and those withheld by caps, regardless of whether it has been approved.
+func (rs *ReceiptService) calculateBreakdown(ctx context.Context, receipt models.Receipt) models.PointsBreakdown {
+	breakdown := models.PointsBreakdown{Lines: []models.PointsLine{}}
+	for _, line := range rs.applyCaps(receipt, rs.ruleLines(ctx, receipt), promotionLines(receipt)) {
+		if line.Points == 0 {
+			continue
+		}
+		breakdown.Lines = append(breakdown.Lines, line)
+		breakdown.Total += line.Points
+	}
+
+	return breakdown
+}
+
+// scoreRules fixes the points a receipt earns from each rule under its rule version and the
+// calendar and expression rules in force, recording which those were.
+func (rs *ReceiptService) scoreRules(ctx context.Context, receipt models.Receipt) models.Receipt {
+	receipt.RuleLines = rs.calculateRulePoints(ctx, rulesFor(receipt), receipt)
+	receipt.RulesDigest = rs.RulesDigest()
+	return receipt
+}
+
+// rescoreItems re-scores the base rules of a receipt's rule version once its items change, keeping
+// the calendar and expression lines it was scored with so that edits to those rules since do not
+// change its points. Receipts stored before scores were fixed are scored under the rules now.
+func (rs *ReceiptService) rescoreItems(ctx context.Context, receipt models.Receipt) models.Receipt {
+	if receipt.RuleLines == nil {
+		return rs.scoreRules(ctx, receipt)
+	}
+	receipt.RuleLines = rs.rescoreRules(ctx, rulesFor(receipt), receipt)
+	return receipt
+}
+
+// rescoreRules scores a receipt's base rules under the given configuration, keeping the
+// calendar and expression lines it was awarded.
+func (rs *ReceiptService) rescoreRules(ctx context.Context, rules models.RuleConfig, receipt models.Receipt) []models.PointsLine {
+	base := baseRuleLines(rs.logger, rules, receipt)
+	frozen := rs.ruleLines(ctx, receipt)
+	return append(base, frozen[len(base):]...)
+}
+
+// RulesDigest identifies the calendar and expression rules in force, and is empty without any.
+// Receipts record the digest of the rules they were scored under, so a backfill can find the
+// receipts scored under rules that have since been edited.
+func (rs *ReceiptService) RulesDigest() string {
+	calendarDigest, expressionDigest := rs.calendar.Digest(), rs.expressions.Digest()
+	if calendarDigest == "" && expressionDigest == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(calendarDigest + ":" + expressionDigest))
+	return hex.EncodeToString(sum[:8])
+}
+
+// ruleLines returns the points a receipt was scored with. Receipts stored before scores were
+// fixed, and receipts not yet submitted, are scored under the rules as they are now.
+func (rs *ReceiptService) ruleLines(ctx context.Context, receipt models.Receipt) []models.PointsLine {
+	if receipt.RuleLines != nil {
+		return receipt.RuleLines
+	}
+	return rs.calculateRulePoints(ctx, rulesFor(receipt), receipt)
+}
+
+// calculateRulePoints scores the items still on a receipt against a total reduced by any returns,
+// followed by any calendar rules matching the store's local purchase date and time and any
+// expression rules that hold for the receipt.
+// Each rule logs its reasoning at debug level and its points are recorded on a scoring span.
+func (rs *ReceiptService) calculateRulePoints(ctx context.Context, rules models.RuleConfig, receipt models.Receipt) []models.PointsLine {
+	_, span := tracing.Tracer().Start(ctx, "ReceiptService.scoreRules", trace.WithAttributes(tracing.ReceiptIDKey.String(receipt.ID)))
+	defer span.End()
+
+	logger := rs.logger
+	items := remainingItems(receipt.Items)
+	total := remainingTotal(receipt.Total, receipt.Items)
+	purchaseDate, purchaseTime := receipt.LocalPurchase()
+
+	lines := baseRuleLines(logger, rules, receipt)
+	lines = append(lines, rs.calendar.Evaluate(purchaseDate, purchaseTime, sumPoints(lines))...)
+	custom, err := rs.expressions.Evaluate(expr.Input{Retailer: canonicalRetailerName(receipt), PurchaseDate: purchaseDate, PurchaseTime: purchaseTime, Total: total, Items: items})
+	if err != nil {
+		// A failing rule awards nothing rather than failing the receipt
+		logger.WarnContext(ctx, "Expression rules failed to evaluate", "receipt_id", receipt.ID, "error", err)
+	}
+	lines = append(lines, custom...)
+
+	for _, line := range lines {
+		span.SetAttributes(attribute.Int("receipt.points.rule."+line.Rule, line.Points))
+	}
+	span.SetAttributes(tracing.PointsTotalKey.Int(sumPoints(lines)))
+	return lines
+}
+
+// baseRuleLines scores the items still on a receipt against a total reduced by any returns under
+// the rules of a rule version, leaving out calendar and expression rules.
+func baseRuleLines(logger *slog.Logger, rules models.RuleConfig, receipt models.Receipt) []models.PointsLine {
+	items := remainingItems(receipt.Items)
+	total := remainingTotal(receipt.Total, receipt.Items)
+	purchaseDate, purchaseTime := receipt.LocalPurchase()
+
+	return []models.PointsLine{
+		{Rule: RuleRetailerName, Points: calculatePointsForRetailerName(logger, rules, canonicalRetailerName(receipt)), Description: retailerNameDescription(rules)},
+		{Rule: RuleTotalDecimals, Points: calculatePointsForTotalDecimals(logger, rules, total), Description: fmt.Sprintf("%d points for a round dollar total, %d points for a multiple of 0.25", rules.PointsForRoundDollar, rules.PointsForQuarterMultiple)},
+		{Rule: RuleItemPairs, Points: calculatePointsForItemPairs(logger, rules, items), Description: fmt.Sprintf("%d points for every two items", rules.PointsPerItemPair)},
+		{Rule: RuleItemDescription, Points: calculatePointsForItemDescription(logger, rules, items), Description: fmt.Sprintf("price * %g rounded up for each description with a trimmed length that is a multiple of %d", rules.DescriptionPriceMultiplier, rules.DescriptionLengthMultiple)},
+		{Rule: RuleDayOfPurchase, Points: calculatePointsForDayOfPurchase(logger, rules, purchaseDate), Description: fmt.Sprintf("%d points if the day in the purchase date is odd", rules.PointsForOddDay)},
+		{Rule: RuleTimeOfPurchase, Points: calculatePointsForTimeOfPurchase(logger, rules, purchaseTime), Description: fmt.Sprintf("%d points if the time of purchase is after %s and before %s", rules.PointsForTimeWindow, rules.TimeWindowStart, rules.TimeWindowEnd)},
+	}
+}
+
+func retailerNameDescription(rules models.RuleConfig) string {
+	if rules.PointsPerRetailerCharacter == 1 {
+		return "one point for every alphanumeric character in the retailer name"
+	}
+	return fmt.Sprintf("%d points for every alphanumeric character in the retailer name", rules.PointsPerRetailerCharacter)
+}
+
+func sumPoints(lines []models.PointsLine) int {
+	points := 0
+	for _, line := range lines {
+		points += line.Points
+	}
+
+	return points
+}
+
+// canonicalRetailerName prefers the registry's display name so that longer spellings of the
+// same merchant do not earn extra points.
+func canonicalRetailerName(receipt models.Receipt) string {
+	if receipt.RetailerName != "" {
+		return receipt.RetailerName
+	}
+	return receipt.Retailer
+}
+
+func remainingItems(items []models.Item) []models.Item {
+	remaining := make([]models.Item, 0, len(items))
+	for _, item := range items {
+		if !item.Returned {
+			remaining = append(remaining, item)
+		}
+	}
+
+	return remaining
+}
+
+// remainingTotal subtracts the price of returned items from the purchase total.
+// Amounts are handled in cents to avoid float drift.
+func remainingTotal(purchaseTotal string, items []models.Item) string {
+	totalCents, ok := reporting.ToCents(purchaseTotal)
+	if !ok {
+		return purchaseTotal
+	}
+
+	for _, item := range items {
+		if !item.Returned {
+			continue
+		}
+		if priceCents, ok := reporting.ToCents(item.Price); ok {
+			totalCents -= priceCents
+		}
+	}
+	if totalCents < 0 {
+		totalCents = 0
+	}
+
+	return fmt.Sprintf("%d.%02d", totalCents/100, totalCents%100)
+}
+
+func calculatePointsForRetailerName(logger *slog.Logger, rules models.RuleConfig, retailerName string) int {
 	re := regexp.MustCompile(`[^a-zA-Z0-9]+`)
 	trimmed_retailer := re.ReplaceAllString(retailerName, "")
+	points := rules.PointsPerRetailerCharacter * len(trimmed_retailer)
 
-	log.Println("\t", len(trimmed_retailer), " points - retailer name (", trimmed_retailer, ") has ", len(trimmed_retailer), " alphanumeric")
+	logger.Debug("retailer name rule", "rule", RuleRetailerName, "points", points, "retailer", trimmed_retailer, "alphanumeric_characters", len(trimmed_retailer))
 
-	return len(trimmed_retailer)
+	return points
 }
 
-func calculatePointsForItemPairs(items []models.Item) int {
-	log.Println("\t", 5*(len(items)/2), " points - ", len(items), " items (2 pairs @ 5 points each)")
+func calculatePointsForItemPairs(logger *slog.Logger, rules models.RuleConfig, items []models.Item) int {
+	logger.Debug("item pairs rule", "rule", RuleItemPairs, "points", rules.PointsPerItemPair*(len(items)/2), "items", len(items), "pairs", len(items)/2)
 
-	return (PointsPerItemPair * (len(items) / 2))
+	return (rules.PointsPerItemPair * (len(items) / 2))
 }
 
-func calculatePointsForItemDescription(items []models.Item) int {
+func calculatePointsForItemDescription(logger *slog.Logger, rules models.RuleConfig, items []models.Item) int {
+	if rules.DescriptionLengthMultiple <= 0 {
+		return 0
+	}
+
 	points := 0
 	for _, value := range items {
 		trimmedDescription := strings.TrimSpace(value.ShortDescription)
-		if len(trimmedDescription)%3 == 0 {
+		if len(trimmedDescription)%rules.DescriptionLengthMultiple == 0 {
 			price, err := strconv.ParseFloat(value.Price, 64)
 			if err != nil {
-				log.Println("Error in converting string to int")
+				logger.Warn("Error in converting item price to a number", "price", value.Price, "error", err)
 			}
-			points += int(math.Ceil(price * 0.2))
-			log.Println("\t", int(math.Ceil(price*0.2)), " Points - \"", trimmedDescription, "\" is ", len(trimmedDescription), " characters (a multiple of 3) item price of ", value.Price, " * 0.2 = ", price*0.2, ", rounded up is ", int(math.Ceil(price*0.2)), " points")
+			points += int(math.Ceil(price * rules.DescriptionPriceMultiplier))
+			logger.Debug("item description rule", "rule", RuleItemDescription, "points", int(math.Ceil(price*rules.DescriptionPriceMultiplier)), "description", trimmedDescription, "length", len(trimmedDescription), "price", value.Price)
 		}
 	}
 
 	return points
 }
 
-func calculatePointsForTotalDecimals(purchaseTotal string) int {
+func calculatePointsForTotalDecimals(logger *slog.Logger, rules models.RuleConfig, purchaseTotal string) int {
 	total, err := strconv.ParseFloat(purchaseTotal, 64)
 	if err != nil {
-		log.Printf("Invalid total: %v", err)
+		logger.Warn("Invalid total", "total", purchaseTotal, "error", err)
 		return 0
 	}
 
 	points := 0
 	if math.Mod(total, 1.0) == 0 {
-		points += PointsForRoundDollar
-		log.Println("\t50 points - total is a round dollar amount")
+		points += rules.PointsForRoundDollar
+		logger.Debug("total is a round dollar amount", "rule", RuleTotalDecimals, "points", rules.PointsForRoundDollar, "total", purchaseTotal)
 	}
 	if math.Mod(total, 0.25) == 0 {
-		points += PointsForQuarterMultiple
-		log.Println("\t25 points - total is a multiple of 0.25")
+		points += rules.PointsForQuarterMultiple
+		logger.Debug("total is a multiple of 0.25", "rule", RuleTotalDecimals, "points", rules.PointsForQuarterMultiple, "total", purchaseTotal)
 	}
 
 	return points
 }
 
-func calculatePointsForDayOfPurchase(purchaseDate string) int {
+func calculatePointsForDayOfPurchase(logger *slog.Logger, rules models.RuleConfig, purchaseDate string) int {
 	day := purchaseDate[8:]
 
 	if day[len(day)-1]%2 == 1 {
-		log.Println("\t6 points - purchase day is odd")
-		return PointsForOddDay
+		logger.Debug("purchase day is odd", "rule", RuleDayOfPurchase, "points", rules.PointsForOddDay, "purchase_date", purchaseDate)
+		return rules.PointsForOddDay
 	}
 
 	return 0
 }
 
-func calculatePointsForTimeOfPurchase(purchaseTime string) int {
-	if purchaseTime > "14:00" && purchaseTime < "18:00" {
-		log.Println("\t10 points - ", purchaseTime, " is between 14:00 and 16:00")
-		return PointsForTimeWindow
+func calculatePointsForTimeOfPurchase(logger *slog.Logger, rules models.RuleConfig, purchaseTime string) int {
+	if purchaseTime > rules.TimeWindowStart && purchaseTime < rules.TimeWindowEnd {
+		logger.Debug("purchase time is within the time window", "rule", RuleTimeOfPurchase, "window_start", rules.TimeWindowStart, "window_end", rules.TimeWindowEnd, "points", rules.PointsForTimeWindow, "purchase_time", purchaseTime)
+		return rules.PointsForTimeWindow
 	}
 
 	return 0
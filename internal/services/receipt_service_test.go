@@ -1,10 +1,21 @@
 package services
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/javier-tello/receipt-processor-challenge/internal/calendar"
+	"github.com/javier-tello/receipt-processor-challenge/internal/events"
+	"github.com/javier-tello/receipt-processor-challenge/internal/expr"
 	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+	"github.com/javier-tello/receipt-processor-challenge/internal/reporting"
+	"github.com/javier-tello/receipt-processor-challenge/internal/repositories"
 )
 
 type MockUUIDGenerator struct{}
@@ -15,22 +26,117 @@ func (m MockUUIDGenerator) New() uuid.UUID {
 
 type MockReceiptRepository struct {
 	receipts    map[string]models.Receipt
+	adjustments map[string][]models.PointsAdjustment
+	outbox      []events.Event
 	idGenerator MockUUIDGenerator
 }
 
 func NewMockReceiptRepository(generator MockUUIDGenerator) *MockReceiptRepository {
-	return &MockReceiptRepository{receipts: make(map[string]models.Receipt), idGenerator: generator}
+	return &MockReceiptRepository{
+		receipts:    make(map[string]models.Receipt),
+		adjustments: make(map[string][]models.PointsAdjustment),
+		idGenerator: generator,
+	}
 }
 
-func (m *MockReceiptRepository) ProcessReceipt(receipt models.Receipt) string {
+func (m *MockReceiptRepository) ProcessReceipt(ctx context.Context, receipt models.Receipt, outbox ...events.Event) (string, error) {
 	receiptID := m.idGenerator.New().String()
+	receipt.ID = receiptID
 	m.receipts[receiptID] = receipt
-	return receiptID
+	for _, event := range outbox {
+		event.ReceiptID = receiptID
+		m.outbox = append(m.outbox, event)
+	}
+	return receiptID, nil
 }
 
-func (m *MockReceiptRepository) FindByID(receiptID string) (models.Receipt, bool) {
+func (m *MockReceiptRepository) FindByID(ctx context.Context, receiptID string) (models.Receipt, error) {
 	receipt, exists := m.receipts[receiptID]
-	return receipt, exists
+	if !exists {
+		return models.Receipt{}, repositories.ErrReceiptNotFound
+	}
+	return receipt, nil
+}
+
+func (m *MockReceiptRepository) UpdateReceipt(ctx context.Context, receiptID string, receipt models.Receipt, outbox ...events.Event) error {
+	if _, exists := m.receipts[receiptID]; !exists {
+		return repositories.ErrReceiptNotFound
+	}
+	m.receipts[receiptID] = receipt
+	m.outbox = append(m.outbox, outbox...)
+	return nil
+}
+
+func (m *MockReceiptRepository) AdjustReceipt(ctx context.Context, receiptID string, receipt models.Receipt, adjustment models.PointsAdjustment, outbox ...events.Event) (string, error) {
+	if _, exists := m.receipts[receiptID]; !exists {
+		return "", repositories.ErrReceiptNotFound
+	}
+	m.receipts[receiptID] = receipt
+	adjustment.ID = m.idGenerator.New().String()
+	adjustment.ReceiptID = receiptID
+	m.adjustments[receiptID] = append(m.adjustments[receiptID], adjustment)
+	m.outbox = append(m.outbox, outbox...)
+	return adjustment.ID, nil
+}
+
+func (m *MockReceiptRepository) FindByStatus(ctx context.Context, status models.ReceiptStatus) ([]models.Receipt, error) {
+	var receipts []models.Receipt
+	for _, receipt := range m.receipts {
+		if receipt.Status == status {
+			receipts = append(receipts, receipt)
+		}
+	}
+	return receipts, nil
+}
+
+func (m *MockReceiptRepository) FindByFingerprint(ctx context.Context, fingerprint string) ([]models.Receipt, error) {
+	var receipts []models.Receipt
+	for _, receipt := range m.receipts {
+		if receipt.Fingerprint == fingerprint {
+			receipts = append(receipts, receipt)
+		}
+	}
+	return receipts, nil
+}
+
+func (m *MockReceiptRepository) FindByClientID(ctx context.Context, clientID string) ([]models.Receipt, error) {
+	var receipts []models.Receipt
+	for _, receipt := range m.receipts {
+		if receipt.ClientID == clientID {
+			receipts = append(receipts, receipt)
+		}
+	}
+	return receipts, nil
+}
+
+func (m *MockReceiptRepository) FindByPurchaseDate(ctx context.Context, from string, to string) ([]models.Receipt, error) {
+	var receipts []models.Receipt
+	for _, receipt := range m.receipts {
+		if (from == "" || receipt.PurchaseDate >= from) && (to == "" || receipt.PurchaseDate <= to) {
+			receipts = append(receipts, receipt)
+		}
+	}
+	return receipts, nil
+}
+
+func (m *MockReceiptRepository) FindCustomerPoints(ctx context.Context, clientID string, submittedAt time.Time) (int, int, error) {
+	day, month := 0, 0
+	for _, receipt := range m.receipts {
+		if receipt.ClientID != clientID || receipt.Status == models.StatusRejected || receipt.Status == models.StatusVoided {
+			continue
+		}
+		if receipt.SubmittedAt.UTC().Format("2006-01") == submittedAt.UTC().Format("2006-01") {
+			month += receipt.Points
+			if receipt.SubmittedAt.UTC().Format("2006-01-02") == submittedAt.UTC().Format("2006-01-02") {
+				day += receipt.Points
+			}
+		}
+	}
+	return day, month, nil
+}
+
+func (m *MockReceiptRepository) FindAdjustmentsByReceiptID(ctx context.Context, receiptID string) ([]models.PointsAdjustment, error) {
+	return m.adjustments[receiptID], nil
 }
 
 func TestReceiptService_PointCalculations(t *testing.T) {
@@ -140,12 +246,12 @@ func TestReceiptService_PointCalculations(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			receiptID, err := service.ProcessReceipt(test.receipt)
+			receiptID, err := service.ProcessReceipt(context.Background(), test.receipt)
 			if err != nil {
 				t.Fatalf("Unexpected error: %v", err)
 			}
 
-			calculatedPoints, err := service.CalculateTotalPointsForReceipt(receiptID)
+			calculatedPoints, err := service.CalculateTotalPointsForReceipt(context.Background(), receiptID)
 			if err != nil {
 				t.Fatalf("Unexpected error: %v", err)
 			}
@@ -164,8 +270,466 @@ func TestReceiptService_MissingReceiptError(t *testing.T) {
 
 	receiptID := "non-existent-id"
 
-	_, err := service.CalculateTotalPointsForReceipt(receiptID)
+	_, err := service.CalculateTotalPointsForReceipt(context.Background(), receiptID)
 	if err == nil {
 		t.Fatalf("Expected error for missing receipt, got nil")
 	}
 }
+
+func TestReceiptService_ReturnItemsAndVoid(t *testing.T) {
+	repo := NewMockReceiptRepository(MockUUIDGenerator{})
+	service := NewReceiptService(repo)
+
+	receiptID, err := service.ProcessReceipt(context.Background(), models.Receipt{
+		Retailer:     "M&M Corner Market",
+		PurchaseDate: "2022-03-20",
+		PurchaseTime: "14:33",
+		Total:        "9.00",
+		Items: []models.Item{
+			{ShortDescription: "Gatorade", Price: "2.25"},
+			{ShortDescription: "Gatorade", Price: "2.25"},
+			{ShortDescription: "Gatorade", Price: "2.25"},
+			{ShortDescription: "Gatorade", Price: "2.25"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	adjustment, err := service.ReturnItems(context.Background(), receiptID, models.ReturnRequest{Items: []int{3}, Reason: "damaged", Actor: "agent-7"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// 109 points before; 3 items totalling 6.75 keep the quarter bonus but lose the round dollar bonus and a pair
+	if adjustment.Points != -55 {
+		t.Errorf("Expected clawback of -55 points, got %d", adjustment.Points)
+	}
+
+	points, _ := service.CalculateTotalPointsForReceipt(context.Background(), receiptID)
+	if points != 54 {
+		t.Errorf("Expected 54 points after return, got %d", points)
+	}
+
+	if _, err := service.ReturnItems(context.Background(), receiptID, models.ReturnRequest{Items: []int{3}, Reason: "damaged", Actor: "agent-7"}); !errors.Is(err, ErrInvalidReturn) {
+		t.Errorf("Expected ErrInvalidReturn for an already returned item, got %v", err)
+	}
+
+	adjustment, err = service.VoidReceipt(context.Background(), receiptID, models.VoidRequest{Reason: "refund", Actor: "agent-7"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if adjustment.Points != -54 {
+		t.Errorf("Expected clawback of -54 points, got %d", adjustment.Points)
+	}
+
+	points, _ = service.CalculateTotalPointsForReceipt(context.Background(), receiptID)
+	if points != 0 {
+		t.Errorf("Expected voided receipt to be worth 0 points, got %d", points)
+	}
+
+	if _, err := service.VoidReceipt(context.Background(), receiptID, models.VoidRequest{Reason: "refund", Actor: "agent-7"}); !errors.Is(err, ErrReceiptVoided) {
+		t.Errorf("Expected ErrReceiptVoided, got %v", err)
+	}
+
+	adjustments, _ := service.GetAdjustmentsForReceipt(context.Background(), receiptID)
+	if len(adjustments) != 2 {
+		t.Errorf("Expected 2 adjustments, got %d", len(adjustments))
+	}
+}
+
+func TestReceiptService_ConcurrentVoid(t *testing.T) {
+	repo := repositories.NewInMemoryReceiptRepo(nil, nil)
+	service := NewReceiptService(repo)
+
+	receiptID, err := service.ProcessReceipt(context.Background(), models.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-02",
+		PurchaseTime: "13:13",
+		Total:        "1.25",
+		Items:        []models.Item{{ShortDescription: "Pepsi - 12-oz", Price: "1.25"}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	const voiders = 10
+	results := make(chan error, voiders)
+	var wg sync.WaitGroup
+	for range voiders {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := service.VoidReceipt(context.Background(), receiptID, models.VoidRequest{Reason: "refund", Actor: "agent-7"})
+			results <- err
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	voided := 0
+	for err := range results {
+		switch {
+		case err == nil:
+			voided++
+		case !errors.Is(err, ErrReceiptVoided) && !errors.Is(err, ErrReceiptConflict):
+			t.Errorf("Unexpected error: %v", err)
+		}
+	}
+	if voided != 1 {
+		t.Errorf("Expected exactly one void to succeed, got %d", voided)
+	}
+
+	adjustments, _ := service.GetAdjustmentsForReceipt(context.Background(), receiptID)
+	if len(adjustments) != 1 {
+		t.Errorf("Expected exactly one adjustment, got %+v", adjustments)
+	}
+}
+
+func TestReceiptService_ConcurrentReturns(t *testing.T) {
+	repo := repositories.NewInMemoryReceiptRepo(nil, nil)
+	service := NewReceiptService(repo)
+
+	receiptID, err := service.ProcessReceipt(context.Background(), models.Receipt{
+		Retailer:     "M&M Corner Market",
+		PurchaseDate: "2022-03-20",
+		PurchaseTime: "14:33",
+		Total:        "9.00",
+		Items: []models.Item{
+			{ShortDescription: "Gatorade", Price: "2.25"},
+			{ShortDescription: "Gatorade", Price: "2.25"},
+			{ShortDescription: "Gatorade", Price: "2.25"},
+			{ShortDescription: "Gatorade", Price: "2.25"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for item := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := service.ReturnItems(context.Background(), receiptID, models.ReturnRequest{Items: []int{item}, Reason: "damaged", Actor: "agent-7"}); err != nil && !errors.Is(err, ErrReceiptConflict) {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Every return that went through is reflected in the receipt, and its adjustments add up
+	receipt, _ := repo.FindByID(context.Background(), receiptID)
+	adjustments, _ := service.GetAdjustmentsForReceipt(context.Background(), receiptID)
+	returned := 0
+	for _, item := range receipt.Items {
+		if item.Returned {
+			returned++
+		}
+	}
+	if returned == 0 || len(adjustments) != returned {
+		t.Errorf("Expected one adjustment per returned item, got %d adjustments for %d items", len(adjustments), returned)
+	}
+	total := 0
+	for _, adjustment := range adjustments {
+		total += adjustment.Points
+	}
+	points, _ := service.CalculateTotalPointsForReceipt(context.Background(), receiptID)
+	if 109+total != points {
+		t.Errorf("Expected adjustments of %d to take 109 points down to %d", total, points)
+	}
+}
+
+func TestReceiptService_PurchaseTimeZone(t *testing.T) {
+	repo := NewMockReceiptRepository(MockUUIDGenerator{})
+	service := NewReceiptService(repo, WithDefaultTimeZone("America/Chicago"))
+
+	tests := []struct {
+		name             string
+		timeZone         string
+		purchaseTime     string
+		expectedTimeZone string
+		expectedInstant  time.Time
+		expectedWindow   int
+	}{
+		{"Default Time Zone", "", "15:30", "America/Chicago", time.Date(2022, 1, 4, 21, 30, 0, 0, time.UTC), PointsForTimeWindow},
+		{"Store Time Zone", "America/Los_Angeles", "15:30", "America/Los_Angeles", time.Date(2022, 1, 4, 23, 30, 0, 0, time.UTC), PointsForTimeWindow},
+		{"UTC Offset", "+05:30", "13:30", "+05:30", time.Date(2022, 1, 4, 8, 0, 0, 0, time.UTC), 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			receiptID, err := service.ProcessReceipt(context.Background(), models.Receipt{
+				Retailer:     "Target",
+				PurchaseDate: "2022-01-04",
+				PurchaseTime: test.purchaseTime,
+				TimeZone:     test.timeZone,
+				Total:        "1.01",
+				Items:        []models.Item{{ShortDescription: "Pepsi", Price: "1.01"}},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			receipt := repo.receipts[receiptID]
+			if receipt.TimeZone != test.expectedTimeZone || !receipt.PurchasedAt.Equal(test.expectedInstant) {
+				t.Errorf("Expected %s at %v, got %s at %v", test.expectedTimeZone, test.expectedInstant, receipt.TimeZone, receipt.PurchasedAt)
+			}
+
+			breakdown, _, _ := service.GetBreakdownForReceipt(context.Background(), receiptID)
+			window := 0
+			for _, line := range breakdown.Lines {
+				if line.Rule == RuleTimeOfPurchase {
+					window = line.Points
+				}
+			}
+			if window != test.expectedWindow {
+				t.Errorf("Expected %d points for the time of purchase in the store's time zone, got %d", test.expectedWindow, window)
+			}
+		})
+	}
+}
+
+func TestReceiptService_PurchaseSkippedByDaylightSaving(t *testing.T) {
+	repo := NewMockReceiptRepository(MockUUIDGenerator{})
+	service := NewReceiptService(repo)
+
+	// Clocks in New York went from 02:00 to 03:00 on 2022-03-13, so 02:30 never happened
+	receiptID, err := service.ProcessReceipt(context.Background(), models.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-03-13",
+		PurchaseTime: "02:30",
+		TimeZone:     "America/New_York",
+		Total:        "1.01",
+		Items:        []models.Item{{ShortDescription: "Pepsi", Price: "1.01"}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	purchaseDate, purchaseTime := repo.receipts[receiptID].LocalPurchase()
+	if purchaseDate != "2022-03-13" || purchaseTime != "03:30" {
+		t.Errorf("Expected the purchase to be moved to 2022-03-13 03:30, got %s %s", purchaseDate, purchaseTime)
+	}
+}
+
+func TestReceiptService_CalendarRules(t *testing.T) {
+	engine, err := calendar.New([]calendar.Rule{
+		{Name: "weekends", Windows: []calendar.Window{{Days: []string{"weekends"}}}, BonusPoints: 20},
+		{Name: "happy-hour", Windows: []calendar.Window{{Days: []string{"friday"}, Start: "17:00", End: "19:00"}}, Multiplier: 2},
+	}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	service := NewReceiptService(NewMockReceiptRepository(MockUUIDGenerator{}), WithCalendar(engine))
+
+	// 18:30 on a Friday in Los Angeles is already Saturday in UTC, so only the happy hour applies
+	breakdown, err := service.PreviewReceipt(context.Background(), models.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-07",
+		PurchaseTime: "18:30",
+		TimeZone:     "America/Los_Angeles",
+		Total:        "1.01",
+		Items:        []models.Item{{ShortDescription: "Pepsi", Price: "1.01"}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if breakdown.Total != 24 {
+		t.Errorf("Expected 24 points, got %d", breakdown.Total)
+	}
+	last := breakdown.Lines[len(breakdown.Lines)-1]
+	if last.Rule != calendar.RulePrefix+"happy-hour" || last.Points != 12 {
+		t.Errorf("Expected the happy hour to double 12 rule points, got %+v", last)
+	}
+}
+
+func TestReceiptService_CalendarRulesFixedWhenProcessed(t *testing.T) {
+	engine, err := calendar.New([]calendar.Rule{{Name: "weekends", Windows: []calendar.Window{{Days: []string{"weekends"}}}, BonusPoints: 20}}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	repo := NewMockReceiptRepository(MockUUIDGenerator{})
+	receiptID, err := NewReceiptService(repo, WithCalendar(engine)).ProcessReceipt(context.Background(), models.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-08",
+		PurchaseTime: "13:01",
+		Total:        "1.01",
+		Items:        []models.Item{{ShortDescription: "Pepsi", Price: "1.01"}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Editing the weekend bonus leaves the points of receipts already processed alone
+	edited, err := calendar.New([]calendar.Rule{{Name: "weekends", Windows: []calendar.Window{{Days: []string{"weekends"}}}, BonusPoints: 50}}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	service := NewReceiptService(repo, WithCalendar(edited))
+
+	if points, _ := service.CalculateTotalPointsForReceipt(context.Background(), receiptID); points != 26 {
+		t.Errorf("Expected the receipt to keep its 26 points, got %d", points)
+	}
+	breakdown, _, _ := service.GetBreakdownForReceipt(context.Background(), receiptID)
+	last := breakdown.Lines[len(breakdown.Lines)-1]
+	if last.Rule != calendar.RulePrefix+"weekends" || last.Points != 20 {
+		t.Errorf("Expected the weekend bonus the receipt was awarded, got %+v", last)
+	}
+}
+
+func TestReceiptService_ReturnsKeepCalendarRules(t *testing.T) {
+	engine, err := calendar.New([]calendar.Rule{{Name: "weekends", Windows: []calendar.Window{{Days: []string{"weekends"}}}, BonusPoints: 20}}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	repo := NewMockReceiptRepository(MockUUIDGenerator{})
+	processed := NewReceiptService(repo, WithCalendar(engine))
+	receiptID, err := processed.ProcessReceipt(context.Background(), gatoradeReceipt())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Raising the weekend bonus before the return leaves the bonus the Sunday purchase earned
+	edited, err := calendar.New([]calendar.Rule{{Name: "weekends", Windows: []calendar.Window{{Days: []string{"weekends"}}}, BonusPoints: 50}}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	service := NewReceiptService(repo, WithCalendar(edited))
+	adjustment, err := service.ReturnItems(context.Background(), receiptID, models.ReturnRequest{Items: []int{3}, Reason: "damaged", Actor: "agent-7"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if adjustment.Points != -55 {
+		t.Errorf("Expected only the returned item's -55 points clawed back, got %d", adjustment.Points)
+	}
+	if points, _ := service.CalculateTotalPointsForReceipt(context.Background(), receiptID); points != 74 {
+		t.Errorf("Expected 54 rule points and the 20 point weekend bonus, got %d", points)
+	}
+	if receipt, _ := repo.FindByID(context.Background(), receiptID); receipt.RulesDigest != processed.RulesDigest() {
+		t.Errorf("Expected the receipt to keep the digest of the rules it was scored with, got %q", receipt.RulesDigest)
+	}
+}
+
+func TestReceiptService_LiabilityFixedWhenIssued(t *testing.T) {
+	engine, err := calendar.New([]calendar.Rule{{Name: "weekends", Windows: []calendar.Window{{Days: []string{"weekends"}}}, BonusPoints: 20}}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	repo := repositories.NewInMemoryReceiptRepo(nil, nil)
+	service := NewReceiptService(repo, WithCalendar(engine), WithPointsCaps(PointsCaps{PerReceipt: 100}))
+	receiptID, err := service.ProcessReceipt(context.Background(), models.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-08",
+		PurchaseTime: "13:01",
+		Total:        "1.01",
+		Items:        []models.Item{{ShortDescription: "Pepsi", Price: "1.01"}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	asOf := time.Now().UTC()
+	before, err := reporting.NewService(repo, service, nil).Liability(context.Background(), asOf)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if before.Total.IssuedPoints != 26 {
+		t.Fatalf("Expected 26 points issued, got %d", before.Total.IssuedPoints)
+	}
+
+	// Editing the weekend bonus and lifting the cap leaves the points already issued alone
+	edited, err := calendar.New([]calendar.Rule{{Name: "weekends", Windows: []calendar.Window{{Days: []string{"weekends"}}}, BonusPoints: 50}}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	service = NewReceiptService(repo, WithCalendar(edited))
+	after, err := reporting.NewService(repo, service, nil).Liability(context.Background(), asOf)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(after, before) {
+		t.Errorf("Expected the report %+v to be unchanged, got %+v", before, after)
+	}
+
+	// Re-scoring under the edited rules is an adjustment to the points issued
+	if _, err := service.RescoreReceipt(context.Background(), receiptID, "backfill-1", models.BackfillRequest{RuleVersion: CurrentRuleVersion, Reason: "weekend bonus raised", Actor: "ops-1"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	rescored, err := reporting.NewService(repo, service, nil).Liability(context.Background(), asOf)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if rescored.Total.IssuedPoints != 26 || rescored.Total.AdjustedPoints != 30 {
+		t.Errorf("Expected 26 points issued and 30 adjusted, got %+v", rescored.Total)
+	}
+}
+
+func TestReceiptService_ExpressionRules(t *testing.T) {
+	engine, err := expr.New([]expr.Rule{
+		{Name: "pepsi", When: `any(items, contains(lower(description), "pepsi"))`, Points: "15"},
+		{Name: "broken", Points: "1 / (itemCount - 1)"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	service := NewReceiptService(NewMockReceiptRepository(MockUUIDGenerator{}), WithExpressions(engine))
+
+	// A rule failing to evaluate awards nothing without failing the receipt
+	breakdown, err := service.PreviewReceipt(context.Background(), models.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-04",
+		PurchaseTime: "13:01",
+		Total:        "1.01",
+		Items:        []models.Item{{ShortDescription: "Pepsi", Price: "1.01"}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if breakdown.Total != 21 {
+		t.Errorf("Expected 21 points, got %d", breakdown.Total)
+	}
+	last := breakdown.Lines[len(breakdown.Lines)-1]
+	if last.Rule != expr.RulePrefix+"pepsi" || last.Points != 15 {
+		t.Errorf("Expected the pepsi rule to award 15 points, got %+v", last)
+	}
+}
+
+func TestReceiptService_WritesEventsToOutbox(t *testing.T) {
+	repo := NewMockReceiptRepository(MockUUIDGenerator{})
+	service := NewReceiptService(repo)
+
+	receiptID, _ := service.ProcessReceipt(context.Background(), models.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-01",
+		PurchaseTime: "13:01",
+		Total:        "35.35",
+		Items: []models.Item{
+			{ShortDescription: "Mountain Dew 12PK", Price: "6.49"},
+			{ShortDescription: "Emils Cheese Pizza", Price: "12.25"},
+		},
+	})
+	service.ReturnItems(context.Background(), receiptID, models.ReturnRequest{Items: []int{1}, Reason: "damaged", Actor: "agent-7"})
+	service.VoidReceipt(context.Background(), receiptID, models.VoidRequest{Reason: "refund", Actor: "agent-7"})
+
+	expected := []events.Type{
+		events.TypeReceiptProcessed,
+		events.TypePointsAwarded,
+		events.TypePointsAdjusted,
+		events.TypeReceiptVoided,
+		events.TypePointsAdjusted,
+	}
+	if len(repo.outbox) != len(expected) {
+		t.Fatalf("Expected %d events, got %d", len(expected), len(repo.outbox))
+	}
+	for i, event := range repo.outbox {
+		if event.Type != expected[i] || event.ReceiptID != receiptID {
+			t.Errorf("Expected event %d to be %s about '%s', got %s about '%s'", i, expected[i], receiptID, event.Type, event.ReceiptID)
+		}
+	}
+
+	var awarded events.PointsAwarded
+	if err := json.Unmarshal(repo.outbox[1].Data, &awarded); err != nil || awarded.Points != 20 {
+		t.Errorf("Expected 20 points awarded, got %+v (%v)", awarded, err)
+	}
+}
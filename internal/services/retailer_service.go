@@ -0,0 +1,141 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/logging"
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+	"github.com/javier-tello/receipt-processor-challenge/internal/repositories"
+)
+
+var (
+	ErrRetailerNotFound = errors.New("cannot find retailer")
+	ErrRetailerConflict = errors.New("retailer conflicts with an existing retailer")
+)
+
+var (
+	storeNumberRegex     = regexp.MustCompile(`(#\s*\d+|\bstore\s+\d+|\bno\.?\s*\d+)`)
+	nonAlphanumericRegex = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// RetailerResolver maps a retailer name printed on a receipt to a canonical retailer.
+type RetailerResolver interface {
+	Resolve(name string) (models.Retailer, bool)
+}
+
+type RetailerService struct {
+	repo   repositories.RetailerRepository
+	logger *slog.Logger
+}
+
+func NewRetailerService(repo repositories.RetailerRepository, logger *slog.Logger) *RetailerService {
+	return &RetailerService{repo: repo, logger: logging.OrDefault(logger)}
+}
+
+// NormalizeRetailerName reduces a retailer name to the form used for matching: lower case,
+// alphanumeric words only and without store numbers, so "TARGET #1234" and "Target" match.
+func NormalizeRetailerName(name string) string {
+	normalized := storeNumberRegex.ReplaceAllString(strings.ToLower(name), " ")
+	normalized = nonAlphanumericRegex.ReplaceAllString(normalized, " ")
+
+	return strings.Join(strings.Fields(normalized), " ")
+}
+
+// Resolve finds the active retailer whose display name or aliases match the given name.
+func (s *RetailerService) Resolve(name string) (models.Retailer, bool) {
+	normalized := NormalizeRetailerName(name)
+	if normalized == "" {
+		return models.Retailer{}, false
+	}
+
+	for _, retailer := range s.repo.FindAll() {
+		if !retailer.Active {
+			continue
+		}
+		for _, candidate := range retailerNames(retailer) {
+			if NormalizeRetailerName(candidate) == normalized {
+				return retailer, true
+			}
+		}
+	}
+
+	return models.Retailer{}, false
+}
+
+func (s *RetailerService) GetRetailers() []models.Retailer {
+	return s.repo.FindAll()
+}
+
+func (s *RetailerService) GetRetailer(retailerID string) (models.Retailer, error) {
+	retailer, exists := s.repo.FindByID(retailerID)
+	if !exists {
+		return models.Retailer{}, ErrRetailerNotFound
+	}
+
+	return retailer, nil
+}
+
+// CreateRetailer registers a retailer, deriving its canonical ID from the display name when none is given.
+func (s *RetailerService) CreateRetailer(retailer models.Retailer) (models.Retailer, error) {
+	if retailer.ID == "" {
+		retailer.ID = strings.ReplaceAll(NormalizeRetailerName(retailer.DisplayName), " ", "-")
+	}
+	if err := s.checkNameConflicts(retailer); err != nil {
+		return models.Retailer{}, err
+	}
+	if !s.repo.Create(retailer) {
+		return models.Retailer{}, fmt.Errorf("%w: id %q is taken", ErrRetailerConflict, retailer.ID)
+	}
+
+	s.logger.Info("Retailer registered", "retailer_id", retailer.ID, "display_name", retailer.DisplayName)
+	return retailer, nil
+}
+
+func (s *RetailerService) UpdateRetailer(retailer models.Retailer) (models.Retailer, error) {
+	if err := s.checkNameConflicts(retailer); err != nil {
+		return models.Retailer{}, err
+	}
+	if !s.repo.Update(retailer) {
+		return models.Retailer{}, ErrRetailerNotFound
+	}
+
+	s.logger.Info("Retailer updated", "retailer_id", retailer.ID)
+	return retailer, nil
+}
+
+func (s *RetailerService) DeleteRetailer(retailerID string) error {
+	if !s.repo.Delete(retailerID) {
+		return ErrRetailerNotFound
+	}
+
+	s.logger.Info("Retailer deleted", "retailer_id", retailerID)
+	return nil
+}
+
+// checkNameConflicts makes sure a name or alias never resolves to more than one retailer.
+func (s *RetailerService) checkNameConflicts(retailer models.Retailer) error {
+	claimed := make(map[string]string)
+	for _, other := range s.repo.FindAll() {
+		if other.ID == retailer.ID {
+			continue
+		}
+		for _, name := range retailerNames(other) {
+			claimed[NormalizeRetailerName(name)] = other.ID
+		}
+	}
+
+	for _, name := range retailerNames(retailer) {
+		if otherID, taken := claimed[NormalizeRetailerName(name)]; taken {
+			return fmt.Errorf("%w: %q already matches retailer %q", ErrRetailerConflict, name, otherID)
+		}
+	}
+	return nil
+}
+
+func retailerNames(retailer models.Retailer) []string {
+	return append([]string{retailer.DisplayName}, retailer.Aliases...)
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+	"github.com/javier-tello/receipt-processor-challenge/internal/repositories"
+)
+
+func TestNormalizeRetailerName(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"Target", "target"},
+		{"TARGET #1234", "target"},
+		{"  Target   Store 0042 ", "target"},
+		{"M&M Corner Market", "m m corner market"},
+		{"7-Eleven", "7 eleven"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if normalized := NormalizeRetailerName(test.name); normalized != test.expected {
+				t.Errorf("NormalizeRetailerName(%q) = %q, expected %q", test.name, normalized, test.expected)
+			}
+		})
+	}
+}
+
+func TestRetailerService_Resolve(t *testing.T) {
+	service := NewRetailerService(repositories.NewInMemoryRetailerRepo(), nil)
+
+	if _, err := service.CreateRetailer(models.Retailer{DisplayName: "Target", Aliases: []string{"Target Store"}, Active: true}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := service.CreateRetailer(models.Retailer{ID: "closed-shop", DisplayName: "Closed Shop", Active: false}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, name := range []string{"Target", "TARGET #1234", "Target Store"} {
+		retailer, ok := service.Resolve(name)
+		if !ok || retailer.ID != "target" {
+			t.Errorf("Expected %q to resolve to 'target', got %+v", name, retailer)
+		}
+	}
+
+	if _, ok := service.Resolve("Closed Shop"); ok {
+		t.Errorf("Expected inactive retailers not to resolve")
+	}
+	if _, ok := service.Resolve("Walgreens"); ok {
+		t.Errorf("Expected unknown retailers not to resolve")
+	}
+
+	if _, err := service.CreateRetailer(models.Retailer{ID: "target-2", DisplayName: "Target Superstore", Aliases: []string{"TARGET"}}); !errors.Is(err, ErrRetailerConflict) {
+		t.Errorf("Expected ErrRetailerConflict for an alias matching another retailer, got %v", err)
+	}
+}
+
+func TestReceiptService_NormalizesRetailer(t *testing.T) {
+	retailers := NewRetailerService(repositories.NewInMemoryRetailerRepo(), nil)
+	retailers.CreateRetailer(models.Retailer{DisplayName: "Target", Active: true})
+
+	service := NewReceiptService(repositories.NewInMemoryReceiptRepo(nil, nil), WithRetailerResolver(retailers))
+
+	receiptID, _ := service.ProcessReceipt(context.Background(), models.Receipt{
+		Retailer:     "TARGET #1234",
+		PurchaseDate: "2022-01-02",
+		PurchaseTime: "13:13",
+		Total:        "1.25",
+		Items:        []models.Item{{ShortDescription: "Pepsi - 12-oz", Price: "1.25"}},
+	})
+
+	// Scored as "Target": 6 for the name and 25 for the quarter multiple
+	points, _ := service.CalculateTotalPointsForReceipt(context.Background(), receiptID)
+	if points != 31 {
+		t.Errorf("Expected the canonical retailer name to be scored, got %d points", points)
+	}
+}
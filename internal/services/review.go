@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/events"
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+	"github.com/javier-tello/receipt-processor-challenge/internal/reporting"
+	"github.com/javier-tello/receipt-processor-challenge/internal/tracing"
+)
+
+var ErrReceiptNotPending = errors.New("receipt is not pending review")
+
+// ReviewPolicy decides which incoming receipts are held for manual review instead of being approved.
+// A zero value for a limit disables that check.
+type ReviewPolicy struct {
+	MaxTotal           float64
+	MaxItems           int
+	FlagDuplicates     bool
+	DuplicateStatuses  []models.ReceiptStatus
+	DuplicateTolerance int
+}
+
+// DefaultReviewPolicy flags receipts over $1000, with more than 50 items, or that look like a resubmission.
+func DefaultReviewPolicy() ReviewPolicy {
+	return ReviewPolicy{
+		MaxTotal:       1000,
+		MaxItems:       50,
+		FlagDuplicates: true,
+		DuplicateStatuses: []models.ReceiptStatus{
+			models.StatusPending,
+			models.StatusApproved,
+		},
+	}
+}
+
+// Evaluate returns the reasons a receipt is suspicious, or nothing if it can be approved right away.
+// existing holds previously stored receipts sharing the receipt's fingerprint.
+func (p ReviewPolicy) Evaluate(receipt models.Receipt, existing []models.Receipt) []string {
+	var reasons []string
+
+	if p.MaxTotal > 0 {
+		if cents, ok := reporting.ToCents(receipt.Total); ok && float64(cents)/100 > p.MaxTotal {
+			reasons = append(reasons, fmt.Sprintf("total %s exceeds %.2f", receipt.Total, p.MaxTotal))
+		}
+	}
+	if p.MaxItems > 0 && len(receipt.Items) > p.MaxItems {
+		reasons = append(reasons, fmt.Sprintf("%d items exceeds %d", len(receipt.Items), p.MaxItems))
+	}
+	if p.FlagDuplicates {
+		duplicates := 0
+		for _, other := range existing {
+			for _, status := range p.DuplicateStatuses {
+				if other.Status == status {
+					duplicates++
+					break
+				}
+			}
+		}
+		if duplicates > p.DuplicateTolerance {
+			reasons = append(reasons, fmt.Sprintf("matches %d previously submitted receipt(s)", duplicates))
+		}
+	}
+
+	return reasons
+}
+
+// Fingerprint identifies receipts that are probably the same purchase submitted more than once.
+// Only item prices are included so that a resubmission with reworded descriptions still matches.
+func Fingerprint(receipt models.Receipt) string {
+	retailer := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, strings.ToLower(canonicalRetailerName(receipt)))
+
+	prices := make([]string, 0, len(receipt.Items))
+	for _, item := range receipt.Items {
+		prices = append(prices, item.Price)
+	}
+	sort.Strings(prices)
+
+	fields := []string{retailer, receipt.PurchaseDate, receipt.PurchaseTime, receipt.Total, strings.Join(prices, ",")}
+	sum := sha256.Sum256([]byte(strings.Join(fields, "|")))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetReviewQueue returns receipts waiting for a review decision, oldest first.
+func (rs *ReceiptService) GetReviewQueue(ctx context.Context) (queue []models.Receipt, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "ReceiptService.GetReviewQueue")
+	defer func() { tracing.End(span, err) }()
+
+	return rs.repo.FindByStatus(ctx, models.StatusPending)
+}
+
+// ApproveReceipt releases the points of a pending receipt.
+func (rs *ReceiptService) ApproveReceipt(ctx context.Context, receiptID string, request models.ReviewRequest) (models.Receipt, error) {
+	return rs.decideReview(ctx, "ApproveReceipt", receiptID, models.StatusApproved, request)
+}
+
+// RejectReceipt closes a pending receipt without awarding points.
+func (rs *ReceiptService) RejectReceipt(ctx context.Context, receiptID string, request models.ReviewRequest) (models.Receipt, error) {
+	return rs.decideReview(ctx, "RejectReceipt", receiptID, models.StatusRejected, request)
+}
+
+func (rs *ReceiptService) decideReview(ctx context.Context, method string, receiptID string, status models.ReceiptStatus, request models.ReviewRequest) (decided models.Receipt, err error) {
+	ctx, span := rs.startSpan(ctx, method, receiptID)
+	defer func() { tracing.End(span, err) }()
+
+	var receipt models.Receipt
+	err = retryOnConflict(ctx, func() error {
+		receipt, err = rs.repo.FindByID(ctx, receiptID)
+		if err != nil {
+			return err
+		}
+		if receipt.Status != models.StatusPending {
+			return fmt.Errorf("%w: receipt is %s", ErrReceiptNotPending, receipt.Status)
+		}
+
+		receipt.Status = status
+		receipt.Review = &models.ReviewDecision{
+			Status:    status,
+			Comment:   request.Comment,
+			Actor:     request.Actor,
+			DecidedAt: time.Now().UTC(),
+		}
+		pending := []pendingEvent{{events.TypeReceiptReviewed, events.ReceiptReviewed{Status: status, Actor: request.Actor, Comment: request.Comment}}}
+		if status == models.StatusApproved {
+			receipt.IssuedPoints = rs.calculatePoints(ctx, receipt)
+			pending = append(pending, pendingEvent{events.TypePointsAwarded, events.PointsAwarded{Points: receipt.IssuedPoints}})
+		}
+		outbox, err := buildEvents(receiptID, pending...)
+		if err != nil {
+			return err
+		}
+		return rs.repo.UpdateReceipt(ctx, receiptID, receipt, outbox...)
+	})
+	if err != nil {
+		return models.Receipt{}, err
+	}
+	if status == models.StatusRejected {
+		rs.releasePromotions(activeAwards(receipt))
+	}
+
+	rs.logger.InfoContext(ctx, "Receipt reviewed", "receipt_id", receiptID, "status", status, "actor", request.Actor)
+	event := models.EventReceiptApproved
+	if status == models.StatusRejected {
+		event = models.EventReceiptRejected
+	}
+	rs.notify(ctx, event, receipt, nil)
+	return receipt, nil
+}
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/fraud"
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+	"github.com/javier-tello/receipt-processor-challenge/internal/repositories"
+)
+
+func TestReviewPolicy_Evaluate(t *testing.T) {
+	policy := ReviewPolicy{MaxTotal: 100, MaxItems: 2, FlagDuplicates: true, DuplicateStatuses: []models.ReceiptStatus{models.StatusApproved}}
+
+	tests := []struct {
+		name            string
+		receipt         models.Receipt
+		existing        []models.Receipt
+		expectedReasons int
+	}{
+		{
+			name:            "Ordinary Receipt",
+			receipt:         models.Receipt{Total: "35.35", Items: make([]models.Item, 2)},
+			expectedReasons: 0,
+		},
+		{
+			name:            "Huge Total",
+			receipt:         models.Receipt{Total: "100.01", Items: make([]models.Item, 1)},
+			expectedReasons: 1,
+		},
+		{
+			name:            "Many Items",
+			receipt:         models.Receipt{Total: "1.00", Items: make([]models.Item, 3)},
+			expectedReasons: 1,
+		},
+		{
+			name:            "Duplicate Of Approved Receipt",
+			receipt:         models.Receipt{Total: "1.00", Items: make([]models.Item, 1)},
+			existing:        []models.Receipt{{Status: models.StatusApproved}},
+			expectedReasons: 1,
+		},
+		{
+			name:            "Duplicate Of Rejected Receipt Is Ignored",
+			receipt:         models.Receipt{Total: "1.00", Items: make([]models.Item, 1)},
+			existing:        []models.Receipt{{Status: models.StatusRejected}},
+			expectedReasons: 0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reasons := policy.Evaluate(test.receipt, test.existing)
+			if len(reasons) != test.expectedReasons {
+				t.Errorf("Expected %d reason(s), got %v", test.expectedReasons, reasons)
+			}
+		})
+	}
+}
+
+func TestFingerprint_IgnoresDescriptionsAndRetailerPunctuation(t *testing.T) {
+	original := models.Receipt{
+		Retailer:     "M&M Corner Market",
+		PurchaseDate: "2022-03-20",
+		PurchaseTime: "14:33",
+		Total:        "4.50",
+		Items:        []models.Item{{ShortDescription: "Gatorade", Price: "2.25"}, {ShortDescription: "Gatorade", Price: "2.25"}},
+	}
+	resubmitted := original
+	resubmitted.Retailer = "MM CORNER MARKET"
+	resubmitted.Items = []models.Item{{ShortDescription: "Gatorade 20oz", Price: "2.25"}, {ShortDescription: "Gatorade", Price: "2.25"}}
+
+	if Fingerprint(original) != Fingerprint(resubmitted) {
+		t.Errorf("Expected resubmitted receipt to share a fingerprint with the original")
+	}
+
+	different := original
+	different.Total = "4.75"
+	if Fingerprint(original) == Fingerprint(different) {
+		t.Errorf("Expected receipts with different totals to have different fingerprints")
+	}
+}
+
+func TestReceiptService_ReviewQueue(t *testing.T) {
+	service := NewReceiptService(repositories.NewInMemoryReceiptRepo(nil, nil), WithReviewPolicy(ReviewPolicy{MaxTotal: 100}))
+
+	receipt := models.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-02",
+		PurchaseTime: "13:13",
+		Total:        "250.00",
+		Items:        []models.Item{{ShortDescription: "Television", Price: "250.00"}},
+	}
+	approvedID, _ := service.ProcessReceipt(context.Background(), receipt)
+	rejectedID, _ := service.ProcessReceipt(context.Background(), receipt)
+
+	queue, _ := service.GetReviewQueue(context.Background())
+	if len(queue) != 2 {
+		t.Fatalf("Expected 2 receipts in the review queue, got %d", len(queue))
+	}
+
+	points, status, _ := service.GetPointsForReceipt(context.Background(), approvedID)
+	if points != 0 || status != models.StatusPending {
+		t.Errorf("Expected points to be withheld while pending, got %d points with status %s", points, status)
+	}
+
+	if _, err := service.ApproveReceipt(context.Background(), approvedID, models.ReviewRequest{Comment: "matches store records", Actor: "reviewer-1"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := service.RejectReceipt(context.Background(), rejectedID, models.ReviewRequest{Comment: "duplicate", Actor: "reviewer-1"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	points, status, _ = service.GetPointsForReceipt(context.Background(), approvedID)
+	if points != 81 || status != models.StatusApproved {
+		t.Errorf("Expected 81 points once approved, got %d points with status %s", points, status)
+	}
+
+	points, status, _ = service.GetPointsForReceipt(context.Background(), rejectedID)
+	if points != 0 || status != models.StatusRejected {
+		t.Errorf("Expected no points once rejected, got %d points with status %s", points, status)
+	}
+
+	if _, err := service.ApproveReceipt(context.Background(), rejectedID, models.ReviewRequest{Comment: "changed my mind", Actor: "reviewer-1"}); !errors.Is(err, ErrReceiptNotPending) {
+		t.Errorf("Expected ErrReceiptNotPending, got %v", err)
+	}
+
+	if queue, _ := service.GetReviewQueue(context.Background()); len(queue) != 0 {
+		t.Errorf("Expected the review queue to be empty")
+	}
+}
+
+func TestReceiptService_FraudEngineHoldsRiskyReceipts(t *testing.T) {
+	engine := fraud.NewEngine(0.5, fraud.DefaultItemSumMismatchSignal(), fraud.DefaultFuturePurchaseSignal())
+	service := NewReceiptService(repositories.NewInMemoryReceiptRepo(nil, nil), WithFraudEngine(engine))
+
+	receiptID, _ := service.ProcessReceipt(context.Background(), models.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-02",
+		PurchaseTime: "13:13",
+		Total:        "100.00",
+		Items:        []models.Item{{ShortDescription: "Pepsi - 12-oz", Price: "1.25"}},
+		ClientID:     "partner-a",
+	})
+
+	_, status, _ := service.GetPointsForReceipt(context.Background(), receiptID)
+	if status != models.StatusPending {
+		t.Errorf("Expected a mismatched total to be held for review, got %s", status)
+	}
+
+	assessment, err := service.GetFraudAssessment(context.Background(), receiptID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !assessment.Flagged || assessment.Score != 0.5 {
+		t.Errorf("Expected a flagged score of 0.5, got %+v", assessment)
+	}
+}
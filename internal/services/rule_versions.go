@@ -0,0 +1,58 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+)
+
+// Versions of the standard rules. A receipt is scored under the version that was current when it
+// was processed, so fixing a rule leaves stored receipts alone until a backfill re-scores them
+// under the new version. The values of a version must never change once receipts use it.
+const (
+	// RuleVersion1 awarded the time of purchase points until 18:00 rather than 16:00
+	RuleVersion1 = "v1"
+	// RuleVersion2 awards the time of purchase points between 14:00 and 16:00
+	RuleVersion2 = "v2"
+
+	CurrentRuleVersion = RuleVersion2
+)
+
+var ErrUnknownRuleVersion = errors.New("unknown rule version")
+
+// RuleVersions lists every version of the standard rules, oldest first.
+func RuleVersions() []string {
+	return []string{RuleVersion1, RuleVersion2}
+}
+
+// RulesForVersion returns the values a version of the standard rules scores receipts with.
+func RulesForVersion(version string) (models.RuleConfig, error) {
+	rules := DefaultRules()
+	switch version {
+	case RuleVersion1:
+		rules.TimeWindowEnd = "18:00"
+	case RuleVersion2:
+	default:
+		return models.RuleConfig{}, fmt.Errorf("%w %q", ErrUnknownRuleVersion, version)
+	}
+	return rules, nil
+}
+
+// ruleVersion is the version of the standard rules a receipt is scored under. Receipts processed
+// before the rules were versioned were scored under the first version.
+func ruleVersion(receipt models.Receipt) string {
+	if receipt.RuleVersion == "" {
+		return RuleVersion1
+	}
+	return receipt.RuleVersion
+}
+
+// rulesFor returns the values of the standard rules a receipt is scored under.
+func rulesFor(receipt models.Receipt) models.RuleConfig {
+	rules, err := RulesForVersion(ruleVersion(receipt))
+	if err != nil {
+		return DefaultRules()
+	}
+	return rules
+}
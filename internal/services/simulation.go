@@ -0,0 +1,169 @@
+package services
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"math/rand/v2"
+	"slices"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+	"github.com/javier-tello/receipt-processor-challenge/internal/reporting"
+	"github.com/javier-tello/receipt-processor-challenge/internal/tracing"
+)
+
+// DefaultTopRetailers is how many retailers a simulation reports unless asked for more or fewer
+const DefaultTopRetailers = 10
+
+// SimulateRules re-scores approved receipts under a candidate rule configuration and compares
+// the points with the rule points each receipt was awarded. The rules the request overrides
+// replace those of each receipt's own rule version, and calendar and expression rules keep
+// the points they awarded, so an empty candidate changes nothing. Nothing is stored.
+// Promotion points were fixed when each receipt was submitted, so only the rules are compared.
+// A sample is drawn at random from the seed, so repeating a simulation with the seed it
+// reported scores the same receipts.
+func (rs *ReceiptService) SimulateRules(ctx context.Context, request models.RuleSimulationRequest) (simulation models.RuleSimulation, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "ReceiptService.SimulateRules")
+	defer func() { tracing.End(span, err) }()
+
+	stored, err := rs.repo.FindByPurchaseDate(ctx, "", "")
+	if err != nil {
+		return models.RuleSimulation{}, err
+	}
+
+	var receipts []models.Receipt
+	for _, receipt := range stored {
+		if receipt.Status == models.StatusApproved {
+			receipts = append(receipts, receipt)
+		}
+	}
+	simulation = models.RuleSimulation{Rules: request.Rules, SampledFrom: len(receipts)}
+
+	if request.SampleSize > 0 && request.SampleSize < len(receipts) {
+		simulation.Seed = request.Seed
+		if simulation.Seed == 0 {
+			simulation.Seed = rand.Uint64()
+		}
+		// Sorting first makes the sample depend only on the seed, not the repository's order
+		slices.SortFunc(receipts, func(a, b models.Receipt) int { return cmp.Compare(a.ID, b.ID) })
+		random := rand.New(rand.NewPCG(simulation.Seed, 0))
+		random.Shuffle(len(receipts), func(i, j int) { receipts[i], receipts[j] = receipts[j], receipts[i] })
+		receipts = receipts[:request.SampleSize]
+	}
+
+	overrides, err := ruleOverrides(request)
+	if err != nil {
+		return models.RuleSimulation{}, err
+	}
+
+	rules := map[string]*models.RuleDelta{}
+	var ruleOrder []string
+	retailers := map[string]*models.RetailerDelta{}
+	var currentPoints, candidatePoints []int
+	for _, receipt := range receipts {
+		if err := ctx.Err(); err != nil {
+			return models.RuleSimulation{}, err
+		}
+
+		// Each receipt is compared with the points it was awarded under its own rule version
+		candidate := rulesFor(receipt)
+		if err := json.Unmarshal(overrides, &candidate); err != nil {
+			return models.RuleSimulation{}, err
+		}
+		before := rs.ruleLines(ctx, receipt)
+		after := rs.rescoreRules(ctx, candidate, receipt)
+		for i, line := range before {
+			rule, ok := rules[line.Rule]
+			if !ok {
+				rule = &models.RuleDelta{Rule: line.Rule}
+				rules[line.Rule] = rule
+				ruleOrder = append(ruleOrder, line.Rule)
+			}
+			rule.CurrentPoints += line.Points
+			rule.CandidatePoints += after[i].Points
+		}
+
+		beforeTotal, afterTotal := sumPoints(before), sumPoints(after)
+		currentPoints = append(currentPoints, beforeTotal)
+		candidatePoints = append(candidatePoints, afterTotal)
+		if beforeTotal != afterTotal {
+			simulation.ChangedReceipts++
+		}
+
+		name := canonicalRetailerName(receipt)
+		retailer, ok := retailers[name]
+		if !ok {
+			retailer = &models.RetailerDelta{Retailer: name}
+			retailers[name] = retailer
+		}
+		retailer.Receipts++
+		retailer.CurrentPoints += beforeTotal
+		retailer.CandidatePoints += afterTotal
+	}
+
+	simulation.Receipts = len(receipts)
+	simulation.Current = reporting.Distribution(currentPoints)
+	simulation.Candidate = reporting.Distribution(candidatePoints)
+	simulation.PointsDelta = simulation.Candidate.Points - simulation.Current.Points
+
+	simulation.RuleDeltas = make([]models.RuleDelta, 0, len(ruleOrder))
+	for _, name := range ruleOrder {
+		rule := rules[name]
+		rule.PointsDelta = rule.CandidatePoints - rule.CurrentPoints
+		simulation.RuleDeltas = append(simulation.RuleDeltas, *rule)
+	}
+
+	simulation.TopRetailers = topRetailers(retailers, request.TopRetailers)
+
+	rs.logger.InfoContext(ctx, "Rules simulated", "receipts", simulation.Receipts, "sampled_from", simulation.SampledFrom, "changed_receipts", simulation.ChangedReceipts, "points_delta", simulation.PointsDelta)
+	return simulation, nil
+}
+
+// ruleOverrides picks the rules a simulation request overrides out of its candidate
+// configuration, ready to be decoded over the rules a receipt was scored under.
+func ruleOverrides(request models.RuleSimulationRequest) ([]byte, error) {
+	data, err := json.Marshal(request.Rules)
+	if err != nil {
+		return nil, err
+	}
+	var candidate map[string]json.RawMessage
+	if err := json.Unmarshal(data, &candidate); err != nil {
+		return nil, err
+	}
+
+	overrides := map[string]json.RawMessage{}
+	for _, name := range request.Overrides {
+		if value, ok := candidate[name]; ok {
+			overrides[name] = value
+		}
+	}
+	return json.Marshal(overrides)
+}
+
+// topRetailers returns the retailers whose points change the most either way, leaving out
+// those that do not change at all.
+func topRetailers(retailers map[string]*models.RetailerDelta, limit int) []models.RetailerDelta {
+	if limit <= 0 {
+		limit = DefaultTopRetailers
+	}
+
+	affected := []models.RetailerDelta{}
+	for _, retailer := range retailers {
+		retailer.PointsDelta = retailer.CandidatePoints - retailer.CurrentPoints
+		if retailer.PointsDelta != 0 {
+			affected = append(affected, *retailer)
+		}
+	}
+	slices.SortFunc(affected, func(a, b models.RetailerDelta) int {
+		return cmp.Or(cmp.Compare(abs(b.PointsDelta), abs(a.PointsDelta)), cmp.Compare(a.Retailer, b.Retailer))
+	})
+
+	return affected[:min(limit, len(affected))]
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
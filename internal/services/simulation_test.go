@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+)
+
+func simulationRepository() *MockReceiptRepository {
+	repo := NewMockReceiptRepository(MockUUIDGenerator{})
+	for _, receipt := range []models.Receipt{
+		// 6 for the name, 75 for a round total and 10 for the time window
+		{ID: "a", Retailer: "Target", PurchaseDate: "2022-01-02", PurchaseTime: "15:00", Total: "9.00", Status: models.StatusApproved},
+		// 6 for the name, 25 for a multiple of 0.25 and 5 for a pair of items
+		{ID: "b", Retailer: "Target", PurchaseDate: "2022-01-02", PurchaseTime: "10:00", Total: "2.50", Status: models.StatusApproved,
+			Items: []models.Item{{ShortDescription: "Pepsi", Price: "1.25"}, {ShortDescription: "Pepsi", Price: "1.25"}}},
+		// 7 for the name and 6 for an odd day
+		{ID: "c", Retailer: "Walmart", PurchaseDate: "2022-01-03", PurchaseTime: "10:00", Total: "1.01", Status: models.StatusApproved},
+		{ID: "d", Retailer: "Walmart", PurchaseDate: "2022-01-03", PurchaseTime: "15:00", Total: "9.00", Status: models.StatusPending},
+	} {
+		repo.receipts[receipt.ID] = receipt
+	}
+	return repo
+}
+
+func TestReceiptService_SimulateRules(t *testing.T) {
+	service := NewReceiptService(simulationRepository())
+
+	rules := DefaultRules()
+	rules.PointsForRoundDollar = 25
+	rules.PointsPerItemPair = 10
+	request := models.RuleSimulationRequest{Rules: rules, Overrides: []string{"pointsForRoundDollar", "pointsPerItemPair"}}
+	simulation, err := service.SimulateRules(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if simulation.Receipts != 3 || simulation.SampledFrom != 3 || simulation.Seed != 0 {
+		t.Errorf("Expected the 3 approved receipts to be scored, got %+v", simulation)
+	}
+	if simulation.Current.Points != 140 || simulation.Candidate.Points != 120 || simulation.PointsDelta != -20 || simulation.ChangedReceipts != 2 {
+		t.Errorf("Unexpected totals: %+v", simulation)
+	}
+	expectedCurrent := models.PointsDistribution{Points: 140, AveragePoints: 46.67, P50Points: 36, P90Points: 91, P99Points: 91}
+	if simulation.Current != expectedCurrent {
+		t.Errorf("Expected current distribution %+v, got %+v", expectedCurrent, simulation.Current)
+	}
+
+	deltas := map[string]int{}
+	for _, rule := range simulation.RuleDeltas {
+		deltas[rule.Rule] = rule.PointsDelta
+	}
+	expectedDeltas := map[string]int{RuleRetailerName: 0, RuleTotalDecimals: -25, RuleItemPairs: 5, RuleItemDescription: 0, RuleDayOfPurchase: 0, RuleTimeOfPurchase: 0}
+	if !reflect.DeepEqual(deltas, expectedDeltas) {
+		t.Errorf("Expected rule deltas %v, got %v", expectedDeltas, deltas)
+	}
+
+	expectedRetailers := []models.RetailerDelta{{Retailer: "Target", Receipts: 2, CurrentPoints: 127, CandidatePoints: 107, PointsDelta: -20}}
+	if !reflect.DeepEqual(simulation.TopRetailers, expectedRetailers) {
+		t.Errorf("Expected only Target to be affected, got %+v", simulation.TopRetailers)
+	}
+}
+
+func TestReceiptService_SimulateRulesEmptyCandidate(t *testing.T) {
+	repo := simulationRepository()
+	service := NewReceiptService(repo)
+
+	// Both earn the time of purchase points only under the time window of their own version
+	repo.receipts["e"] = models.Receipt{ID: "e", Retailer: "Target", PurchaseDate: "2022-01-02", PurchaseTime: "17:00", Total: "9.00", Status: models.StatusApproved, RuleVersion: RuleVersion1}
+	repo.receipts["f"] = service.scoreRules(context.Background(), models.Receipt{ID: "f", Retailer: "Target", PurchaseDate: "2022-01-02", PurchaseTime: "15:00", Total: "9.00", Status: models.StatusApproved, RuleVersion: RuleVersion2})
+
+	simulation, err := service.SimulateRules(context.Background(), models.RuleSimulationRequest{Rules: DefaultRules()})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if simulation.Receipts != 5 || simulation.Current.Points != 322 {
+		t.Errorf("Expected the 5 approved receipts to be scored, got %+v", simulation)
+	}
+	if simulation.PointsDelta != 0 || simulation.ChangedReceipts != 0 || len(simulation.TopRetailers) != 0 {
+		t.Errorf("Expected an empty candidate to change nothing, got %+v", simulation)
+	}
+	for _, rule := range simulation.RuleDeltas {
+		if rule.PointsDelta != 0 {
+			t.Errorf("Expected no change to %s, got %+v", rule.Rule, rule)
+		}
+	}
+}
+
+func TestReceiptService_SimulateRulesSample(t *testing.T) {
+	service := NewReceiptService(simulationRepository())
+
+	request := models.RuleSimulationRequest{Rules: DefaultRules(), SampleSize: 2}
+	first, err := service.SimulateRules(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if first.Receipts != 2 || first.SampledFrom != 3 || first.Seed == 0 {
+		t.Fatalf("Expected a seeded sample of 2 of 3 receipts, got %+v", first)
+	}
+	if first.PointsDelta != 0 || first.ChangedReceipts != 0 || len(first.TopRetailers) != 0 {
+		t.Errorf("Expected the current rules to change nothing, got %+v", first)
+	}
+
+	request.Seed = first.Seed
+	second, err := service.SimulateRules(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if second.Current != first.Current {
+		t.Errorf("Expected the same seed to sample the same receipts, got %+v and %+v", first.Current, second.Current)
+	}
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/logging"
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+	"github.com/javier-tello/receipt-processor-challenge/internal/repositories"
+)
+
+var (
+	ErrSubscriptionNotFound = errors.New("cannot find webhook subscription")
+	ErrDeliveryNotFound     = errors.New("cannot find webhook delivery")
+	ErrDeliveryPending      = errors.New("webhook delivery is still pending")
+)
+
+// Notifier is told whenever a receipt is scored or changes state.
+type Notifier interface {
+	Notify(ctx context.Context, notification models.ReceiptNotification)
+}
+
+// WebhookService manages partner subscriptions and queues a delivery to each subscriber
+// of an event. The deliveries are sent by a webhooks.Worker.
+type WebhookService struct {
+	repo   repositories.WebhookRepository
+	logger *slog.Logger
+}
+
+func NewWebhookService(repo repositories.WebhookRepository, logger *slog.Logger) *WebhookService {
+	return &WebhookService{repo: repo, logger: logging.OrDefault(logger)}
+}
+
+// GetSubscriptions returns every subscription without its secret.
+func (s *WebhookService) GetSubscriptions() []models.WebhookSubscription {
+	subscriptions := s.repo.FindSubscriptions()
+	for i := range subscriptions {
+		subscriptions[i].Secret = ""
+	}
+	return subscriptions
+}
+
+// GetSubscription returns a subscription without its secret.
+func (s *WebhookService) GetSubscription(subscriptionID string) (models.WebhookSubscription, error) {
+	subscription, exists := s.repo.FindSubscription(subscriptionID)
+	if !exists {
+		return models.WebhookSubscription{}, ErrSubscriptionNotFound
+	}
+
+	subscription.Secret = ""
+	return subscription, nil
+}
+
+// CreateSubscription registers a partner endpoint with a newly generated signing secret,
+// which is only ever returned here.
+func (s *WebhookService) CreateSubscription(request models.WebhookSubscriptionRequest) (models.WebhookSubscription, error) {
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return models.WebhookSubscription{}, err
+	}
+
+	subscription := models.WebhookSubscription{
+		URL:       request.URL,
+		Events:    request.Events,
+		Secret:    secret,
+		CreatedAt: time.Now().UTC(),
+	}
+	if len(subscription.Events) == 0 {
+		subscription.Events = slices.Clone(models.WebhookEvents)
+	}
+	subscription.ID = s.repo.CreateSubscription(subscription)
+
+	s.logger.Info("Webhook subscription created", "subscription_id", subscription.ID, "url", subscription.URL)
+	return subscription, nil
+}
+
+// DeleteSubscription stops notifying a subscriber. Deliveries already queued are abandoned by the worker.
+func (s *WebhookService) DeleteSubscription(subscriptionID string) error {
+	if !s.repo.DeleteSubscription(subscriptionID) {
+		return ErrSubscriptionNotFound
+	}
+
+	s.logger.Info("Webhook subscription deleted", "subscription_id", subscriptionID)
+	return nil
+}
+
+// GetDeadLetters returns the deliveries that failed after every retry, oldest first.
+func (s *WebhookService) GetDeadLetters() []models.WebhookDelivery {
+	return s.repo.FindDeliveriesByStatus(models.DeliveryFailed)
+}
+
+// Redeliver queues a delivery to be sent again right away with a fresh set of retries.
+func (s *WebhookService) Redeliver(deliveryID string) (models.WebhookDelivery, error) {
+	delivery, exists := s.repo.FindDelivery(deliveryID)
+	if !exists {
+		return models.WebhookDelivery{}, ErrDeliveryNotFound
+	}
+	if delivery.Status == models.DeliveryPending {
+		return models.WebhookDelivery{}, ErrDeliveryPending
+	}
+	if _, exists := s.repo.FindSubscription(delivery.SubscriptionID); !exists {
+		return models.WebhookDelivery{}, fmt.Errorf("%w: the subscription has been deleted", ErrSubscriptionNotFound)
+	}
+
+	delivery.Status = models.DeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = time.Now().UTC()
+	delivery.DeliveredAt = nil
+	if !s.repo.UpdateDelivery(delivery) {
+		return models.WebhookDelivery{}, ErrDeliveryNotFound
+	}
+
+	s.logger.Info("Webhook delivery queued for redelivery", "delivery_id", deliveryID, "subscription_id", delivery.SubscriptionID)
+	return delivery, nil
+}
+
+// Notify queues a delivery of the notification for every subscriber of its event.
+func (s *WebhookService) Notify(ctx context.Context, notification models.ReceiptNotification) {
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to encode webhook payload", "event", notification.Event, "receipt_id", notification.ReceiptID, "error", err)
+		return
+	}
+
+	now := time.Now().UTC()
+	for _, subscription := range s.repo.FindSubscriptions() {
+		if !slices.Contains(subscription.Events, notification.Event) {
+			continue
+		}
+
+		deliveryID := s.repo.CreateDelivery(models.WebhookDelivery{
+			SubscriptionID: subscription.ID,
+			Event:          notification.Event,
+			Payload:        payload,
+			Status:         models.DeliveryPending,
+			CreatedAt:      now,
+			NextAttemptAt:  now,
+		})
+		s.logger.DebugContext(ctx, "Webhook delivery queued", "delivery_id", deliveryID, "subscription_id", subscription.ID, "event", notification.Event, "receipt_id", notification.ReceiptID)
+	}
+}
+
+func newWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("generating webhook secret: %w", err)
+	}
+	return "whsec_" + hex.EncodeToString(secret), nil
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+	"github.com/javier-tello/receipt-processor-challenge/internal/repositories"
+)
+
+type recordingNotifier struct {
+	notifications []models.ReceiptNotification
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, notification models.ReceiptNotification) {
+	n.notifications = append(n.notifications, notification)
+}
+
+func TestReceiptService_NotifiesLifecycleEvents(t *testing.T) {
+	notifier := &recordingNotifier{}
+	service := NewReceiptService(NewMockReceiptRepository(MockUUIDGenerator{}),
+		WithReviewPolicy(ReviewPolicy{MaxTotal: 5}),
+		WithNotifier(notifier),
+	)
+
+	receiptID, err := service.ProcessReceipt(context.Background(), models.Receipt{
+		Retailer:     "M&M Corner Market",
+		PurchaseDate: "2022-03-20",
+		PurchaseTime: "14:33",
+		Total:        "9.00",
+		Items: []models.Item{
+			{ShortDescription: "Gatorade", Price: "4.50"},
+			{ShortDescription: "Gatorade", Price: "4.50"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := service.ApproveReceipt(context.Background(), receiptID, models.ReviewRequest{Comment: "checked", Actor: "agent-7"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := service.ReturnItems(context.Background(), receiptID, models.ReturnRequest{Items: []int{0}, Reason: "damaged", Actor: "agent-7"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := service.ReturnItems(context.Background(), receiptID, models.ReturnRequest{Items: []int{1}, Reason: "damaged", Actor: "agent-7"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var events []models.WebhookEvent
+	for _, notification := range notifier.notifications {
+		events = append(events, notification.Event)
+	}
+	expected := []models.WebhookEvent{models.EventReceiptFlagged, models.EventReceiptApproved, models.EventReceiptAdjusted, models.EventReceiptVoided}
+	if !reflect.DeepEqual(events, expected) {
+		t.Fatalf("Expected events %v, got %v", expected, events)
+	}
+
+	flagged := notifier.notifications[0]
+	if flagged.ReceiptID != receiptID || flagged.Points != 0 || len(flagged.Reasons) != 1 {
+		t.Errorf("Expected a flagged receipt with no points and one reason, got %+v", flagged)
+	}
+	if approved := notifier.notifications[1]; approved.Points == 0 {
+		t.Errorf("Expected an approved receipt to carry its points, got %+v", approved)
+	}
+	if voided := notifier.notifications[3]; voided.Adjustment == nil || voided.Adjustment.Points >= 0 {
+		t.Errorf("Expected the void to carry its clawback, got %+v", voided)
+	}
+}
+
+func TestWebhookService_Subscriptions(t *testing.T) {
+	repo := repositories.NewInMemoryWebhookRepo(nil)
+	service := NewWebhookService(repo, nil)
+
+	voids, err := service.CreateSubscription(models.WebhookSubscriptionRequest{URL: "https://partner.example.com/voids", Events: []models.WebhookEvent{models.EventReceiptVoided}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(voids.Secret, "whsec_") {
+		t.Errorf("Expected a generated secret on creation, got %q", voids.Secret)
+	}
+	everything, _ := service.CreateSubscription(models.WebhookSubscriptionRequest{URL: "https://partner.example.com/all"})
+	if len(everything.Events) != len(models.WebhookEvents) {
+		t.Errorf("Expected no events to subscribe to all of them, got %v", everything.Events)
+	}
+
+	if subscription, _ := service.GetSubscription(voids.ID); subscription.Secret != "" {
+		t.Errorf("Expected the secret to be hidden once created")
+	}
+
+	service.Notify(context.Background(), models.ReceiptNotification{Event: models.EventReceiptScored, ReceiptID: "receipt-1"})
+	service.Notify(context.Background(), models.ReceiptNotification{Event: models.EventReceiptVoided, ReceiptID: "receipt-1"})
+	if pending := repo.FindDeliveriesByStatus(models.DeliveryPending); len(pending) != 3 {
+		t.Errorf("Expected 3 deliveries queued, got %d", len(pending))
+	}
+
+	if _, err := service.Redeliver("non-existent-id"); !errors.Is(err, ErrDeliveryNotFound) {
+		t.Errorf("Expected ErrDeliveryNotFound, got %v", err)
+	}
+	if _, err := service.Redeliver(repo.FindDeliveriesByStatus(models.DeliveryPending)[0].ID); !errors.Is(err, ErrDeliveryPending) {
+		t.Errorf("Expected ErrDeliveryPending redelivering a queued delivery, got %v", err)
+	}
+	if err := service.DeleteSubscription(voids.ID); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := service.DeleteSubscription(voids.ID); !errors.Is(err, ErrSubscriptionNotFound) {
+		t.Errorf("Expected ErrSubscriptionNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,207 @@
+// Package stream broadcasts live receipt activity to subscribers, keeping a bounded history
+// so a client that reconnects can resume where it left off.
+package stream
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+)
+
+const (
+	// DefaultHistory is how many activities are kept for clients resuming a stream
+	DefaultHistory = 1000
+	// DefaultSubscriberBuffer is how many activities may queue for a subscriber before it is dropped
+	DefaultSubscriberBuffer = 64
+)
+
+// Activity is a receipt that finished processing.
+type Activity struct {
+	ID          uint64               `json:"-"`
+	ReceiptID   string               `json:"receiptId"`
+	Retailer    string               `json:"retailer"`
+	Points      int                  `json:"points"`
+	Status      models.ReceiptStatus `json:"status"`
+	ProcessedAt time.Time            `json:"processedAt"`
+}
+
+// Filter selects the activities a subscriber receives. The zero Filter matches everything.
+type Filter struct {
+	// Retailer matches the retailer name, ignoring case
+	Retailer  string
+	MinPoints int
+}
+
+// Matches reports whether the activity passes the filter.
+func (f Filter) Matches(activity Activity) bool {
+	if f.Retailer != "" && !strings.EqualFold(f.Retailer, activity.Retailer) {
+		return false
+	}
+	return activity.Points >= f.MinPoints
+}
+
+// Broadcaster fans activities out to subscribers. It never blocks a publisher: a subscriber
+// whose buffer fills up is dropped and must reconnect, resuming from the history with the ID
+// of the last activity it saw.
+// A nil *Broadcaster discards everything published, so streaming is optional.
+type Broadcaster struct {
+	subscriberBuffer int
+	mu               sync.Mutex
+	history          []Activity
+	next             int
+	size             int
+	lastID           uint64
+	subscribers      map[*Subscription]struct{}
+	closed           bool
+}
+
+// Subscription receives the activities matching its filter on C, which is closed when the
+// subscriber falls behind, unsubscribes or the broadcaster is closed.
+type Subscription struct {
+	C      <-chan Activity
+	ch     chan Activity
+	filter Filter
+	lagged bool
+}
+
+// Lagged reports whether the subscription was dropped for falling behind. It is only
+// meaningful once C is closed.
+func (s *Subscription) Lagged() bool {
+	return s.lagged
+}
+
+// New returns a broadcaster remembering the last history activities, each subscriber
+// buffering up to subscriberBuffer. Values below 1 use the defaults.
+func New(history int, subscriberBuffer int) *Broadcaster {
+	if history < 1 {
+		history = DefaultHistory
+	}
+	if subscriberBuffer < 1 {
+		subscriberBuffer = DefaultSubscriberBuffer
+	}
+
+	return &Broadcaster{
+		subscriberBuffer: subscriberBuffer,
+		history:          make([]Activity, history),
+		subscribers:      make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish assigns the activity the next ID, records it and sends it to every matching subscriber.
+func (b *Broadcaster) Publish(activity Activity) Activity {
+	if b == nil {
+		return activity
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	activity.ID = b.lastID
+	b.history[b.next] = activity
+	b.next = (b.next + 1) % len(b.history)
+	b.size = min(b.size+1, len(b.history))
+
+	for sub := range b.subscribers {
+		if !sub.filter.Matches(activity) {
+			continue
+		}
+		select {
+		case sub.ch <- activity:
+		default:
+			sub.lagged = true
+			b.drop(sub)
+		}
+	}
+	return activity
+}
+
+// Subscribe receives activities published from now on.
+func (b *Broadcaster) Subscribe(filter Filter) *Subscription {
+	sub, _, _ := b.subscribe(filter, false, 0)
+	return sub
+}
+
+// SubscribeAfter resumes a stream after the activity with ID lastEventID. It returns the
+// matching activities still in the history, oldest first, and whether the history reached
+// back far enough to include everything published since.
+func (b *Broadcaster) SubscribeAfter(filter Filter, lastEventID uint64) (*Subscription, []Activity, bool) {
+	return b.subscribe(filter, true, lastEventID)
+}
+
+func (b *Broadcaster) subscribe(filter Filter, resume bool, lastEventID uint64) (*Subscription, []Activity, bool) {
+	if b == nil {
+		ch := make(chan Activity)
+		close(ch)
+		return &Subscription{C: ch, ch: ch, filter: filter}, nil, false
+	}
+
+	ch := make(chan Activity, b.subscriberBuffer)
+	sub := &Subscription{C: ch, ch: ch, filter: filter}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		close(ch)
+		return sub, nil, false
+	}
+	b.subscribers[sub] = struct{}{}
+	if !resume {
+		return sub, nil, true
+	}
+
+	// An ID from the future was issued before a restart, so everything remembered is new to the client
+	complete := true
+	if lastEventID > b.lastID {
+		lastEventID, complete = 0, false
+	}
+
+	// Replaying under the lock means nothing is missed or repeated between the replay and C
+	var replay []Activity
+	oldest := b.lastID - uint64(b.size) + 1
+	for i := 0; i < b.size; i++ {
+		activity := b.history[(b.next-b.size+i+len(b.history))%len(b.history)]
+		if activity.ID > lastEventID && filter.Matches(activity) {
+			replay = append(replay, activity)
+		}
+	}
+	return sub, replay, complete && lastEventID+1 >= oldest
+}
+
+// Unsubscribe stops a subscription and closes its channel.
+func (b *Broadcaster) Unsubscribe(sub *Subscription) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.drop(sub)
+}
+
+// Close ends every subscription, e.g. so streams don't hold up a graceful shutdown.
+func (b *Broadcaster) Close() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for sub := range b.subscribers {
+		b.drop(sub)
+	}
+}
+
+// drop removes a subscriber and closes its channel. The caller must hold b.mu.
+func (b *Broadcaster) drop(sub *Subscription) {
+	if _, ok := b.subscribers[sub]; !ok {
+		return
+	}
+	delete(b.subscribers, sub)
+	close(sub.ch)
+}
@@ -0,0 +1,98 @@
+package stream
+
+import (
+	"testing"
+)
+
+func TestBroadcaster_FiltersSubscribers(t *testing.T) {
+	broadcaster := New(10, 10)
+	target := broadcaster.Subscribe(Filter{Retailer: "target", MinPoints: 20})
+	all := broadcaster.Subscribe(Filter{})
+
+	broadcaster.Publish(Activity{Retailer: "Target", Points: 31})
+	broadcaster.Publish(Activity{Retailer: "Target", Points: 5})
+	broadcaster.Publish(Activity{Retailer: "Walgreens", Points: 50})
+
+	if len(target.C) != 1 || len(all.C) != 3 {
+		t.Fatalf("Expected 1 filtered and 3 unfiltered activities, got %d and %d", len(target.C), len(all.C))
+	}
+	if activity := <-target.C; activity.ID != 1 || activity.Points != 31 {
+		t.Errorf("Expected activity 1 worth 31 points, got %+v", activity)
+	}
+}
+
+func TestBroadcaster_ResumesFromHistory(t *testing.T) {
+	broadcaster := New(3, 10)
+	for points := 1; points <= 5; points++ {
+		broadcaster.Publish(Activity{Points: points})
+	}
+
+	_, replay, complete := broadcaster.SubscribeAfter(Filter{}, 3)
+	if !complete || len(replay) != 2 || replay[0].ID != 4 || replay[1].ID != 5 {
+		t.Errorf("Expected a complete replay of activities 4 and 5, got %+v (complete %v)", replay, complete)
+	}
+
+	// Activity 2 has been overwritten by now
+	_, replay, complete = broadcaster.SubscribeAfter(Filter{}, 1)
+	if complete || len(replay) != 3 || replay[0].ID != 3 {
+		t.Errorf("Expected an incomplete replay from activity 3, got %+v (complete %v)", replay, complete)
+	}
+
+	// An ID from before a restart replays the whole history
+	_, replay, complete = broadcaster.SubscribeAfter(Filter{}, 40)
+	if complete || len(replay) != 3 {
+		t.Errorf("Expected an incomplete replay of the whole history, got %+v (complete %v)", replay, complete)
+	}
+
+	sub, replay, _ := broadcaster.SubscribeAfter(Filter{MinPoints: 5}, 0)
+	if len(replay) != 1 || replay[0].Points != 5 {
+		t.Errorf("Expected the replay to be filtered, got %+v", replay)
+	}
+	broadcaster.Publish(Activity{Points: 6})
+	if activity := <-sub.C; activity.ID != 6 {
+		t.Errorf("Expected live activity 6 after the replay, got %+v", activity)
+	}
+}
+
+func TestBroadcaster_DropsSlowSubscribers(t *testing.T) {
+	broadcaster := New(10, 2)
+	slow := broadcaster.Subscribe(Filter{})
+	fast := broadcaster.Subscribe(Filter{})
+
+	for points := 1; points <= 3; points++ {
+		broadcaster.Publish(Activity{Points: points})
+		if points < 3 {
+			<-fast.C
+		}
+	}
+
+	received := 0
+	for range slow.C {
+		received++
+	}
+	if received != 2 || !slow.Lagged() {
+		t.Errorf("Expected the slow subscriber to be dropped after 2 activities, got %d (lagged %v)", received, slow.Lagged())
+	}
+	if activity := <-fast.C; activity.ID != 3 || fast.Lagged() {
+		t.Errorf("Expected the fast subscriber to keep receiving, got %+v", activity)
+	}
+}
+
+func TestBroadcaster_Close(t *testing.T) {
+	broadcaster := New(10, 10)
+	sub := broadcaster.Subscribe(Filter{})
+	broadcaster.Close()
+
+	if _, ok := <-sub.C; ok || sub.Lagged() {
+		t.Errorf("Expected closing to end subscriptions without marking them lagged")
+	}
+	if _, ok := <-broadcaster.Subscribe(Filter{}).C; ok {
+		t.Errorf("Expected subscribing after closing to end at once")
+	}
+
+	var disabled *Broadcaster
+	disabled.Publish(Activity{})
+	if _, ok := <-disabled.Subscribe(Filter{}).C; ok {
+		t.Errorf("Expected a nil broadcaster to have nothing to stream")
+	}
+}
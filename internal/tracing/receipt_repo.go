@@ -0,0 +1,111 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/events"
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+	"github.com/javier-tello/receipt-processor-challenge/internal/repositories"
+)
+
+// TracedReceiptRepo records a client span for every call to the wrapped repository.
+type TracedReceiptRepo struct {
+	repo repositories.ReceiptRepository
+}
+
+func NewTracedReceiptRepo(repo repositories.ReceiptRepository) *TracedReceiptRepo {
+	return &TracedReceiptRepo{repo: repo}
+}
+
+func (t *TracedReceiptRepo) start(ctx context.Context, operation string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, "ReceiptRepository."+operation, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// end ends a repository span. A missing receipt is an expected outcome rather than a failure.
+func (t *TracedReceiptRepo) end(span trace.Span, err error) {
+	if errors.Is(err, repositories.ErrReceiptNotFound) {
+		span.SetAttributes(attribute.Bool("receipt.found", false))
+		err = nil
+	}
+	End(span, err)
+}
+
+func (t *TracedReceiptRepo) ProcessReceipt(ctx context.Context, receipt models.Receipt, outbox ...events.Event) (receiptID string, err error) {
+	ctx, span := t.start(ctx, "ProcessReceipt", ReceiptStatusKey.String(string(receipt.Status)))
+	defer func() { t.end(span, err) }()
+
+	receiptID, err = t.repo.ProcessReceipt(ctx, receipt, outbox...)
+	span.SetAttributes(ReceiptIDKey.String(receiptID))
+	return receiptID, err
+}
+
+func (t *TracedReceiptRepo) FindByID(ctx context.Context, receiptID string) (receipt models.Receipt, err error) {
+	ctx, span := t.start(ctx, "FindByID", ReceiptIDKey.String(receiptID))
+	defer func() { t.end(span, err) }()
+	return t.repo.FindByID(ctx, receiptID)
+}
+
+func (t *TracedReceiptRepo) UpdateReceipt(ctx context.Context, receiptID string, receipt models.Receipt, outbox ...events.Event) (err error) {
+	ctx, span := t.start(ctx, "UpdateReceipt", ReceiptIDKey.String(receiptID), ReceiptStatusKey.String(string(receipt.Status)))
+	defer func() { t.end(span, err) }()
+	return t.repo.UpdateReceipt(ctx, receiptID, receipt, outbox...)
+}
+
+func (t *TracedReceiptRepo) AdjustReceipt(ctx context.Context, receiptID string, receipt models.Receipt, adjustment models.PointsAdjustment, outbox ...events.Event) (adjustmentID string, err error) {
+	ctx, span := t.start(ctx, "AdjustReceipt", ReceiptIDKey.String(receiptID), ReceiptStatusKey.String(string(receipt.Status)))
+	defer func() { t.end(span, err) }()
+	return t.repo.AdjustReceipt(ctx, receiptID, receipt, adjustment, outbox...)
+}
+
+func (t *TracedReceiptRepo) FindByStatus(ctx context.Context, status models.ReceiptStatus) (receipts []models.Receipt, err error) {
+	ctx, span := t.start(ctx, "FindByStatus", ReceiptStatusKey.String(string(status)))
+	defer func() { t.end(span, err) }()
+
+	receipts, err = t.repo.FindByStatus(ctx, status)
+	span.SetAttributes(attribute.Int("receipt.count", len(receipts)))
+	return receipts, err
+}
+
+func (t *TracedReceiptRepo) FindByFingerprint(ctx context.Context, fingerprint string) (receipts []models.Receipt, err error) {
+	ctx, span := t.start(ctx, "FindByFingerprint")
+	defer func() { t.end(span, err) }()
+
+	receipts, err = t.repo.FindByFingerprint(ctx, fingerprint)
+	span.SetAttributes(attribute.Int("receipt.count", len(receipts)))
+	return receipts, err
+}
+
+func (t *TracedReceiptRepo) FindByClientID(ctx context.Context, clientID string) (receipts []models.Receipt, err error) {
+	ctx, span := t.start(ctx, "FindByClientID")
+	defer func() { t.end(span, err) }()
+
+	receipts, err = t.repo.FindByClientID(ctx, clientID)
+	span.SetAttributes(attribute.Int("receipt.count", len(receipts)))
+	return receipts, err
+}
+
+func (t *TracedReceiptRepo) FindByPurchaseDate(ctx context.Context, from string, to string) (receipts []models.Receipt, err error) {
+	ctx, span := t.start(ctx, "FindByPurchaseDate", attribute.String("receipt.purchase_date.from", from), attribute.String("receipt.purchase_date.to", to))
+	defer func() { t.end(span, err) }()
+
+	receipts, err = t.repo.FindByPurchaseDate(ctx, from, to)
+	span.SetAttributes(attribute.Int("receipt.count", len(receipts)))
+	return receipts, err
+}
+
+func (t *TracedReceiptRepo) FindCustomerPoints(ctx context.Context, clientID string, submittedAt time.Time) (day int, month int, err error) {
+	ctx, span := t.start(ctx, "FindCustomerPoints")
+	defer func() { t.end(span, err) }()
+	return t.repo.FindCustomerPoints(ctx, clientID, submittedAt)
+}
+
+func (t *TracedReceiptRepo) FindAdjustmentsByReceiptID(ctx context.Context, receiptID string) (adjustments []models.PointsAdjustment, err error) {
+	ctx, span := t.start(ctx, "FindAdjustmentsByReceiptID", ReceiptIDKey.String(receiptID))
+	defer func() { t.end(span, err) }()
+	return t.repo.FindAdjustmentsByReceiptID(ctx, receiptID)
+}
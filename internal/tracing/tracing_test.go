@@ -0,0 +1,166 @@
+package tracing_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/handlers"
+	"github.com/javier-tello/receipt-processor-challenge/internal/repositories"
+	"github.com/javier-tello/receipt-processor-challenge/internal/services"
+	"github.com/javier-tello/receipt-processor-challenge/internal/tracing"
+	"github.com/javier-tello/receipt-processor-challenge/internal/validation"
+)
+
+const incomingTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+func setupTracing(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+
+	if _, err := tracing.Setup(context.Background(), tracing.ExporterNone, ""); err != nil {
+		t.Fatalf("Unexpected error setting up tracing: %v", err)
+	}
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	return exporter
+}
+
+func findSpan(spans tracetest.SpanStubs, name string) (tracetest.SpanStub, bool) {
+	for _, span := range spans {
+		if span.Name == name {
+			return span, true
+		}
+	}
+	return tracetest.SpanStub{}, false
+}
+
+func attributeValue(span tracetest.SpanStub, key attribute.Key) (attribute.Value, bool) {
+	for _, attr := range span.Attributes {
+		if attr.Key == key {
+			return attr.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestMiddleware_TracesPointsLookupAcrossLayers(t *testing.T) {
+	exporter := setupTracing(t)
+
+	repo := tracing.NewTracedReceiptRepo(repositories.NewInMemoryReceiptRepo(nil, nil))
+	service := services.NewReceiptService(repo)
+	handler := handlers.NewReceiptHandler(service, validation.ReceiptValidator{}, nil)
+
+	router := mux.NewRouter()
+	router.Use(tracing.Middleware)
+	router.HandleFunc("/receipts/process", handler.ProcessReceipt).Methods("POST")
+	router.HandleFunc("/receipts/{id}/points", handler.GetPointsForReceipt).Methods("GET")
+
+	body := `{"retailer": "Target", "purchaseDate": "2022-01-01", "purchaseTime": "13:01", "total": "6.49", "items": [{"shortDescription": "Mountain Dew 12PK", "price": "6.49"}]}`
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/receipts/process", strings.NewReader(body)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", rec.Code)
+	}
+	receiptID := strings.Split(rec.Body.String(), `"`)[3]
+
+	// Receipts are scored once, when they are processed
+	scoring, ok := findSpan(exporter.GetSpans(), "ReceiptService.scoreRules")
+	if !ok {
+		t.Fatalf("Expected a scoring span when the receipt is processed")
+	}
+	if value, _ := attributeValue(scoring, "receipt.points.rule."+services.RuleRetailerName); value.AsInt64() != 6 {
+		t.Errorf("Expected 6 retailer name points on the scoring span, got %d", value.AsInt64())
+	}
+	if value, _ := attributeValue(scoring, tracing.PointsTotalKey); value.AsInt64() != 12 {
+		t.Errorf("Expected 12 total points on the scoring span, got %d", value.AsInt64())
+	}
+	exporter.Reset()
+
+	req := httptest.NewRequest(http.MethodGet, "/receipts/"+receiptID+"/points", nil)
+	req.Header.Set("traceparent", "00-"+incomingTraceID+"-00f067aa0ba902b7-01")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	spans := exporter.GetSpans()
+	for _, name := range []string{"GET /receipts/{id}/points", "ReceiptValidator.ValidateReceiptID", "ReceiptService.GetPointsForReceipt", "ReceiptRepository.FindByID"} {
+		span, ok := findSpan(spans, name)
+		if !ok {
+			t.Fatalf("Expected a %q span, got %d spans", name, len(spans))
+		}
+		if span.SpanContext.TraceID().String() != incomingTraceID {
+			t.Errorf("Expected %q to continue the incoming trace, got trace %s", name, span.SpanContext.TraceID())
+		}
+	}
+
+	lookup, _ := findSpan(spans, "ReceiptService.GetPointsForReceipt")
+	if value, _ := attributeValue(lookup, tracing.ReceiptIDKey); value.AsString() != receiptID {
+		t.Errorf("Expected receipt.id %s on the service span, got '%s'", receiptID, value.AsString())
+	}
+}
+
+func TestReceiptService_RecordsErrorOnSpan(t *testing.T) {
+	exporter := setupTracing(t)
+
+	service := services.NewReceiptService(tracing.NewTracedReceiptRepo(repositories.NewInMemoryReceiptRepo(nil, nil)))
+	if _, _, err := service.GetPointsForReceipt(context.Background(), "missing"); err == nil {
+		t.Fatalf("Expected an error for a missing receipt")
+	}
+
+	lookup, ok := findSpan(exporter.GetSpans(), "ReceiptService.GetPointsForReceipt")
+	if !ok {
+		t.Fatalf("Expected a service span")
+	}
+	if len(lookup.Events) == 0 || lookup.Events[0].Name != "exception" {
+		t.Errorf("Expected the error to be recorded on the span, got %+v", lookup.Events)
+	}
+}
+
+func TestSetup_FileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.json")
+	previous := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	shutdown, err := tracing.Setup(context.Background(), tracing.ExporterFile, path)
+	if err != nil {
+		t.Fatalf("Unexpected error setting up tracing: %v", err)
+	}
+
+	_, span := tracing.Tracer().Start(context.Background(), "test-span")
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("Unexpected error flushing traces: %v", err)
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected error reading trace file: %v", err)
+	}
+	if !bytes.Contains(contents, []byte(`"Name":"test-span"`)) {
+		t.Errorf("Expected the span to be written to the trace file, got %s", contents)
+	}
+}
+
+func TestSetup_RejectsUnknownExporter(t *testing.T) {
+	if _, err := tracing.Setup(context.Background(), "jaeger", ""); err == nil {
+		t.Errorf("Expected an error for an unknown exporter")
+	}
+	if _, err := tracing.Setup(context.Background(), tracing.ExporterFile, ""); err == nil {
+		t.Errorf("Expected an error for a file exporter without a path")
+	}
+}
@@ -0,0 +1,279 @@
+package validation
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Failure codes reported when a request body cannot be decoded
+const (
+	CodeSyntax         = "syntax"
+	CodeUnknownField   = "unknown_field"
+	CodeDuplicateField = "duplicate_field"
+	CodeType           = "type"
+	CodeTrailingData   = "trailing_data"
+)
+
+// bodyField names the request body as a whole in a FieldError
+const bodyField = "body"
+
+var (
+	jsonUnmarshalerType = reflect.TypeFor[json.Unmarshaler]()
+	textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+)
+
+// DecodeStrict decodes a JSON request body into v, which must be a pointer. Unlike
+// json.Unmarshal it rejects fields v does not declare, including fields whose name differs
+// only in case, keys that appear twice in an object, values of the wrong type and anything
+// after the JSON value. Failures are returned as ValidationErrors naming the offending path,
+// e.g. items[2].price.
+func DecodeStrict(data []byte, v any) error {
+	target := reflect.TypeOf(v)
+	if target == nil || target.Kind() != reflect.Pointer {
+		return fmt.Errorf("DecodeStrict requires a pointer, got %T", v)
+	}
+
+	checker := &strictChecker{decoder: json.NewDecoder(bytes.NewReader(data))}
+	checker.decoder.UseNumber()
+	if fieldError := checker.value("", target.Elem()); fieldError != nil {
+		return ValidationErrors{*fieldError}
+	}
+	if _, err := checker.decoder.Token(); err != io.EOF {
+		return ValidationErrors{{Field: bodyField, Code: CodeTrailingData, Message: "The request is invalid, unexpected data after the JSON value."}}
+	}
+
+	// The body matches v, so this only fills it in
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+// strictChecker walks the tokens of a JSON value alongside the Go type it will be decoded into.
+type strictChecker struct {
+	decoder *json.Decoder
+}
+
+func (c *strictChecker) value(path string, t reflect.Type) *FieldError {
+	if implementsUnmarshaler(t) {
+		// Types that decode themselves are left to report their own errors
+		var raw json.RawMessage
+		if err := c.decoder.Decode(&raw); err != nil {
+			return syntaxError(err)
+		}
+		return nil
+	}
+
+	token, err := c.decoder.Token()
+	if err != nil {
+		return syntaxError(err)
+	}
+	if token == nil {
+		return nil
+	}
+
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch token := token.(type) {
+	case json.Delim:
+		if token == '[' {
+			return c.array(path, t)
+		}
+		return c.object(path, t)
+	case string:
+		if t.Kind() != reflect.String && t.Kind() != reflect.Interface {
+			return typeError(path, t)
+		}
+	case bool:
+		if t.Kind() != reflect.Bool && t.Kind() != reflect.Interface {
+			return typeError(path, t)
+		}
+	case json.Number:
+		return checkNumber(path, t, token)
+	}
+	return nil
+}
+
+func (c *strictChecker) object(path string, t reflect.Type) *FieldError {
+	var fields map[string]reflect.Type
+	switch {
+	case t.Kind() == reflect.Struct:
+		fields = jsonFields(t)
+	case t.Kind() == reflect.Map && t.Key().Kind() == reflect.String, t.Kind() == reflect.Interface:
+	default:
+		return typeError(path, t)
+	}
+
+	seen := make(map[string]bool)
+	for c.decoder.More() {
+		token, err := c.decoder.Token()
+		if err != nil {
+			return syntaxError(err)
+		}
+		key := token.(string)
+		fieldPath := joinPath(path, key)
+
+		if seen[key] {
+			return &FieldError{Field: fieldPath, Code: CodeDuplicateField, Message: fmt.Sprintf("The request is invalid, %s appears more than once.", fieldPath)}
+		}
+		seen[key] = true
+
+		var fieldType reflect.Type
+		switch t.Kind() {
+		case reflect.Struct:
+			var known bool
+			if fieldType, known = fields[key]; !known {
+				return &FieldError{Field: fieldPath, Code: CodeUnknownField, Message: fmt.Sprintf("The request is invalid, %s is not a known field.", fieldPath)}
+			}
+		case reflect.Map:
+			fieldType = t.Elem()
+		default:
+			fieldType = t
+		}
+
+		if fieldError := c.value(fieldPath, fieldType); fieldError != nil {
+			return fieldError
+		}
+	}
+
+	if _, err := c.decoder.Token(); err != nil {
+		return syntaxError(err)
+	}
+	return nil
+}
+
+func (c *strictChecker) array(path string, t reflect.Type) *FieldError {
+	var elem reflect.Type
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		elem = t.Elem()
+	case reflect.Interface:
+		elem = t
+	default:
+		return typeError(path, t)
+	}
+
+	for i := 0; c.decoder.More(); i++ {
+		if fieldError := c.value(fmt.Sprintf("%s[%d]", path, i), elem); fieldError != nil {
+			return fieldError
+		}
+	}
+
+	if _, err := c.decoder.Token(); err != nil {
+		return syntaxError(err)
+	}
+	return nil
+}
+
+// jsonFields maps the JSON names of a struct's decodable fields to their types, including the
+// fields of embedded structs.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for _, field := range reflect.VisibleFields(t) {
+		if !field.IsExported() || len(field.Index) > 1 && !isPromoted(t, field) {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+// isPromoted reports whether a nested field is reached through untagged embedded structs.
+func isPromoted(t reflect.Type, field reflect.StructField) bool {
+	for _, index := range field.Index[:len(field.Index)-1] {
+		embedded := t.Field(index)
+		if !embedded.Anonymous || embedded.Tag.Get("json") != "" {
+			return false
+		}
+		t = embedded.Type
+		if t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+	}
+	return true
+}
+
+func implementsUnmarshaler(t reflect.Type) bool {
+	pointer := reflect.PointerTo(t)
+	return pointer.Implements(jsonUnmarshalerType) || pointer.Implements(textUnmarshalerType)
+}
+
+func checkNumber(path string, t reflect.Type, number json.Number) *FieldError {
+	switch t.Kind() {
+	case reflect.Interface, reflect.Float32, reflect.Float64:
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if _, err := strconv.ParseInt(number.String(), 10, t.Bits()); err == nil {
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if _, err := strconv.ParseUint(number.String(), 10, t.Bits()); err == nil {
+			return nil
+		}
+	}
+	return typeError(path, t)
+}
+
+func typeError(path string, t reflect.Type) *FieldError {
+	field := path
+	if field == "" {
+		field = bodyField
+	}
+	return &FieldError{Field: field, Code: CodeType, Message: fmt.Sprintf("The request is invalid, %s must be %s.", field, describeType(t))}
+}
+
+func describeType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	default:
+		return "an object"
+	}
+}
+
+func syntaxError(err error) *FieldError {
+	message := "The request is invalid, the body is not valid JSON."
+	var syntax *json.SyntaxError
+	switch {
+	case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+		message = "The request is invalid, the body is empty or incomplete."
+	case errors.As(err, &syntax):
+		message = fmt.Sprintf("The request is invalid, the body is not valid JSON at byte %d.", syntax.Offset)
+	}
+	return &FieldError{Field: bodyField, Code: CodeSyntax, Message: message}
+}
+
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,64 @@
+package validation_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+	"github.com/javier-tello/receipt-processor-challenge/internal/validation"
+)
+
+func TestDecodeStrict_Rejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		field string
+		code  string
+	}{
+		{"Unknown Field", `{"retailer": "Target", "purchasedate": "2022-01-02"}`, "purchasedate", validation.CodeUnknownField},
+		{"Server Assigned ID", `{"ID": "chosen-by-client", "retailer": "Target"}`, "ID", validation.CodeUnknownField},
+		{"Unknown Item Field", `{"items": [{"price": "1.25"}, {"price": "2.00", "Returned": true}]}`, "items[1].Returned", validation.CodeUnknownField},
+		{"Duplicate Key", `{"total": "1.25", "total": "0.01"}`, "total", validation.CodeDuplicateField},
+		{"Number For String", `{"items": [{"shortDescription": "Pepsi", "price": 1.25}]}`, "items[0].price", validation.CodeType},
+		{"Object For Array", `{"items": {"price": "1.25"}}`, "items", validation.CodeType},
+		{"Array Body", `[]`, "body", validation.CodeType},
+		{"Trailing Data", `{"retailer": "Target"} {"retailer": "Walmart"}`, "body", validation.CodeTrailingData},
+		{"Malformed", `{"retailer": "Target",}`, "body", validation.CodeSyntax},
+		{"Empty", ``, "body", validation.CodeSyntax},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var request models.ReceiptRequest
+			err := validation.DecodeStrict([]byte(test.body), &request)
+
+			var fieldErrors validation.ValidationErrors
+			if !errors.As(err, &fieldErrors) || len(fieldErrors) != 1 {
+				t.Fatalf("Expected one field error, got %v", err)
+			}
+			if fieldErrors[0].Field != test.field || fieldErrors[0].Code != test.code {
+				t.Errorf("Expected %s/%s, got %s/%s", test.field, test.code, fieldErrors[0].Field, fieldErrors[0].Code)
+			}
+		})
+	}
+}
+
+func TestDecodeStrict_Decodes(t *testing.T) {
+	body := `{"retailer": "Target", "purchaseDate": "2022-01-02", "purchaseTime": "13:13", "total": "1.25", "items": [{"shortDescription": "Pepsi - 12-oz", "price": "1.25"}]}`
+
+	var request models.ReceiptRequest
+	if err := validation.DecodeStrict([]byte(body), &request); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if request.Retailer != "Target" || len(request.Items) != 1 || request.Items[0].Price != "1.25" {
+		t.Errorf("Unexpected receipt request: %+v", request)
+	}
+
+	var promotion models.Promotion
+	if err := validation.DecodeStrict([]byte(`{"bonusPoints": 1.5}`), &promotion); err == nil {
+		t.Errorf("Expected a fractional number to be rejected for an integer field")
+	}
+	if err := validation.DecodeStrict([]byte(`{"bonusPoints": 10, "multiplier": 1.5, "retailerIds": null}`), &promotion); err != nil {
+		t.Errorf("Unexpected error decoding a promotion: %v", err)
+	}
+}
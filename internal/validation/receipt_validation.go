@@ -3,7 +3,10 @@ package validation
 import (
 	"errors"
 	"fmt"
+	"net/netip"
+	"net/url"
 	"regexp"
+	"slices"
 	"strings"
 	"time"
 
@@ -16,6 +19,7 @@ var (
 	purchaseTimeRegex         = regexp.MustCompile(`^(2[0-3]|[01][0-9]):[0-5][0-9]$`)
 	amountRegex               = regexp.MustCompile(`^\d+\.\d{2}$`)
 	itemShortDescriptionRegex = regexp.MustCompile(`^[\w\s\-]+$`)
+	retailerIDRegex           = regexp.MustCompile(`^[a-z0-9][a-z0-9\-]*$`)
 )
 
 type ReceiptValidator struct{}
@@ -30,55 +34,87 @@ func (uv *ReceiptValidator) ValidateReceiptID(receiptID string) error {
 	return nil
 }
 
+// Failure codes reported with each FieldError
+const (
+	CodeRequired = "required"
+	CodeFormat   = "format"
+)
+
+// FieldError describes why a single field of a receipt failed validation
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors collects every field that failed validation
+type ValidationErrors []FieldError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, fieldError := range e {
+		messages = append(messages, fieldError.Message)
+	}
+	return strings.Join(messages, " | ")
+}
+
 func (uv *ReceiptValidator) ValidateReceipt(receipt models.Receipt) error {
-	var validationErrors []string
+	var validationErrors ValidationErrors
+	fail := func(field string, code string, message string) {
+		validationErrors = append(validationErrors, FieldError{Field: field, Code: code, Message: message})
+	}
 
 	if receipt.Retailer == "" {
-		validationErrors = append(validationErrors, "The receipt is invalid, retailer is required.")
+		fail("retailer", CodeRequired, "The receipt is invalid, retailer is required.")
 	}
 	if receipt.PurchaseDate == "" {
-		validationErrors = append(validationErrors, "The receipt is invalid, purchase date is required.")
+		fail("purchaseDate", CodeRequired, "The receipt is invalid, purchase date is required.")
 	}
 	if receipt.PurchaseTime == "" {
-		validationErrors = append(validationErrors, "The receipt is invalid, purchase time is required.")
+		fail("purchaseTime", CodeRequired, "The receipt is invalid, purchase time is required.")
 	}
 	if receipt.Total == "" {
-		validationErrors = append(validationErrors, "The receipt is invalid, total is required.")
+		fail("total", CodeRequired, "The receipt is invalid, total is required.")
 	}
 	if len(receipt.Items) == 0 {
-		validationErrors = append(validationErrors, "The receipt is invalid, item(s) are required.")
+		fail("items", CodeRequired, "The receipt is invalid, item(s) are required.")
 	}
 
 	if receipt.Retailer != "" && !retailerRegex.MatchString(receipt.Retailer) {
-		validationErrors = append(validationErrors, "The receipt is invalid, bad retailer name.")
+		fail("retailer", CodeFormat, "The receipt is invalid, bad retailer name.")
 	}
 	if receipt.PurchaseDate != "" && !IsValidPurchaseDate(receipt.PurchaseDate) {
-		validationErrors = append(validationErrors, "The receipt is invalid, bad purchase date. Must be in YYYY-MM-DD format.")
+		fail("purchaseDate", CodeFormat, "The receipt is invalid, bad purchase date. Must be in YYYY-MM-DD format.")
 	}
 	if receipt.PurchaseTime != "" && !purchaseTimeRegex.MatchString(receipt.PurchaseTime) {
-		validationErrors = append(validationErrors, "The receipt is invalid, bad purchase time. Must be in HH:MM format")
+		fail("purchaseTime", CodeFormat, "The receipt is invalid, bad purchase time. Must be in HH:MM format")
+	}
+	if receipt.TimeZone != "" {
+		if _, err := models.LoadTimeZone(receipt.TimeZone); err != nil {
+			fail("timeZone", CodeFormat, "The receipt is invalid, bad time zone. Must be an IANA time zone such as America/Chicago or a UTC offset such as -05:00.")
+		}
 	}
 	if receipt.Total != "" && !amountRegex.MatchString(receipt.Total) {
-		validationErrors = append(validationErrors, "The receipt is invalid, bad total. Must be in ##.## format.")
+		fail("total", CodeFormat, "The receipt is invalid, bad total. Must be in ##.## format.")
 	}
 
 	for i, item := range receipt.Items {
 		if item.Price == "" {
-			validationErrors = append(validationErrors, fmt.Sprintf("The receipt is invalid, missing price in item at index %d.", i))
+			fail(fmt.Sprintf("items[%d].price", i), CodeRequired, fmt.Sprintf("The receipt is invalid, missing price in item at index %d.", i))
 		}
 		if item.ShortDescription == "" {
-			validationErrors = append(validationErrors, fmt.Sprintf("The receipt is invalid, missing short description in item at index %d.", i))
+			fail(fmt.Sprintf("items[%d].shortDescription", i), CodeRequired, fmt.Sprintf("The receipt is invalid, missing short description in item at index %d.", i))
 		}
 		if item.Price != "" && !amountRegex.MatchString(item.Price) {
-			validationErrors = append(validationErrors, fmt.Sprintf("The receipt is invalid, bad price in item at index %d.", i))
+			fail(fmt.Sprintf("items[%d].price", i), CodeFormat, fmt.Sprintf("The receipt is invalid, bad price in item at index %d.", i))
 		}
 		if item.ShortDescription != "" && !itemShortDescriptionRegex.MatchString(item.ShortDescription) {
-			validationErrors = append(validationErrors, fmt.Sprintf("The receipt is invalid, bad short description in item at index %d.", i))
+			fail(fmt.Sprintf("items[%d].shortDescription", i), CodeFormat, fmt.Sprintf("The receipt is invalid, bad short description in item at index %d.", i))
 		}
 	}
 
 	if len(validationErrors) > 0 {
-		return errors.New(strings.Join(validationErrors, " | "))
+		return validationErrors
 	}
 	return nil
 }
@@ -87,3 +123,326 @@ func IsValidPurchaseDate(purchaseDate string) bool {
 	_, err := time.Parse("2006-01-02", purchaseDate)
 	return err == nil
 }
+
+func (uv *ReceiptValidator) ValidateVoidRequest(request models.VoidRequest) error {
+	var validationErrors []string
+
+	if strings.TrimSpace(request.Reason) == "" {
+		validationErrors = append(validationErrors, "The void request is invalid, reason is required.")
+	}
+	if strings.TrimSpace(request.Actor) == "" {
+		validationErrors = append(validationErrors, "The void request is invalid, actor is required.")
+	}
+
+	if len(validationErrors) > 0 {
+		return errors.New(strings.Join(validationErrors, " | "))
+	}
+	return nil
+}
+
+func (uv *ReceiptValidator) ValidateReturnRequest(request models.ReturnRequest) error {
+	var validationErrors []string
+
+	if len(request.Items) == 0 {
+		validationErrors = append(validationErrors, "The return request is invalid, item(s) are required.")
+	}
+	if strings.TrimSpace(request.Reason) == "" {
+		validationErrors = append(validationErrors, "The return request is invalid, reason is required.")
+	}
+	if strings.TrimSpace(request.Actor) == "" {
+		validationErrors = append(validationErrors, "The return request is invalid, actor is required.")
+	}
+
+	seen := make(map[int]bool, len(request.Items))
+	for _, index := range request.Items {
+		if seen[index] {
+			validationErrors = append(validationErrors, fmt.Sprintf("The return request is invalid, item at index %d is listed more than once.", index))
+		}
+		seen[index] = true
+	}
+
+	if len(validationErrors) > 0 {
+		return errors.New(strings.Join(validationErrors, " | "))
+	}
+	return nil
+}
+
+func (uv *ReceiptValidator) ValidateReviewRequest(request models.ReviewRequest) error {
+	var validationErrors []string
+
+	if strings.TrimSpace(request.Comment) == "" {
+		validationErrors = append(validationErrors, "The review request is invalid, comment is required.")
+	}
+	if strings.TrimSpace(request.Actor) == "" {
+		validationErrors = append(validationErrors, "The review request is invalid, actor is required.")
+	}
+
+	if len(validationErrors) > 0 {
+		return errors.New(strings.Join(validationErrors, " | "))
+	}
+	return nil
+}
+
+func (uv *ReceiptValidator) ValidateRetailerID(retailerID string) error {
+	if strings.TrimSpace(retailerID) == "" {
+		return errors.New("please pass in a non-empty retailer id")
+	}
+	if !retailerIDRegex.MatchString(retailerID) {
+		return errors.New("invalid retailer id passed in, must be lower case letters, digits and dashes")
+	}
+	return nil
+}
+
+func (uv *ReceiptValidator) ValidateRetailer(retailer models.Retailer) error {
+	var validationErrors []string
+
+	if retailer.ID != "" && !retailerIDRegex.MatchString(retailer.ID) {
+		validationErrors = append(validationErrors, "The retailer is invalid, bad id. Must be lower case letters, digits and dashes.")
+	}
+	if strings.TrimSpace(retailer.DisplayName) == "" {
+		validationErrors = append(validationErrors, "The retailer is invalid, display name is required.")
+	} else if !retailerRegex.MatchString(retailer.DisplayName) {
+		validationErrors = append(validationErrors, "The retailer is invalid, bad display name.")
+	}
+
+	for i, alias := range retailer.Aliases {
+		if strings.TrimSpace(alias) == "" {
+			validationErrors = append(validationErrors, fmt.Sprintf("The retailer is invalid, empty alias at index %d.", i))
+		}
+	}
+	for i, category := range retailer.Categories {
+		if strings.TrimSpace(category) == "" {
+			validationErrors = append(validationErrors, fmt.Sprintf("The retailer is invalid, empty category at index %d.", i))
+		}
+	}
+
+	if len(validationErrors) > 0 {
+		return errors.New(strings.Join(validationErrors, " | "))
+	}
+	return nil
+}
+
+func (uv *ReceiptValidator) ValidatePromotionID(promotionID string) error {
+	if strings.TrimSpace(promotionID) == "" {
+		return errors.New("please pass in a non-empty promotion id")
+	}
+	if !receiptIDRegex.MatchString(promotionID) {
+		return errors.New("invalid promotion id passed in")
+	}
+	return nil
+}
+
+func (uv *ReceiptValidator) ValidatePromotion(promotion models.Promotion) error {
+	var validationErrors []string
+
+	if strings.TrimSpace(promotion.Name) == "" {
+		validationErrors = append(validationErrors, "The promotion is invalid, name is required.")
+	}
+	if !IsValidPurchaseDate(promotion.StartDate) {
+		validationErrors = append(validationErrors, "The promotion is invalid, bad start date. Must be in YYYY-MM-DD format.")
+	}
+	if promotion.EndDate != "" && !IsValidPurchaseDate(promotion.EndDate) {
+		validationErrors = append(validationErrors, "The promotion is invalid, bad end date. Must be in YYYY-MM-DD format.")
+	} else if promotion.EndDate != "" && promotion.EndDate < promotion.StartDate {
+		validationErrors = append(validationErrors, "The promotion is invalid, end date is before start date.")
+	}
+	if promotion.Multiplier != 0 && promotion.Multiplier < 1 {
+		validationErrors = append(validationErrors, "The promotion is invalid, multiplier must be at least 1.")
+	}
+	if promotion.BonusPoints < 0 {
+		validationErrors = append(validationErrors, "The promotion is invalid, bonus points cannot be negative.")
+	}
+	if promotion.Multiplier <= 1 && promotion.BonusPoints <= 0 {
+		validationErrors = append(validationErrors, "The promotion is invalid, a multiplier above 1 or bonus points are required.")
+	}
+	if promotion.BudgetPoints < 0 {
+		validationErrors = append(validationErrors, "The promotion is invalid, budget cannot be negative.")
+	}
+
+	for i, retailerID := range promotion.RetailerIDs {
+		if !retailerIDRegex.MatchString(retailerID) {
+			validationErrors = append(validationErrors, fmt.Sprintf("The promotion is invalid, bad retailer id at index %d.", i))
+		}
+	}
+
+	if len(validationErrors) > 0 {
+		return errors.New(strings.Join(validationErrors, " | "))
+	}
+	return nil
+}
+
+func (uv *ReceiptValidator) ValidateWebhookID(webhookID string) error {
+	if strings.TrimSpace(webhookID) == "" {
+		return errors.New("please pass in a non-empty id")
+	}
+	if !receiptIDRegex.MatchString(webhookID) {
+		return errors.New("invalid id passed in")
+	}
+	return nil
+}
+
+func (uv *ReceiptValidator) ValidateWebhookSubscription(request models.WebhookSubscriptionRequest) error {
+	var validationErrors []string
+
+	if target, err := url.Parse(request.URL); err != nil || target.Host == "" || target.Scheme != "http" && target.Scheme != "https" {
+		validationErrors = append(validationErrors, "The webhook subscription is invalid, url must be an absolute http or https URL.")
+	} else if isInternalHost(target.Hostname()) {
+		validationErrors = append(validationErrors, "The webhook subscription is invalid, url must not point at a loopback, link-local or private address.")
+	}
+
+	for i, event := range request.Events {
+		if !slices.Contains(models.WebhookEvents, event) {
+			validationErrors = append(validationErrors, fmt.Sprintf("The webhook subscription is invalid, unknown event %q at index %d.", event, i))
+		}
+	}
+
+	if len(validationErrors) > 0 {
+		return errors.New(strings.Join(validationErrors, " | "))
+	}
+	return nil
+}
+
+// sharedAddressSpace is the carrier-grade NAT range, private in practice though not in netip
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// isInternalHost reports whether a webhook host names this machine or an internal address,
+// which a subscriber could otherwise have the server post to on their behalf. Host names are
+// checked again by the webhook worker once resolved, as any name may resolve to such an address.
+func isInternalHost(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	return IsInternalAddr(addr)
+}
+
+// IsInternalAddr reports whether addr is a loopback, private, carrier-grade NAT, link-local or
+// unspecified address, none of which webhooks may be delivered to.
+func IsInternalAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() || sharedAddressSpace.Contains(addr) ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast()
+}
+
+func (uv *ReceiptValidator) ValidateReportQuery(query models.ReportQuery) error {
+	var validationErrors []string
+
+	if !slices.Contains(models.ReportDimensions, query.GroupBy) {
+		validationErrors = append(validationErrors, fmt.Sprintf("The report request is invalid, cannot group by %q. Must be retailer, date, weekday or hour.", query.GroupBy))
+	}
+	if query.From != "" && !IsValidPurchaseDate(query.From) {
+		validationErrors = append(validationErrors, "The report request is invalid, bad from date. Must be in YYYY-MM-DD format.")
+	}
+	if query.To != "" && !IsValidPurchaseDate(query.To) {
+		validationErrors = append(validationErrors, "The report request is invalid, bad to date. Must be in YYYY-MM-DD format.")
+	} else if query.From != "" && query.To != "" && query.To < query.From {
+		validationErrors = append(validationErrors, "The report request is invalid, to date is before from date.")
+	}
+	if query.TimeZone != "" {
+		if _, err := models.LoadTimeZone(query.TimeZone); err != nil {
+			validationErrors = append(validationErrors, "The report request is invalid, bad time zone. Must be an IANA time zone such as America/Chicago or a UTC offset such as -05:00.")
+		}
+	}
+
+	if len(validationErrors) > 0 {
+		return errors.New(strings.Join(validationErrors, " | "))
+	}
+	return nil
+}
+
+func (uv *ReceiptValidator) ValidateRuleSimulation(request models.RuleSimulationRequest) error {
+	var validationErrors []string
+
+	rules := request.Rules
+	for _, rule := range []struct {
+		name   string
+		points int
+	}{
+		{"pointsPerRetailerCharacter", rules.PointsPerRetailerCharacter},
+		{"pointsForRoundDollar", rules.PointsForRoundDollar},
+		{"pointsForQuarterMultiple", rules.PointsForQuarterMultiple},
+		{"pointsPerItemPair", rules.PointsPerItemPair},
+		{"pointsForOddDay", rules.PointsForOddDay},
+		{"pointsForTimeWindow", rules.PointsForTimeWindow},
+	} {
+		if rule.points < 0 {
+			validationErrors = append(validationErrors, fmt.Sprintf("The simulation request is invalid, %s cannot be negative.", rule.name))
+		}
+	}
+	if rules.DescriptionLengthMultiple < 1 {
+		validationErrors = append(validationErrors, "The simulation request is invalid, descriptionLengthMultiple must be at least 1.")
+	}
+	if rules.DescriptionPriceMultiplier < 0 {
+		validationErrors = append(validationErrors, "The simulation request is invalid, descriptionPriceMultiplier cannot be negative.")
+	}
+	if !purchaseTimeRegex.MatchString(rules.TimeWindowStart) {
+		validationErrors = append(validationErrors, "The simulation request is invalid, bad time window start. Must be in HH:MM format.")
+	}
+	if !purchaseTimeRegex.MatchString(rules.TimeWindowEnd) {
+		validationErrors = append(validationErrors, "The simulation request is invalid, bad time window end. Must be in HH:MM format.")
+	} else if purchaseTimeRegex.MatchString(rules.TimeWindowStart) && rules.TimeWindowEnd <= rules.TimeWindowStart {
+		validationErrors = append(validationErrors, "The simulation request is invalid, time window end must be after its start.")
+	}
+	if request.SampleSize < 0 {
+		validationErrors = append(validationErrors, "The simulation request is invalid, sample size cannot be negative.")
+	}
+	if request.TopRetailers < 0 {
+		validationErrors = append(validationErrors, "The simulation request is invalid, top retailers cannot be negative.")
+	}
+
+	if len(validationErrors) > 0 {
+		return errors.New(strings.Join(validationErrors, " | "))
+	}
+	return nil
+}
+
+func (uv *ReceiptValidator) ValidateBackfillID(backfillID string) error {
+	if strings.TrimSpace(backfillID) == "" {
+		return errors.New("please pass in a non-empty id")
+	}
+	if !receiptIDRegex.MatchString(backfillID) {
+		return errors.New("invalid id passed in")
+	}
+	return nil
+}
+
+func (uv *ReceiptValidator) ValidateBackfillRequest(request models.BackfillRequest) error {
+	var validationErrors []string
+
+	if strings.TrimSpace(request.RuleVersion) == "" {
+		validationErrors = append(validationErrors, "The backfill request is invalid, ruleVersion is required.")
+	}
+	if strings.TrimSpace(request.Reason) == "" {
+		validationErrors = append(validationErrors, "The backfill request is invalid, reason is required.")
+	}
+	if strings.TrimSpace(request.Actor) == "" {
+		validationErrors = append(validationErrors, "The backfill request is invalid, actor is required.")
+	}
+	if request.ReceiptsPerSecond < 0 {
+		validationErrors = append(validationErrors, "The backfill request is invalid, receiptsPerSecond cannot be negative.")
+	}
+
+	filter := request.Filter
+	if filter.From != "" && !IsValidPurchaseDate(filter.From) {
+		validationErrors = append(validationErrors, "The backfill request is invalid, bad from date. Must be in YYYY-MM-DD format.")
+	}
+	if filter.To != "" && !IsValidPurchaseDate(filter.To) {
+		validationErrors = append(validationErrors, "The backfill request is invalid, bad to date. Must be in YYYY-MM-DD format.")
+	} else if filter.From != "" && filter.To != "" && filter.To < filter.From {
+		validationErrors = append(validationErrors, "The backfill request is invalid, to date is before from date.")
+	}
+	for i, status := range filter.Statuses {
+		if status != models.StatusApproved && status != models.StatusPending {
+			validationErrors = append(validationErrors, fmt.Sprintf("The backfill request is invalid, status %q at index %d cannot be re-scored. Must be approved or pending.", status, i))
+		}
+	}
+
+	if len(validationErrors) > 0 {
+		return errors.New(strings.Join(validationErrors, " | "))
+	}
+	return nil
+}
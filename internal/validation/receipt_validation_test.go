@@ -1,6 +1,7 @@
 package validation_test
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/javier-tello/receipt-processor-challenge/internal/models"
@@ -54,6 +55,42 @@ func TestValidateReceipt(t *testing.T) {
 			},
 			expectErr: false,
 		},
+		{
+			name: "Valid Time Zone",
+			receipt: models.Receipt{
+				Retailer:     "Retailer 1",
+				PurchaseDate: "2024-12-11",
+				PurchaseTime: "14:30",
+				TimeZone:     "America/Chicago",
+				Total:        "58.01",
+				Items:        validItems,
+			},
+			expectErr: false,
+		},
+		{
+			name: "Valid UTC Offset",
+			receipt: models.Receipt{
+				Retailer:     "Retailer 1",
+				PurchaseDate: "2024-12-11",
+				PurchaseTime: "14:30",
+				TimeZone:     "-05:00",
+				Total:        "58.01",
+				Items:        validItems,
+			},
+			expectErr: false,
+		},
+		{
+			name: "Unknown Time Zone",
+			receipt: models.Receipt{
+				Retailer:     "Retailer 1",
+				PurchaseDate: "2024-12-11",
+				PurchaseTime: "14:30",
+				TimeZone:     "Central",
+				Total:        "58.01",
+				Items:        validItems,
+			},
+			expectErr: true,
+		},
 		{
 			name: "Missing Retailer",
 			receipt: models.Receipt{
@@ -156,3 +193,308 @@ func TestIsValidPurchaseDate(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateVoidRequest(t *testing.T) {
+	validator := &validation.ReceiptValidator{}
+
+	tests := []struct {
+		name      string
+		request   models.VoidRequest
+		expectErr bool
+	}{
+		{"Valid Void Request", models.VoidRequest{Reason: "refund", Actor: "agent-7"}, false},
+		{"Missing Reason", models.VoidRequest{Actor: "agent-7"}, true},
+		{"Missing Actor", models.VoidRequest{Reason: "refund"}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validator.ValidateVoidRequest(test.request)
+			if (err != nil) != test.expectErr {
+				t.Errorf("ValidateVoidRequest(%+v) error = %v, expectErr = %v", test.request, err, test.expectErr)
+			}
+		})
+	}
+}
+
+func TestValidateReturnRequest(t *testing.T) {
+	validator := &validation.ReceiptValidator{}
+
+	tests := []struct {
+		name      string
+		request   models.ReturnRequest
+		expectErr bool
+	}{
+		{"Valid Return Request", models.ReturnRequest{Items: []int{0, 2}, Reason: "damaged", Actor: "agent-7"}, false},
+		{"Missing Items", models.ReturnRequest{Reason: "damaged", Actor: "agent-7"}, true},
+		{"Duplicate Items", models.ReturnRequest{Items: []int{1, 1}, Reason: "damaged", Actor: "agent-7"}, true},
+		{"Missing Reason", models.ReturnRequest{Items: []int{0}, Actor: "agent-7"}, true},
+		{"Missing Actor", models.ReturnRequest{Items: []int{0}, Reason: "damaged"}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validator.ValidateReturnRequest(test.request)
+			if (err != nil) != test.expectErr {
+				t.Errorf("ValidateReturnRequest(%+v) error = %v, expectErr = %v", test.request, err, test.expectErr)
+			}
+		})
+	}
+}
+
+func TestValidateReviewRequest(t *testing.T) {
+	validator := &validation.ReceiptValidator{}
+
+	tests := []struct {
+		name      string
+		request   models.ReviewRequest
+		expectErr bool
+	}{
+		{"Valid Review Request", models.ReviewRequest{Comment: "verified with store", Actor: "reviewer-1"}, false},
+		{"Missing Comment", models.ReviewRequest{Actor: "reviewer-1"}, true},
+		{"Missing Actor", models.ReviewRequest{Comment: "verified with store"}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validator.ValidateReviewRequest(test.request)
+			if (err != nil) != test.expectErr {
+				t.Errorf("ValidateReviewRequest(%+v) error = %v, expectErr = %v", test.request, err, test.expectErr)
+			}
+		})
+	}
+}
+
+func TestValidateRetailer(t *testing.T) {
+	validator := &validation.ReceiptValidator{}
+
+	tests := []struct {
+		name      string
+		retailer  models.Retailer
+		expectErr bool
+	}{
+		{"Valid Retailer", models.Retailer{ID: "target", DisplayName: "Target", Aliases: []string{"TARGET #1234"}, Categories: []string{"general"}}, false},
+		{"Generated ID", models.Retailer{DisplayName: "M&M Corner Market"}, false},
+		{"Bad ID", models.Retailer{ID: "Target Store", DisplayName: "Target"}, true},
+		{"Missing Display Name", models.Retailer{ID: "target"}, true},
+		{"Empty Alias", models.Retailer{DisplayName: "Target", Aliases: []string{" "}}, true},
+		{"Empty Category", models.Retailer{DisplayName: "Target", Categories: []string{""}}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validator.ValidateRetailer(test.retailer)
+			if (err != nil) != test.expectErr {
+				t.Errorf("ValidateRetailer(%+v) error = %v, expectErr = %v", test.retailer, err, test.expectErr)
+			}
+		})
+	}
+}
+
+func TestValidatePromotion(t *testing.T) {
+	validator := &validation.ReceiptValidator{}
+
+	tests := []struct {
+		name      string
+		promotion models.Promotion
+		expectErr bool
+	}{
+		{"Valid Multiplier", models.Promotion{Name: "2x at Walgreens", StartDate: "2022-01-01", EndDate: "2022-01-07", RetailerIDs: []string{"walgreens"}, Multiplier: 2}, false},
+		{"Valid Open Ended Bonus", models.Promotion{Name: "Gatorade", StartDate: "2022-01-01", ItemPattern: "Gatorade", BonusPoints: 100, BudgetPoints: 10000}, false},
+		{"Missing Name", models.Promotion{StartDate: "2022-01-01", BonusPoints: 100}, true},
+		{"Bad Start Date", models.Promotion{Name: "Bonus", StartDate: "01-01-2022", BonusPoints: 100}, true},
+		{"End Before Start", models.Promotion{Name: "Bonus", StartDate: "2022-01-07", EndDate: "2022-01-01", BonusPoints: 100}, true},
+		{"No Reward", models.Promotion{Name: "Bonus", StartDate: "2022-01-01", Multiplier: 1}, true},
+		{"Fractional Multiplier", models.Promotion{Name: "Bonus", StartDate: "2022-01-01", Multiplier: 0.5, BonusPoints: 10}, true},
+		{"Negative Budget", models.Promotion{Name: "Bonus", StartDate: "2022-01-01", BonusPoints: 10, BudgetPoints: -1}, true},
+		{"Bad Retailer ID", models.Promotion{Name: "Bonus", StartDate: "2022-01-01", BonusPoints: 10, RetailerIDs: []string{"Walgreens"}}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validator.ValidatePromotion(test.promotion)
+			if (err != nil) != test.expectErr {
+				t.Errorf("ValidatePromotion(%+v) error = %v, expectErr = %v", test.promotion, err, test.expectErr)
+			}
+		})
+	}
+}
+
+func TestValidateWebhookSubscription(t *testing.T) {
+	validator := &validation.ReceiptValidator{}
+
+	tests := []struct {
+		name      string
+		request   models.WebhookSubscriptionRequest
+		expectErr bool
+	}{
+		{"Valid All Events", models.WebhookSubscriptionRequest{URL: "https://partner.example.com/hooks"}, false},
+		{"Valid Some Events", models.WebhookSubscriptionRequest{URL: "http://partner.example.com:8080/hooks", Events: []models.WebhookEvent{models.EventReceiptScored, models.EventReceiptVoided}}, false},
+		{"Valid Public Address", models.WebhookSubscriptionRequest{URL: "https://203.0.113.10/hooks"}, false},
+		{"Localhost", models.WebhookSubscriptionRequest{URL: "http://localhost:8080/hooks"}, true},
+		{"Loopback Address", models.WebhookSubscriptionRequest{URL: "http://127.0.0.1/hooks"}, true},
+		{"Loopback IPv6 Address", models.WebhookSubscriptionRequest{URL: "http://[::1]/hooks"}, true},
+		{"Mapped Loopback Address", models.WebhookSubscriptionRequest{URL: "http://[::ffff:127.0.0.1]/hooks"}, true},
+		{"Unspecified Address", models.WebhookSubscriptionRequest{URL: "http://0.0.0.0/hooks"}, true},
+		{"Link-Local Address", models.WebhookSubscriptionRequest{URL: "http://169.254.169.254/latest/meta-data"}, true},
+		{"Private Address", models.WebhookSubscriptionRequest{URL: "https://10.0.0.5/hooks"}, true},
+		{"Private IPv6 Address", models.WebhookSubscriptionRequest{URL: "https://[fd00::1]/hooks"}, true},
+		{"Carrier-Grade NAT Address", models.WebhookSubscriptionRequest{URL: "https://100.64.0.1/hooks"}, true},
+		{"Missing URL", models.WebhookSubscriptionRequest{}, true},
+		{"Relative URL", models.WebhookSubscriptionRequest{URL: "/hooks"}, true},
+		{"Unsupported Scheme", models.WebhookSubscriptionRequest{URL: "ftp://partner.example.com/hooks"}, true},
+		{"Unknown Event", models.WebhookSubscriptionRequest{URL: "https://partner.example.com/hooks", Events: []models.WebhookEvent{"receipt.deleted"}}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validator.ValidateWebhookSubscription(test.request)
+			if (err != nil) != test.expectErr {
+				t.Errorf("ValidateWebhookSubscription(%+v) error = %v, expectErr = %v", test.request, err, test.expectErr)
+			}
+		})
+	}
+}
+
+func TestValidateReportQuery(t *testing.T) {
+	validator := &validation.ReceiptValidator{}
+
+	tests := []struct {
+		name      string
+		query     models.ReportQuery
+		expectErr bool
+	}{
+		{"Valid Unbounded", models.ReportQuery{GroupBy: models.DimensionRetailer}, false},
+		{"Valid Range", models.ReportQuery{GroupBy: models.DimensionHour, From: "2022-01-01", To: "2022-01-31"}, false},
+		{"Valid Single Day", models.ReportQuery{GroupBy: models.DimensionWeekday, From: "2022-01-01", To: "2022-01-01"}, false},
+		{"Unknown Dimension", models.ReportQuery{GroupBy: "month"}, true},
+		{"Bad From Date", models.ReportQuery{GroupBy: models.DimensionDate, From: "01/01/2022"}, true},
+		{"Bad To Date", models.ReportQuery{GroupBy: models.DimensionDate, To: "2022-02-30"}, true},
+		{"Reversed Range", models.ReportQuery{GroupBy: models.DimensionDate, From: "2022-02-01", To: "2022-01-01"}, true},
+		{"Valid Time Zone", models.ReportQuery{GroupBy: models.DimensionHour, TimeZone: "America/New_York"}, false},
+		{"Valid Offset", models.ReportQuery{GroupBy: models.DimensionHour, TimeZone: "-05:00"}, false},
+		{"Unknown Time Zone", models.ReportQuery{GroupBy: models.DimensionHour, TimeZone: "Eastern"}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validator.ValidateReportQuery(test.query)
+			if (err != nil) != test.expectErr {
+				t.Errorf("ValidateReportQuery(%+v) error = %v, expectErr = %v", test.query, err, test.expectErr)
+			}
+		})
+	}
+}
+
+func TestValidateRuleSimulation(t *testing.T) {
+	validator := &validation.ReceiptValidator{}
+	rules := func(change func(*models.RuleConfig)) models.RuleConfig {
+		rules := models.RuleConfig{
+			PointsPerRetailerCharacter: 1,
+			PointsForRoundDollar:       50,
+			PointsForQuarterMultiple:   25,
+			PointsPerItemPair:          5,
+			DescriptionLengthMultiple:  3,
+			DescriptionPriceMultiplier: 0.2,
+			PointsForOddDay:            6,
+			PointsForTimeWindow:        10,
+			TimeWindowStart:            "14:00",
+			TimeWindowEnd:              "18:00",
+		}
+		change(&rules)
+		return rules
+	}
+
+	tests := []struct {
+		name      string
+		request   models.RuleSimulationRequest
+		expectErr bool
+	}{
+		{"Valid", models.RuleSimulationRequest{Rules: rules(func(r *models.RuleConfig) {})}, false},
+		{"Valid Sample", models.RuleSimulationRequest{Rules: rules(func(r *models.RuleConfig) { r.PointsForRoundDollar = 0 }), SampleSize: 100, Seed: 7, TopRetailers: 3}, false},
+		{"Negative Points", models.RuleSimulationRequest{Rules: rules(func(r *models.RuleConfig) { r.PointsPerItemPair = -5 })}, true},
+		{"Zero Description Multiple", models.RuleSimulationRequest{Rules: rules(func(r *models.RuleConfig) { r.DescriptionLengthMultiple = 0 })}, true},
+		{"Negative Price Multiplier", models.RuleSimulationRequest{Rules: rules(func(r *models.RuleConfig) { r.DescriptionPriceMultiplier = -0.2 })}, true},
+		{"Bad Window Start", models.RuleSimulationRequest{Rules: rules(func(r *models.RuleConfig) { r.TimeWindowStart = "2pm" })}, true},
+		{"Reversed Window", models.RuleSimulationRequest{Rules: rules(func(r *models.RuleConfig) { r.TimeWindowStart, r.TimeWindowEnd = "18:00", "14:00" })}, true},
+		{"Negative Sample Size", models.RuleSimulationRequest{Rules: rules(func(r *models.RuleConfig) {}), SampleSize: -1}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validator.ValidateRuleSimulation(test.request)
+			if (err != nil) != test.expectErr {
+				t.Errorf("ValidateRuleSimulation(%+v) error = %v, expectErr = %v", test.request, err, test.expectErr)
+			}
+		})
+	}
+}
+
+func TestValidateBackfillRequest(t *testing.T) {
+	validator := &validation.ReceiptValidator{}
+
+	valid := models.BackfillRequest{RuleVersion: "v2", Reason: "time window fix", Actor: "ops-1"}
+	request := func(change func(*models.BackfillRequest)) models.BackfillRequest {
+		r := valid
+		change(&r)
+		return r
+	}
+
+	tests := []struct {
+		name      string
+		request   models.BackfillRequest
+		expectErr bool
+	}{
+		{"Valid", valid, false},
+		{"Valid Filter", request(func(r *models.BackfillRequest) {
+			r.Filter = models.BackfillFilter{From: "2022-01-01", To: "2022-01-31", Retailer: "Target", RuleVersions: []string{"v1"}, Statuses: []models.ReceiptStatus{models.StatusApproved}}
+			r.ReceiptsPerSecond = 0.5
+		}), false},
+		{"Missing Rule Version", request(func(r *models.BackfillRequest) { r.RuleVersion = " " }), true},
+		{"Missing Reason", request(func(r *models.BackfillRequest) { r.Reason = "" }), true},
+		{"Missing Actor", request(func(r *models.BackfillRequest) { r.Actor = "" }), true},
+		{"Negative Rate", request(func(r *models.BackfillRequest) { r.ReceiptsPerSecond = -1 }), true},
+		{"Bad From Date", request(func(r *models.BackfillRequest) { r.Filter.From = "01-01-2022" }), true},
+		{"To Before From", request(func(r *models.BackfillRequest) { r.Filter.From, r.Filter.To = "2022-02-01", "2022-01-01" }), true},
+		{"Voided Status", request(func(r *models.BackfillRequest) { r.Filter.Statuses = []models.ReceiptStatus{models.StatusVoided} }), true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validator.ValidateBackfillRequest(test.request)
+			if (err != nil) != test.expectErr {
+				t.Errorf("ValidateBackfillRequest(%+v) error = %v, expectErr = %v", test.request, err, test.expectErr)
+			}
+		})
+	}
+}
+
+func TestValidateReceipt_FieldErrors(t *testing.T) {
+	validator := &validation.ReceiptValidator{}
+
+	err := validator.ValidateReceipt(models.Receipt{
+		PurchaseDate: "2024-13-11",
+		PurchaseTime: "14:30",
+		Total:        "58.01",
+		Items:        []models.Item{{ShortDescription: "Item 1", Price: "12.3"}},
+	})
+
+	var fieldErrors validation.ValidationErrors
+	if !errors.As(err, &fieldErrors) {
+		t.Fatalf("Expected ValidationErrors, got %T", err)
+	}
+
+	expected := []validation.FieldError{
+		{Field: "retailer", Code: validation.CodeRequired},
+		{Field: "purchaseDate", Code: validation.CodeFormat},
+		{Field: "items[0].price", Code: validation.CodeFormat},
+	}
+	if len(fieldErrors) != len(expected) {
+		t.Fatalf("Expected %d field errors, got %+v", len(expected), fieldErrors)
+	}
+	for i, fieldError := range fieldErrors {
+		if fieldError.Field != expected[i].Field || fieldError.Code != expected[i].Code {
+			t.Errorf("Expected %s/%s, got %s/%s", expected[i].Field, expected[i].Code, fieldError.Field, fieldError.Code)
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/logging"
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+	"github.com/javier-tello/receipt-processor-challenge/internal/repositories"
+	"github.com/javier-tello/receipt-processor-challenge/internal/validation"
+)
+
+// Headers sent with every delivery. Receivers verify the signature with Verify, or by computing
+// the HMAC-SHA256 of "<timestamp>.<body>" keyed with the subscription secret.
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+const (
+	DefaultMaxAttempts  = 8
+	DefaultBaseBackoff  = 5 * time.Second
+	DefaultMaxBackoff   = time.Hour
+	DefaultPollInterval = time.Second
+	DefaultTimeout      = 10 * time.Second
+	DefaultConcurrency  = 8
+)
+
+// Worker sends queued webhook deliveries, retrying failures with exponential backoff until
+// MaxAttempts is reached and the delivery is dead-lettered. Each subscription's deliveries are
+// sent in order, one at a time, and up to Concurrency subscriptions are sent to at once, so a
+// slow receiver holds up only its own deliveries.
+type Worker struct {
+	Client       *http.Client
+	MaxAttempts  int
+	BaseBackoff  time.Duration
+	MaxBackoff   time.Duration
+	PollInterval time.Duration
+	Concurrency  int
+	repo         repositories.WebhookRepository
+	now          func() time.Time
+	logger       *slog.Logger
+	sending      map[string]bool
+	slots        chan struct{}
+	slotsOnce    sync.Once
+	mu           sync.Mutex
+}
+
+func NewWorker(repo repositories.WebhookRepository, logger *slog.Logger) *Worker {
+	return &Worker{
+		Client:       newClient(),
+		MaxAttempts:  DefaultMaxAttempts,
+		BaseBackoff:  DefaultBaseBackoff,
+		MaxBackoff:   DefaultMaxBackoff,
+		PollInterval: DefaultPollInterval,
+		Concurrency:  DefaultConcurrency,
+		repo:         repo,
+		now:          time.Now,
+		logger:       logging.OrDefault(logger),
+		sending:      make(map[string]bool),
+	}
+}
+
+// errInternalAddress is returned when a receiver's address is one webhooks may not be sent to
+var errInternalAddress = errors.New("receiver address is internal")
+
+// newClient returns the client deliveries are sent with. Subscription URLs are checked when
+// created, but a host name may resolve to any address, so the address is checked again on every
+// connection. Redirects are not followed, so a receiver cannot send a delivery on elsewhere; the
+// redirect is its response and fails the attempt. Proxies are not used, as a proxy's address is
+// what would be checked rather than the receiver's.
+func newClient() *http.Client {
+	dialer := &net.Dialer{Timeout: DefaultTimeout, Control: refuseInternal}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   DefaultTimeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// refuseInternal stops a connection to an internal address once the receiver's name is resolved.
+func refuseInternal(network string, address string, conn syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if validation.IsInternalAddr(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", errInternalAddress, addrPort.Addr())
+	}
+	return nil
+}
+
+// Run delivers due webhooks every PollInterval until ctx is cancelled, then waits for the
+// deliveries under way. A poll does not wait for the one before it, which skips the
+// subscriptions still being sent to.
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.PollInterval)
+	defer ticker.Stop()
+
+	var polls sync.WaitGroup
+	defer polls.Wait()
+	for {
+		polls.Add(1)
+		go func() {
+			defer polls.Done()
+			w.DeliverDue(ctx)
+		}()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverDue attempts every pending delivery whose next attempt is due and returns how many
+// were delivered. Subscriptions already being sent to by another call are skipped.
+func (w *Worker) DeliverDue(ctx context.Context) int {
+	now := w.now()
+	var subscriptionIDs []string
+	queues := make(map[string][]string)
+	for _, delivery := range w.repo.FindDeliveriesByStatus(models.DeliveryPending) {
+		if delivery.NextAttemptAt.After(now) {
+			continue
+		}
+		if _, queued := queues[delivery.SubscriptionID]; !queued {
+			subscriptionIDs = append(subscriptionIDs, delivery.SubscriptionID)
+		}
+		queues[delivery.SubscriptionID] = append(queues[delivery.SubscriptionID], delivery.ID)
+	}
+
+	var delivered atomic.Int64
+	var senders sync.WaitGroup
+	for _, subscriptionID := range subscriptionIDs {
+		if !w.claim(ctx, subscriptionID) {
+			continue
+		}
+		senders.Add(1)
+		go func() {
+			defer senders.Done()
+			defer w.release(subscriptionID)
+			delivered.Add(int64(w.sendQueue(ctx, queues[subscriptionID], now)))
+		}()
+	}
+	senders.Wait()
+	return int(delivered.Load())
+}
+
+// sendQueue attempts a subscription's deliveries in order and returns how many were delivered.
+// Each is read again first, as another call may have attempted it since it was queued.
+func (w *Worker) sendQueue(ctx context.Context, deliveryIDs []string, now time.Time) int {
+	delivered := 0
+	for _, deliveryID := range deliveryIDs {
+		if ctx.Err() != nil {
+			break
+		}
+		delivery, exists := w.repo.FindDelivery(deliveryID)
+		if !exists || delivery.Status != models.DeliveryPending || delivery.NextAttemptAt.After(now) {
+			continue
+		}
+		if w.attempt(ctx, delivery) {
+			delivered++
+		}
+	}
+	return delivered
+}
+
+// claim reserves a subscription and a slot to send to it from, waiting for a slot if all
+// Concurrency are taken. It reports false if the subscription is already being sent to or ctx
+// is cancelled while waiting.
+func (w *Worker) claim(ctx context.Context, subscriptionID string) bool {
+	w.slotsOnce.Do(func() { w.slots = make(chan struct{}, max(w.Concurrency, 1)) })
+
+	w.mu.Lock()
+	if w.sending[subscriptionID] {
+		w.mu.Unlock()
+		return false
+	}
+	w.sending[subscriptionID] = true
+	w.mu.Unlock()
+
+	select {
+	case w.slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		w.mu.Lock()
+		delete(w.sending, subscriptionID)
+		w.mu.Unlock()
+		return false
+	}
+}
+
+// release frees a subscription and its slot once its deliveries have been attempted.
+func (w *Worker) release(subscriptionID string) {
+	<-w.slots
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.sending, subscriptionID)
+}
+
+// attempt sends a delivery once and records the outcome.
+func (w *Worker) attempt(ctx context.Context, delivery models.WebhookDelivery) bool {
+	logger := w.logger.With("delivery_id", delivery.ID, "subscription_id", delivery.SubscriptionID, "event", delivery.Event)
+
+	subscription, exists := w.repo.FindSubscription(delivery.SubscriptionID)
+	if !exists {
+		delivery.Status = models.DeliveryFailed
+		delivery.LastError = "subscription deleted"
+		w.repo.UpdateDelivery(delivery)
+		logger.InfoContext(ctx, "Webhook delivery abandoned, the subscription was deleted")
+		return false
+	}
+
+	delivery.Attempts++
+	err := w.send(ctx, subscription, delivery)
+	now := w.now().UTC()
+	if err == nil {
+		delivery.Status = models.DeliveryDelivered
+		delivery.LastError = ""
+		delivery.DeliveredAt = &now
+		w.repo.UpdateDelivery(delivery)
+		logger.InfoContext(ctx, "Webhook delivered", "attempts", delivery.Attempts)
+		return true
+	}
+
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= w.MaxAttempts {
+		delivery.Status = models.DeliveryFailed
+		w.repo.UpdateDelivery(delivery)
+		logger.WarnContext(ctx, "Webhook delivery failed, moved to the dead-letter list", "attempts", delivery.Attempts, "error", err)
+		return false
+	}
+
+	delivery.NextAttemptAt = now.Add(w.backoff(delivery.Attempts))
+	w.repo.UpdateDelivery(delivery)
+	logger.InfoContext(ctx, "Webhook delivery failed, will retry", "attempts", delivery.Attempts, "next_attempt_at", delivery.NextAttemptAt, "error", err)
+	return false
+}
+
+func (w *Worker) send(ctx context.Context, subscription models.WebhookSubscription, delivery models.WebhookDelivery) error {
+	timestamp := strconv.FormatInt(w.now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, string(delivery.Event))
+	req.Header.Set(DeliveryHeader, delivery.ID)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(subscription.Secret, timestamp, delivery.Payload))
+
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("receiver responded %s", resp.Status)
+	}
+	return nil
+}
+
+// backoff doubles the wait after every failed attempt, up to MaxBackoff.
+func (w *Worker) backoff(attempts int) time.Duration {
+	wait := w.BaseBackoff
+	for i := 1; i < attempts; i++ {
+		wait *= 2
+		if wait >= w.MaxBackoff {
+			return w.MaxBackoff
+		}
+	}
+	return min(wait, w.MaxBackoff)
+}
+
+// Sign returns the signature sent in the X-Webhook-Signature header.
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is the signature of the timestamp and body.
+func Verify(secret string, timestamp string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
@@ -0,0 +1,242 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/javier-tello/receipt-processor-challenge/internal/models"
+	"github.com/javier-tello/receipt-processor-challenge/internal/repositories"
+	"github.com/javier-tello/receipt-processor-challenge/internal/services"
+)
+
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+}
+
+// newTestWorker delivers to httptest receivers, which listen on loopback where the worker's own
+// client refuses to connect
+func newTestWorker(repo repositories.WebhookRepository) *Worker {
+	worker := NewWorker(repo, nil)
+	worker.Client = &http.Client{Timeout: DefaultTimeout}
+	return worker
+}
+
+func TestWorker_DeliversSignedNotification(t *testing.T) {
+	received := make(chan receivedWebhook, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- receivedWebhook{header: r.Header, body: body}
+	}))
+	defer receiver.Close()
+
+	repo := repositories.NewInMemoryWebhookRepo(nil)
+	webhookService := services.NewWebhookService(repo, nil)
+	subscription, err := webhookService.CreateSubscription(models.WebhookSubscriptionRequest{URL: receiver.URL, Events: []models.WebhookEvent{models.EventReceiptScored}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	receiptService := services.NewReceiptService(repositories.NewInMemoryReceiptRepo(nil, nil), services.WithNotifier(webhookService))
+	receiptID, err := receiptService.ProcessReceipt(context.Background(), models.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-01",
+		PurchaseTime: "13:01",
+		Total:        "35.35",
+		Items:        []models.Item{{ShortDescription: "Mountain Dew 12PK", Price: "6.49"}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if delivered := newTestWorker(repo).DeliverDue(context.Background()); delivered != 1 {
+		t.Fatalf("Expected 1 delivery, got %d", delivered)
+	}
+
+	webhook := <-received
+	if !Verify(subscription.Secret, webhook.header.Get(TimestampHeader), webhook.body, webhook.header.Get(SignatureHeader)) {
+		t.Errorf("Expected a valid signature, got %q", webhook.header.Get(SignatureHeader))
+	}
+	if event := webhook.header.Get(EventHeader); event != string(models.EventReceiptScored) {
+		t.Errorf("Expected event %s, got %s", models.EventReceiptScored, event)
+	}
+
+	var notification models.ReceiptNotification
+	if err := json.Unmarshal(webhook.body, &notification); err != nil {
+		t.Fatalf("Failed to parse webhook body: %v", err)
+	}
+	if notification.ReceiptID != receiptID || notification.Status != models.StatusApproved || notification.Points != 12 {
+		t.Errorf("Unexpected notification: %+v", notification)
+	}
+}
+
+func TestWorker_RetriesThenDeadLetters(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	attempts := 0
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if failing.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer receiver.Close()
+
+	repo := repositories.NewInMemoryWebhookRepo(nil)
+	webhookService := services.NewWebhookService(repo, nil)
+	if _, err := webhookService.CreateSubscription(models.WebhookSubscriptionRequest{URL: receiver.URL}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	webhookService.Notify(context.Background(), models.ReceiptNotification{Event: models.EventReceiptVoided, ReceiptID: "receipt-1"})
+
+	clock := time.Now()
+	worker := newTestWorker(repo)
+	worker.MaxAttempts = 3
+	worker.BaseBackoff = time.Minute
+	worker.now = func() time.Time { return clock }
+
+	worker.DeliverDue(context.Background())
+	worker.DeliverDue(context.Background())
+	if attempts != 1 {
+		t.Fatalf("Expected the retry to wait for its backoff, got %d attempts", attempts)
+	}
+
+	// Backoff doubles: 1 minute after the first failure, 2 after the second
+	clock = clock.Add(time.Minute)
+	worker.DeliverDue(context.Background())
+	clock = clock.Add(2 * time.Minute)
+	worker.DeliverDue(context.Background())
+	if attempts != 3 {
+		t.Fatalf("Expected 3 attempts, got %d", attempts)
+	}
+
+	deadLetters := webhookService.GetDeadLetters()
+	if len(deadLetters) != 1 || deadLetters[0].Attempts != 3 || deadLetters[0].LastError == "" {
+		t.Fatalf("Expected one dead letter after 3 attempts, got %+v", deadLetters)
+	}
+
+	failing.Store(false)
+	if _, err := webhookService.Redeliver(deadLetters[0].ID); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if delivered := worker.DeliverDue(context.Background()); delivered != 1 {
+		t.Errorf("Expected the redelivery to succeed, got %d deliveries", delivered)
+	}
+	if len(webhookService.GetDeadLetters()) != 0 {
+		t.Errorf("Expected the dead-letter list to be empty after redelivery")
+	}
+}
+
+func TestWorker_Backoff(t *testing.T) {
+	worker := NewWorker(nil, nil)
+	worker.BaseBackoff = time.Second
+	worker.MaxBackoff = 10 * time.Second
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for i, wait := range expected {
+		if got := worker.backoff(i + 1); got != wait {
+			t.Errorf("Expected a backoff of %s after %d attempts, got %s", wait, i+1, got)
+		}
+	}
+}
+
+func TestWorker_SlowReceiverHoldsUpOnlyItsOwnDeliveries(t *testing.T) {
+	release := make(chan struct{})
+	var slowAttempts atomic.Int32
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slowAttempts.Add(1)
+		<-release
+	}))
+	defer slow.Close()
+	received := make(chan struct{}, 1)
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+	}))
+	defer fast.Close()
+
+	repo := repositories.NewInMemoryWebhookRepo(nil)
+	webhookService := services.NewWebhookService(repo, nil)
+	for _, url := range []string{slow.URL, fast.URL} {
+		if _, err := webhookService.CreateSubscription(models.WebhookSubscriptionRequest{URL: url}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	webhookService.Notify(context.Background(), models.ReceiptNotification{Event: models.EventReceiptVoided, ReceiptID: "receipt-1"})
+
+	worker := newTestWorker(repo)
+	done := make(chan int)
+	go func() { done <- worker.DeliverDue(context.Background()) }()
+
+	select {
+	case <-received:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the fast receiver to be sent to while the slow one is still responding")
+	}
+
+	// A later poll leaves the slow receiver's delivery to the send already under way
+	worker.DeliverDue(context.Background())
+	close(release)
+	if delivered := <-done; delivered != 2 {
+		t.Errorf("Expected 2 deliveries, got %d", delivered)
+	}
+	if attempts := slowAttempts.Load(); attempts != 1 {
+		t.Errorf("Expected the slow receiver to be sent to once, got %d", attempts)
+	}
+}
+
+func TestWorker_RefusesInternalAddresses(t *testing.T) {
+	var reached atomic.Bool
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached.Store(true)
+	}))
+	defer receiver.Close()
+
+	// Stored directly, as validation rejects localhost by name, to stand in for any name resolving to loopback
+	repo := repositories.NewInMemoryWebhookRepo(nil)
+	subscriptionID := repo.CreateSubscription(models.WebhookSubscription{URL: strings.Replace(receiver.URL, "127.0.0.1", "localhost", 1), Events: models.WebhookEvents})
+	deliveryID := repo.CreateDelivery(models.WebhookDelivery{SubscriptionID: subscriptionID, Event: models.EventReceiptVoided, Status: models.DeliveryPending})
+
+	if delivered := NewWorker(repo, nil).DeliverDue(context.Background()); delivered != 0 {
+		t.Errorf("Expected nothing delivered, got %d", delivered)
+	}
+	if reached.Load() {
+		t.Errorf("Expected the loopback receiver not to be reached")
+	}
+	if delivery, _ := repo.FindDelivery(deliveryID); !strings.Contains(delivery.LastError, errInternalAddress.Error()) {
+		t.Errorf("Expected the delivery to fail on the internal address, got %q", delivery.LastError)
+	}
+}
+
+func TestWorker_DoesNotFollowRedirects(t *testing.T) {
+	var reached atomic.Bool
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached.Store(true)
+	}))
+	defer internal.Close()
+	receiver := httptest.NewServer(http.RedirectHandler(internal.URL, http.StatusFound))
+	defer receiver.Close()
+
+	repo := repositories.NewInMemoryWebhookRepo(nil)
+	subscriptionID := repo.CreateSubscription(models.WebhookSubscription{URL: receiver.URL, Events: models.WebhookEvents})
+	deliveryID := repo.CreateDelivery(models.WebhookDelivery{SubscriptionID: subscriptionID, Event: models.EventReceiptVoided, Status: models.DeliveryPending})
+
+	// The worker's own client, allowed onto loopback so that the redirect is what is refused
+	worker := NewWorker(repo, nil)
+	worker.Client.Transport = http.DefaultTransport
+	if delivered := worker.DeliverDue(context.Background()); delivered != 0 {
+		t.Errorf("Expected nothing delivered, got %d", delivered)
+	}
+	if reached.Load() {
+		t.Errorf("Expected the redirect not to be followed")
+	}
+	if delivery, _ := repo.FindDelivery(deliveryID); !strings.Contains(delivery.LastError, "302") {
+		t.Errorf("Expected the redirect to fail the attempt, got %q", delivery.LastError)
+	}
+}
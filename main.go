@@ -1,36 +1,336 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/gorilla/mux"
 
+	"github.com/javier-tello/receipt-processor-challenge/internal/calendar"
+	"github.com/javier-tello/receipt-processor-challenge/internal/config"
+	"github.com/javier-tello/receipt-processor-challenge/internal/events"
+	"github.com/javier-tello/receipt-processor-challenge/internal/expr"
+	"github.com/javier-tello/receipt-processor-challenge/internal/fraud"
 	"github.com/javier-tello/receipt-processor-challenge/internal/handlers"
+	"github.com/javier-tello/receipt-processor-challenge/internal/logging"
+	"github.com/javier-tello/receipt-processor-challenge/internal/metrics"
+	"github.com/javier-tello/receipt-processor-challenge/internal/ratelimit"
+	"github.com/javier-tello/receipt-processor-challenge/internal/reporting"
 	"github.com/javier-tello/receipt-processor-challenge/internal/repositories"
+	"github.com/javier-tello/receipt-processor-challenge/internal/rules"
 	"github.com/javier-tello/receipt-processor-challenge/internal/services"
+	"github.com/javier-tello/receipt-processor-challenge/internal/stream"
+	"github.com/javier-tello/receipt-processor-challenge/internal/tracing"
 	"github.com/javier-tello/receipt-processor-challenge/internal/validation"
+	"github.com/javier-tello/receipt-processor-challenge/internal/webhooks"
 )
 
 func main() {
+	cfg, err := config.Load(os.Args[1:], os.LookupEnv, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading configuration: %v\n", err)
+		os.Exit(2)
+	}
+
+	logger, err := logging.New(os.Stdout, cfg.LogLevel, cfg.LogFormat)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error configuring logger: %v\n", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
+	logger.Info("Effective configuration", "config", cfg.Redacted())
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.TraceExporter, cfg.TraceFile)
+	if err != nil {
+		logger.Error("Error configuring tracing", "error", err)
+		os.Exit(1)
+	}
+
+	appMetrics := metrics.New()
 	receiptValidator := validation.ReceiptValidator{}
-	receiptRepo := repositories.NewInMemoryReceiptRepo(nil)
-	receiptService := services.NewReceiptService(receiptRepo)
-	receiptHandler := handlers.NewReceiptHandler(receiptService, receiptValidator)
+	retailerRepo := repositories.NewInMemoryRetailerRepo()
+	retailerService := services.NewRetailerService(retailerRepo, logger)
+	retailerHandler := handlers.NewRetailerHandler(retailerService, receiptValidator, logger)
+
+	promotionRepo := repositories.NewInMemoryPromotionRepo(nil)
+	promotionService := services.NewPromotionService(promotionRepo, logger)
+	promotionHandler := handlers.NewPromotionHandler(promotionService, receiptValidator, logger)
+
+	webhookRepo := repositories.NewInMemoryWebhookRepo(nil)
+	webhookService := services.NewWebhookService(webhookRepo, logger)
+	webhookHandler := handlers.NewWebhookHandler(webhookService, receiptValidator, logger)
+
+	storage, err := newReceiptRepository(cfg, logger)
+	if err != nil {
+		logger.Error("Error configuring storage", "error", err)
+		os.Exit(1)
+	}
+	ruleFile, err := rules.Load(cfg.RulesFile)
+	if err != nil {
+		logger.Error("Error loading rules", "error", err)
+		os.Exit(1)
+	}
+	calendarRules, err := newCalendar(cfg, ruleFile)
+	if err != nil {
+		logger.Error("Error loading calendar rules", "error", err)
+		os.Exit(1)
+	}
+	expressionRules, err := expr.New(ruleFile.Expressions)
+	if err != nil {
+		logger.Error("Error compiling expression rules", "error", err)
+		os.Exit(1)
+	}
+	logger.Info("Rules loaded", "calendar_rules", calendarRules.Rules(), "expression_rules", expressionRules.Rules())
+
+	receiptRepo := metrics.NewInstrumentedReceiptRepo(tracing.NewTracedReceiptRepo(storage), appMetrics)
+	receiptService := services.NewReceiptService(receiptRepo,
+		services.WithLogger(logger),
+		services.WithFraudEngine(fraud.DefaultEngine()),
+		services.WithRetailerResolver(retailerService),
+		services.WithPromotions(promotionService),
+		services.WithScoreObserver(appMetrics),
+		services.WithNotifier(webhookService),
+		services.WithDefaultTimeZone(cfg.DefaultTimeZone),
+		services.WithCalendar(calendarRules),
+		services.WithExpressions(expressionRules),
+		services.WithPointsCaps(services.PointsCaps{
+			PerRule:          cfg.MaxPointsPerRule,
+			PerReceipt:       cfg.MaxPointsPerReceipt,
+			PerCustomerDay:   cfg.MaxPointsPerCustomerDay,
+			PerCustomerMonth: cfg.MaxPointsPerCustomerMonth,
+		}),
+	)
+	receiptHandler := handlers.NewReceiptHandler(receiptService, receiptValidator, logger)
+	receiptHandler.Metrics = appMetrics
+	receiptHandler.Timeout = cfg.RequestTimeout
+	receiptHandler.RateLimiter = ratelimit.New(cfg.RateLimitRPS, cfg.RateLimitBurst)
+	receiptHandler.MaxBodyBytes = cfg.MaxBodyBytes
+	receiptHandler.MaxItems = cfg.MaxItems
+	receiptHandler.Activity = stream.New(stream.DefaultHistory, stream.DefaultSubscriberBuffer)
+
+	reports := reporting.NewService(receiptRepo, receiptService, logger)
+	reports.Policy = reporting.LiabilityPolicy{PointValue: cfg.PointValue, ExpiryMonths: cfg.PointsExpiryMonths, BreakageRate: cfg.BreakageRate}
+	reportHandler := handlers.NewReportHandler(reports, receiptValidator, logger)
+
+	backfillService := services.NewBackfillService(receiptService, repositories.NewInMemoryBackfillRepo(nil), logger)
+	backfillHandler := handlers.NewBackfillHandler(backfillService, receiptValidator, logger)
+
+	router := setupRouter(receiptHandler, retailerHandler, promotionHandler, webhookHandler, reportHandler, backfillHandler, handlers.NewConfigHandler(cfg), appMetrics, logger)
+
+	healthHandler := handlers.NewHealthHandler(logger)
+	if pinger, ok := storage.(repositories.Pinger); ok {
+		healthHandler.AddCheck("repository", pinger.Ping)
+	}
+	healthHandler.AddCheck("rules", rulesCheck(cfg.RulesFile))
+
+	eventBus := events.NewBus()
+	eventBus.Subscribe(func(ctx context.Context, event events.Event) error {
+		logger.DebugContext(ctx, "Receipt event published", "event_id", event.ID, "type", event.Type, "receipt_id", event.ReceiptID)
+		return nil
+	})
+	relay, closeSinks, err := newEventRelay(cfg, storage, eventBus, logger)
+	if err != nil {
+		logger.Error("Error configuring event sinks", "error", err)
+		os.Exit(1)
+	}
+	defer closeSinks()
+
+	workerCtx, stopWorker := context.WithCancel(context.Background())
+	go webhooks.NewWorker(webhookRepo, logger).Run(workerCtx)
+	go backfillService.Run(workerCtx)
+	if relay != nil {
+		go relay.Run(workerCtx)
+	}
+
+	server := newServer(cfg, withProbes(router, healthHandler), logger)
+	server.RegisterOnShutdown(receiptHandler.Activity.Close)
+	serveErr := serve(server, cfg, healthHandler, logger)
+	stopWorker()
+	if err := shutdownTracing(context.Background()); err != nil {
+		logger.Error("Error flushing traces", "error", err)
+	}
+	if serveErr != nil {
+		logger.Error("Server stopped with an error", "error", serveErr)
+		os.Exit(1)
+	}
+}
 
-	router := setupRouter(receiptHandler)
+func newServer(cfg config.Config, handler http.Handler, logger *slog.Logger) *http.Server {
+	return &http.Server{
+		Addr:              cfg.ListenAddr,
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.ReadTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelWarn),
+	}
+}
+
+// withProbes serves the orchestrator's probes ahead of the router, keeping them out of
+// access logs, traces and request metrics.
+func withProbes(router http.Handler, healthHandler *handlers.HealthHandler) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", healthHandler.Liveness)
+	mux.HandleFunc("GET /readyz", healthHandler.Readiness)
+	mux.Handle("/", router)
+	return mux
+}
+
+// serve runs the server until SIGINT or SIGTERM, then stops reporting ready and gives
+// in-flight requests the configured grace period to finish.
+func serve(server *http.Server, cfg config.Config, healthHandler *handlers.HealthHandler, logger *slog.Logger) error {
+	stop, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		logger.Info("Starting receipt-processor-challenge simple web server", "addr", cfg.ListenAddr, "tls", cfg.TLSCertFile != "")
+		if cfg.TLSCertFile != "" {
+			serverErr <- server.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+		} else {
+			serverErr <- server.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err := <-serverErr:
+		return err
+	case <-stop.Done():
+	}
+
+	logger.Info("Shutting down, draining in-flight requests", "grace_period", cfg.ShutdownGrace.String())
+	healthHandler.Drain()
+
+	ctx, cancelGrace := context.WithTimeout(context.Background(), cfg.ShutdownGrace)
+	defer cancelGrace()
+	if err := server.Shutdown(ctx); err != nil {
+		server.Close()
+		return fmt.Errorf("requests still in flight after %s: %w", cfg.ShutdownGrace, err)
+	}
+
+	logger.Info("Server stopped")
+	return nil
+}
+
+// rulesCheck reports the rules file unreadable, if one is configured.
+func rulesCheck(path string) handlers.ReadinessCheck {
+	return func(ctx context.Context) error {
+		if path == "" {
+			return nil
+		}
+		_, err := os.Stat(path)
+		return err
+	}
+}
+
+// newCalendar compiles the calendar rules in the rules file against the holiday calendar.
+func newCalendar(cfg config.Config, file rules.File) (*calendar.Engine, error) {
+	var holidays []calendar.Holiday
+	if cfg.HolidaysFile != "" {
+		var err error
+		if holidays, err = calendar.LoadHolidays(cfg.HolidaysFile); err != nil {
+			return nil, err
+		}
+	}
+	return calendar.New(file.Calendar, holidays)
+}
+
+// newReceiptRepository opens the configured storage backend.
+func newReceiptRepository(cfg config.Config, logger *slog.Logger) (repositories.ReceiptRepository, error) {
+	switch cfg.StorageBackend {
+	case config.StorageMemory:
+		return repositories.NewInMemoryReceiptRepo(nil, logger), nil
+	default:
+		return nil, fmt.Errorf("unsupported storage backend %q", cfg.StorageBackend)
+	}
+}
+
+// newEventRelay relays the events the storage backend writes to its outbox to the in-process
+// bus and, if configured, an NDJSON file and NATS subjects. The relay is nil if the backend has
+// no outbox. No NATS client is linked in, so events are published to the in-memory stand-in and
+// logged from there; a *nats.Conn passed to NewNATSSink publishes them to a real server.
+func newEventRelay(cfg config.Config, storage repositories.ReceiptRepository, bus *events.Bus, logger *slog.Logger) (*events.Relay, func(), error) {
+	store, ok := storage.(events.Store)
+	if !ok {
+		return nil, func() {}, nil
+	}
+
+	relay := events.NewRelay(store, nil, logger)
+	relay.AddConsumer("bus", bus)
+	if cfg.EventsSubject != "" {
+		conn := events.NewInMemoryNATS()
+		conn.Subscribe(cfg.EventsSubject+".>", func(data []byte) {
+			logger.Debug("Receipt event published over NATS", "event", string(data))
+		})
+		relay.AddConsumer("nats", events.NewNATSSink(conn, cfg.EventsSubject))
+	}
+	if cfg.EventsFile == "" {
+		return relay, func() {}, nil
+	}
 
-	port := ":3000"
-	log.Printf("Starting receipt-processor-challenge simple web server on : %s\n", port)
-	if err := http.ListenAndServe(port, router); err != nil {
-		log.Fatalf("Error starting server: %v\n", err)
+	sink, err := events.NewNDJSONSink(cfg.EventsFile)
+	if err != nil {
+		return nil, nil, err
 	}
+	relay.AddConsumer("ndjson", sink)
+	return relay, func() { sink.Close() }, nil
 }
 
-func setupRouter(handler *handlers.ReceiptHandler) *mux.Router {
+func setupRouter(handler *handlers.ReceiptHandler, retailerHandler *handlers.RetailerHandler, promotionHandler *handlers.PromotionHandler, webhookHandler *handlers.WebhookHandler, reportHandler *handlers.ReportHandler, backfillHandler *handlers.BackfillHandler, configHandler *handlers.ConfigHandler, appMetrics *metrics.Metrics, logger *slog.Logger) *mux.Router {
 	router := mux.NewRouter()
+	router.Use(tracing.Middleware)
+	router.Use(logging.Middleware(logger))
+	router.Use(appMetrics.Middleware)
+	router.Handle("/metrics", appMetrics.Handler()).Methods("GET")
 	router.HandleFunc("/receipts/process", handler.ProcessReceipt).Methods("POST")
+	router.HandleFunc("/receipts/score", handler.ScoreReceipt).Methods("POST")
+	router.HandleFunc("/receipts/stream", handler.StreamReceipts).Methods("GET")
 	router.HandleFunc("/receipts/{id}/points", handler.GetPointsForReceipt).Methods("GET")
+	router.HandleFunc("/receipts/{id}/breakdown", handler.GetBreakdownForReceipt).Methods("GET")
+	router.HandleFunc("/receipts/{id}", handler.VoidReceipt).Methods("DELETE")
+	router.HandleFunc("/receipts/{id}/returns", handler.ReturnItems).Methods("POST")
+	router.HandleFunc("/receipts/{id}/adjustments", handler.GetAdjustmentsForReceipt).Methods("GET")
+	router.HandleFunc("/admin/reviews", handler.GetReviewQueue).Methods("GET")
+	router.HandleFunc("/admin/receipts/{id}/approve", handler.ApproveReceipt).Methods("POST")
+	router.HandleFunc("/admin/receipts/{id}/reject", handler.RejectReceipt).Methods("POST")
+	router.HandleFunc("/admin/receipts/{id}/fraud", handler.GetFraudAssessment).Methods("GET")
+	router.HandleFunc("/admin/rules/simulate", handler.SimulateRules).Methods("POST")
+	router.HandleFunc("/admin/retailers", retailerHandler.GetRetailers).Methods("GET")
+	router.HandleFunc("/admin/retailers", retailerHandler.CreateRetailer).Methods("POST")
+	router.HandleFunc("/admin/retailers/{id}", retailerHandler.GetRetailer).Methods("GET")
+	router.HandleFunc("/admin/retailers/{id}", retailerHandler.UpdateRetailer).Methods("PUT")
+	router.HandleFunc("/admin/retailers/{id}", retailerHandler.DeleteRetailer).Methods("DELETE")
+	router.HandleFunc("/admin/promotions", promotionHandler.GetPromotions).Methods("GET")
+	router.HandleFunc("/admin/promotions", promotionHandler.CreatePromotion).Methods("POST")
+	router.HandleFunc("/admin/promotions/{id}", promotionHandler.GetPromotion).Methods("GET")
+	router.HandleFunc("/admin/promotions/{id}", promotionHandler.UpdatePromotion).Methods("PUT")
+	router.HandleFunc("/admin/promotions/{id}", promotionHandler.DeletePromotion).Methods("DELETE")
+	router.HandleFunc("/admin/webhooks", webhookHandler.GetSubscriptions).Methods("GET")
+	router.HandleFunc("/admin/webhooks", webhookHandler.CreateSubscription).Methods("POST")
+	router.HandleFunc("/admin/webhooks/dead-letters", webhookHandler.GetDeadLetters).Methods("GET")
+	router.HandleFunc("/admin/webhooks/deliveries/{id}/redeliver", webhookHandler.Redeliver).Methods("POST")
+	router.HandleFunc("/admin/webhooks/{id}", webhookHandler.GetSubscription).Methods("GET")
+	router.HandleFunc("/admin/webhooks/{id}", webhookHandler.DeleteSubscription).Methods("DELETE")
+	router.HandleFunc("/admin/backfills", backfillHandler.GetBackfills).Methods("GET")
+	router.HandleFunc("/admin/backfills", backfillHandler.StartBackfill).Methods("POST")
+	router.HandleFunc("/admin/backfills/{id}", backfillHandler.GetBackfill).Methods("GET")
+	router.HandleFunc("/admin/backfills/{id}/results", backfillHandler.GetBackfillResults).Methods("GET")
+	router.HandleFunc("/admin/backfills/{id}/pause", backfillHandler.PauseBackfill).Methods("POST")
+	router.HandleFunc("/admin/backfills/{id}/resume", backfillHandler.ResumeBackfill).Methods("POST")
+	router.HandleFunc("/reports/liability", reportHandler.GetLiabilityReport).Methods("GET")
+	router.HandleFunc("/reports/{groupBy}", reportHandler.GetReport).Methods("GET")
+	router.HandleFunc("/admin/config", configHandler.GetConfig).Methods("GET")
 
 	return router
 }